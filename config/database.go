@@ -112,6 +112,97 @@ func RunMigrations(db *sql.DB) error {
 			updated_at TIMESTAMP DEFAULT NOW()
 		)`,
 
+		// One row per saved version of budget_data (same encrypted wrapper as
+		// the head row). Pruned by the cleanup loop in main.go according to
+		// BUDGET_REVISIONS_KEEP_LATEST / BUDGET_REVISIONS_KEEP_DAILY_DAYS.
+		`CREATE TABLE IF NOT EXISTS budget_data_revisions (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			budget_id UUID NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+			version INTEGER NOT NULL,
+			data JSONB NOT NULL,
+			size_bytes INTEGER NOT NULL DEFAULT 0,
+			author_id UUID REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			CONSTRAINT budget_data_revisions_unique UNIQUE (budget_id, version)
+		)`,
+
+		// Per-budget data key (envelope encryption, see services/budget_keys.go),
+		// wrapped by DATA_ENCRYPTION_KEY. Only used without a separate key store
+		// (BUDGET_KEYS_DATABASE_URL); otherwise rows are moved there at startup.
+		`CREATE TABLE IF NOT EXISTS budget_data_keys (
+			budget_id UUID PRIMARY KEY REFERENCES budgets(id) ON DELETE CASCADE,
+			wrapped_key TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// 2FA recovery codes (services/second_factor.go): SHA-256 only, one-time.
+		`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			id BIGSERIAL PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash TEXT NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// Passkeys (services/passkeys.go). credential_id is base64url; the
+		// public key is not secret, so it is stored as is.
+		`CREATE TABLE IF NOT EXISTS webauthn_credentials (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			credential_id TEXT NOT NULL UNIQUE,
+			public_key BYTEA NOT NULL,
+			attestation_type VARCHAR(50),
+			transports TEXT,
+			aaguid BYTEA,
+			sign_count BIGINT NOT NULL DEFAULT 0,
+			backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+			backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+			name VARCHAR(100) NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			last_used_at TIMESTAMP
+		)`,
+
+		// Pending WebAuthn ceremonies: one-time challenges, pruned daily
+		`CREATE TABLE IF NOT EXISTS webauthn_sessions (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			purpose VARCHAR(20) NOT NULL,
+			passkey_name VARCHAR(100),
+			session_data TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL
+		)`,
+
+		// Oversized WebSocket fan-out messages (NOTIFY payload > 8000 bytes).
+		// Encrypted, referenced by id in the notification; rows older than 1h are
+		// removed every hour by scheduleBroadcastOutboxCleanup in main.go.
+		`CREATE TABLE IF NOT EXISTS broadcast_outbox (
+			id BIGSERIAL PRIMARY KEY,
+			payload TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// Single-use WebSocket tickets: jti of each accepted ticket until it
+		// expires (services/ws_tickets.go), pruned daily
+		`CREATE TABLE IF NOT EXISTS ws_ticket_uses (
+			jti TEXT PRIMARY KEY,
+			expires_at TIMESTAMP NOT NULL
+		)`,
+
+		// Transfert de propriété d'un budget : l'owner désigne un membre, qui
+		// confirme (lien email ou in-app). Un seul transfert pending par budget.
+		// Le token n'est stocké que hashé (SHA-256), comme les refresh tokens.
+		`CREATE TABLE IF NOT EXISTS budget_ownership_transfers (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			budget_id UUID NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+			from_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			to_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			resolved_at TIMESTAMP
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS audit_logs (
 			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
 			budget_id UUID REFERENCES budgets(id) ON DELETE CASCADE,
@@ -171,33 +262,6 @@ func RunMigrations(db *sql.DB) error {
 		// TABLES BANKING
 		// ============================================================================
 
-		`CREATE TABLE IF NOT EXISTS bank_connections (
-			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-			budget_id UUID REFERENCES budgets(id) ON DELETE CASCADE,
-			institution_id VARCHAR(255) NOT NULL,
-			institution_name VARCHAR(255),
-			provider_connection_id VARCHAR(255) NOT NULL,
-			encrypted_access_token TEXT,
-			encrypted_refresh_token TEXT,
-			expires_at TIMESTAMP,
-			status VARCHAR(50) DEFAULT 'active',
-			created_at TIMESTAMP DEFAULT NOW(),
-			updated_at TIMESTAMP DEFAULT NOW()
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS bank_accounts (
-			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-			connection_id UUID NOT NULL REFERENCES bank_connections(id) ON DELETE CASCADE,
-			external_account_id VARCHAR(255) NOT NULL,
-			name VARCHAR(255),
-			mask VARCHAR(10),
-			currency VARCHAR(3) DEFAULT 'EUR',
-			balance DECIMAL(20, 2) DEFAULT 0,
-			is_savings_pool BOOLEAN DEFAULT FALSE,
-			last_synced_at TIMESTAMP DEFAULT NOW()
-		)`,
-
 		`CREATE TABLE IF NOT EXISTS label_mappings (
 			normalized_label VARCHAR(255) PRIMARY KEY,
 			category VARCHAR(50) NOT NULL,
@@ -211,7 +275,7 @@ func RunMigrations(db *sql.DB) error {
 			budget_id UUID NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
 			aspsp_name VARCHAR(255) NOT NULL,
 			aspsp_country VARCHAR(2) NOT NULL,
-			session_id UUID NOT NULL,
+			session_id VARCHAR(255) NOT NULL,
 			access_token TEXT,
 			refresh_token TEXT,
 			expires_at TIMESTAMP,
@@ -223,7 +287,7 @@ func RunMigrations(db *sql.DB) error {
 		`CREATE TABLE IF NOT EXISTS banking_accounts (
 			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
 			connection_id UUID NOT NULL REFERENCES banking_connections(id) ON DELETE CASCADE,
-			account_id UUID NOT NULL,
+			account_id VARCHAR(255) NOT NULL,
 			account_name VARCHAR(255),
 			account_type VARCHAR(50),
 			currency VARCHAR(3),
@@ -232,6 +296,113 @@ func RunMigrations(db *sql.DB) error {
 			created_at TIMESTAMP DEFAULT NOW()
 		)`,
 
+		// Schéma bancaire unique, indépendant du fournisseur : provider dit qui
+		// a créé la connexion, session_id et account_id portent les
+		// identifiants du fournisseur (pas forcément des UUID). session_id et
+		// les jetons sont chiffrés (voir services/banking_credentials.go) :
+		// TEXT, le chiffré dépasse la taille de l'identifiant.
+		`ALTER TABLE banking_connections ADD COLUMN IF NOT EXISTS provider VARCHAR(50) NOT NULL DEFAULT 'enablebanking'`,
+		`ALTER TABLE banking_connections ALTER COLUMN session_id TYPE TEXT USING session_id::text`,
+		`ALTER TABLE banking_accounts ALTER COLUMN account_id TYPE VARCHAR(255) USING account_id::text`,
+		`ALTER TABLE banking_accounts ADD COLUMN IF NOT EXISTS mask VARCHAR(10)`,
+
+		// Autorisations bancaires en attente : session chiffrée entre le
+		// callback et SyncAccounts, indexée par le state OAuth
+		`CREATE TABLE IF NOT EXISTS banking_authorizations (
+			state TEXT PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			budget_id UUID NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+			session_id TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL
+		)`,
+
+		// Migrations de données faites une fois au démarrage (une ligne par
+		// migration terminée, ex. services.EncryptBankCredentials)
+		`CREATE TABLE IF NOT EXISTS data_migrations (
+			name VARCHAR(100) PRIMARY KEY,
+			completed_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+		`ALTER TABLE banking_accounts ADD COLUMN IF NOT EXISTS is_savings_pool BOOLEAN NOT NULL DEFAULT FALSE`,
+
+		// Synchro bancaire en tâche de fond (voir services/bank_sync.go) :
+		// statut, dernière erreur et prochaine échéance par connexion.
+		`ALTER TABLE banking_connections ADD COLUMN IF NOT EXISTS sync_status VARCHAR(20) DEFAULT 'idle'`,
+		`ALTER TABLE banking_connections ADD COLUMN IF NOT EXISTS sync_started_at TIMESTAMP`,
+		`ALTER TABLE banking_connections ADD COLUMN IF NOT EXISTS last_sync_at TIMESTAMP`,
+		`ALTER TABLE banking_connections ADD COLUMN IF NOT EXISTS last_sync_error TEXT`,
+		`ALTER TABLE banking_connections ADD COLUMN IF NOT EXISTS sync_failures INT DEFAULT 0`,
+		`ALTER TABLE banking_connections ADD COLUMN IF NOT EXISTS next_sync_at TIMESTAMP`,
+
+		// Consentement PSD2 (voir services/bank_consent.go) : expires_at porte
+		// le valid_until réel de la session, status suit active / expiring /
+		// expired / revoked / error. identification_hash (stable d'une session
+		// à l'autre) permet de rattacher les comptes après une reconnexion.
+		`ALTER TABLE banking_connections ADD COLUMN IF NOT EXISTS consent_reminder_sent_at TIMESTAMP`,
+		`ALTER TABLE banking_connections ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP`,
+		`ALTER TABLE banking_accounts ADD COLUMN IF NOT EXISTS identification_hash VARCHAR(255)`,
+
+		// Ledger local des transactions Enable Banking : l'historique survit à
+		// l'expiration du consentement et la page ne dépend plus de la banque.
+		// description chiffrée (utils.Encrypt), montant signé (débit < 0).
+		`CREATE TABLE IF NOT EXISTS bank_transactions (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			account_id UUID NOT NULL REFERENCES banking_accounts(id) ON DELETE CASCADE,
+			provider_transaction_id VARCHAR(255) NOT NULL,
+			amount DECIMAL(15,2) NOT NULL,
+			currency VARCHAR(3),
+			credit_debit VARCHAR(4),
+			status VARCHAR(10),
+			booking_date DATE,
+			value_date DATE,
+			encrypted_description TEXT,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW(),
+			CONSTRAINT unique_bank_transaction_per_account UNIQUE (account_id, provider_transaction_id)
+		)`,
+		// Catégorie (CategorizerService) des transactions importées depuis un
+		// relevé CSV / OFX / CAMT.053
+		`ALTER TABLE bank_transactions ADD COLUMN IF NOT EXISTS category VARCHAR(50)`,
+
+		// Historique des soldes (voir services/balance_history.go) : un point
+		// par compte et par jour, le dernier solde connu du jour.
+		`CREATE TABLE IF NOT EXISTS bank_balance_snapshots (
+			account_id UUID NOT NULL REFERENCES banking_accounts(id) ON DELETE CASCADE,
+			snapshot_date DATE NOT NULL,
+			balance DECIMAL(15,2) NOT NULL,
+			currency VARCHAR(3),
+			updated_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (account_id, snapshot_date)
+		)`,
+
+		// Taux de change (voir services/fx_rates.go) : unités de devise pour
+		// 1 EUR, un jeu de taux par jour comme les fichiers BCE.
+		`CREATE TABLE IF NOT EXISTS fx_rates (
+			rate_date DATE NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			rate DECIMAL(18,8) NOT NULL,
+			source VARCHAR(20) NOT NULL DEFAULT 'ecb',
+			created_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (rate_date, currency)
+		)`,
+
+		// Réconciliation plan / banque (voir services/bank_reconciliation.go) :
+		// seules les décisions de l'utilisateur sont stockées, les propositions
+		// sont recalculées. target_id = id de charge ou de projet dans
+		// budget_data, '' pour target_type 'none'.
+		`CREATE TABLE IF NOT EXISTS bank_transaction_matches (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			budget_id UUID NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			transaction_id UUID NOT NULL REFERENCES bank_transactions(id) ON DELETE CASCADE,
+			target_type VARCHAR(10) NOT NULL,
+			target_id VARCHAR(255) NOT NULL DEFAULT '',
+			status VARCHAR(10) NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW(),
+			CONSTRAINT unique_bank_transaction_match UNIQUE (budget_id, transaction_id, target_type, target_id)
+		)`,
+
 		// ============================================================================
 		// REFRESH TOKENS
 		// ============================================================================
@@ -303,6 +474,11 @@ func RunMigrations(db *sql.DB) error {
 		// "most-consulted" budget as primary; falls back to updated_at when null.
 		`ALTER TABLE budgets ADD COLUMN IF NOT EXISTS last_viewed_at TIMESTAMP`,
 		`ALTER TABLE users ADD COLUMN IF NOT EXISTS has_seen_tutorial BOOLEAN DEFAULT FALSE`,
+		// Last TOTP period accepted: a code is only valid once (login, step-up)
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_counter BIGINT`,
+		// 2FA attempts in the current lockout window (services/second_factor.go)
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS second_factor_failures INT NOT NULL DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS second_factor_window_end TIMESTAMP`,
 
 		// ============================================================================
 		// MARKET SUGGESTIONS — cache key refinement (currency + household)
@@ -324,6 +500,10 @@ func RunMigrations(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires ON refresh_tokens(expires_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_active ON refresh_tokens(user_id) WHERE revoked_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user ON user_recovery_codes(user_id, code_hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user ON webauthn_credentials(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_webauthn_sessions_expires ON webauthn_sessions(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_ws_ticket_uses_expires ON ws_ticket_uses(expires_at)`,
 
 		// Indexes budget_members
 		`CREATE INDEX IF NOT EXISTS idx_budget_members_budget_id ON budget_members(budget_id)`,
@@ -331,6 +511,11 @@ func RunMigrations(db *sql.DB) error {
 
 		// Indexes budget_data
 		`CREATE INDEX IF NOT EXISTS idx_budget_data_budget_id ON budget_data(budget_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_budget_data_revisions_created ON budget_data_revisions(budget_id, created_at)`,
+
+		// Indexes ownership transfers
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_ownership_transfers_pending
+			ON budget_ownership_transfers(budget_id) WHERE status = 'pending'`,
 
 		// Indexes invitations
 		`CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations(email)`,
@@ -366,25 +551,28 @@ func RunMigrations(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_budgets_created_at ON budgets(created_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_budgets_location ON budgets(location)`, // ✅ NOUVEAU
 
-		// Indexes bank_connections
-		`CREATE INDEX IF NOT EXISTS idx_bank_connections_user ON bank_connections(user_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_bank_connections_budget ON bank_connections(budget_id)`,
-
-		// Indexes bank_accounts
-		`CREATE INDEX IF NOT EXISTS idx_bank_accounts_connection ON bank_accounts(connection_id)`,
-
 		// Indexes label_mappings
 		`CREATE INDEX IF NOT EXISTS idx_label_mappings_label ON label_mappings(normalized_label)`,
 
 		// Indexes banking_connections
 		`CREATE INDEX IF NOT EXISTS idx_banking_connections_user_budget ON banking_connections(user_id, budget_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_banking_connections_session ON banking_connections(session_id)`,
+		// session_id est chiffré (nonce aléatoire) : l'index ne sert plus
+		`DROP INDEX IF EXISTS idx_banking_connections_session`,
 		`CREATE INDEX IF NOT EXISTS idx_banking_connections_status ON banking_connections(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_banking_connections_next_sync ON banking_connections(next_sync_at)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_bank_transaction_matches_confirmed ON bank_transaction_matches(budget_id, transaction_id) WHERE status = 'confirmed'`,
+		`CREATE INDEX IF NOT EXISTS idx_bank_transaction_matches_user ON bank_transaction_matches(budget_id, user_id)`,
 
 		// Indexes banking_accounts
 		`CREATE INDEX IF NOT EXISTS idx_banking_accounts_connection ON banking_accounts(connection_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_banking_accounts_last_sync ON banking_accounts(last_sync_at)`,
 
+		// Indexes bank_transactions
+		`CREATE INDEX IF NOT EXISTS idx_bank_transactions_account_date ON bank_transactions(account_id, booking_date DESC)`,
+
+		// Index fx_rates : dernier taux connu d'une devise à une date
+		`CREATE INDEX IF NOT EXISTS idx_fx_rates_currency_date ON fx_rates(currency, rate_date DESC)`,
+
 		// Indexes market_suggestions
 		`CREATE INDEX IF NOT EXISTS idx_market_suggestions_category_country ON market_suggestions(category, country)`,
 		`CREATE INDEX IF NOT EXISTS idx_market_suggestions_expires ON market_suggestions(expires_at)`,
@@ -404,13 +592,6 @@ func RunMigrations(db *sql.DB) error {
 		// CONSTRAINTS
 		// ============================================================================
 
-		`ALTER TABLE bank_connections DROP CONSTRAINT IF EXISTS bank_connections_provider_connection_id_key`,
-		`ALTER TABLE bank_connections DROP CONSTRAINT IF EXISTS unique_provider_connection_per_budget`,
-		`ALTER TABLE bank_connections ADD CONSTRAINT unique_provider_connection_per_budget UNIQUE (provider_connection_id, budget_id)`,
-
-		`ALTER TABLE bank_accounts DROP CONSTRAINT IF EXISTS unique_account_per_connection`,
-		`ALTER TABLE bank_accounts ADD CONSTRAINT unique_account_per_connection UNIQUE (connection_id, external_account_id)`,
-
 		`ALTER TABLE banking_connections DROP CONSTRAINT IF EXISTS unique_banking_connection_per_budget`,
 		`ALTER TABLE banking_connections ADD CONSTRAINT unique_banking_connection_per_budget 
 			UNIQUE (user_id, budget_id, aspsp_name, aspsp_country)`,
@@ -446,6 +627,71 @@ func RunMigrations(db *sql.DB) error {
 		// Mettre à jour les users existants avec valeurs par défaut (optionnel)
 		`UPDATE users SET country = 'FR' WHERE country IS NULL`,
 
+		// Rôles budget (owner / editor / viewer) : l'ancien rôle 'member' valait
+		// lecture + écriture, soit 'editor'. budgets.owner_id fait foi pour owner.
+		`ALTER TABLE budget_members ALTER COLUMN role SET DEFAULT 'editor'`,
+		`UPDATE budget_members SET role = 'editor' WHERE role IS NULL OR role = 'member'`,
+		`UPDATE budget_members bm SET role = 'owner'
+		FROM budgets b
+		WHERE b.id = bm.budget_id AND b.owner_id = bm.user_id AND bm.role <> 'owner'`,
+
+		// Connexions bancaires : ancien défaut NULL → active. expires_at valait
+		// created_at + 3 mois (valeur codée en dur), le check de consentement
+		// le corrige à la prochaine synchro.
+		`UPDATE banking_connections SET status = 'active' WHERE status IS NULL`,
+
+		// Ancien schéma bancaire (bank_connections / bank_accounts) → schéma
+		// unique. Les connexions sans budget n'étaient visibles nulle part et
+		// ne sont pas reprises ; une connexion qui existe déjà (même banque,
+		// même utilisateur, même budget) récupère les comptes et le flag
+		// épargne. Les anciennes tables sont renommées en *_legacy (à
+		// supprimer une fois la reprise vérifiée) : le bloc ne tourne qu'une
+		// fois, en une seule transaction.
+		`DO $$
+		BEGIN
+			IF to_regclass('public.bank_connections') IS NULL THEN
+				RETURN;
+			END IF;
+
+			INSERT INTO banking_connections (
+				user_id, budget_id, provider, aspsp_name, aspsp_country, session_id,
+				access_token, refresh_token, expires_at, status, created_at, updated_at
+			)
+			SELECT user_id, budget_id, 'legacy', COALESCE(NULLIF(institution_name, ''), institution_id), 'FR',
+			       provider_connection_id, encrypted_access_token, encrypted_refresh_token, expires_at,
+			       COALESCE(status, 'active'), COALESCE(created_at, NOW()), COALESCE(updated_at, NOW())
+			FROM bank_connections
+			WHERE budget_id IS NOT NULL
+			ON CONFLICT (user_id, budget_id, aspsp_name, aspsp_country) DO NOTHING;
+
+			INSERT INTO banking_accounts (
+				connection_id, account_id, account_name, account_type, mask, currency,
+				balance, is_savings_pool, last_sync_at, created_at
+			)
+			SELECT DISTINCT ON (nc.id, oa.external_account_id)
+			       nc.id, oa.external_account_id, oa.name, 'CACC', oa.mask, oa.currency,
+			       oa.balance, COALESCE(oa.is_savings_pool, FALSE), oa.last_synced_at, NOW()
+			FROM bank_accounts oa
+			JOIN bank_connections oc ON oc.id = oa.connection_id
+			JOIN banking_connections nc ON nc.user_id = oc.user_id
+			     AND nc.budget_id = oc.budget_id
+			     AND nc.aspsp_name = COALESCE(NULLIF(oc.institution_name, ''), oc.institution_id)
+			     AND nc.aspsp_country = 'FR'
+			ORDER BY nc.id, oa.external_account_id, oa.is_savings_pool DESC NULLS LAST
+			ON CONFLICT (connection_id, account_id) DO UPDATE
+			SET is_savings_pool = banking_accounts.is_savings_pool OR EXCLUDED.is_savings_pool;
+
+			ALTER TABLE bank_accounts RENAME TO bank_accounts_legacy;
+			ALTER TABLE bank_connections RENAME TO bank_connections_legacy;
+		END $$`,
+
+		// Premier point d'historique : le solde actuel, à sa date de synchro
+		`INSERT INTO bank_balance_snapshots (account_id, snapshot_date, balance, currency)
+		 SELECT id, COALESCE(last_sync_at::date, CURRENT_DATE), balance, currency
+		 FROM banking_accounts
+		 WHERE balance IS NOT NULL
+		 ON CONFLICT (account_id, snapshot_date) DO NOTHING`,
+
 		// ============================================================================
 		// SEED DATA
 		// ============================================================================
@@ -0,0 +1,57 @@
+// config/key_store.go
+// Magasin des clés de données des budgets (voir services/budget_keys.go) :
+// une base Postgres à part, désignée par BUDGET_KEYS_DATABASE_URL, à exclure
+// des sauvegardes de la base principale.
+
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// InitKeyStoreDB ouvre le magasin de clés ; (nil, nil) si
+// BUDGET_KEYS_DATABASE_URL n'est pas défini (clés dans la base principale).
+func InitKeyStoreDB() (*sql.DB, error) {
+	dbURL := os.Getenv("BUDGET_KEYS_DATABASE_URL")
+	if dbURL == "" {
+		return nil, nil
+	}
+	if dbURL == os.Getenv("DATABASE_URL") {
+		return nil, fmt.Errorf("BUDGET_KEYS_DATABASE_URL must point to another database than DATABASE_URL")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key store: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping key store: %w", err)
+	}
+
+	// Une requête courte par lecture/écriture de budget
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetConnMaxIdleTime(2 * time.Minute)
+
+	fmt.Println("✅ Budget key store connected")
+	return db, nil
+}
+
+// RunKeyStoreMigrations crée la table des clés dans le magasin. Pas de clé
+// étrangère vers budgets : la table est dans une autre base.
+func RunKeyStoreMigrations(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS budget_data_keys (
+		budget_id UUID PRIMARY KEY,
+		wrapped_key TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT NOW()
+	)`)
+	if err != nil {
+		return fmt.Errorf("key store migration: %w", err)
+	}
+	return nil
+}
@@ -11,7 +11,7 @@ import (
 	"os"
 	"time"
 
-	"github.com/LovationAdmin/budget-api/utils"
+	"github.com/LovationAdmin/budget-api/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -336,7 +336,7 @@ func (h *AdminHandler) runMigration(ctx context.Context, budgetID string) (gin.H
 
 		if err := json.Unmarshal(rawJSON, &wrapper); err == nil && wrapper.Encrypted != "" {
 			// Données chiffrées
-			decryptedBytes, err := utils.Decrypt(wrapper.Encrypted)
+			decryptedBytes, err := services.DecryptBudgetData(ctx, h.DB, id, wrapper.Encrypted)
 			if err != nil {
 				log.Printf("  ❌ Decrypt error: %v", err)
 				errors++
@@ -383,7 +383,7 @@ func (h *AdminHandler) runMigration(ctx context.Context, budgetID string) (gin.H
 			continue
 		}
 
-		encryptedString, err := utils.Encrypt(migratedJSON)
+		encryptedString, err := services.EncryptBudgetData(ctx, h.DB, id, migratedJSON)
 		if err != nil {
 			log.Printf("  ❌ Encrypt error: %v", err)
 			errors++
@@ -0,0 +1,165 @@
+// handlers/admin_fx_rates.go
+// ============================================================================
+// ADMIN FX RATES HANDLER
+// ============================================================================
+// Chargement des taux de change (voir services/fx_rates.go).
+//
+// POST /api/v1/admin/fx-rates
+// Header: X-Admin-Secret
+// Body, au choix :
+//   - multipart/form-data, champ "file" : fichier BCE (XML ou CSV)
+//   - corps brut XML ou CSV au format BCE
+//   - JSON { "date": "2026-03-02", "rates": { "USD": 1.0812, "CHF": 0.9412 } }
+//
+// GET /api/v1/admin/fx-rates?date=YYYY-MM-DD   (taux en vigueur, aujourd'hui
+// par défaut)
+// ============================================================================
+
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// maxFXRatesSize : eurofxref-hist.xml complet (~6 Mo) avec de la marge.
+const maxFXRatesSize = 16 << 20
+
+type AdminFXRatesHandler struct {
+	DB *sql.DB
+	FX *services.FXRateService
+}
+
+func NewAdminFXRatesHandler(db *sql.DB, fx *services.FXRateService) *AdminFXRatesHandler {
+	return &AdminFXRatesHandler{DB: db, FX: fx}
+}
+
+type manualFXRatesRequest struct {
+	Date  string             `json:"date" binding:"required"`
+	Rates map[string]float64 `json:"rates" binding:"required,min=1"`
+}
+
+// readFXRates lit les taux du corps de la requête, quel que soit son format.
+func readFXRates(c *gin.Context) ([]models.FXRate, string, error) {
+	contentType := c.ContentType()
+
+	if contentType == "application/json" {
+		var req manualFXRatesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, "", err
+		}
+		rates := make([]models.FXRate, 0, len(req.Rates))
+		for currency, rate := range req.Rates {
+			rates = append(rates, models.FXRate{Date: req.Date, Currency: strings.ToUpper(currency), Rate: rate})
+		}
+		return rates, "manual", nil
+	}
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(contentType, "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", errors.New("a rates file is required (field 'file')")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		defer file.Close()
+		body = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxFXRatesSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxFXRatesSize {
+		return nil, "", errors.New("rates file is too large")
+	}
+	rates, err := services.ParseFXRates(data)
+	return rates, "ecb", err
+}
+
+// UploadFXRates — POST /api/v1/admin/fx-rates.
+func (h *AdminFXRatesHandler) UploadFXRates(c *gin.Context) {
+	if !requireAdminSecret(c) {
+		return
+	}
+
+	rates, source, err := readFXRates(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stored, err := h.FX.Store(c.Request.Context(), rates, source)
+	if errors.Is(err, services.ErrInvalidFXRates) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		utils.SafeError("❌ Failed to store FX rates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store FX rates"})
+		return
+	}
+
+	from, to := rates[0].Date, rates[0].Date
+	currencies := map[string]bool{}
+	for _, r := range rates {
+		if r.Date < from {
+			from = r.Date
+		}
+		if r.Date > to {
+			to = r.Date
+		}
+		currencies[r.Currency] = true
+	}
+
+	utils.SafeInfo("✅ FX rates loaded: %d rates (%s → %s)", stored, from, to)
+	c.JSON(http.StatusOK, gin.H{
+		"stored":     stored,
+		"from":       from,
+		"to":         to,
+		"currencies": len(currencies),
+	})
+}
+
+// ListFXRates — GET /api/v1/admin/fx-rates.
+func (h *AdminFXRatesHandler) ListFXRates(c *gin.Context) {
+	if !requireAdminSecret(c) {
+		return
+	}
+
+	date := time.Now()
+	if raw := c.Query("date"); raw != "" {
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must use the YYYY-MM-DD format"})
+			return
+		}
+		date = parsed
+	}
+
+	rates, err := h.FX.ListRates(c.Request.Context(), date)
+	if err != nil {
+		utils.SafeError("❌ Failed to list FX rates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list FX rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"base":  services.FXBaseCurrency,
+		"date":  date.Format("2006-01-02"),
+		"rates": rates,
+	})
+}
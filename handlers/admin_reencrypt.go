@@ -0,0 +1,117 @@
+// handlers/admin_reencrypt.go
+// ============================================================================
+// ADMIN RE-ENCRYPTION HANDLER
+// ============================================================================
+// Rechiffre les données stockées avec la clé active du trousseau après une
+// rotation de DATA_ENCRYPTION_KEY (voir utils/crypto.go et
+// services/key_rotation.go).
+//
+// POST /api/v1/admin/maintenance/reencrypt
+// Header: X-Admin-Secret
+// Body: {
+//   "dry_run": bool,            // déchiffre seulement, n'écrit rien
+//   "limit": int,               // lignes lues au plus (0 = tout)
+//   "columns": ["budget_data"], // optionnel, toutes par défaut
+//   "cursor": {...}             // "columns[].cursor" d'un appel précédent
+// }
+// Le job est resumable : tant que "done" est false, relancer avec le même
+// corps et "cursor" renvoyé. Sans curseur, il repart des lignes restantes.
+//
+// GET /api/v1/admin/maintenance/reencrypt   (lignes restantes par colonne)
+// ============================================================================
+
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+type AdminReencryptHandler struct {
+	DB       *sql.DB
+	Rotation *services.KeyRotationService
+}
+
+func NewAdminReencryptHandler(db *sql.DB, rotation *services.KeyRotationService) *AdminReencryptHandler {
+	return &AdminReencryptHandler{DB: db, Rotation: rotation}
+}
+
+type reencryptRequest struct {
+	DryRun  bool              `json:"dry_run"`
+	Limit   int               `json:"limit,omitempty"`
+	Columns []string          `json:"columns,omitempty"`
+	Cursor  map[string]string `json:"cursor,omitempty"`
+}
+
+// Reencrypt — POST /api/v1/admin/maintenance/reencrypt.
+func (h *AdminReencryptHandler) Reencrypt(c *gin.Context) {
+	if !requireAdminSecret(c) {
+		return
+	}
+
+	var req reencryptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	for _, name := range req.Columns {
+		if !isEncryptedColumn(name) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "unknown column: " + name,
+				"columns": services.EncryptedColumnNames(),
+			})
+			return
+		}
+	}
+
+	res, err := h.Rotation.Reencrypt(c.Request.Context(), services.ReencryptOptions{
+		DryRun:  req.DryRun,
+		Limit:   req.Limit,
+		Columns: req.Columns,
+		Cursor:  req.Cursor,
+	})
+	if err != nil {
+		utils.SafeError("admin/reencrypt: failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "re-encryption failed"})
+		return
+	}
+
+	scanned, reencrypted, failed := 0, 0, 0
+	for _, p := range res.Columns {
+		scanned += p.Scanned
+		reencrypted += p.Reencrypted
+		failed += p.Failed
+	}
+	utils.SafeInfo("admin/reencrypt: dry_run=%v key=%s scanned=%d reencrypted=%d failed=%d done=%v duration=%dms",
+		req.DryRun, res.ActiveKeyID, scanned, reencrypted, failed, res.Done, res.DurationMs)
+	c.JSON(http.StatusOK, res)
+}
+
+// ReencryptStatus — GET /api/v1/admin/maintenance/reencrypt.
+func (h *AdminReencryptHandler) ReencryptStatus(c *gin.Context) {
+	if !requireAdminSecret(c) {
+		return
+	}
+
+	res, err := h.Rotation.Status(c.Request.Context())
+	if err != nil {
+		utils.SafeError("admin/reencrypt: status failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "status failed"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func isEncryptedColumn(name string) bool {
+	for _, known := range services.EncryptedColumnNames() {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"os"
 	"strings"
@@ -18,6 +19,8 @@ type AuthHandler struct {
 	DB            *sql.DB
 	EmailService  *services.EmailService
 	RefreshTokens *services.RefreshTokenService
+	SecondFactor  *services.SecondFactorService
+	Passkeys      *services.PasskeyService
 }
 
 // NewAuthHandler garde la signature historique pour compat. Le RefreshTokens
@@ -26,6 +29,8 @@ func NewAuthHandler(db *sql.DB) *AuthHandler {
 	return &AuthHandler{
 		DB:           db,
 		EmailService: services.NewEmailService(),
+		SecondFactor: services.NewSecondFactorService(db),
+		Passkeys:     services.NewPasskeyService(db),
 	}
 }
 
@@ -35,6 +40,8 @@ func NewAuthHandlerWithRefresh(db *sql.DB, rt *services.RefreshTokenService) *Au
 		DB:            db,
 		EmailService:  services.NewEmailService(),
 		RefreshTokens: rt,
+		SecondFactor:  services.NewSecondFactorService(db),
+		Passkeys:      services.NewPasskeyService(db),
 	}
 }
 
@@ -147,6 +154,8 @@ type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
 	TOTPCode string `json:"totp_code,omitempty"`
+	// Code de récupération, à la place de totp_code (téléphone perdu)
+	RecoveryCode string `json:"recovery_code,omitempty"`
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -198,23 +207,60 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	var recoveryCodesLeft *int
 	if user.TOTPEnabled && totpSecret.Valid {
-		if req.TOTPCode == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
+		code := req.TOTPCode
+		if code == "" {
+			code = req.RecoveryCode
+		}
+
+		method, err := h.SecondFactor.Verify(c.Request.Context(), user.ID, code)
+		if errors.Is(err, services.ErrSecondFactorRequired) {
+			resp := gin.H{
 				"error":        "2FA code required",
 				"requires_2fa": true,
-			})
+			}
+			// Passkey en alternative au code : finir par POST /auth/passkey/verify
+			if passkey := h.passkeySecondFactor(c, user.ID); passkey != nil {
+				resp["passkey"] = passkey
+			}
+			c.JSON(http.StatusUnauthorized, resp)
 			return
 		}
-
-		valid, err := utils.VerifyTOTP(totpSecret.String, req.TOTPCode)
-		if err != nil || !valid {
+		if errors.Is(err, services.ErrSecondFactorLocked) {
+			utils.LogAuthAction("Login-2FA-Locked", req.Email, false)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid 2FA codes, please try again later"})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidSecondFactor) {
 			utils.LogAuthAction("Login-2FA", req.Email, false)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid 2FA code"})
 			return
 		}
+		if err != nil {
+			utils.SafeError("Failed to verify 2FA code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+			return
+		}
+
+		// Prévenir quand les codes de récupération s'épuisent
+		if method == services.SecondFactorRecovery {
+			if n, err := h.SecondFactor.RemainingRecoveryCodes(c.Request.Context(), user.ID); err == nil {
+				recoveryCodesLeft = &n
+			}
+		}
+	}
+
+	extra := gin.H{}
+	if recoveryCodesLeft != nil {
+		extra["recovery_codes_remaining"] = *recoveryCodesLeft
 	}
+	h.completeLogin(c, "Login", &user, extra)
+}
 
+// completeLogin émet l'access token et le refresh token (cookie httpOnly)
+// d'un utilisateur authentifié : mot de passe (+ 2FA) ou passkey.
+func (h *AuthHandler) completeLogin(c *gin.Context, action string, user *models.User, extra gin.H) {
 	token, err := utils.GenerateAccessToken(user.ID, user.Email)
 	if err != nil {
 		utils.SafeError("Failed to generate token: %v", err)
@@ -222,19 +268,14 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Émettre un refresh token (rotation gérée côté /auth/refresh)
-	if err != nil {
-		utils.SafeError("Failed to issue refresh token: %v", err)
-		// On ne bloque PAS le login si le refresh échoue (l'access token est valide)
-		// L'utilisateur sera juste reconnecté à la prochaine expiration.
-	}
+	utils.LogAuthAction(action, user.Email, true)
 
-	utils.LogAuthAction("Login", req.Email, true)
-
-	// Émettre le refresh token et poser le cookie httpOnly
+	// Émettre le refresh token et poser le cookie httpOnly (rotation gérée
+	// côté /auth/refresh). Un échec ne bloque pas le login : l'access token
+	// est valide, l'utilisateur sera reconnecté à la prochaine expiration.
 	h.IssueRefreshAndSetCookie(c, user.ID)
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"token":      token,
 		"expires_in": 15 * 60, // secondes — aligné sur JWT_EXPIRY=15m
 		"user": gin.H{
@@ -244,7 +285,11 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			"avatar":       user.Avatar,
 			"totp_enabled": user.TOTPEnabled,
 		},
-	})
+	}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // ============================================================================
@@ -0,0 +1,109 @@
+// handlers/bank_balance_history.go
+// ============================================================================
+// BALANCE HISTORY — courbe de patrimoine (voir services/balance_history.go)
+// ============================================================================
+//   GET /budgets/:id/banking/balance-history
+//       ?from=YYYY-MM-DD&to=YYYY-MM-DD&interval=day|week|month
+//       &savings_pool=true&account_id=...
+//
+// Par défaut : jusqu'à aujourd'hui, 90 jours au jour, 26 semaines à la
+// semaine, 12 mois au mois (interval=month si absent).
+// ============================================================================
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/LovationAdmin/budget-api/middleware"
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// timelineDefaultRange : période par défaut selon le découpage.
+func timelineDefaultRange(interval string, to time.Time) time.Time {
+	switch interval {
+	case services.TimelineDay:
+		return to.AddDate(0, 0, -89)
+	case services.TimelineWeek:
+		// 26 semaines complètes : la première commence un lundi
+		start := to.AddDate(0, 0, -7*25)
+		return start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	default:
+		return time.Date(to.Year(), to.Month()-11, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// GetBalanceHistory renvoie les soldes par compte et le patrimoine agrégé
+// dans la devise du budget.
+func (h *EnableBankingHandler) GetBalanceHistory(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBudgetAction("GetBalanceHistory", budgetID, userID)
+
+	query := services.TimelineQuery{
+		Interval:  c.DefaultQuery("interval", services.TimelineMonth),
+		AccountID: c.Query("account_id"),
+	}
+	switch query.Interval {
+	case services.TimelineDay, services.TimelineWeek, services.TimelineMonth:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, week or month"})
+		return
+	}
+	if query.AccountID != "" {
+		if _, err := uuid.Parse(query.AccountID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+			return
+		}
+	}
+	if raw := c.Query("savings_pool"); raw != "" {
+		pool, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "savings_pool must be true or false"})
+			return
+		}
+		query.SavingsPoolOnly = pool
+	}
+
+	now := time.Now().UTC()
+	query.To = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for _, p := range []struct {
+		name string
+		dest *time.Time
+	}{{"to", &query.To}, {"from", &query.From}} {
+		raw := c.Query(p.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dates must use the YYYY-MM-DD format"})
+			return
+		}
+		*p.dest = parsed
+	}
+	if query.From.IsZero() {
+		query.From = timelineDefaultRange(query.Interval, query.To)
+	}
+
+	timeline, err := h.BalanceHistory.Timeline(c.Request.Context(), budgetID, userID, query)
+	if errors.Is(err, services.ErrInvalidTimeline) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		utils.SafeError("❌ Failed to build balance history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch balance history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, timeline)
+}
@@ -0,0 +1,172 @@
+// handlers/bank_reconciliation.go
+// ============================================================================
+// BANK RECONCILIATION — plan vs. banque (voir services/bank_reconciliation.go)
+// ============================================================================
+//   GET    /budgets/:id/banking/reconciliation?month=YYYY-MM
+//   PUT    /budgets/:id/banking/reconciliation/:transaction_id         {"target_type","target_id"}
+//   POST   /budgets/:id/banking/reconciliation/:transaction_id/reject  {"target_type","target_id"}
+//   DELETE /budgets/:id/banking/reconciliation/:transaction_id         (retour à l'auto)
+//   GET    /banking/budgets/:id/reality-check?month=YYYY-MM            (connexions + réconciliation)
+// ============================================================================
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/LovationAdmin/budget-api/middleware"
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+type reconciliationMatchRequest struct {
+	TargetType string `json:"target_type" binding:"required"`
+	TargetID   string `json:"target_id"`
+}
+
+// parseReconciliationMonth lit ?month=YYYY-MM (mois courant par défaut).
+func parseReconciliationMonth(c *gin.Context) (time.Time, bool) {
+	raw := c.Query("month")
+	if raw == "" {
+		return time.Now().UTC(), true
+	}
+	month, err := time.Parse("2006-01", raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "month must use the YYYY-MM format"})
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+// GetReconciliation compare les charges et projets du mois aux transactions
+// des comptes que les membres ont connectés au budget.
+func (h *EnableBankingHandler) GetReconciliation(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBudgetAction("GetReconciliation", budgetID, userID)
+
+	month, ok := parseReconciliationMonth(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.Reconciliation.Reconcile(c.Request.Context(), budgetID, month)
+	if err != nil {
+		utils.SafeError("❌ Failed to reconcile budget: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// RealityCheck : connexions et trésorerie réelle, plus la réconciliation du
+// mois.
+func (h *EnableBankingHandler) RealityCheck(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBudgetAction("RealityCheck", budgetID, userID)
+
+	month, ok := parseReconciliationMonth(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.loadConnections(c.Request.Context(), budgetID, userID)
+	if err != nil {
+		utils.SafeError("❌ Error fetching connections: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch connections"})
+		return
+	}
+
+	// La réconciliation enrichit la réponse mais ne la conditionne pas
+	report, err := h.Reconciliation.Reconcile(c.Request.Context(), budgetID, month)
+	if err != nil {
+		utils.SafeWarn("⚠️  Reconciliation unavailable: %v", err)
+	}
+	response["reconciliation"] = report
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ConfirmReconciliationMatch rattache une transaction à une charge, un projet,
+// ou la marque hors plan (target_type "none").
+func (h *EnableBankingHandler) ConfirmReconciliationMatch(c *gin.Context) {
+	h.updateReconciliationMatch(c, "ConfirmReconciliationMatch", h.Reconciliation.ConfirmMatch)
+}
+
+// RejectReconciliationMatch écarte une proposition automatique.
+func (h *EnableBankingHandler) RejectReconciliationMatch(c *gin.Context) {
+	h.updateReconciliationMatch(c, "RejectReconciliationMatch", h.Reconciliation.RejectMatch)
+}
+
+func (h *EnableBankingHandler) updateReconciliationMatch(
+	c *gin.Context,
+	action string,
+	apply func(ctx context.Context, budgetID, userID, transactionID, targetType, targetID string) error,
+) {
+	budgetID := c.Param("id")
+	transactionID := c.Param("transaction_id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBudgetAction(action, budgetID, userID)
+
+	if _, err := uuid.Parse(transactionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction_id"})
+		return
+	}
+
+	var req reconciliationMatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := apply(c.Request.Context(), budgetID, userID, transactionID, req.TargetType, req.TargetID); err != nil {
+		respondReconciliationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reconciliation updated"})
+}
+
+// ResetReconciliationMatch efface les décisions prises sur une transaction.
+func (h *EnableBankingHandler) ResetReconciliationMatch(c *gin.Context) {
+	budgetID := c.Param("id")
+	transactionID := c.Param("transaction_id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBudgetAction("ResetReconciliationMatch", budgetID, userID)
+
+	if _, err := uuid.Parse(transactionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction_id"})
+		return
+	}
+
+	if err := h.Reconciliation.ResetMatches(c.Request.Context(), budgetID, transactionID); err != nil {
+		respondReconciliationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reconciliation reset"})
+}
+
+func respondReconciliationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTransactionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+	case errors.Is(err, services.ErrInvalidMatchTarget):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target_type must be charge, project or none, with the id of an existing charge or project"})
+	default:
+		utils.SafeError("❌ Reconciliation update failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reconciliation"})
+	}
+}
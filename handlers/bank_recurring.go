@@ -0,0 +1,97 @@
+// handlers/bank_recurring.go
+// ============================================================================
+// RECURRING CHARGES — détection et import (voir services/recurring_charges.go)
+// ============================================================================
+//   GET  /budgets/:id/banking/recurring?account_id=...
+//   POST /budgets/:id/banking/recurring/import   {"keys": [...], "account_id"}
+// ============================================================================
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/LovationAdmin/budget-api/middleware"
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+type importRecurringRequest struct {
+	Keys      []string `json:"keys" binding:"required,min=1"`
+	AccountID string   `json:"account_id"`
+}
+
+// DetectRecurringCharges propose les débits périodiques des comptes que
+// l'utilisateur a connectés au budget (ou du seul account_id).
+func (h *EnableBankingHandler) DetectRecurringCharges(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBudgetAction("DetectRecurringCharges", budgetID, userID)
+
+	accountID := c.Query("account_id")
+	if accountID != "" {
+		if _, err := uuid.Parse(accountID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+			return
+		}
+	}
+
+	proposals, err := h.Recurring.Detect(c.Request.Context(), budgetID, userID, accountID)
+	if err != nil {
+		utils.SafeError("❌ Failed to detect recurring charges: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to detect recurring charges"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"proposals": proposals})
+}
+
+// ImportRecurringCharges ajoute les propositions choisies aux charges du
+// budget ; celles déjà présentes sont ignorées.
+func (h *EnableBankingHandler) ImportRecurringCharges(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBudgetAction("ImportRecurringCharges", budgetID, userID)
+
+	var req importRecurringRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.AccountID != "" {
+		if _, err := uuid.Parse(req.AccountID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+			return
+		}
+	}
+
+	var userName string
+	if err := h.DB.QueryRowContext(c.Request.Context(),
+		"SELECT name FROM users WHERE id = $1", userID).Scan(&userName); err != nil {
+		userName = "Un membre" // Fallback
+	}
+
+	imported, version, err := h.Recurring.Import(c.Request.Context(), budgetID, userID, userName, req.AccountID, req.Keys)
+	if errors.Is(err, services.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Budget data was modified by someone else, retry the import"})
+		return
+	}
+	if err != nil {
+		utils.SafeError("❌ Failed to import recurring charges: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import recurring charges"})
+		return
+	}
+
+	response := gin.H{"imported": imported}
+	if version > 0 {
+		c.Header("ETag", versionETag(version))
+		response["version"] = version
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,127 @@
+// handlers/bank_statements.go
+// ============================================================================
+// STATEMENT IMPORT — dépôt de relevés (voir services/bank_statements.go)
+// ============================================================================
+//   POST /budgets/:id/banking/imports   (multipart/form-data)
+//     file          relevé CSV, OFX/QFX ou CAMT.053 (5 Mo max)
+//     format        csv | ofx | camt053 (détecté si absent)
+//     preset        preset CSV (détecté si absent)
+//     account_id    compte importé existant à compléter (optionnel)
+//     account_name  nom du compte créé (optionnel)
+//     date_column, label_column, amount_column, debit_column, credit_column,
+//     currency_column, date_format : mapping CSV hors presets
+//   GET  /banking/imports/presets
+// ============================================================================
+
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/LovationAdmin/budget-api/middleware"
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// statementMapping lit le mapping CSV explicite du formulaire, nil si
+// aucune colonne n'est donnée.
+func statementMapping(c *gin.Context) (*services.CSVMapping, bool) {
+	m := services.CSVMapping{
+		Date:       c.PostForm("date_column"),
+		Label:      c.PostForm("label_column"),
+		Amount:     c.PostForm("amount_column"),
+		Debit:      c.PostForm("debit_column"),
+		Credit:     c.PostForm("credit_column"),
+		Currency:   c.PostForm("currency_column"),
+		DateFormat: c.PostForm("date_format"),
+	}
+	if m.Date == "" && m.Label == "" && m.Amount == "" && m.Debit == "" && m.Credit == "" {
+		return nil, true
+	}
+	if m.Date == "" || m.Label == "" || (m.Amount == "" && (m.Debit == "" || m.Credit == "")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_column, label_column and amount_column (or debit_column and credit_column) are required"})
+		return nil, false
+	}
+	return &m, true
+}
+
+// ImportBankStatement importe un relevé dans le ledger du budget.
+func (h *EnableBankingHandler) ImportBankStatement(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBudgetAction("ImportBankStatement", budgetID, userID)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A statement file is required (field 'file')"})
+		return
+	}
+	if header.Size > services.MaxStatementSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Statement file is too large (5 MB max)"})
+		return
+	}
+
+	accountID := c.PostForm("account_id")
+	if accountID != "" {
+		if _, err := uuid.Parse(accountID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+			return
+		}
+	}
+	mapping, ok := statementMapping(c)
+	if !ok {
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot read statement file"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, services.MaxStatementSize+1))
+	if err != nil || len(data) > services.MaxStatementSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot read statement file"})
+		return
+	}
+
+	statement, err := services.ParseStatement(header.Filename, data, services.StatementOptions{
+		Format:  c.PostForm("format"),
+		Preset:  c.PostForm("preset"),
+		Mapping: mapping,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.Statements.Import(c.Request.Context(), budgetID, userID, statement, accountID, c.PostForm("account_name"))
+	switch {
+	case errors.Is(err, services.ErrInvalidStatement):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrBankAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Imported account not found"})
+		return
+	case err != nil:
+		utils.SafeError("❌ Failed to import statement: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import statement"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetStatementPresets liste les presets CSV reconnus.
+func (h *EnableBankingHandler) GetStatementPresets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"formats": []string{services.StatementFormatCSV, services.StatementFormatOFX, services.StatementFormatCAMT053},
+		"presets": services.CSVPresetNames(),
+	})
+}
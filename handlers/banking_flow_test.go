@@ -0,0 +1,254 @@
+// handlers/banking_flow_test.go
+// ============================================================================
+// TESTS — parcours bancaire complet sur le fournisseur mock
+// ============================================================================
+// connect → callback → sync des comptes → synchro planifiée → transactions,
+// base simulée par sqlmock. Lancer : go test ./handlers -run BankingFlow -v
+// ============================================================================
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/services"
+)
+
+// capturedArg accepte n'importe quelle valeur et la garde, pour la rendre
+// plus loin comme si la base l'avait stockée.
+type capturedArg struct{ value driver.Value }
+
+func (a *capturedArg) Match(v driver.Value) bool {
+	a.value = v
+	return true
+}
+
+// flowProvider est le fournisseur mock avec une horloge et une fenêtre de
+// transactions fixes : le Livret A reçoit un virement le 1er de chaque mois,
+// soit trois transactions.
+type flowProvider struct {
+	*services.MockBankingProvider
+}
+
+func (p flowProvider) GetTransactions(ctx context.Context, accountUID, dateFrom, dateTo string) ([]services.Transaction, error) {
+	return p.MockBankingProvider.GetTransactions(ctx, accountUID, "2026-01-01", "2026-03-31")
+}
+
+func newBankingFlow(t *testing.T) (*EnableBankingHandler, flowProvider, sqlmock.Sqlmock, *gin.Engine) {
+	t.Helper()
+	t.Setenv("BANKING_PROVIDER", services.ProviderMock)
+	t.Setenv("DATA_ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	provider := flowProvider{services.NewMockBankingProvider()}
+	provider.Now = func() time.Time { return time.Date(2026, 4, 15, 10, 0, 0, 0, time.UTC) }
+	h := NewEnableBankingHandler(db, nil)
+	h.Provider = provider
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "u1") })
+	router.POST("/banking/enablebanking/connect", h.CreateConnection)
+	router.GET("/banking/enablebanking/callback", h.HandleCallback)
+	router.POST("/budgets/:id/banking/enablebanking/sync", h.SyncAccounts)
+	router.GET("/budgets/:id/banking/transactions", h.ListBudgetTransactions)
+	return h, provider, mock, router
+}
+
+func doJSON(t *testing.T, router *gin.Engine, method, target string, body interface{}, out interface{}) {
+	t.Helper()
+	reader := bytes.NewReader(nil)
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s = %d: %s", method, target, w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectOwnerAccess(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`FROM budget_members bm`).WithArgs("b1", "u1").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "is_owner", "permissions"}).AddRow("owner", true, nil))
+}
+
+func TestBankingFlowMockProvider(t *testing.T) {
+	h, provider, mock, router := newBankingFlow(t)
+
+	// 1. Connect : l'autorisation est enregistrée pour u1
+	expectOwnerAccess(mock)
+	mock.ExpectExec(`INSERT INTO banking_authorizations`).WithArgs(sqlmock.AnyArg(), "u1", "b1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	var connect struct {
+		RedirectURL string `json:"redirect_url"`
+		State       string `json:"state"`
+	}
+	doJSON(t, router, http.MethodPost, "/banking/enablebanking/connect",
+		map[string]string{"aspsp_id": "Mock Bank", "budget_id": "b1"}, &connect)
+	redirect, err := url.Parse(connect.RedirectURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := redirect.Query().Get("code")
+	if code == "" || redirect.Query().Get("state") != connect.State {
+		t.Fatalf("redirect_url = %s", connect.RedirectURL)
+	}
+
+	// 2. Callback : la session reste côté serveur, chiffrée
+	session := &capturedArg{}
+	mock.ExpectQuery(`SELECT budget_id FROM banking_authorizations`).WithArgs(connect.State, "u1").
+		WillReturnRows(sqlmock.NewRows([]string{"budget_id"}).AddRow("b1"))
+	mock.ExpectExec(`UPDATE banking_authorizations SET session_id`).WithArgs(connect.State, "u1", session).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	var callback struct {
+		BudgetID   string `json:"budget_id"`
+		BankName   string `json:"bank_name"`
+		ValidUntil string `json:"valid_until"`
+		Accounts   []struct {
+			UID                string `json:"uid"`
+			Name               string `json:"name"`
+			Currency           string `json:"currency"`
+			IdentificationHash string `json:"identification_hash"`
+		} `json:"accounts"`
+	}
+	doJSON(t, router, http.MethodGet, "/banking/enablebanking/callback?"+url.Values{
+		"code": {code}, "state": {connect.State},
+	}.Encode(), nil, &callback)
+	if callback.BudgetID != "b1" || callback.BankName != "Mock Bank" || len(callback.Accounts) != 2 {
+		t.Fatalf("callback = %+v", callback)
+	}
+	livret := callback.Accounts[1]
+
+	// 3. Sync des comptes choisis : connexion, compte, solde et historique
+	connSession := &capturedArg{}
+	var descriptions []*capturedArg
+	mock.ExpectQuery(`SELECT session_id FROM banking_authorizations`).WithArgs(connect.State, "u1", "b1").
+		WillReturnRows(sqlmock.NewRows([]string{"session_id"}).AddRow(session.value))
+	mock.ExpectQuery(`INSERT INTO banking_connections`).
+		WithArgs("u1", "b1", "Mock Bank", "FR", connSession, "", sqlmock.AnyArg(), "active", services.ProviderMock).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("c1"))
+	mock.ExpectExec(`UPDATE banking_accounts\s+SET account_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO banking_accounts`).
+		WithArgs("c1", livret.UID, "Livret A", "CACC", "EUR", 8200.0, livret.IdentificationHash, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("a1"))
+	mock.ExpectExec(`INSERT INTO bank_balance_snapshots`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT MAX\(booking_date\) FROM bank_transactions`).WithArgs("a1").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectBegin()
+	prepared := mock.ExpectPrepare(`INSERT INTO bank_transactions`)
+	for _, date := range []string{"2026-01-01", "2026-02-01", "2026-03-01"} {
+		description := &capturedArg{}
+		descriptions = append(descriptions, description)
+		prepared.ExpectQuery().
+			WithArgs("a1", sqlmock.AnyArg(), 200.0, "EUR", "CRDT", "BOOK", date, date, description, "").
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	}
+	mock.ExpectCommit()
+	var synced struct {
+		AccountsSynced       int `json:"accounts_synced"`
+		TransactionsImported int `json:"transactions_imported"`
+	}
+	doJSON(t, router, http.MethodPost, "/budgets/b1/banking/enablebanking/sync", map[string]interface{}{
+		"state":       connect.State,
+		"bank_name":   callback.BankName,
+		"valid_until": callback.ValidUntil,
+		"accounts":    []interface{}{livret},
+	}, &synced)
+	if synced.AccountsSynced != 1 || synced.TransactionsImported != 3 {
+		t.Fatalf("sync = %+v", synced)
+	}
+
+	// 4. Synchro planifiée : solde rafraîchi, rien de nouveau à importer
+	mock.ExpectQuery(`UPDATE banking_connections bc`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "budget_id", "session_id", "status", "sync_failures", "previous_sync_status"}).
+			AddRow("c1", "b1", connSession.value, services.ConnectionActive, 0, ""))
+	mock.ExpectExec(`UPDATE banking_connections SET expires_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT id, account_id FROM banking_accounts`).WithArgs("c1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "account_id"}).AddRow("a1", livret.UID))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE banking_accounts SET balance`).WithArgs(8200.0, "a1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO bank_balance_snapshots`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT MAX\(booking_date\) FROM bank_transactions`).WithArgs("a1").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)))
+	mock.ExpectBegin()
+	prepared = mock.ExpectPrepare(`INSERT INTO bank_transactions`)
+	for range descriptions {
+		prepared.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	}
+	mock.ExpectCommit()
+	mock.ExpectExec(`UPDATE banking_connections\s+SET sync_status = \$1,\s+sync_failures`).
+		WithArgs(services.SyncStatusOK, 0, nil, sqlmock.AnyArg(), true, "c1", services.ConnectionActive).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	scheduler := services.NewBankSyncScheduler(h.DB, provider, nil, services.BankSyncConfig{Interval: 6 * time.Hour})
+	result, err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Succeeded != 1 || result.TransactionsImported != 0 {
+		t.Fatalf("scheduler result = %+v", result)
+	}
+
+	// 5. Transactions du budget, descriptions déchiffrées
+	expectOwnerAccess(mock)
+	mock.ExpectQuery(`SELECT COUNT\(\*\)`).WithArgs("b1", "u1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	rows := sqlmock.NewRows([]string{"id", "account_id", "account_name", "provider_transaction_id", "amount", "currency",
+		"credit_debit", "status", "booking_date", "value_date", "encrypted_description", "category", "created_at"})
+	for i, date := range []string{"2026-03-01", "2026-02-01", "2026-01-01"} {
+		rows.AddRow("t"+date, "a1", "Livret A", "p"+date, 200.0, "EUR", "CRDT", "BOOK", date, date,
+			descriptions[2-i].value, "", time.Now())
+	}
+	mock.ExpectQuery(`SELECT bt.id, bt.account_id`).WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT COALESCE\(NULLIF\(currency, ''\), \$2\) FROM budgets`).WithArgs("b1", services.FXBaseCurrency).
+		WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow("EUR"))
+	var listed struct {
+		Total        int `json:"total"`
+		Transactions []struct {
+			Date        string  `json:"date"`
+			Amount      float64 `json:"amount"`
+			Description string  `json:"clean_description"`
+		} `json:"transactions"`
+	}
+	doJSON(t, router, http.MethodGet, "/budgets/b1/banking/transactions", nil, &listed)
+	if listed.Total != 3 || len(listed.Transactions) != 3 {
+		t.Fatalf("transactions = %+v", listed)
+	}
+	for _, tx := range listed.Transactions {
+		if tx.Amount != 200 || tx.Description != "VIR EPARGNE MENSUELLE" {
+			t.Errorf("transaction = %+v", tx)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -5,11 +5,16 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -145,7 +150,9 @@ func (h *Handler) DeleteBudget(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Budget deleted successfully"})
 }
 
-// GetBudgetData returns the JSON data for a budget
+// GetBudgetData returns the JSON data for a budget.
+// The current version is returned both in the body and as an ETag so clients
+// can send it back via If-Match on the next save.
 func (h *Handler) GetBudgetData(c *gin.Context) {
 	budgetID := c.Param("id")
 	userID := c.GetString("user_id")
@@ -157,7 +164,7 @@ func (h *Handler) GetBudgetData(c *gin.Context) {
 		return
 	}
 
-	data, err := h.budgetService.GetData(c.Request.Context(), budgetID)
+	data, version, err := h.budgetService.GetDataWithVersion(c.Request.Context(), budgetID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get budget data"})
 		return
@@ -172,16 +179,22 @@ func (h *Handler) GetBudgetData(c *gin.Context) {
 		_ = h.budgetService.BumpLastViewed(bumpCtx, budgetID)
 	}()
 
-	c.JSON(http.StatusOK, gin.H{"data": data})
+	c.Header("ETag", versionETag(version))
+	c.JSON(http.StatusOK, gin.H{"data": data, "version": version})
 }
 
-// UpdateBudgetData updates the JSON data for a budget
+// UpdateBudgetData updates the JSON data for a budget.
+// Optimistic concurrency: if the client sends If-Match (the ETag from GET) or
+// a "version" body field, the save only succeeds when that version is still
+// the stored head; otherwise we answer 409 with the current version and data
+// so the client can merge and retry. Without either, last writer wins.
 func (h *Handler) UpdateBudgetData(c *gin.Context) {
 	budgetID := c.Param("id")
 	userID := c.GetString("user_id")
 
 	var req struct {
-		Data interface{} `json:"data" binding:"required"`
+		Data    interface{} `json:"data" binding:"required"`
+		Version int         `json:"version"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -189,8 +202,14 @@ func (h *Handler) UpdateBudgetData(c *gin.Context) {
 		return
 	}
 
+	expected, err := expectedVersion(c, req.Version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Check access
-	_, err := h.budgetService.GetByID(c.Request.Context(), budgetID, userID)
+	_, err = h.budgetService.GetByID(c.Request.Context(), budgetID, userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
 		return
@@ -205,12 +224,118 @@ func (h *Handler) UpdateBudgetData(c *gin.Context) {
 	}
 
 	// Pass userID and userName to UpdateData
-	if err := h.budgetService.UpdateData(c.Request.Context(), budgetID, req.Data, userID, userName); err != nil {
+	newVersion, err := h.budgetService.UpdateDataIfVersion(c.Request.Context(), budgetID, req.Data, expected, userID, userName)
+	if errors.Is(err, services.ErrVersionConflict) {
+		h.respondVersionConflict(c, budgetID)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update budget data"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Budget data updated successfully"})
+	c.Header("ETag", versionETag(newVersion))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Budget data updated successfully",
+		"version": newVersion,
+	})
+}
+
+// PatchBudgetData applies an RFC 6902 JSON Patch (application/json-patch+json)
+// to the stored document. The optional If-Match header guards the base version.
+func (h *Handler) PatchBudgetData(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	var ops []utils.PatchOperation
+	if err := c.ShouldBindJSON(&ops); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Body must be a JSON Patch array"})
+		return
+	}
+	if len(ops) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Patch is empty"})
+		return
+	}
+
+	expected, err := expectedVersion(c, 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.budgetService.GetByID(c.Request.Context(), budgetID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+
+	var userName string
+	err = h.budgetService.GetDB().QueryRowContext(c.Request.Context(),
+		"SELECT name FROM users WHERE id = $1", userID).Scan(&userName)
+	if err != nil {
+		userName = "Un membre" // Fallback
+	}
+
+	newVersion, err := h.budgetService.PatchData(c.Request.Context(), budgetID, ops, expected, userID, userName)
+	if errors.Is(err, services.ErrVersionConflict) {
+		h.respondVersionConflict(c, budgetID)
+		return
+	}
+	if errors.Is(err, services.ErrInvalidPatch) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to patch budget data"})
+		return
+	}
+
+	c.Header("ETag", versionETag(newVersion))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Budget data patched successfully",
+		"version": newVersion,
+	})
+}
+
+// respondVersionConflict answers 409 with the stored head so the client can
+// rebase its local edits without an extra GET.
+func (h *Handler) respondVersionConflict(c *gin.Context, budgetID string) {
+	current, currentVersion, err := h.budgetService.GetDataWithVersion(c.Request.Context(), budgetID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Budget data was modified by someone else"})
+		return
+	}
+
+	c.Header("ETag", versionETag(currentVersion))
+	c.JSON(http.StatusConflict, gin.H{
+		"error":           "Budget data was modified by someone else",
+		"current_version": currentVersion,
+		"data":            current,
+	})
+}
+
+// versionETag formats a budget_data version as a strong ETag.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// expectedVersion returns the version the client based its edit on. If-Match
+// wins over the body field; "*" and an absent header mean no precondition.
+func expectedVersion(c *gin.Context, bodyVersion int) (int, error) {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		if bodyVersion < 0 {
+			return 0, fmt.Errorf("invalid version")
+		}
+		return bodyVersion, nil
+	}
+
+	tag := strings.TrimPrefix(ifMatch, "W/")
+	tag = strings.Trim(tag, `"`)
+	v, err := strconv.Atoi(tag)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid If-Match header")
+	}
+	return v, nil
 }
 
 // InviteMember invites a member to a budget
@@ -227,18 +352,13 @@ func (h *Handler) InviteMember(c *gin.Context) {
 	budgetID := c.Param("id")
 	userID := c.GetString("user_id")
 
-	// Check if user is the owner
+	// Permission "invite" vérifiée par middleware.RequireBudgetPermission
 	budget, err := h.budgetService.GetByID(c.Request.Context(), budgetID, userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
 		return
 	}
 
-	if budget.OwnerID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can invite members"})
-		return
-	}
-
 	// Check if user is already a member
 	isMember, err := h.budgetService.IsMemberByEmail(c.Request.Context(), budgetID, req.Email)
 	if err != nil {
@@ -267,8 +387,10 @@ func (h *Handler) InviteMember(c *gin.Context) {
 	}
 
 	// ✅ CORRIGÉ : SendInvitation prend 4 paramètres (email, inviterName, budgetName, token)
-	inviterName := budget.OwnerName
-	if inviterName == "" {
+	// L'invitant n'est plus forcément l'owner (permission "invite")
+	var inviterName string
+	if err := h.budgetService.GetDB().QueryRowContext(c.Request.Context(),
+		"SELECT name FROM users WHERE id = $1", userID).Scan(&inviterName); err != nil || inviterName == "" {
 		inviterName = "Un utilisateur"
 	}
 
@@ -277,12 +399,62 @@ func (h *Handler) InviteMember(c *gin.Context) {
 		// Don't fail the request if email fails, but log it
 	}
 
+	h.budgetService.PublishEvent(services.NewBudgetEvent(budgetID, services.EventInvitationCreated,
+		&services.EventActor{ID: userID, Name: inviterName},
+		map[string]interface{}{"invitation_id": invitation.ID, "email": req.Email},
+	), userID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "Invitation sent successfully",
 		"invitation": invitation,
 	})
 }
 
+// UpdateMemberRole changes the role of a member (owner only).
+// Body: {"role": "editor"|"viewer", "permissions": {"invite": true, ...}}
+// "permissions" is optional and holds custom grants on top of the role.
+func (h *Handler) UpdateMemberRole(c *gin.Context) {
+	var req struct {
+		Role        string          `json:"role" binding:"required"`
+		Permissions map[string]bool `json:"permissions"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budgetID := c.Param("id")
+	memberID := c.Param("member_id")
+	userID := c.GetString("user_id")
+
+	access, err := h.budgetService.SetMemberRole(c.Request.Context(), budgetID, userID, memberID, req.Role, req.Permissions)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrNotBudgetOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can change member roles"})
+		return
+	case errors.Is(err, services.ErrNotBudgetMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	case errors.Is(err, services.ErrInvalidRole),
+		errors.Is(err, services.ErrUnknownPermission),
+		errors.Is(err, services.ErrOwnerRoleChange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		log.Printf("Failed to update member role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":     memberID,
+		"role":        access.Role,
+		"permissions": access.Permissions,
+	})
+}
+
 // AcceptInvitation accepts an invitation
 func (h *Handler) AcceptInvitation(c *gin.Context) {
 	var req struct {
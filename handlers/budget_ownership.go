@@ -0,0 +1,147 @@
+// handlers/budget_ownership.go
+// ============================================================================
+// BUDGET OWNERSHIP TRANSFER
+// ============================================================================
+//   POST   /budgets/:id/transfer-ownership         : owner nominates {"member_id"}
+//   GET    /budgets/:id/transfer-ownership         : pending request, if any
+//   DELETE /budgets/:id/transfer-ownership         : owner cancels / target declines
+//   POST   /budgets/:id/transfer-ownership/accept  : target confirms in-app
+//   POST   /ownership-transfers/accept             : target confirms from the email link {"token"}
+// ============================================================================
+
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/services"
+)
+
+// RequestOwnershipTransfer lets the owner hand the budget to another member.
+func (h *Handler) RequestOwnershipTransfer(c *gin.Context) {
+	var req struct {
+		MemberID string `json:"member_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budgetID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	transfer, token, err := h.budgetService.RequestOwnershipTransfer(c.Request.Context(), budgetID, userID, req.MemberID)
+	if err != nil {
+		respondOwnershipError(c, err)
+		return
+	}
+
+	// Email de confirmation au membre désigné ; la confirmation in-app reste
+	// possible si l'envoi échoue.
+	budget, err := h.budgetService.GetByID(c.Request.Context(), budgetID, userID)
+	if err == nil {
+		for _, member := range budget.Members {
+			if member.UserID != req.MemberID {
+				continue
+			}
+			ownerName := budget.OwnerName
+			if ownerName == "" {
+				ownerName = "Un utilisateur"
+			}
+			if err := h.emailService.SendOwnershipTransfer(member.UserEmail, ownerName, budget.Name, token); err != nil {
+				log.Printf("Failed to send ownership transfer email: %v", err)
+			}
+			break
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Ownership transfer requested",
+		"transfer": transfer,
+	})
+}
+
+// GetOwnershipTransfer returns the pending transfer of a budget.
+func (h *Handler) GetOwnershipTransfer(c *gin.Context) {
+	transfer, err := h.budgetService.GetPendingOwnershipTransfer(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, services.ErrTransferNotFound) {
+		c.JSON(http.StatusOK, gin.H{"transfer": nil})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ownership transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transfer": transfer})
+}
+
+// WithdrawOwnershipTransfer cancels (owner) or declines (target) the pending
+// transfer.
+func (h *Handler) WithdrawOwnershipTransfer(c *gin.Context) {
+	status, err := h.budgetService.WithdrawOwnershipTransfer(c.Request.Context(), c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		respondOwnershipError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ownership transfer " + status, "status": status})
+}
+
+// AcceptOwnershipTransfer confirms the pending transfer from the app.
+func (h *Handler) AcceptOwnershipTransfer(c *gin.Context) {
+	budgetID := c.Param("id")
+
+	if err := h.budgetService.AcceptOwnershipTransfer(c.Request.Context(), budgetID, c.GetString("user_id")); err != nil {
+		respondOwnershipError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "You are now the owner of this budget", "budget_id": budgetID})
+}
+
+// AcceptOwnershipTransferByToken confirms a transfer from the emailed link.
+// The caller must be logged in as the nominated member.
+func (h *Handler) AcceptOwnershipTransferByToken(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budgetID, err := h.budgetService.AcceptOwnershipTransferByToken(c.Request.Context(), req.Token, c.GetString("user_id"))
+	if err != nil {
+		respondOwnershipError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "You are now the owner of this budget", "budget_id": budgetID})
+}
+
+func respondOwnershipError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotBudgetOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can transfer the budget"})
+	case errors.Is(err, services.ErrTransferNotForUser):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotBudgetMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+	case errors.Is(err, services.ErrTransferNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTransferExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTransferTarget):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Ownership transfer failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ownership transfer failed"})
+	}
+}
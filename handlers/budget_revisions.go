@@ -0,0 +1,145 @@
+// handlers/budget_revisions.go
+// ============================================================================
+// BUDGET REVISIONS — history, diff and restore of budget_data
+// ============================================================================
+//   GET  /budgets/:id/revisions                    : metadata, newest first
+//   GET  /budgets/:id/revisions/:version           : one revision, decrypted
+//   GET  /budgets/:id/revisions/diff?from=X&to=Y   : leaf-level JSON diff
+//   POST /budgets/:id/revisions/:version/restore   : revision becomes the head
+// ============================================================================
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/services"
+)
+
+// ListRevisions returns the revision history of a budget.
+func (h *Handler) ListRevisions(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if _, err := h.budgetService.GetByID(c.Request.Context(), budgetID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	revisions, err := h.budgetService.ListRevisions(c.Request.Context(), budgetID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// GetRevision returns a single revision with its decrypted document.
+func (h *Handler) GetRevision(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	if _, err := h.budgetService.GetByID(c.Request.Context(), budgetID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+
+	rev, err := h.budgetService.GetRevision(c.Request.Context(), budgetID, version)
+	if errors.Is(err, services.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get revision"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rev)
+}
+
+// DiffRevisions compares two revisions (?from=&to=).
+func (h *Handler) DiffRevisions(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	from, errFrom := strconv.Atoi(c.Query("from"))
+	to, errTo := strconv.Atoi(c.Query("to"))
+	if errFrom != nil || errTo != nil || from <= 0 || to <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to versions are required"})
+		return
+	}
+
+	if _, err := h.budgetService.GetByID(c.Request.Context(), budgetID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+
+	changes, err := h.budgetService.DiffRevisions(c.Request.Context(), budgetID, from, to)
+	if errors.Is(err, services.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to diff revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"changes": changes,
+	})
+}
+
+// RestoreRevision turns an older revision into the new head.
+func (h *Handler) RestoreRevision(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	if _, err := h.budgetService.GetByID(c.Request.Context(), budgetID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+
+	var userName string
+	err = h.budgetService.GetDB().QueryRowContext(c.Request.Context(),
+		"SELECT name FROM users WHERE id = $1", userID).Scan(&userName)
+	if err != nil {
+		userName = "Un membre" // Fallback
+	}
+
+	newVersion, err := h.budgetService.RestoreRevision(c.Request.Context(), budgetID, version, userID, userName)
+	if errors.Is(err, services.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore revision"})
+		return
+	}
+
+	c.Header("ETag", versionETag(newVersion))
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Revision restored successfully",
+		"restored_from": version,
+		"version":       newVersion,
+	})
+}
@@ -0,0 +1,134 @@
+// handlers/budget_test.go
+// ============================================================================
+// TESTS — sauvegarde concurrente de budget_data (If-Match / ETag)
+// ============================================================================
+// Lancer : go test ./handlers -run BudgetData -v
+// ============================================================================
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// newBudgetDataRouter monte PUT /budgets/:id/data pour u1, membre de b1 dont
+// la clé de données existe déjà.
+func newBudgetDataRouter(t *testing.T) (sqlmock.Sqlmock, *gin.Engine) {
+	t.Helper()
+	t.Setenv("DATA_ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+	gin.SetMode(gin.TestMode)
+
+	key, err := utils.GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := utils.Encrypt(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mock.ExpectQuery(`FROM budgets b`).WithArgs("b1", "u1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "owner_id", "location", "currency",
+			"created_at", "updated_at", "is_owner", "owner_name"}).
+			AddRow("b1", "Famille", "u1", "FR", "EUR", time.Now(), time.Now(), true, "User u1"))
+	mock.ExpectQuery(`FROM budget_members bm`).WithArgs("b1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "role", "permissions", "is_owner",
+			"joined_at", "name", "email", "avatar"}))
+	mock.ExpectQuery(`SELECT name FROM users`).WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("User u1"))
+	mock.ExpectQuery(`SELECT wrapped_key FROM budget_data_keys`).WithArgs("b1").
+		WillReturnRows(sqlmock.NewRows([]string{"wrapped_key"}).AddRow(wrapped))
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT 1 FROM budgets WHERE id = \$1 FOR NO KEY UPDATE`).WithArgs("b1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	h := NewHandler(services.NewBudgetService(db, nil, nil), nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "u1") })
+	router.PUT("/budgets/:id/data", h.UpdateBudgetData)
+	return mock, router
+}
+
+func putBudgetData(router *gin.Engine, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/budgets/b1/data",
+		strings.NewReader(`{"data": {"budgetTitle": "Vacances"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", ifMatch)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateBudgetDataStaleVersion(t *testing.T) {
+	mock, router := newBudgetDataRouter(t)
+
+	// Un autre membre a sauvegardé la version 3 entre-temps
+	mock.ExpectQuery(`SELECT id, COALESCE\(version, 1\), data FROM budget_data`).WithArgs("b1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "data"}).AddRow("d1", 3, []byte(`{}`)))
+	mock.ExpectRollback()
+	mock.ExpectQuery(`SELECT data, COALESCE\(version, 1\) FROM budget_data`).WithArgs("b1").
+		WillReturnRows(sqlmock.NewRows([]string{"data", "version"}).AddRow([]byte(`{"budgetTitle": "Famille"}`), 3))
+
+	w := putBudgetData(router, `"2"`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body.String())
+	}
+	if etag := w.Header().Get("ETag"); etag != `"3"` {
+		t.Errorf("ETag = %s, want \"3\"", etag)
+	}
+	var body struct {
+		CurrentVersion int                    `json:"current_version"`
+		Data           map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.CurrentVersion != 3 || body.Data["budgetTitle"] != "Famille" {
+		t.Errorf("conflict body = %+v", body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateBudgetDataCurrentVersion(t *testing.T) {
+	mock, router := newBudgetDataRouter(t)
+
+	mock.ExpectQuery(`SELECT id, COALESCE\(version, 1\), data FROM budget_data`).WithArgs("b1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "data"}).AddRow("d1", 3, []byte(`{}`)))
+	mock.ExpectExec(`INSERT INTO budget_data_revisions`).WithArgs("d1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE budget_data`).WithArgs(sqlmock.AnyArg(), 4, "u1", sqlmock.AnyArg(), "b1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO budget_data_revisions`).WithArgs("d1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := putBudgetData(router, `"3"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if etag := w.Header().Get("ETag"); etag != `"4"` {
+		t.Errorf("ETag = %s, want \"4\"", etag)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,15 +2,19 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/LovationAdmin/budget-api/middleware"
+	"github.com/LovationAdmin/budget-api/models"
 	"github.com/LovationAdmin/budget-api/services"
 	"github.com/LovationAdmin/budget-api/utils"
 
@@ -21,14 +25,38 @@ import (
 type EnableBankingHandler struct {
 	DB                   *sql.DB
 	Service              *services.BankingService
-	EnableBankingService *services.EnableBankingService
+	Provider             services.BankingProvider
+	Transactions         *services.BankTransactionService
+	Reconciliation       *services.ReconciliationService
+	Recurring            *services.RecurringChargeService
+	Statements           *services.StatementImportService
+	FX                   *services.FXRateService
+	BalanceHistory       *services.BalanceHistoryService
+	WS                   *WSHandler // optionnel : notifie la fin des syncs
 }
 
-func NewEnableBankingHandler(db *sql.DB) *EnableBankingHandler {
+func NewEnableBankingHandler(db *sql.DB, ws *WSHandler) *EnableBankingHandler {
+	// Un *WSHandler nil ne doit pas devenir un Broadcaster non nil
+	var broadcaster services.Broadcaster
+	if ws != nil {
+		broadcaster = ws
+	}
+	budgetService := services.NewBudgetService(db, broadcaster, nil)
+	transactions := services.NewBankTransactionService(db)
+	categorizer := services.NewCategorizerService(db)
+	fx := services.NewFXRateService(db)
+
 	return &EnableBankingHandler{
 		DB:                   db,
 		Service:              services.NewBankingService(db),
-		EnableBankingService: services.NewEnableBankingService(),
+		Provider:             services.NewBankingProviderFromEnv(),
+		Transactions:         transactions,
+		Reconciliation:       services.NewReconciliationService(db, budgetService),
+		Recurring:            services.NewRecurringChargeService(db, budgetService, categorizer),
+		Statements:           services.NewStatementImportService(db, transactions, categorizer),
+		FX:                   fx,
+		BalanceHistory:       services.NewBalanceHistoryService(db, fx),
+		WS:                   ws,
 	}
 }
 
@@ -42,7 +70,7 @@ func (h *EnableBankingHandler) GetBanks(c *gin.Context) {
 	// ✅ LOGGING SÉCURISÉ
 	utils.SafeInfo("🏦 Fetching banks for country: %s", country)
 
-	aspsps, err := h.EnableBankingService.GetASPSPs(c.Request.Context(), country)
+	aspsps, err := h.Provider.GetASPSPs(c.Request.Context(), country)
 	if err != nil {
 		utils.SafeError("❌ Failed to fetch banks: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -100,13 +128,49 @@ func (h *EnableBankingHandler) CreateConnection(c *gin.Context) {
 		return
 	}
 
+	// Le budget_id vient du body : le middleware de route ne peut pas le voir
+	access, err := services.GetMemberAccess(c.Request.Context(), h.DB, req.BudgetID, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+	if !access.Can(services.PermManageBanking) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":    "Insufficient permissions",
+			"required": services.PermManageBanking,
+		})
+		return
+	}
+
 	// ✅ LOGGING SÉCURISÉ - Pas d'IDs complets en production
 	utils.SafeInfo("🔐 Creating connection for bank: %s", req.ASPSPID)
 	utils.LogBudgetAction("CreateBankConnection", req.BudgetID, "")
 
-	// Générer un state unique qui encode le budget ID
-	state := fmt.Sprintf("%s|%s", req.BudgetID, uuid.New().String())
-	validUntil := time.Now().AddDate(0, 0, 90).Format(time.RFC3339)
+	authResp, state, err := h.startAuthorization(c, req.BudgetID, req.ASPSPID, "FR") // Pour l'instant, on se concentre sur la France
+	if err != nil {
+		utils.SafeError("❌ Failed to create auth request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create connection",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	utils.SafeInfo("✅ Authorization URL created successfully")
+
+	c.JSON(http.StatusOK, gin.H{
+		"redirect_url":     authResp.URL,
+		"state":            state,
+		"authorization_id": authResp.AuthorizationID,
+	})
+}
+
+// startAuthorization crée la demande d'autorisation auprès du fournisseur pour un
+// budget. Le state ("budgetID|uuid") est enregistré pour l'utilisateur courant :
+// le callback et SyncAccounts n'acceptent que lui.
+func (h *EnableBankingHandler) startAuthorization(c *gin.Context, budgetID, aspspName, aspspCountry string) (*services.AuthResponse, string, error) {
+	state := fmt.Sprintf("%s|%s", budgetID, uuid.New().String())
+	validUntil := time.Now().Add(services.DefaultConsentValidity).Format(time.RFC3339)
 
 	// Construire l'URL de callback
 	callbackURL := os.Getenv("FRONTEND_URL")
@@ -117,37 +181,27 @@ func (h *EnableBankingHandler) CreateConnection(c *gin.Context) {
 
 	utils.SafeDebug("📍 Callback URL: %s", callbackURL)
 
-	// Créer la demande d'autorisation
 	authReq := services.AuthRequest{
 		Access: services.Access{
 			ValidUntil: validUntil,
 		},
 		ASPSP: services.ASPSPIdentifier{
-			Name:    req.ASPSPID,
-			Country: "FR", // Pour l'instant, on se concentre sur la France
+			Name:    aspspName,
+			Country: aspspCountry,
 		},
 		State:       state,
 		RedirectURL: callbackURL,
 		PSUType:     "personal",
 	}
 
-	authResp, err := h.EnableBankingService.CreateAuthRequest(c.Request.Context(), authReq)
+	authResp, err := h.Provider.CreateAuthRequest(c.Request.Context(), authReq)
 	if err != nil {
-		utils.SafeError("❌ Failed to create auth request: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to create connection",
-			"details": err.Error(),
-		})
-		return
+		return nil, "", err
 	}
-
-	utils.SafeInfo("✅ Authorization URL created successfully")
-
-	c.JSON(http.StatusOK, gin.H{
-		"redirect_url":     authResp.URL,
-		"state":            state,
-		"authorization_id": authResp.AuthorizationID,
-	})
+	if err := h.Service.SaveBankAuthorization(c.Request.Context(), state, middleware.GetUserID(c), budgetID); err != nil {
+		return nil, "", err
+	}
+	return authResp, state, nil
 }
 
 // ============================================================================
@@ -169,8 +223,21 @@ func (h *EnableBankingHandler) HandleCallback(c *gin.Context) {
 		return
 	}
 
+	// Le state doit venir d'une autorisation lancée par cet utilisateur
+	userID := middleware.GetUserID(c)
+	budgetID, err := h.Service.BankAuthorizationBudget(c.Request.Context(), state, userID)
+	if errors.Is(err, services.ErrBankAuthorizationNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or expired authorization, please reconnect"})
+		return
+	}
+	if err != nil {
+		utils.SafeError("❌ Failed to load authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
 	// Créer la session avec le code d'autorisation
-	sessionResp, err := h.EnableBankingService.CreateSession(c.Request.Context(), code, state)
+	sessionResp, err := h.Provider.CreateSession(c.Request.Context(), code, state)
 	if err != nil {
 		utils.SafeError("❌ Failed to create session: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -180,11 +247,11 @@ func (h *EnableBankingHandler) HandleCallback(c *gin.Context) {
 		return
 	}
 
-	// Extraire le budget ID du state
-	budgetID := state
-	if len(state) > 36 {
-		// State format: "budgetID|uuid"
-		budgetID = state[:36]
+	// La session reste côté serveur, SyncAccounts la retrouve par le state
+	if err := h.Service.AttachBankSession(c.Request.Context(), state, userID, sessionResp.SessionID); err != nil {
+		utils.SafeError("❌ Failed to store session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
 	}
 
 	// ✅ LOGGING SÉCURISÉ
@@ -207,20 +274,22 @@ func (h *EnableBankingHandler) HandleCallback(c *gin.Context) {
 		}
 
 		accounts = append(accounts, map[string]interface{}{
-			"uid":      acc.UID,
-			"name":     acc.Name,
-			"iban":     maskedIBAN,
-			"currency": acc.Currency,
-			"type":     acc.CashAccountType,
+			"uid":                 acc.UID,
+			"name":                acc.Name,
+			"iban":                maskedIBAN,
+			"currency":            acc.Currency,
+			"type":                acc.CashAccountType,
+			"identification_hash": acc.IdentificationHash,
 		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"session_id":   sessionResp.SessionID,
+		"state":        state,
 		"budget_id":    budgetID,
 		"accounts":     accounts,
 		"bank_name":    sessionResp.ASPSP.Name,
 		"bank_country": sessionResp.ASPSP.Country,
+		"valid_until":  sessionResp.Access.ValidUntil,
 	})
 }
 
@@ -252,14 +321,16 @@ func (h *EnableBankingHandler) SyncAccounts(c *gin.Context) {
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	var req struct {
-		SessionID string `json:"session_id" binding:"required"`
-		BankName  string `json:"bank_name"`
-		Accounts  []struct {
-			UID      string `json:"uid" binding:"required"`
-			Name     string `json:"name" binding:"required"`
-			IBAN     string `json:"iban"`
-			Currency string `json:"currency" binding:"required"`
-			Type     string `json:"type"`
+		State      string `json:"state" binding:"required"`
+		BankName   string `json:"bank_name"`
+		ValidUntil string `json:"valid_until"`
+		Accounts   []struct {
+			UID                string `json:"uid" binding:"required"`
+			Name               string `json:"name" binding:"required"`
+			IBAN               string `json:"iban"`
+			Currency           string `json:"currency" binding:"required"`
+			Type               string `json:"type"`
+			IdentificationHash string `json:"identification_hash"`
 		} `json:"accounts" binding:"required"`
 	}
 
@@ -272,6 +343,18 @@ func (h *EnableBankingHandler) SyncAccounts(c *gin.Context) {
 		return
 	}
 
+	// Session obtenue au callback, gardée côté serveur
+	sessionID, err := h.Service.BankAuthorizationSession(c.Request.Context(), req.State, userID, budgetID)
+	if errors.Is(err, services.ErrBankAuthorizationNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or expired authorization, please reconnect"})
+		return
+	}
+	if err != nil {
+		utils.SafeError("❌ Failed to load authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync accounts"})
+		return
+	}
+
 	// ✅ LOGGING SÉCURISÉ
 	utils.SafeInfo("✅ Parsed request:")
 	utils.SafeInfo("   Bank: %s", req.BankName)
@@ -287,11 +370,30 @@ func (h *EnableBankingHandler) SyncAccounts(c *gin.Context) {
 	}
 
 	accountsSynced := 0
+	transactionsImported := 0
 	bankName := req.BankName
 	if bankName == "" {
 		bankName = "Enable Banking"
 	}
 
+	// Validité réelle du consentement et empreintes des comptes : la session
+	// fait foi, le body (retour du callback) sert de repli.
+	expiresAt := time.Now().Add(services.DefaultConsentValidity)
+	if t, ok := services.ParseConsentValidUntil(req.ValidUntil); ok {
+		expiresAt = t
+	}
+	identificationHashes := map[string]string{}
+	if session, err := h.Provider.GetSession(c.Request.Context(), sessionID); err != nil {
+		utils.SafeWarn("⚠️  Could not read session details: %v", err)
+	} else {
+		if t, ok := services.ParseConsentValidUntil(session.Access.ValidUntil); ok {
+			expiresAt = t
+		}
+		for _, a := range session.AccountsData {
+			identificationHashes[a.UID] = a.IdentificationHash
+		}
+	}
+
 	for i, acc := range req.Accounts {
 		// ✅ LOGGING SÉCURISÉ - Pas d'IBAN ni de données sensibles
 		utils.SafeInfo("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
@@ -306,10 +408,10 @@ func (h *EnableBankingHandler) SyncAccounts(c *gin.Context) {
 			budgetID,
 			acc.UID,
 			bankName,
-			req.SessionID,
-			"enablebanking",
+			sessionID,
+			h.Provider.Name(),
 			"",
-			time.Now().AddDate(0, 3, 0), // 3 mois
+			expiresAt,
 		)
 
 		if err != nil {
@@ -323,9 +425,9 @@ func (h *EnableBankingHandler) SyncAccounts(c *gin.Context) {
 		balance := 0.0
 		utils.SafeDebug("   → Fetching balance...")
 
-		balances, err := h.EnableBankingService.GetBalances(
+		balances, err := h.Provider.GetBalances(
 			c.Request.Context(),
-			req.SessionID,
+			sessionID,
 			acc.UID,
 		)
 
@@ -349,8 +451,12 @@ func (h *EnableBankingHandler) SyncAccounts(c *gin.Context) {
 		if len(mask) > 4 {
 			mask = mask[len(mask)-4:]
 		}
+		identificationHash := identificationHashes[acc.UID]
+		if identificationHash == "" {
+			identificationHash = acc.IdentificationHash
+		}
 
-		err = h.Service.SaveAccount(
+		accountID, err := h.Service.SaveAccount(
 			c.Request.Context(),
 			connID,
 			acc.UID,
@@ -358,6 +464,7 @@ func (h *EnableBankingHandler) SyncAccounts(c *gin.Context) {
 			mask,
 			acc.Currency,
 			balance,
+			identificationHash,
 		)
 
 		if err != nil {
@@ -365,6 +472,13 @@ func (h *EnableBankingHandler) SyncAccounts(c *gin.Context) {
 			continue
 		}
 
+		// D. Import initial des transactions dans le ledger (best effort)
+		imported, err := h.Transactions.SyncAccountTransactions(c.Request.Context(), h.Provider, accountID, acc.UID)
+		if err != nil {
+			utils.SafeWarn("⚠️  Could not import transactions for %s: %v", acc.Name, err)
+		}
+		transactionsImported += imported
+
 		utils.SafeInfo("✅ Account synced: %s", acc.Name)
 		accountsSynced++
 	}
@@ -375,10 +489,24 @@ func (h *EnableBankingHandler) SyncAccounts(c *gin.Context) {
 	utils.LogBudgetAction("SyncAccounts-Complete", budgetID, userID)
 	utils.SafeInfo("═══════════════════════════════════════════════════")
 
+	if h.WS != nil {
+		h.WS.PublishEvent(services.NewBudgetEvent(budgetID, services.EventBankSyncCompleted,
+			&services.EventActor{ID: userID},
+			map[string]interface{}{
+				"bank_name":             bankName,
+				"accounts_synced":       accountsSynced,
+				"total_accounts":        len(req.Accounts),
+				"transactions_imported": transactionsImported,
+			},
+		), "")
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":         "Accounts synchronized successfully",
-		"accounts_synced": accountsSynced,
-		"total_accounts":  len(req.Accounts),
+		"message":               "Accounts synchronized successfully",
+		"accounts_synced":       accountsSynced,
+		"total_accounts":        len(req.Accounts),
+		"transactions_imported": transactionsImported,
+		"valid_until":           expiresAt,
 	})
 }
 
@@ -393,74 +521,104 @@ func (h *EnableBankingHandler) GetConnections(c *gin.Context) {
 	// ✅ LOGGING SÉCURISÉ
 	utils.LogBudgetAction("GetConnections", budgetID, userID)
 
-	// 1. Fetch List of Connections
-	rows, err := h.DB.Query(`
-        SELECT 
-            bc.id,
-            bc.aspsp_name as institution_name,
-            bc.session_id,
-            bc.created_at,
-            COUNT(ba.id) as account_count
-        FROM banking_connections bc
-        LEFT JOIN banking_accounts ba ON ba.connection_id = bc.id
-        WHERE bc.budget_id = $1 
-          AND bc.user_id = $2
-        GROUP BY bc.id, bc.aspsp_name, bc.session_id, bc.created_at
-        ORDER BY bc.created_at DESC
-    `, budgetID, userID)
-
+	response, err := h.loadConnections(c.Request.Context(), budgetID, userID)
 	if err != nil {
 		utils.SafeError("❌ Error fetching connections: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch connections"})
 		return
 	}
-	defer rows.Close()
-
-	type Connection struct {
-		ID              string    `json:"id"`
-		InstitutionName string    `json:"institution_name"`
-		SessionID       string    `json:"session_id"`
-		CreatedAt       time.Time `json:"created_at"`
-		AccountCount    int       `json:"account_count"`
-		Provider        string    `json:"provider"`
-	}
 
-	var connections []Connection
+	c.JSON(http.StatusOK, response)
+}
 
-	for rows.Next() {
-		var conn Connection
-		conn.Provider = "enablebanking"
-		if err := rows.Scan(&conn.ID, &conn.InstitutionName, &conn.SessionID, &conn.CreatedAt, &conn.AccountCount); err != nil {
-			utils.SafeWarn("⚠️  Error scanning row: %v", err)
-			continue
-		}
-		connections = append(connections, conn)
+// loadConnections renvoie les connexions de userID sur le budget (avec leurs
+// comptes), le total de leurs soldes (total_real_cash) et l'épargne commune
+// du budget (savings_pool_total, comptes marqués is_savings_pool).
+func (h *EnableBankingHandler) loadConnections(ctx context.Context, budgetID, userID string) (gin.H, error) {
+	connections, err := h.Service.GetBudgetConnections(ctx, budgetID, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	// 2. Calculate Total Cash (The missing piece!)
-	var totalRealCash float64
-	err = h.DB.QueryRow(`
-        SELECT COALESCE(SUM(balance), 0)
-        FROM banking_accounts ba
-        JOIN banking_connections bc ON ba.connection_id = bc.id
-        WHERE bc.budget_id = $1 
-          AND bc.user_id = $2
-    `, budgetID, userID).Scan(&totalRealCash)
-
+	// Les totaux enrichissent la réponse mais ne la conditionnent pas. Les
+	// soldes sont convertis dans la devise du budget.
+	currency, err := h.FX.BudgetCurrency(ctx, budgetID)
 	if err != nil {
-		utils.SafeWarn("⚠️  Error calculating total cash: %v", err)
-		// We don't fail the request, just return 0
-		totalRealCash = 0
+		utils.SafeWarn("⚠️  Error loading budget currency: %v", err)
+		currency = services.FXBaseCurrency
 	}
+	if err := h.FX.ConvertAccounts(ctx, currency, connections); err != nil {
+		utils.SafeWarn("⚠️  Error converting account balances: %v", err)
+	}
+	realCash := h.convertedTotals(ctx, currency, "total cash", func() (map[string]float64, error) {
+		return h.Service.GetUserCashBalances(ctx, budgetID, userID)
+	})
+	savingsPool := h.convertedTotals(ctx, currency, "savings pool", func() (map[string]float64, error) {
+		return h.Service.GetRealityCheckBalances(ctx, budgetID)
+	})
 
 	// ✅ LOGGING SÉCURISÉ - Ne pas logger le montant total
 	utils.SafeInfo("✅ Found %d connections", len(connections))
 
-	// 3. Return both connections AND the total
-	c.JSON(http.StatusOK, gin.H{
-		"connections":     connections,
-		"total_real_cash": totalRealCash, // <--- This is what the frontend needs
-	})
+	return gin.H{
+		"connections":        connections,
+		"currency":           currency,
+		"total_real_cash":    realCash.Total, // <--- This is what the frontend needs
+		"savings_pool_total": savingsPool.Total,
+		"real_cash":          realCash,    // détail par devise
+		"savings_pool":       savingsPool, // détail par devise
+	}, nil
+}
+
+// convertedTotals charge des soldes par devise et les convertit ; en cas
+// d'erreur, un total vide plutôt qu'un échec de la page.
+func (h *EnableBankingHandler) convertedTotals(ctx context.Context, currency, label string, load func() (map[string]float64, error)) *models.CurrencyTotals {
+	empty := &models.CurrencyTotals{Currency: currency, Breakdown: []models.CurrencyBreakdown{}}
+	balances, err := load()
+	if err != nil {
+		utils.SafeWarn("⚠️  Error calculating %s: %v", label, err)
+		return empty
+	}
+	totals, err := h.FX.ConvertBalances(ctx, balances, currency)
+	if err != nil {
+		utils.SafeWarn("⚠️  Error converting %s: %v", label, err)
+		return empty
+	}
+	return totals
+}
+
+// UpdateAccountPool marque un compte comme épargne commune du budget (Reality
+// Check). PUT /budgets/:id/banking/accounts/:account_id/pool
+func (h *EnableBankingHandler) UpdateAccountPool(c *gin.Context) {
+	budgetID := c.Param("id")
+	accountID := c.Param("account_id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBudgetAction("UpdateAccountPool", budgetID, userID)
+
+	if _, err := uuid.Parse(accountID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+		return
+	}
+
+	var req models.UpdateAccountPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.Service.UpdateAccountPool(c.Request.Context(), budgetID, userID, accountID, req.IsSavingsPool)
+	if errors.Is(err, services.ErrBankAccountNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+	if err != nil {
+		utils.SafeError("❌ Failed to update account pool: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account updated successfully"})
 }
 
 // ============================================================================
@@ -481,88 +639,29 @@ func (h *EnableBankingHandler) RefreshBalances(c *gin.Context) {
 	utils.SafeInfo("🔄 Refreshing balances for connection")
 	utils.LogBankingAction("RefreshBalances", req.ConnectionID, "")
 
-	// Récupérer le session ID
-	var sessionID string
-	err := h.DB.QueryRow(`
-		SELECT session_id 
-		FROM banking_connections 
-		WHERE id = $1
-	`, req.ConnectionID).Scan(&sessionID)
-
-	if err != nil {
-		utils.SafeError("❌ Connection not found: %v", err)
+	userID := middleware.GetUserID(c)
+	updatedCount, failures, err := h.Service.RefreshConnectionBalances(c.Request.Context(), h.Provider, req.ConnectionID, userID)
+	if errors.Is(err, services.ErrBankConnectionNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
 		return
 	}
-
-	// Récupérer tous les comptes de cette connexion
-	rows, err := h.DB.Query(`
-		SELECT id, account_id, account_name
-		FROM banking_accounts 
-		WHERE connection_id = $1
-	`, req.ConnectionID)
-
+	if errors.Is(err, services.ErrBankProviderMismatch) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Connection belongs to another banking provider, reconnect it first"})
+		return
+	}
 	if err != nil {
-		utils.SafeError("❌ Failed to fetch accounts: %v", err)
+		utils.SafeError("❌ Failed to refresh balances: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
 		return
 	}
-	defer rows.Close()
-
-	updatedCount := 0
-	errors := []string{}
-
-	for rows.Next() {
-		var accountID, externalID, accountName string
-		if err := rows.Scan(&accountID, &externalID, &accountName); err != nil {
-			continue
-		}
-
-		// ✅ LOGGING SÉCURISÉ
-		utils.SafeDebug("💰 Refreshing balance for: %s", accountName)
-
-		balances, err := h.EnableBankingService.GetBalances(
-			c.Request.Context(),
-			sessionID,
-			externalID,
-		)
-
-		if err != nil {
-			errMsg := fmt.Sprintf("Error fetching balance for %s", accountName)
-			utils.SafeWarn("❌ %s: %v", errMsg, err)
-			errors = append(errors, errMsg)
-			continue
-		}
-
-		if len(balances) > 0 {
-			amountStr := balances[0].BalanceAmount.Amount
-			if balance, err := strconv.ParseFloat(amountStr, 64); err == nil {
-				_, err := h.DB.Exec(`
-					UPDATE banking_accounts 
-					SET balance = $1, last_sync_at = NOW() 
-					WHERE id = $2
-				`, balance, accountID)
-
-				if err == nil {
-					// ✅ LOGGING SÉCURISÉ - Ne pas logger le montant
-					utils.SafeInfo("✅ Updated balance for %s", accountName)
-					updatedCount++
-				} else {
-					errMsg := fmt.Sprintf("Failed to update balance for %s", accountName)
-					utils.SafeError("❌ %s: %v", errMsg, err)
-					errors = append(errors, errMsg)
-				}
-			}
-		}
-	}
 
 	response := gin.H{
 		"message":          "Balances refresh completed",
 		"accounts_updated": updatedCount,
 	}
 
-	if len(errors) > 0 {
-		response["errors"] = errors
+	if len(failures) > 0 {
+		response["errors"] = failures
 	}
 
 	utils.SafeInfo("✅ Balance refresh complete: %d accounts updated", updatedCount)
@@ -571,128 +670,139 @@ func (h *EnableBankingHandler) RefreshBalances(c *gin.Context) {
 }
 
 // ============================================================================
-// 7. GET TRANSACTIONS - Récupérer les transactions
+// 7. TRANSACTIONS - Ledger local (voir services/bank_transactions.go)
 // ============================================================================
 
+// GetTransactions lit le ledger local. Route historique :
+// GET /banking/enablebanking/transactions?budget_id=...
 func (h *EnableBankingHandler) GetTransactions(c *gin.Context) {
-	budgetID := c.Query("budget_id")
+	h.listTransactions(c, c.Query("budget_id"))
+}
+
+// ListBudgetTransactions : GET /budgets/:id/banking/transactions
+// Filtres : account_id, from, to (YYYY-MM-DD), type (DBIT|CRDT), limit, offset
+func (h *EnableBankingHandler) ListBudgetTransactions(c *gin.Context) {
+	h.listTransactions(c, c.Param("id"))
+}
+
+func (h *EnableBankingHandler) listTransactions(c *gin.Context, budgetID string) {
 	userID := middleware.GetUserID(c)
 
 	// ✅ LOGGING SÉCURISÉ
 	utils.LogBudgetAction("GetTransactions", budgetID, userID)
 
-	// FIX: Change 'ba.external_account_id' to 'ba.account_id'
-	rows, err := h.DB.Query(`
-        SELECT bc.session_id, ba.account_id, ba.id, ba.account_name
-        FROM banking_accounts ba
-        JOIN banking_connections bc ON ba.connection_id = bc.id
-        WHERE bc.user_id = $1 
-          AND bc.budget_id = $2 
-    `, userID, budgetID)
-
-	if err != nil {
-		utils.SafeError("❌ Failed to fetch accounts: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+	if _, err := services.GetMemberAccess(c.Request.Context(), h.DB, budgetID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
 		return
 	}
-	defer rows.Close()
 
-	type TransactionDisplay struct {
-		ID          string  `json:"id"`
-		AccountID   string  `json:"account_id"`
-		AccountName string  `json:"account_name"`
-		Amount      float64 `json:"amount"`
-		Currency    string  `json:"currency_code"`
-		Description string  `json:"clean_description"`
-		Date        string  `json:"date"`
-		Type        string  `json:"type"` // DBIT ou CRDT
+	filter := services.TransactionFilter{
+		AccountID: c.Query("account_id"),
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+		Type:      strings.ToUpper(c.Query("type")),
 	}
-
-	var allTransactions []TransactionDisplay
-	transactionID := 1
-
-	// Récupérer les transactions des 90 derniers jours
-	dateFrom := time.Now().AddDate(0, 0, -90).Format("2006-01-02")
-	dateTo := time.Now().Format("2006-01-02")
-
-	for rows.Next() {
-		var sessionID, accountUID, accountID, accountName string
-		if err := rows.Scan(&sessionID, &accountUID, &accountID, &accountName); err != nil {
+	for _, d := range []string{filter.From, filter.To} {
+		if d == "" {
 			continue
 		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dates must use the YYYY-MM-DD format"})
+			return
+		}
+	}
+	if filter.Type != "" && filter.Type != "DBIT" && filter.Type != "CRDT" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be DBIT or CRDT"})
+		return
+	}
+	if filter.AccountID != "" {
+		if _, err := uuid.Parse(filter.AccountID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+			return
+		}
+	}
+	filter.Limit, _ = strconv.Atoi(c.Query("limit"))
+	filter.Offset, _ = strconv.Atoi(c.Query("offset"))
 
-		utils.SafeDebug("   → Fetching transactions for: %s", accountName)
+	transactions, total, err := h.Transactions.ListTransactions(c.Request.Context(), budgetID, userID, filter)
+	if err != nil {
+		utils.SafeError("❌ Failed to list transactions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
+		return
+	}
 
-		transactions, err := h.EnableBankingService.GetTransactions(
-			c.Request.Context(),
-			accountUID,
-			dateFrom,
-			dateTo,
-		)
+	// amount_converted : montant dans la devise du budget (facultatif)
+	currency, err := h.FX.BudgetCurrency(c.Request.Context(), budgetID)
+	if err != nil {
+		utils.SafeWarn("⚠️  Error loading budget currency: %v", err)
+		currency = services.FXBaseCurrency
+	}
+	if err := h.FX.ConvertTransactions(c.Request.Context(), currency, transactions); err != nil {
+		utils.SafeWarn("⚠️  Transactions not converted: %v", err)
+	}
 
-		if err != nil {
-			utils.SafeWarn("⚠️  Error fetching transactions for %s: %v", accountName, err)
-			continue
-		}
+	c.JSON(http.StatusOK, gin.H{
+		"currency":     currency,
+		"transactions": transactions,
+		"total":        total,
+		"limit":        filter.Limit,
+		"offset":       filter.Offset,
+	})
+}
 
-		utils.SafeDebug("   ✅ Found %d transactions for %s", len(transactions), accountName)
-
-		for _, tx := range transactions {
-			// Convertir le montant
-			amount := 0.0
-			if parsed, err := strconv.ParseFloat(tx.TransactionAmount.Amount, 64); err == nil {
-				amount = parsed
-				// Si c'est un débit, rendre le montant négatif
-				if tx.CreditDebitIndicator == "DBIT" {
-					amount = -amount
-				}
-			}
+// SyncTransactions importe les nouvelles transactions des comptes que
+// l'utilisateur a connectés au budget via le fournisseur actif (les comptes
+// importés depuis un relevé n'ont rien à synchroniser).
+// POST /budgets/:id/banking/transactions/sync
+func (h *EnableBankingHandler) SyncTransactions(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := middleware.GetUserID(c)
 
-			// Construire la description
-			description := ""
-			if len(tx.RemittanceInformation) > 0 {
-				description = tx.RemittanceInformation[0]
-			}
-			if description == "" && tx.Creditor != nil {
-				description = tx.Creditor.Name
-			}
-			if description == "" && tx.Debtor != nil {
-				description = tx.Debtor.Name
-			}
-			if description == "" {
-				description = "Transaction"
-			}
+	utils.LogBudgetAction("SyncTransactions", budgetID, userID)
 
-			// Utiliser la date de réservation ou la date de valeur
-			date := tx.BookingDate
-			if date == "" {
-				date = tx.ValueDate
-			}
-			if date == "" {
-				date = tx.TransactionDate
-			}
+	rows, err := h.DB.QueryContext(c.Request.Context(), `
+		SELECT ba.id, ba.account_id, COALESCE(ba.account_name, '')
+		FROM banking_accounts ba
+		JOIN banking_connections bc ON ba.connection_id = bc.id
+		WHERE bc.budget_id = $1 AND bc.user_id = $2 AND bc.provider = $3
+	`, budgetID, userID, h.Provider.Name())
+	if err != nil {
+		utils.SafeError("❌ Failed to fetch accounts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+		return
+	}
 
-			allTransactions = append(allTransactions, TransactionDisplay{
-				ID:          fmt.Sprintf("eb-%d", transactionID),
-				AccountID:   accountID,
-				AccountName: accountName,
-				Amount:      amount,
-				Currency:    tx.TransactionAmount.Currency,
-				Description: description,
-				Date:        date,
-				Type:        tx.CreditDebitIndicator,
-			})
-			transactionID++
+	type account struct{ id, uid, name string }
+	var accounts []account
+	for rows.Next() {
+		var a account
+		if err := rows.Scan(&a.id, &a.uid, &a.name); err == nil {
+			accounts = append(accounts, a)
 		}
 	}
+	rows.Close()
 
-	// ✅ LOGGING SÉCURISÉ - Ne pas révéler le nombre exact de transactions
-	utils.SafeInfo("✅ Transactions retrieved successfully")
+	imported := 0
+	failures := []string{}
+	for _, a := range accounts {
+		n, err := h.Transactions.SyncAccountTransactions(c.Request.Context(), h.Provider, a.id, a.uid)
+		if err != nil {
+			utils.SafeWarn("⚠️  Transaction sync failed for %s: %v", a.name, err)
+			failures = append(failures, a.name)
+			continue
+		}
+		imported += n
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"transactions": allTransactions,
-		"total":        len(allTransactions),
-	})
+	response := gin.H{
+		"message":               "Transactions synchronized",
+		"accounts":              len(accounts),
+		"transactions_imported": imported,
+	}
+	if len(failures) > 0 {
+		response["failed_accounts"] = failures
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // ============================================================================
@@ -706,52 +816,24 @@ func (h *EnableBankingHandler) DeleteConnection(c *gin.Context) {
 	// ✅ LOGGING SÉCURISÉ
 	utils.LogBankingAction("DeleteConnection", connectionID, userID)
 
-	// Récupérer le session ID avant de supprimer
-	var sessionID string
-	err := h.DB.QueryRow(`
-		SELECT session_id 
-		FROM banking_connections 
-		WHERE id = $1 AND user_id = $2
-	`, connectionID, userID).Scan(&sessionID)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			utils.SafeWarn("❌ Connection not found or unauthorized")
-			c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
-		} else {
-			utils.SafeError("❌ Database error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		}
+	// Révoquer la session chez le fournisseur avant de supprimer
+	err := h.Service.RevokeProviderSession(c.Request.Context(), h.Provider, connectionID, userID)
+	if errors.Is(err, services.ErrBankConnectionNotFound) {
+		utils.SafeWarn("❌ Connection not found or unauthorized")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
 		return
 	}
-
-	// Supprimer la session Enable Banking
-	if sessionID != "" {
-		if err := h.EnableBankingService.DeleteSession(c.Request.Context(), sessionID); err != nil {
-			utils.SafeWarn("⚠️  Failed to delete Enable Banking session: %v", err)
-			// Continue quand même avec la suppression locale
-		}
-	}
-
-	// Supprimer les comptes associés
-	_, err = h.DB.Exec(`
-		DELETE FROM banking_accounts 
-		WHERE connection_id = $1
-	`, connectionID)
-
 	if err != nil {
-		utils.SafeError("❌ Failed to delete accounts: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete accounts"})
-		return
+		utils.SafeWarn("⚠️  Failed to delete provider session: %v", err)
+		// Continue quand même avec la suppression locale
 	}
 
-	// Supprimer la connexion
-	_, err = h.DB.Exec(`
-		DELETE FROM banking_connections 
-		WHERE id = $1 AND user_id = $2
-	`, connectionID, userID)
-
-	if err != nil {
+	// Supprimer la connexion et ses comptes
+	if err := h.Service.DeleteConnection(c.Request.Context(), connectionID, userID); err != nil {
+		if errors.Is(err, services.ErrBankConnectionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+			return
+		}
 		utils.SafeError("❌ Failed to delete connection: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete connection"})
 		return
@@ -770,4 +852,55 @@ func min(a, b int) int {
 		return a
 	}
 	return b
-}
\ No newline at end of file
+}
+
+// ============================================================================
+// 9. RECONNECT - Renouveler le consentement d'une connexion
+// ============================================================================
+// Même ASPSP, nouvelle autorisation. Au retour, le front enchaîne callback →
+// SyncAccounts comme pour une première connexion : la connexion existante est
+// mise à jour (nouvelle session, nouveau valid_until, status active) et les
+// comptes sont rattachés via leur identification_hash, historique compris.
+
+func (h *EnableBankingHandler) ReconnectConnection(c *gin.Context) {
+	budgetID := c.Param("id")
+	connectionID := c.Param("connection_id")
+	userID := middleware.GetUserID(c)
+
+	utils.LogBankingAction("ReconnectConnection", connectionID, userID)
+
+	var aspspName, aspspCountry, status string
+	err := h.DB.QueryRowContext(c.Request.Context(), `
+		SELECT aspsp_name, aspsp_country, COALESCE(status, 'active')
+		FROM banking_connections
+		WHERE id = $1 AND budget_id = $2 AND user_id = $3
+	`, connectionID, budgetID, userID).Scan(&aspspName, &aspspCountry, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+		return
+	}
+	if err != nil {
+		utils.SafeError("❌ Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	authResp, state, err := h.startAuthorization(c, budgetID, aspspName, aspspCountry)
+	if err != nil {
+		utils.SafeError("❌ Failed to create auth request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to reconnect",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	utils.SafeInfo("✅ Reconnection URL created (previous status: %s)", status)
+
+	c.JSON(http.StatusOK, gin.H{
+		"redirect_url":     authResp.URL,
+		"state":            state,
+		"authorization_id": authResp.AuthorizationID,
+		"connection_id":    connectionID,
+	})
+}
@@ -9,11 +9,13 @@ import (
 	"github.com/google/uuid"
 	"github.com/LovationAdmin/budget-api/middleware"
 	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/services"
 	"github.com/LovationAdmin/budget-api/utils"
 )
 
 type InvitationHandler struct {
 	DB *sql.DB
+	WS *WSHandler // optionnel : ferme les WebSockets d'un membre retiré
 }
 
 // InviteUser sends an invitation to join a budget
@@ -256,7 +258,7 @@ func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
 	// Add user to budget
 	_, err = h.DB.Exec(`
 		INSERT INTO budget_members (budget_id, user_id, role, permissions)
-		VALUES ($1, $2, 'member', '{"read": true, "write": true}')
+		VALUES ($1, $2, 'editor', '{"read": true, "write": true}')
 	`, inv.BudgetID, userID)
 
 	if err != nil {
@@ -324,6 +326,13 @@ func (h *InvitationHandler) CancelInvitation(c *gin.Context) {
 		return
 	}
 
+	if h.WS != nil {
+		h.WS.PublishEvent(services.NewBudgetEvent(budgetID, services.EventInvitationCancelled,
+			&services.EventActor{ID: userID},
+			map[string]interface{}{"invitation_id": invitationID},
+		), userID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Invitation cancelled successfully"})
 }
 
@@ -333,21 +342,20 @@ func (h *InvitationHandler) RemoveMember(c *gin.Context) {
 	budgetID := c.Param("id")
 	memberID := c.Param("member_id")
 
-	// Check if user is owner
+	// Permission "manage_members" vérifiée par middleware.RequireBudgetPermission.
+	// Can't remove owner (quel que soit l'appelant)
 	var isOwner bool
 	err := h.DB.QueryRow(`
 		SELECT owner_id = $1
 		FROM budgets
 		WHERE id = $2
-	`, userID, budgetID).Scan(&isOwner)
+	`, memberID, budgetID).Scan(&isOwner)
 
-	if err != nil || !isOwner {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can remove members"})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
 		return
 	}
-
-	// Can't remove owner
-	if memberID == userID {
+	if isOwner {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Owner cannot be removed"})
 		return
 	}
@@ -369,5 +377,13 @@ func (h *InvitationHandler) RemoveMember(c *gin.Context) {
 		return
 	}
 
+	if h.WS != nil {
+		h.WS.PublishEvent(services.NewBudgetEvent(budgetID, services.EventMemberRemoved,
+			&services.EventActor{ID: userID},
+			map[string]interface{}{"user_id": memberID},
+		), userID)
+		h.WS.DisconnectMember(budgetID, memberID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
 }
\ No newline at end of file
@@ -442,9 +442,9 @@ func (h *MarketSuggestionsHandler) BulkAnalyzeCharges(c *gin.Context) {
 
 		// 4. Notify Frontend via WebSocket
 		if h.WS != nil {
-			responsePayload := map[string]interface{}{
-				"type": "suggestions_ready",
-				"data": map[string]interface{}{
+			event := services.NewBudgetEvent(budgetID, services.EventSuggestionsReady,
+				&services.EventActor{ID: userID},
+				map[string]interface{}{
 					"suggestions":             suggestions,
 					"total_potential_savings": totalSavings,
 					"household_size":          householdSize,
@@ -452,9 +452,9 @@ func (h *MarketSuggestionsHandler) BulkAnalyzeCharges(c *gin.Context) {
 					"ai_calls_made":           aiCallsMade,
 					"currency":                currency,
 				},
-			}
+			)
 
-			h.WS.BroadcastJSON(budgetID, responsePayload)
+			h.WS.PublishEvent(event, "")
 		}
 	}()
 }
@@ -0,0 +1,306 @@
+// handlers/passkeys.go
+// ============================================================================
+// PASSKEYS (WebAuthn) — voir services/passkeys.go
+// ============================================================================
+// Gestion (authentifié) :
+//   GET    /user/passkeys                      liste
+//   POST   /user/passkeys/register/begin       {name} → {session_id, options}
+//   POST   /user/passkeys/register/finish      {session_id, credential}
+//   PATCH  /user/passkeys/:passkey_id          {name}
+//   DELETE /user/passkeys/:passkey_id
+//   POST   /user/step-up/passkey               → {session_id, options}, à
+//                                              renvoyer dans X-Passkey-Session
+//                                              (voir middleware/second_factor.go)
+//
+// Connexion (public) :
+//   POST /auth/passkey/login/begin             → {session_id, options}
+//   POST /auth/passkey/login/finish            {session_id, credential}
+//   POST /auth/passkey/verify                  {session_id, credential}, second
+//                                              facteur après le mot de passe
+//
+// options se passe tel quel à navigator.credentials.create() / .get() ;
+// credential est le PublicKeyCredential obtenu, sérialisé en JSON.
+// ============================================================================
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/middleware"
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+type passkeyFinishRequest struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type passkeyNameRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// passkeyError traduit les erreurs du service ; renvoie false si err est nil.
+func passkeyError(c *gin.Context, err error, fallback string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrPasskeysUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Passkeys are not available"})
+	case errors.Is(err, services.ErrInvalidPasskeyName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPasskeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+	case errors.Is(err, services.ErrNoPasskeys):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No passkey registered"})
+	case errors.Is(err, services.ErrPasskeyChallenge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey challenge expired, please try again"})
+	case errors.Is(err, services.ErrPasskeyVerification):
+		utils.SafeWarn("Passkey verification failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+	default:
+		utils.SafeError("%s: %v", fallback, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+	return true
+}
+
+// ============================================================================
+// GESTION DES PASSKEYS
+// ============================================================================
+
+func (h *UserHandler) ListPasskeys(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	passkeys, err := h.Passkeys.List(c.Request.Context(), userID)
+	if passkeyError(c, err, "Failed to list passkeys") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"passkeys": passkeys})
+}
+
+func (h *UserHandler) BeginPasskeyRegistration(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req passkeyNameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	options, sessionID, err := h.Passkeys.BeginRegistration(c.Request.Context(), userID, req.Name)
+	if passkeyError(c, err, "Failed to start passkey registration") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+func (h *UserHandler) FinishPasskeyRegistration(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req passkeyFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passkey, err := h.Passkeys.FinishRegistration(c.Request.Context(), userID, req.SessionID, req.Credential)
+	if passkeyError(c, err, "Failed to register passkey") {
+		return
+	}
+
+	utils.SafeInfo("✅ Passkey added for user %s", userID)
+
+	c.JSON(http.StatusCreated, gin.H{"passkey": passkey})
+}
+
+func (h *UserHandler) RenamePasskey(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req passkeyNameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.Passkeys.Rename(c.Request.Context(), userID, c.Param("passkey_id"), req.Name)
+	if passkeyError(c, err, "Failed to rename passkey") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey renamed"})
+}
+
+func (h *UserHandler) DeletePasskey(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	err := h.Passkeys.Delete(c.Request.Context(), userID, c.Param("passkey_id"))
+	if passkeyError(c, err, "Failed to delete passkey") {
+		return
+	}
+
+	utils.SafeInfo("✅ Passkey revoked for user %s", userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted"})
+}
+
+// BeginPasskeyStepUp ouvre la confirmation d'une action sensible par passkey,
+// à la place d'un code 2FA ou du mot de passe.
+func (h *UserHandler) BeginPasskeyStepUp(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	options, sessionID, err := h.Passkeys.BeginStepUp(c.Request.Context(), userID)
+	if passkeyError(c, err, "Failed to start passkey confirmation") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// ============================================================================
+// CONNEXION PAR PASSKEY
+// ============================================================================
+
+// BeginPasskeyLogin ouvre une connexion sans mot de passe.
+func (h *AuthHandler) BeginPasskeyLogin(c *gin.Context) {
+	options, sessionID, err := h.Passkeys.BeginLogin(c.Request.Context())
+	if passkeyError(c, err, "Failed to start passkey login") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// FinishPasskeyLogin connecte l'utilisateur de la passkey. La vérification
+// sur l'appareil (PIN, biométrie) tient lieu de second facteur.
+func (h *AuthHandler) FinishPasskeyLogin(c *gin.Context) {
+	var req passkeyFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := h.Passkeys.FinishLogin(c.Request.Context(), req.SessionID, req.Credential)
+	if passkeyError(c, err, "Login failed") {
+		return
+	}
+	h.completePasskeyLogin(c, "Login-Passkey", userID)
+}
+
+// VerifyPasskeySecondFactor termine un login par mot de passe dont la 2FA
+// est faite avec une passkey (challenge renvoyé par Login dans "passkey").
+func (h *AuthHandler) VerifyPasskeySecondFactor(c *gin.Context) {
+	var req passkeyFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := h.Passkeys.FinishSecondFactor(c.Request.Context(), req.SessionID, req.Credential)
+	if passkeyError(c, err, "Login failed") {
+		return
+	}
+	h.completePasskeyLogin(c, "Login-2FA-Passkey", userID)
+}
+
+func (h *AuthHandler) completePasskeyLogin(c *gin.Context, action, userID string) {
+	user, err := h.loadLoginUser(c.Request.Context(), userID)
+	if err != nil {
+		utils.SafeError("Failed to load user after passkey login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	if !user.EmailVerified {
+		utils.LogAuthAction(action+"-Unverified", user.Email, false)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":              "Email not verified",
+			"email_not_verified": true,
+		})
+		return
+	}
+
+	h.completeLogin(c, action, user, nil)
+}
+
+func (h *AuthHandler) loadLoginUser(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	err := h.DB.QueryRowContext(ctx, `
+		SELECT id, email, name, COALESCE(avatar, ''), COALESCE(totp_enabled, FALSE),
+		       COALESCE(email_verified, FALSE), created_at, updated_at
+		FROM users WHERE id = $1
+	`, userID).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Avatar, &user.TOTPEnabled,
+		&user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// passkeySecondFactor prépare le challenge passkey proposé par Login quand
+// la 2FA est requise ; nil si l'utilisateur n'a pas de passkey.
+func (h *AuthHandler) passkeySecondFactor(c *gin.Context, userID string) gin.H {
+	if h.Passkeys == nil {
+		return nil
+	}
+	options, sessionID, err := h.Passkeys.BeginSecondFactor(c.Request.Context(), userID)
+	if errors.Is(err, services.ErrNoPasskeys) || errors.Is(err, services.ErrPasskeysUnavailable) {
+		return nil
+	}
+	if err != nil {
+		utils.SafeWarn("Failed to start passkey second factor: %v", err)
+		return nil
+	}
+	return gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	}
+}
@@ -5,6 +5,7 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -19,6 +20,8 @@ import (
 type UserHandler struct {
 	DB            *sql.DB
 	RefreshTokens *services.RefreshTokenService
+	SecondFactor  *services.SecondFactorService
+	Passkeys      *services.PasskeyService
 }
 
 // ============================================================================
@@ -247,29 +250,16 @@ func (h *UserHandler) VerifyTOTP(c *gin.Context) {
 		return
 	}
 
-	var secret sql.NullString
-	err := h.DB.QueryRow(`
-		SELECT totp_secret FROM users WHERE id = $1
-	`, userID).Scan(&secret)
-
-	if err != nil || !secret.Valid {
+	// Active la 2FA et génère les codes de récupération (affichés une fois)
+	codes, err := h.SecondFactor.Enable(c.Request.Context(), userID, req.Code)
+	if errors.Is(err, services.ErrTOTPNotSetUp) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "TOTP not set up"})
 		return
 	}
-
-	// ✅ CORRIGÉ : utils.VerifyTOTP retourne (bool, error)
-	valid, err := utils.VerifyTOTP(secret.String, req.Code)
-	if err != nil || !valid {
+	if errors.Is(err, services.ErrInvalidSecondFactor) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid TOTP code"})
 		return
 	}
-
-	_, err = h.DB.Exec(`
-		UPDATE users
-		SET totp_enabled = TRUE, updated_at = NOW()
-		WHERE id = $1
-	`, userID)
-
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable 2FA"})
 		return
@@ -278,8 +268,9 @@ func (h *UserHandler) VerifyTOTP(c *gin.Context) {
 	log.Printf("✅ 2FA enabled for user %s", userID)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "2FA enabled successfully",
-		"enabled": true,
+		"message":        "2FA enabled successfully",
+		"enabled":        true,
+		"recovery_codes": codes,
 	})
 }
 
@@ -302,10 +293,9 @@ func (h *UserHandler) DisableTOTP(c *gin.Context) {
 	}
 
 	var passwordHash string
-	var secret sql.NullString
 	err := h.DB.QueryRow(`
-		SELECT password_hash, totp_secret FROM users WHERE id = $1
-	`, userID).Scan(&passwordHash, &secret)
+		SELECT password_hash FROM users WHERE id = $1
+	`, userID).Scan(&passwordHash)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify credentials"})
@@ -317,21 +307,21 @@ func (h *UserHandler) DisableTOTP(c *gin.Context) {
 		return
 	}
 
-	if secret.Valid {
-		valid, err := utils.VerifyTOTP(secret.String, req.Code)
-		if err != nil || !valid {
+	// Code TOTP frais ou code de récupération (téléphone perdu)
+	if _, err := h.SecondFactor.Verify(c.Request.Context(), userID, req.Code); err != nil {
+		if errors.Is(err, services.ErrSecondFactorLocked) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid 2FA codes, please try again later"})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidSecondFactor) || errors.Is(err, services.ErrSecondFactorRequired) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid 2FA code"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify credentials"})
+		return
 	}
 
-	_, err = h.DB.Exec(`
-		UPDATE users
-		SET totp_enabled = FALSE, totp_secret = NULL, updated_at = NOW()
-		WHERE id = $1
-	`, userID)
-
-	if err != nil {
+	if err := h.SecondFactor.Disable(c.Request.Context(), userID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable 2FA"})
 		return
 	}
@@ -344,6 +334,46 @@ func (h *UserHandler) DisableTOTP(c *gin.Context) {
 	})
 }
 
+// GetRecoveryCodes renvoie le nombre de codes de récupération restants.
+func (h *UserHandler) GetRecoveryCodes(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	remaining, err := h.SecondFactor.RemainingRecoveryCodes(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"remaining": remaining})
+}
+
+// RegenerateRecoveryCodes remplace les codes de récupération (step-up requis).
+func (h *UserHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	codes, err := h.SecondFactor.RegenerateRecoveryCodes(c.Request.Context(), userID)
+	if errors.Is(err, services.ErrTOTPNotEnabled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2FA is not enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	log.Printf("✅ Recovery codes regenerated for user %s", userID)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
 // ============================================================================
 // ACCOUNT DELETION
 // ============================================================================
@@ -380,6 +410,14 @@ func (h *UserHandler) DeleteAccount(c *gin.Context) {
 		return
 	}
 
+	// Révoque les sessions avant la suppression : coupe aussi les WebSockets
+	// ouverts via le hook OnRevokeAll.
+	if h.RefreshTokens != nil {
+		if _, err := h.RefreshTokens.RevokeAllForUser(c.Request.Context(), userID); err != nil {
+			log.Printf("⚠️ Failed to revoke refresh tokens before account deletion: %v", err)
+		}
+	}
+
 	_, err = h.DB.Exec(`DELETE FROM users WHERE id = $1`, userID)
 
 	if err != nil {
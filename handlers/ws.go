@@ -8,12 +8,19 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/LovationAdmin/budget-api/services"
 	"github.com/LovationAdmin/budget-api/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -30,42 +37,85 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return utils.IsAllowedOrigin(r.Header.Get("Origin"))
 	},
+	// Le client peut s'authentifier via "Sec-WebSocket-Protocol: bearer, <jwt>" ;
+	// on doit alors renvoyer le sous-protocole "bearer" sinon le navigateur
+	// coupe la connexion.
+	Subprotocols: []string{wsBearerProtocol},
 }
 
-type WSSession struct {
-	Conn     *websocket.Conn
-	BudgetID string
-	UserID   string
-}
+const wsBearerProtocol = "bearer"
+
+// Codes de fermeture applicatifs (plage 4000-4999 réservée aux applications)
+const (
+	wsCloseSessionRevoked    = 4001 // logout-all, changement de mot de passe, reuse détecté
+	wsCloseMembershipRevoked = 4003 // membre retiré du budget
+	wsCloseSlowConsumer      = 4008 // buffer d'envoi plein, le client doit se reconnecter
+)
 
 type WSHandler struct {
-	sessions map[string]*WSSession // key = conn pointer address
+	db       *sql.DB
+	backend  services.BroadcastBackend             // nil = mono-instance
+	sessions map[string]*WSSession                 // key = WSSession.ID
+	remote   map[string]map[string]*remoteInstance // budget → instance d'origine
+	replay   *replayBuffer                         // événements durables récents
 	mu       sync.RWMutex
+
+	presenceMu sync.Mutex // ordonne les annonces de présence (voir ws_presence.go)
 }
 
 // ============================================================================
 // CONSTRUCTOR
 // ============================================================================
 
-func NewWSHandler() *WSHandler {
-	return &WSHandler{
+func NewWSHandler(db *sql.DB) *WSHandler {
+	h := &WSHandler{
+		db:       db,
 		sessions: make(map[string]*WSSession),
+		remote:   make(map[string]map[string]*remoteInstance),
+		replay:   newReplayBuffer(),
 	}
+	go h.sweepReplayLoop()
+	return h
 }
 
 // ============================================================================
 // WEBSOCKET CONNECTION HANDLER
 // ============================================================================
 
+// HandleWS authentifie l'upgrade AVANT de l'accepter : la route est hors
+// AuthMiddleware (un navigateur ne peut pas envoyer de header Authorization
+// sur un WebSocket), l'identité vient donc d'un ticket ou du sous-protocole.
 func (h *WSHandler) HandleWS(c *gin.Context) {
 	budgetID := c.Param("id")
-	userID := c.Query("user_id")
 
 	if budgetID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Budget ID required"})
 		return
 	}
 
+	userID, err := h.authenticateWS(c, budgetID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing WebSocket credentials"})
+		return
+	}
+
+	isMember, err := h.isMember(c.Request.Context(), budgetID, userID)
+	if err != nil {
+		utils.SafeError("WebSocket membership check failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify budget access"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this budget"})
+		return
+	}
+
+	var userName string
+	if err := h.db.QueryRowContext(c.Request.Context(),
+		"SELECT name FROM users WHERE id = $1", userID).Scan(&userName); err != nil {
+		userName = "Un membre" // Fallback
+	}
+
 	// ✅ LOGGING SÉCURISÉ
 	utils.LogWebSocket("Connect", budgetID, userID)
 
@@ -77,39 +127,118 @@ func (h *WSHandler) HandleWS(c *gin.Context) {
 	}
 
 	// Create session
-	sessionKey := conn.RemoteAddr().String()
-	session := &WSSession{
-		Conn:     conn,
-		BudgetID: budgetID,
-		UserID:   userID,
-	}
+	session := newWSSession(uuid.New().String(), conn, budgetID, userID, userName)
 
-	// Register session
-	h.mu.Lock()
-	h.sessions[sessionKey] = session
-	h.mu.Unlock()
+	// Register session (+ rattrapage si le client reprend après une coupure)
+	// et annonce de présence
+	h.openSession(session, c.Query("last_event_id"))
 
 	utils.SafeInfo("WebSocket client connected (budget sessions: %d)", h.countBudgetSessions(budgetID))
 
+	go session.writePump()
+
 	// Handle messages
-	go h.handleMessages(sessionKey, session)
+	go h.handleMessages(session)
+}
+
+// IssueTicket émet un ticket d'upgrade court pour un budget dont l'appelant
+// est membre. Route protégée : POST /budgets/:id/ws-ticket
+func (h *WSHandler) IssueTicket(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	isMember, err := h.isMember(c.Request.Context(), budgetID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify budget access"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+
+	ticket, expiresAt, err := utils.GenerateWSTicket(userID, budgetID)
+	if err != nil {
+		utils.SafeError("Failed to issue WebSocket ticket: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue ticket"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"expires_at": expiresAt,
+	})
+}
+
+// authenticateWS résout l'utilisateur de l'upgrade, par ordre de préférence :
+//  1. ?ticket=<ticket> émis par IssueTicket (lié au budget, usage unique)
+//  2. Sec-WebSocket-Protocol: bearer, <access token>
+func (h *WSHandler) authenticateWS(c *gin.Context, budgetID string) (string, error) {
+	if ticket := c.Query("ticket"); ticket != "" {
+		claims, err := utils.ValidateWSTicket(ticket)
+		if err != nil {
+			return "", err
+		}
+		if claims.BudgetID != budgetID {
+			return "", errWSBudgetMismatch
+		}
+		if h.db == nil {
+			return "", errors.New("websocket handler has no database")
+		}
+		if err := services.ConsumeWSTicket(c.Request.Context(), h.db, claims.ID, claims.ExpiresAt.Time); err != nil {
+			if !errors.Is(err, services.ErrWSTicketReused) {
+				utils.SafeError("Failed to record WebSocket ticket: %v", err)
+			}
+			return "", err
+		}
+		return claims.UserID, nil
+	}
+
+	protocols := websocket.Subprotocols(c.Request)
+	for i, p := range protocols {
+		if strings.EqualFold(p, wsBearerProtocol) && i+1 < len(protocols) {
+			claims, err := utils.ValidateToken(protocols[i+1])
+			if err != nil {
+				return "", err
+			}
+			return claims.UserID, nil
+		}
+	}
+
+	return "", errWSNoCredentials
+}
+
+var (
+	errWSNoCredentials  = errors.New("no websocket credentials")
+	errWSBudgetMismatch = errors.New("ticket issued for another budget")
+)
+
+// isMember vérifie l'appartenance à budget_members.
+func (h *WSHandler) isMember(ctx context.Context, budgetID, userID string) (bool, error) {
+	if h.db == nil {
+		return false, errors.New("websocket handler has no database")
+	}
+	var exists bool
+	err := h.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM budget_members WHERE budget_id = $1 AND user_id = $2)
+	`, budgetID, userID).Scan(&exists)
+	return exists, err
 }
 
 // ============================================================================
 // MESSAGE HANDLING
 // ============================================================================
 
-func (h *WSHandler) handleMessages(sessionKey string, session *WSSession) {
+func (h *WSHandler) handleMessages(session *WSSession) {
 	defer func() {
 		// Cleanup on disconnect
-		h.mu.Lock()
-		delete(h.sessions, sessionKey)
-		h.mu.Unlock()
-
-		session.Conn.Close()
+		h.closeSession(session)
+		session.close(websocket.CloseNormalClosure, "")
 		utils.LogWebSocket("Disconnect", session.BudgetID, session.UserID)
 	}()
 
+	session.prepareRead()
+
 	for {
 		_, msg, err := session.Conn.ReadMessage()
 		if err != nil {
@@ -118,6 +247,8 @@ func (h *WSHandler) handleMessages(sessionKey string, session *WSSession) {
 			}
 			break
 		}
+		// Tout trafic client prouve que la connexion est vivante
+		session.Conn.SetReadDeadline(time.Now().Add(wsPongWait))
 
 		// Parse message
 		var data map[string]interface{}
@@ -125,11 +256,14 @@ func (h *WSHandler) handleMessages(sessionKey string, session *WSSession) {
 			continue
 		}
 
-		// Handle ping/pong for keepalive
-		if msgType, ok := data["type"].(string); ok {
-			if msgType == "ping" {
-				session.Conn.WriteJSON(map[string]string{"type": "pong"})
-			}
+		msgType, _ := data["type"].(string)
+		switch msgType {
+		case "ping":
+			// Ping applicatif historique du front ; le heartbeat serveur
+			// passe par les trames ping/pong du protocole.
+			session.enqueue([]byte(`{"type":"pong"}`))
+		case "editing":
+			h.handleEditing(session, data)
 		}
 	}
 }
@@ -137,93 +271,194 @@ func (h *WSHandler) handleMessages(sessionKey string, session *WSSession) {
 // ============================================================================
 // BROADCAST METHODS
 // ============================================================================
+// Chaque méthode publique construit un services.BroadcastMessage et passe par
+// publish : livraison locale immédiate, puis relais aux autres instances si un
+// backend est branché (voir services/broadcast_backend.go).
+
+// UseBackend branche un backend de fan-out multi-instance et commence à
+// livrer localement les messages des autres instances.
+func (h *WSHandler) UseBackend(backend services.BroadcastBackend) error {
+	err := backend.Start(func(msg services.BroadcastMessage) {
+		h.trackRemotePresence(msg)
+		h.deliver(msg)
+	})
+	if err != nil {
+		return err
+	}
+	h.backend = backend
+	go h.presenceHeartbeatLoop()
+	return nil
+}
 
-// BroadcastJSON envoie un message JSON à tous les clients d'un budget
-func (h *WSHandler) BroadcastJSON(budgetID string, payload interface{}) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+func (h *WSHandler) publish(msg services.BroadcastMessage) {
+	h.deliver(msg)
 
-	sentCount := 0
-	for _, session := range h.sessions {
-		if session.BudgetID == budgetID {
-			if err := session.Conn.WriteJSON(payload); err != nil {
-				utils.SafeWarn("Failed to send WebSocket message: %v", err)
-				continue
-			}
-			sentCount++
-		}
+	if h.backend == nil {
+		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.backend.Publish(ctx, msg); err != nil {
+		utils.SafeWarn("Failed to relay WebSocket message to other instances: %v", err)
+	}
+}
 
-	if sentCount > 0 {
-		utils.SafeInfo("Broadcast sent to %d clients", sentCount)
+// PublishEvent implémente Broadcaster : sérialise l'enveloppe et la diffuse
+// aux membres du budget (sauf excludeUserID), sur toutes les instances.
+func (h *WSHandler) PublishEvent(event services.BudgetEvent, excludeUserID string) {
+	h.publishEvent(event, excludeUserID, "")
+}
+
+func (h *WSHandler) publishEvent(event services.BudgetEvent, excludeUserID, onlyUserID string) {
+	raw, err := json.Marshal(event)
+	if err != nil {
+		utils.SafeWarn("Failed to encode WebSocket event: %v", err)
+		return
 	}
+	h.publish(services.BroadcastMessage{
+		Kind:          services.BroadcastKindJSON,
+		BudgetID:      event.BudgetID,
+		ExcludeUserID: excludeUserID,
+		OnlyUserID:    onlyUserID,
+		EventID:       event.ID,
+		Payload:       raw,
+	})
 }
 
-// BroadcastUpdate implémente l'interface Broadcaster requise par BudgetService
-func (h *WSHandler) BroadcastUpdate(budgetID string, updateType string, userWhoUpdated string) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+// controlEvent sérialise un événement de contrôle destiné à UNE session.
+func (h *WSHandler) controlEvent(budgetID, eventType string, payload interface{}) []byte {
+	raw, _ := json.Marshal(services.NewEphemeralEvent(budgetID, eventType, nil, payload))
+	return raw
+}
+
+// sessionWants applique les filtres destinataires d'un message.
+func sessionWants(session *WSSession, msg services.BroadcastMessage) bool {
+	if session.BudgetID != msg.BudgetID {
+		return false
+	}
+	if msg.ExcludeUserID != "" && session.UserID == msg.ExcludeUserID {
+		return false
+	}
+	if msg.OnlyUserID != "" && session.UserID != msg.OnlyUserID {
+		return false
+	}
+	return true
+}
+
+// deliver écrit un message sur les sessions LOCALES concernées.
+func (h *WSHandler) deliver(msg services.BroadcastMessage) {
+	switch msg.Kind {
+	case services.BroadcastKindDisconnectUser:
+		h.closeSessions(func(s *WSSession) bool {
+			return s.UserID == msg.UserID
+		}, wsCloseSessionRevoked, "session revoked")
+		return
+	case services.BroadcastKindDisconnectMember:
+		h.closeSessions(func(s *WSSession) bool {
+			return s.BudgetID == msg.BudgetID && s.UserID == msg.UserID
+		}, wsCloseMembershipRevoked, "membership revoked")
+		return
+	case services.BroadcastKindPresence:
+		// Instantané pour h.remote (trackRemotePresence), pas pour les clients
+		return
+	case services.BroadcastKindJSON:
+	default:
+		utils.SafeWarn("Unknown broadcast kind %q", msg.Kind)
+		return
+	}
 
-	payload := map[string]interface{}{
-		"type": updateType,
-		"user": userWhoUpdated,
+	h.mu.RLock()
+	// Sous h.mu : exclusif avec registerWithReplay (voir ws_replay.go)
+	if msg.EventID != "" {
+		h.replay.append(msg)
 	}
 
 	sentCount := 0
+	var overflowed []*WSSession
 	for _, session := range h.sessions {
-		if session.BudgetID == budgetID {
-			if err := session.Conn.WriteJSON(payload); err != nil {
-				utils.SafeWarn("Failed to send WebSocket message: %v", err)
-				continue
-			}
-			sentCount++
+		if !sessionWants(session, msg) {
+			continue
+		}
+		if !session.enqueue(msg.Payload) {
+			overflowed = append(overflowed, session)
+			continue
 		}
+		sentCount++
+	}
+	h.mu.RUnlock()
+
+	// Évincer hors du verrou : close() peut attendre jusqu'à 1s
+	for _, session := range overflowed {
+		session.close(wsCloseSlowConsumer, "send buffer full")
+	}
+	if len(overflowed) > 0 {
+		utils.SafeWarn("Evicted %d slow WebSocket clients", len(overflowed))
 	}
 
 	if sentCount > 0 {
-		utils.SafeInfo("Update broadcast sent to %d clients", sentCount)
+		utils.SafeInfo("Broadcast queued for %d clients", sentCount)
 	}
 }
 
+// BroadcastUpdate implémente l'interface Broadcaster requise par BudgetService
+func (h *WSHandler) BroadcastUpdate(budgetID string, updateType string, userWhoUpdated string) {
+	h.PublishEvent(services.NewBudgetEvent(budgetID, updateType,
+		&services.EventActor{Name: userWhoUpdated}, nil), "")
+}
+
 // BroadcastUpdateExcludingUser envoie un message à tous sauf l'utilisateur spécifié
 func (h *WSHandler) BroadcastUpdateExcludingUser(budgetID string, updateType string, userWhoUpdated string, userIDToExclude string) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	h.PublishEvent(services.NewBudgetEvent(budgetID, updateType,
+		&services.EventActor{Name: userWhoUpdated}, nil), userIDToExclude)
+}
 
-	payload := map[string]interface{}{
-		"type": updateType,
-		"user": userWhoUpdated,
-	}
+// BroadcastToUser envoie un événement à un utilisateur spécifique
+func (h *WSHandler) BroadcastToUser(userID string, event services.BudgetEvent) {
+	h.publishEvent(event, "", userID)
+}
 
-	sentCount := 0
-	for _, session := range h.sessions {
-		if session.BudgetID == budgetID && session.UserID != userIDToExclude {
-			if err := session.Conn.WriteJSON(payload); err != nil {
-				utils.SafeWarn("Failed to send WebSocket message: %v", err)
-				continue
-			}
-			sentCount++
-		}
-	}
+// ============================================================================
+// SESSION REVOCATION
+// ============================================================================
 
-	if sentCount > 0 {
-		utils.SafeInfo("Update broadcast to %d clients (excluding modifier)", sentCount)
-	}
+// DisconnectUser ferme toutes les sessions d'un utilisateur, tous budgets et
+// toutes instances confondus. Branché sur RefreshTokenService (logout-all,
+// mot de passe).
+func (h *WSHandler) DisconnectUser(userID string) {
+	h.publish(services.BroadcastMessage{
+		Kind:   services.BroadcastKindDisconnectUser,
+		UserID: userID,
+	})
 }
 
-// BroadcastToUser envoie un message à un utilisateur spécifique
-func (h *WSHandler) BroadcastToUser(budgetID string, userID string, payload interface{}) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+// DisconnectMember ferme les sessions d'un utilisateur retiré d'un budget.
+func (h *WSHandler) DisconnectMember(budgetID, userID string) {
+	h.publish(services.BroadcastMessage{
+		Kind:     services.BroadcastKindDisconnectMember,
+		BudgetID: budgetID,
+		UserID:   userID,
+	})
+}
 
+// closeSessions envoie une trame de fermeture puis coupe la connexion ; la
+// boucle de lecture de la session se charge ensuite du nettoyage.
+func (h *WSHandler) closeSessions(match func(*WSSession) bool, code int, reason string) {
+	h.mu.RLock()
+	var targets []*WSSession
 	for _, session := range h.sessions {
-		if session.BudgetID == budgetID && session.UserID == userID {
-			if err := session.Conn.WriteJSON(payload); err != nil {
-				utils.SafeWarn("Failed to send WebSocket message to user: %v", err)
-			}
-			return
+		if match(session) {
+			targets = append(targets, session)
 		}
 	}
+	h.mu.RUnlock()
+
+	for _, session := range targets {
+		session.close(code, reason)
+	}
+
+	if len(targets) > 0 {
+		utils.SafeInfo("Closed %d WebSocket sessions (%s)", len(targets), reason)
+	}
 }
 
 // ============================================================================
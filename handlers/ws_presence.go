@@ -0,0 +1,386 @@
+// handlers/ws_presence.go
+// ============================================================================
+// PRÉSENCE & INDICATEURS D'ÉDITION — au-dessus du WebSocket budget
+// ============================================================================
+// Événements éphémères (enveloppe services.BudgetEvent sans id) envoyés aux
+// AUTRES membres du budget, l'auteur étant dans "actor" :
+//   presence_join, presence_leave, editing (payload {"section": "..."})
+//
+// Message client : {"type":"editing","section":"months/Mars"} ; une section
+// vide (ou null) signifie "j'ai fini". La section est un identifiant libre
+// choisi par le front (mois, charge, projet...).
+//
+// GET /budgets/:id/presence renvoie l'état courant. En multi-instance, chaque
+// instance tient h.remote par instance d'origine :
+//   - les événements ci-dessus la mettent à jour au fil de l'eau ;
+//   - toutes les presenceHeartbeatInterval, chaque instance republie l'état
+//     complet de ses sessions, budget par budget (BroadcastKindPresence, non
+//     transmis aux clients) : une instance qui démarre l'apprend, et un
+//     événement perdu est corrigé ;
+//   - sans nouvelle d'une instance pendant presenceRemoteTTL (crash, coupure
+//     du listener), ses users sont oubliés.
+//
+// presenceMu ordonne comptage et annonce : deux onglets qui s'ouvrent ou se
+// ferment en même temps donnent un seul join / leave, dans le bon ordre.
+// ============================================================================
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+const maxEditingSectionLength = 100
+
+const (
+	presenceHeartbeatInterval = 30 * time.Second
+	presenceRemoteTTL         = 3 * presenceHeartbeatInterval
+)
+
+// PresenceEntry décrit un membre connecté à un budget.
+type PresenceEntry struct {
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	Editing     string `json:"editing,omitempty"`
+	Connections int    `json:"connections"`
+}
+
+// presenceEvent est la partie d'une enveloppe utile au suivi de présence
+// des autres instances.
+type presenceEvent struct {
+	Type    string               `json:"type"`
+	Actor   *services.EventActor `json:"actor"`
+	Payload struct {
+		Section *string `json:"section"`
+	} `json:"payload"`
+}
+
+// remotePresence est la vue, depuis cette instance, d'un user connecté
+// ailleurs.
+type remotePresence struct {
+	UserName string `json:"user_name"`
+	Sessions int    `json:"sessions"`
+	Editing  string `json:"editing,omitempty"`
+}
+
+// remoteInstance : users d'un budget connectés à une autre instance, valable
+// jusqu'à expiresAt.
+type remoteInstance struct {
+	users     map[string]*remotePresence
+	expiresAt time.Time
+}
+
+// GetPresence renvoie les membres connectés et ce qu'ils éditent.
+// Route protégée : GET /budgets/:id/presence
+func (h *WSHandler) GetPresence(c *gin.Context) {
+	budgetID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	isMember, err := h.isMember(c.Request.Context(), budgetID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify budget access"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": h.presence(budgetID)})
+}
+
+// presence fusionne sessions locales et présence relayée par les autres
+// instances, un élément par utilisateur.
+func (h *WSHandler) presence(budgetID string) []PresenceEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	byUser := make(map[string]*PresenceEntry)
+	for _, session := range h.sessions {
+		if session.BudgetID != budgetID || session.UserID == "" {
+			continue
+		}
+		entry, ok := byUser[session.UserID]
+		if !ok {
+			entry = &PresenceEntry{UserID: session.UserID, UserName: session.UserName}
+			byUser[session.UserID] = entry
+		}
+		entry.Connections++
+		if session.Editing != "" {
+			entry.Editing = session.Editing
+		}
+	}
+
+	now := time.Now()
+	for _, instance := range h.remote[budgetID] {
+		if now.After(instance.expiresAt) {
+			continue
+		}
+		for userID, remote := range instance.users {
+			entry, ok := byUser[userID]
+			if !ok {
+				entry = &PresenceEntry{UserID: userID, UserName: remote.UserName}
+				byUser[userID] = entry
+			}
+			entry.Connections += remote.Sessions
+			if entry.Editing == "" {
+				entry.Editing = remote.Editing
+			}
+		}
+	}
+
+	users := make([]PresenceEntry, 0, len(byUser))
+	for _, entry := range byUser {
+		users = append(users, *entry)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserName < users[j].UserName })
+	return users
+}
+
+// announcePresence diffuse un événement de présence aux autres membres.
+// Appelée sous presenceMu.
+func (h *WSHandler) announcePresence(session *WSSession, eventType string, section *string) {
+	var payload interface{}
+	if section != nil {
+		payload = map[string]string{"section": *section}
+	}
+	h.PublishEvent(services.NewEphemeralEvent(session.BudgetID, eventType,
+		&services.EventActor{ID: session.UserID, Name: session.UserName}, payload), session.UserID)
+}
+
+// openSession enregistre la session (avec rattrapage) et annonce l'arrivée
+// du user s'il n'avait pas déjà une session locale sur ce budget (plusieurs
+// onglets = une seule présence).
+func (h *WSHandler) openSession(session *WSSession, lastEventID string) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	if h.registerWithReplay(session, lastEventID) == 1 {
+		h.announcePresence(session, services.EventPresenceJoin, nil)
+	}
+}
+
+// closeSession retire la session et annonce le départ quand la dernière
+// session locale du user tombe, ou libère la section si cet onglet était en
+// train d'éditer.
+func (h *WSHandler) closeSession(session *WSSession) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	h.mu.Lock()
+	delete(h.sessions, session.ID)
+	remaining := h.userSessionCountLocked(session.BudgetID, session.UserID)
+	editing := session.Editing
+	h.mu.Unlock()
+
+	switch {
+	case remaining == 0:
+		h.announcePresence(session, services.EventPresenceLeave, nil)
+	case editing != "":
+		empty := ""
+		h.announcePresence(session, services.EventEditing, &empty)
+	}
+}
+
+// handleEditing enregistre la section éditée par la session et la relaie.
+func (h *WSHandler) handleEditing(session *WSSession, data map[string]interface{}) {
+	section, _ := data["section"].(string)
+	if len(section) > maxEditingSectionLength {
+		return
+	}
+
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	h.mu.Lock()
+	changed := session.Editing != section
+	session.Editing = section
+	h.mu.Unlock()
+
+	if changed {
+		h.announcePresence(session, services.EventEditing, &section)
+	}
+}
+
+// userSessionCountLocked compte les sessions locales d'un user sur un
+// budget ; appelée sous h.mu.
+func (h *WSHandler) userSessionCountLocked(budgetID, userID string) int {
+	count := 0
+	for _, session := range h.sessions {
+		if session.BudgetID == budgetID && session.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+// ============================================================================
+// PRÉSENCE DES AUTRES INSTANCES
+// ============================================================================
+
+// presenceHeartbeatLoop republie la présence locale et oublie les instances
+// muettes. Lancée par UseBackend.
+func (h *WSHandler) presenceHeartbeatLoop() {
+	ticker := time.NewTicker(presenceHeartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.publishPresenceSnapshots()
+		h.sweepRemotePresence(time.Now())
+	}
+}
+
+// localPresence regroupe les sessions locales par budget puis par user.
+func (h *WSHandler) localPresence() map[string]map[string]*remotePresence {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	budgets := make(map[string]map[string]*remotePresence)
+	for _, session := range h.sessions {
+		if session.UserID == "" {
+			continue
+		}
+		users := budgets[session.BudgetID]
+		if users == nil {
+			users = make(map[string]*remotePresence)
+			budgets[session.BudgetID] = users
+		}
+		p, ok := users[session.UserID]
+		if !ok {
+			p = &remotePresence{UserName: session.UserName}
+			users[session.UserID] = p
+		}
+		p.Sessions++
+		if session.Editing != "" {
+			p.Editing = session.Editing
+		}
+	}
+	return budgets
+}
+
+// publishPresenceSnapshots envoie aux autres instances l'état complet des
+// sessions locales, un message par budget. Sous presenceMu : un instantané
+// ne passe pas devant un événement plus récent.
+func (h *WSHandler) publishPresenceSnapshots() {
+	if h.backend == nil {
+		return
+	}
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	for budgetID, users := range h.localPresence() {
+		raw, err := json.Marshal(users)
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = h.backend.Publish(ctx, services.BroadcastMessage{
+			Kind:     services.BroadcastKindPresence,
+			BudgetID: budgetID,
+			Payload:  raw,
+		})
+		cancel()
+		if err != nil {
+			utils.SafeWarn("Failed to publish presence snapshot: %v", err)
+		}
+	}
+}
+
+// sweepRemotePresence oublie les instances expirées.
+func (h *WSHandler) sweepRemotePresence(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for budgetID, instances := range h.remote {
+		for origin, instance := range instances {
+			if now.After(instance.expiresAt) {
+				delete(instances, origin)
+			}
+		}
+		if len(instances) == 0 {
+			delete(h.remote, budgetID)
+		}
+	}
+}
+
+// remoteInstanceLocked renvoie (en la créant) la présence d'une instance
+// sur un budget et repousse son expiration ; appelée sous h.mu.
+func (h *WSHandler) remoteInstanceLocked(budgetID, origin string, now time.Time) *remoteInstance {
+	instances := h.remote[budgetID]
+	if instances == nil {
+		instances = make(map[string]*remoteInstance)
+		h.remote[budgetID] = instances
+	}
+	instance, ok := instances[origin]
+	if !ok || now.After(instance.expiresAt) {
+		instance = &remoteInstance{users: make(map[string]*remotePresence)}
+		instances[origin] = instance
+	}
+	instance.expiresAt = now.Add(presenceRemoteTTL)
+	return instance
+}
+
+// trackRemotePresence met à jour h.remote à partir des instantanés et des
+// événements de présence publiés par les autres instances. Les messages
+// locaux ne passent pas ici.
+func (h *WSHandler) trackRemotePresence(msg services.BroadcastMessage) {
+	now := time.Now()
+
+	switch msg.Kind {
+	case services.BroadcastKindPresence:
+		users := make(map[string]*remotePresence)
+		if err := json.Unmarshal(msg.Payload, &users); err != nil {
+			return
+		}
+		h.mu.Lock()
+		h.remoteInstanceLocked(msg.BudgetID, msg.Origin, now).users = users
+		h.mu.Unlock()
+		return
+	case services.BroadcastKindJSON:
+	default:
+		return
+	}
+
+	var event presenceEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil || event.Actor == nil || event.Actor.ID == "" {
+		return
+	}
+	switch event.Type {
+	case services.EventPresenceJoin, services.EventPresenceLeave, services.EventEditing:
+	default:
+		return
+	}
+	userID := event.Actor.ID
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	users := h.remoteInstanceLocked(msg.BudgetID, msg.Origin, now).users
+	switch event.Type {
+	case services.EventPresenceJoin:
+		if p, ok := users[userID]; ok {
+			p.Sessions++
+		} else {
+			users[userID] = &remotePresence{UserName: event.Actor.Name, Sessions: 1}
+		}
+	case services.EventPresenceLeave:
+		if p, ok := users[userID]; ok {
+			p.Sessions--
+			if p.Sessions <= 0 {
+				delete(users, userID)
+			}
+		}
+	case services.EventEditing:
+		if p, ok := users[userID]; ok && event.Payload.Section != nil {
+			p.Editing = *event.Payload.Section
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// handlers/ws_presence_test.go
+// ============================================================================
+// TESTS — présence WebSocket, locale et relayée par les autres instances
+// ============================================================================
+// Lancer : go test ./handlers -run Presence -race -v
+// ============================================================================
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/services"
+)
+
+// recordingBackend garde les messages publiés vers les autres instances.
+type recordingBackend struct {
+	mu       sync.Mutex
+	messages []services.BroadcastMessage
+}
+
+func (b *recordingBackend) Publish(_ context.Context, msg services.BroadcastMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, msg)
+	return nil
+}
+
+func (b *recordingBackend) Start(func(services.BroadcastMessage)) error { return nil }
+func (b *recordingBackend) Close() error                                { return nil }
+
+// eventTypes renvoie le type des événements publiés, dans l'ordre.
+func (b *recordingBackend) eventTypes(t *testing.T) []string {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var types []string
+	for _, msg := range b.messages {
+		if msg.Kind != services.BroadcastKindJSON {
+			types = append(types, msg.Kind)
+			continue
+		}
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func newPresenceHandler() (*WSHandler, *recordingBackend) {
+	h := NewWSHandler(nil)
+	backend := &recordingBackend{}
+	h.backend = backend
+	return h, backend
+}
+
+func testSession(id, budgetID, userID string) *WSSession {
+	return newWSSession(id, nil, budgetID, userID, "User "+userID)
+}
+
+// remoteEvent simule un événement de présence publié par une autre instance.
+func remoteEvent(t *testing.T, origin, budgetID, userID, eventType string, section *string) services.BroadcastMessage {
+	t.Helper()
+	var payload interface{}
+	if section != nil {
+		payload = map[string]string{"section": *section}
+	}
+	raw, err := json.Marshal(services.NewEphemeralEvent(budgetID, eventType,
+		&services.EventActor{ID: userID, Name: "User " + userID}, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return services.BroadcastMessage{Origin: origin, Kind: services.BroadcastKindJSON, BudgetID: budgetID, Payload: raw}
+}
+
+func TestPresenceOneJoinAndLeavePerUser(t *testing.T) {
+	h, backend := newPresenceHandler()
+
+	// Deux onglets ouverts puis fermés en même temps : un seul join, un seul
+	// leave, dans cet ordre
+	for round := 0; round < 20; round++ {
+		tabs := []*WSSession{
+			testSession(fmt.Sprintf("a%d", round), "b1", "u1"),
+			testSession(fmt.Sprintf("b%d", round), "b1", "u1"),
+		}
+		var wg sync.WaitGroup
+		for _, s := range tabs {
+			wg.Add(1)
+			go func(s *WSSession) {
+				defer wg.Done()
+				h.openSession(s, "")
+			}(s)
+		}
+		wg.Wait()
+		for _, s := range tabs {
+			wg.Add(1)
+			go func(s *WSSession) {
+				defer wg.Done()
+				h.closeSession(s)
+			}(s)
+		}
+		wg.Wait()
+	}
+
+	types := backend.eventTypes(t)
+	if len(types) != 40 {
+		t.Fatalf("published %d events, want 40: %v", len(types), types)
+	}
+	for i, typ := range types {
+		want := services.EventPresenceJoin
+		if i%2 == 1 {
+			want = services.EventPresenceLeave
+		}
+		if typ != want {
+			t.Fatalf("event %d = %q, want %q (%v)", i, typ, want, types)
+		}
+	}
+}
+
+func TestPresenceClosingEditingTab(t *testing.T) {
+	h, backend := newPresenceHandler()
+	first, second := testSession("s1", "b1", "u1"), testSession("s2", "b1", "u1")
+	h.openSession(first, "")
+	h.openSession(second, "")
+
+	h.handleEditing(second, map[string]interface{}{"section": "months/Mars"})
+	if got := h.presence("b1"); len(got) != 1 || got[0].Editing != "months/Mars" || got[0].Connections != 2 {
+		t.Fatalf("presence = %+v", got)
+	}
+
+	// L'onglet qui éditait se ferme, l'autre reste : la section est libérée
+	h.closeSession(second)
+	want := []string{services.EventPresenceJoin, services.EventEditing, services.EventEditing}
+	if got := backend.eventTypes(t); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if got := h.presence("b1"); len(got) != 1 || got[0].Editing != "" || got[0].Connections != 1 {
+		t.Errorf("presence after close = %+v", got)
+	}
+}
+
+func TestRemotePresenceEvents(t *testing.T) {
+	h, _ := newPresenceHandler()
+	section := "charges"
+
+	h.trackRemotePresence(remoteEvent(t, "instance-b", "b1", "u2", services.EventPresenceJoin, nil))
+	h.trackRemotePresence(remoteEvent(t, "instance-c", "b1", "u2", services.EventPresenceJoin, nil))
+	h.trackRemotePresence(remoteEvent(t, "instance-c", "b1", "u2", services.EventEditing, &section))
+
+	got := h.presence("b1")
+	if len(got) != 1 || got[0].Connections != 2 || got[0].Editing != "charges" {
+		t.Fatalf("presence = %+v", got)
+	}
+
+	// Départ d'une instance : l'autre session compte toujours
+	h.trackRemotePresence(remoteEvent(t, "instance-c", "b1", "u2", services.EventPresenceLeave, nil))
+	got = h.presence("b1")
+	if len(got) != 1 || got[0].Connections != 1 || got[0].Editing != "" {
+		t.Errorf("presence after leave = %+v", got)
+	}
+}
+
+func TestRemotePresenceSnapshotAndTTL(t *testing.T) {
+	h, _ := newPresenceHandler()
+
+	// Une instance démarrée après le join apprend la présence par l'instantané
+	raw, _ := json.Marshal(map[string]*remotePresence{
+		"u2": {UserName: "User u2", Sessions: 2, Editing: "projects"},
+	})
+	h.trackRemotePresence(services.BroadcastMessage{
+		Origin: "instance-b", Kind: services.BroadcastKindPresence, BudgetID: "b1", Payload: raw,
+	})
+	got := h.presence("b1")
+	if len(got) != 1 || got[0].UserID != "u2" || got[0].Connections != 2 || got[0].Editing != "projects" {
+		t.Fatalf("presence = %+v", got)
+	}
+
+	// Instance muette depuis presenceRemoteTTL : ignorée, puis oubliée
+	h.mu.Lock()
+	h.remote["b1"]["instance-b"].expiresAt = time.Now().Add(-time.Second)
+	h.mu.Unlock()
+	if got := h.presence("b1"); len(got) != 0 {
+		t.Errorf("expired presence still listed: %+v", got)
+	}
+	h.sweepRemotePresence(time.Now())
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.remote) != 0 {
+		t.Errorf("remote presence not swept: %+v", h.remote)
+	}
+}
+
+func TestPublishPresenceSnapshots(t *testing.T) {
+	h, backend := newPresenceHandler()
+	h.openSession(testSession("s1", "b1", "u1"), "")
+	h.openSession(testSession("s2", "b1", "u1"), "")
+	h.openSession(testSession("s3", "b2", "u3"), "")
+	backend.messages = nil
+
+	h.publishPresenceSnapshots()
+
+	snapshots := map[string]map[string]*remotePresence{}
+	for _, msg := range backend.messages {
+		if msg.Kind != services.BroadcastKindPresence {
+			t.Fatalf("unexpected message kind %q", msg.Kind)
+		}
+		users := map[string]*remotePresence{}
+		if err := json.Unmarshal(msg.Payload, &users); err != nil {
+			t.Fatal(err)
+		}
+		snapshots[msg.BudgetID] = users
+	}
+	if len(snapshots) != 2 || snapshots["b1"]["u1"].Sessions != 2 || snapshots["b2"]["u3"].Sessions != 1 {
+		t.Errorf("snapshots = %+v", snapshots)
+	}
+}
@@ -0,0 +1,139 @@
+// handlers/ws_replay.go
+// ============================================================================
+// WEBSOCKET REPLAY — ring buffer des événements durables par budget
+// ============================================================================
+// Chaque instance garde les wsReplayCapacity derniers événements durables de
+// chaque budget (les siens ET ceux relayés par les autres instances, voir
+// deliver). À la reconnexion, le client passe ?last_event_id=<id> :
+//   - id trouvé      → événements manqués puis {"type":"replay_completed"}
+//   - id introuvable → {"type":"resync_required"}, le client recharge tout
+// La recherche est positionnelle (ordre de réception), pas une comparaison
+// d'ids : deux instances peuvent recevoir deux événements concurrents dans
+// un ordre différent, les clients dédupliquent par id.
+// ============================================================================
+
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/services"
+)
+
+const (
+	wsReplayCapacity = 200              // événements gardés par budget
+	wsReplayTTL      = 15 * time.Minute // au-delà, un reload complet est plus sûr
+)
+
+type replayEntry struct {
+	msg services.BroadcastMessage
+	at  time.Time
+}
+
+type replayBuffer struct {
+	mu      sync.Mutex
+	budgets map[string][]replayEntry
+}
+
+func newReplayBuffer() *replayBuffer {
+	return &replayBuffer{budgets: make(map[string][]replayEntry)}
+}
+
+func (b *replayBuffer) append(msg services.BroadcastMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := append(b.budgets[msg.BudgetID], replayEntry{msg: msg, at: time.Now()})
+	if len(entries) > wsReplayCapacity {
+		// Copie pour libérer le tableau sous-jacent
+		entries = append([]replayEntry(nil), entries[len(entries)-wsReplayCapacity:]...)
+	}
+	b.budgets[msg.BudgetID] = entries
+}
+
+// since renvoie les messages reçus après lastEventID. ok = false si l'id
+// n'est plus (ou n'a jamais été) dans le buffer.
+func (b *replayBuffer) since(budgetID, lastEventID string) ([]services.BroadcastMessage, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := b.budgets[budgetID]
+	cutoff := time.Now().Add(-wsReplayTTL)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].msg.EventID != lastEventID {
+			continue
+		}
+		if entries[i].at.Before(cutoff) {
+			return nil, false
+		}
+		missed := make([]services.BroadcastMessage, 0, len(entries)-i-1)
+		for _, e := range entries[i+1:] {
+			missed = append(missed, e.msg)
+		}
+		return missed, true
+	}
+	return nil, false
+}
+
+// sweep supprime les événements expirés et les budgets devenus vides.
+func (b *replayBuffer) sweep() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cutoff := time.Now().Add(-wsReplayTTL)
+	for budgetID, entries := range b.budgets {
+		keep := 0
+		for keep < len(entries) && entries[keep].at.Before(cutoff) {
+			keep++
+		}
+		if keep == len(entries) {
+			delete(b.budgets, budgetID)
+			continue
+		}
+		if keep > 0 {
+			b.budgets[budgetID] = append([]replayEntry(nil), entries[keep:]...)
+		}
+	}
+}
+
+func (h *WSHandler) sweepReplayLoop() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.replay.sweep()
+	}
+}
+
+// registerWithReplay enregistre la session et met en file les événements
+// manqués sous le même verrou que deliver : un événement est soit rejoué,
+// soit livré en direct, jamais perdu entre les deux. Renvoie le nombre de
+// sessions locales du user sur ce budget, celle-ci comprise.
+func (h *WSHandler) registerWithReplay(session *WSSession, lastEventID string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sessions[session.ID] = session
+	sessions := h.userSessionCountLocked(session.BudgetID, session.UserID)
+	if lastEventID == "" {
+		return sessions
+	}
+
+	missed, ok := h.replay.since(session.BudgetID, lastEventID)
+	// Un rattrapage plus gros que la file d'envoi évincerait le client :
+	// autant lui demander un reload tout de suite.
+	if !ok || len(missed) >= wsSendBuffer {
+		session.enqueue(h.controlEvent(session.BudgetID, services.EventResyncRequired, nil))
+		return sessions
+	}
+
+	count := 0
+	for _, msg := range missed {
+		if sessionWants(session, msg) && session.enqueue(msg.Payload) {
+			count++
+		}
+	}
+	session.enqueue(h.controlEvent(session.BudgetID, services.EventReplayCompleted,
+		map[string]interface{}{"count": count}))
+	return sessions
+}
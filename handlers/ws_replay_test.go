@@ -0,0 +1,124 @@
+// handlers/ws_replay_test.go
+// ============================================================================
+// TESTS — rejeu des événements durables à la reconnexion (?last_event_id=)
+// ============================================================================
+// Lancer : go test ./handlers -run Replay -v
+// ============================================================================
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/services"
+)
+
+// publishDurable publie n événements durables sur b1 et renvoie leurs ids.
+func publishDurable(h *WSHandler, n int, excludeUserID string) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		event := services.NewBudgetEvent("b1", services.EventBudgetUpdated, nil, map[string]int{"version": i})
+		h.PublishEvent(event, excludeUserID)
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+// queued vide la file d'envoi de la session et renvoie les événements.
+func queued(t *testing.T, s *WSSession) []services.BudgetEvent {
+	t.Helper()
+	var events []services.BudgetEvent
+	for {
+		select {
+		case raw := <-s.send:
+			var event services.BudgetEvent
+			if err := json.Unmarshal(raw, &event); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestReplaySinceLastEvent(t *testing.T) {
+	h := NewWSHandler(nil)
+	ids := publishDurable(h, 3, "")
+	publishDurable(h, 1, "u1") // pas pour u1, même en rejeu
+	h.PublishEvent(services.NewEphemeralEvent("b1", services.EventEditing, nil, nil), "")
+
+	s := testSession("s1", "b1", "u1")
+	h.registerWithReplay(s, ids[0])
+
+	events := queued(t, s)
+	var got []string
+	for _, e := range events {
+		got = append(got, e.ID)
+	}
+	want := fmt.Sprint([]string{ids[1], ids[2], ""}) // "" : replay_completed
+	if fmt.Sprint(got) != want {
+		t.Fatalf("replayed ids = %v, want %v", got, want)
+	}
+	last := events[len(events)-1]
+	if last.Type != services.EventReplayCompleted {
+		t.Fatalf("last event = %q, want %q", last.Type, services.EventReplayCompleted)
+	}
+	if count := last.Payload.(map[string]interface{})["count"]; count != 2.0 {
+		t.Errorf("replay_completed count = %v, want 2", count)
+	}
+}
+
+func TestReplayResyncRequired(t *testing.T) {
+	cases := []struct {
+		name  string
+		setup func(h *WSHandler) string
+	}{
+		{"unknown id", func(h *WSHandler) string {
+			publishDurable(h, 2, "")
+			return "not-in-buffer"
+		}},
+		{"expired", func(h *WSHandler) string {
+			ids := publishDurable(h, 2, "")
+			h.replay.mu.Lock()
+			for i := range h.replay.budgets["b1"] {
+				h.replay.budgets["b1"][i].at = time.Now().Add(-wsReplayTTL - time.Minute)
+			}
+			h.replay.mu.Unlock()
+			return ids[0]
+		}},
+		{"more than the send buffer", func(h *WSHandler) string {
+			return publishDurable(h, wsSendBuffer+1, "")[0]
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewWSHandler(nil)
+			lastEventID := tc.setup(h)
+
+			s := testSession("s1", "b1", "u1")
+			h.registerWithReplay(s, lastEventID)
+
+			events := queued(t, s)
+			if len(events) != 1 || events[0].Type != services.EventResyncRequired {
+				t.Errorf("events = %+v, want a single resync_required", events)
+			}
+		})
+	}
+}
+
+func TestReplayBufferCapacity(t *testing.T) {
+	h := NewWSHandler(nil)
+	ids := publishDurable(h, wsReplayCapacity+1, "")
+
+	// Le plus ancien est sorti du buffer, le suivant y est encore
+	if _, ok := h.replay.since("b1", ids[0]); ok {
+		t.Error("oldest event still in the buffer")
+	}
+	if missed, ok := h.replay.since("b1", ids[1]); !ok || len(missed) != wsReplayCapacity-1 {
+		t.Errorf("since(ids[1]) = %d events, %v", len(missed), ok)
+	}
+}
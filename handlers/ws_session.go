@@ -0,0 +1,123 @@
+// handlers/ws_session.go
+// ============================================================================
+// WEBSOCKET SESSION — file d'envoi, write pump et heartbeat
+// ============================================================================
+// gorilla/websocket n'autorise qu'UN écrivain concurrent par connexion. Chaque
+// session possède donc un canal d'envoi bufferisé, vidé par une seule
+// goroutine (writePump). Les broadcasts ne font qu'un envoi non bloquant :
+// un client lent ne ralentit plus les autres, et s'il laisse son buffer se
+// remplir il est évincé (close 4008), à lui de se reconnecter et de refetch.
+//
+// Heartbeat : le serveur envoie un ping toutes les wsPingPeriod ; chaque pong
+// repousse la deadline de lecture. Sans pong pendant wsPongWait, la lecture
+// échoue et la session est nettoyée (connexions mortes derrière un proxy).
+// ============================================================================
+
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second    // durée max d'une écriture
+	wsPongWait       = 60 * time.Second    // silence toléré avant de couper
+	wsPingPeriod     = wsPongWait * 9 / 10 // doit être < wsPongWait
+	wsSendBuffer     = 64                  // messages en attente par session
+	wsMaxMessageSize = 4096                // les messages client sont petits (ping, editing)
+)
+
+type WSSession struct {
+	ID       string // uuid, clé de h.sessions (RemoteAddr collisionne derrière un proxy)
+	Conn     *websocket.Conn
+	BudgetID string
+	UserID   string
+	UserName string
+	Editing  string // section en cours d'édition (voir ws_presence.go)
+
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newWSSession(id string, conn *websocket.Conn, budgetID, userID, userName string) *WSSession {
+	return &WSSession{
+		ID:       id,
+		Conn:     conn,
+		BudgetID: budgetID,
+		UserID:   userID,
+		UserName: userName,
+		send:     make(chan []byte, wsSendBuffer),
+		done:     make(chan struct{}),
+	}
+}
+
+// enqueue place un message dans la file sans jamais bloquer. false = session
+// fermée ou buffer plein (l'appelant évince la session).
+func (s *WSSession) enqueue(msg []byte) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// close envoie une trame de fermeture puis coupe la connexion. Idempotent ;
+// WriteControl et Close sont sûrs en concurrence avec le write pump.
+func (s *WSSession) close(code int, reason string) {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		_ = s.Conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		s.Conn.Close()
+	})
+}
+
+// writePump est le SEUL écrivain de la connexion (messages + pings).
+func (s *WSSession) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case msg := <-s.send:
+			s.Conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := s.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				utils.SafeWarn("WebSocket write failed: %v", err)
+				s.close(websocket.CloseGoingAway, "write failed")
+				return
+			}
+
+		case <-ticker.C:
+			s.Conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := s.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				s.close(websocket.CloseGoingAway, "ping failed")
+				return
+			}
+		}
+	}
+}
+
+// prepareRead configure limites et deadlines de lecture pour le heartbeat.
+func (s *WSSession) prepareRead() {
+	s.Conn.SetReadLimit(wsMaxMessageSize)
+	s.Conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.Conn.SetPongHandler(func(string) error {
+		return s.Conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+}
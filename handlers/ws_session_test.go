@@ -0,0 +1,108 @@
+// handlers/ws_session_test.go
+// ============================================================================
+// TESTS — file d'envoi WebSocket et éviction des clients lents
+// ============================================================================
+// Lancer : go test ./handlers -run WSSlowConsumer -race -v
+// ============================================================================
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/LovationAdmin/budget-api/services"
+)
+
+// wsPair ouvre une vraie connexion WebSocket locale : côté serveur pour la
+// session, côté client pour lire ce qu'elle reçoit.
+func wsPair(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server = <-conns
+	t.Cleanup(func() { server.Close() })
+	return server, client
+}
+
+func TestWSSlowConsumerEvicted(t *testing.T) {
+	h := NewWSHandler(nil)
+
+	fastConn, fastClient := wsPair(t)
+	slowConn, slowClient := wsPair(t)
+	fast := newWSSession("fast", fastConn, "b1", "u1", "User u1")
+	slow := newWSSession("slow", slowConn, "b1", "u2", "User u2")
+	h.mu.Lock()
+	h.sessions[fast.ID] = fast
+	h.sessions[slow.ID] = slow
+	h.mu.Unlock()
+
+	// Seul le client rapide a un write pump : la file du lent ne se vide pas
+	go fast.writePump()
+
+	send := func(i int) {
+		h.deliver(services.BroadcastMessage{
+			Kind: services.BroadcastKindJSON, BudgetID: "b1",
+			Payload: []byte(fmt.Sprintf(`{"seq":%d}`, i)),
+		})
+	}
+	read := func(i int) {
+		t.Helper()
+		fastClient.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, msg, err := fastClient.ReadMessage()
+		if err != nil {
+			t.Fatalf("fast client, message %d: %v", i, err)
+		}
+		if want := fmt.Sprintf(`{"seq":%d}`, i); string(msg) != want {
+			t.Fatalf("fast client got %s, want %s", msg, want)
+		}
+	}
+
+	for i := 0; i < wsSendBuffer; i++ {
+		send(i)
+		read(i)
+	}
+	select {
+	case <-slow.done:
+		t.Fatal("slow client evicted before its buffer was full")
+	default:
+	}
+
+	// Buffer plein : le message suivant évince le lent, pas le rapide
+	send(wsSendBuffer)
+	read(wsSendBuffer)
+
+	slowClient.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := slowClient.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != wsCloseSlowConsumer {
+		t.Fatalf("slow client read error = %v, want close %d", err, wsCloseSlowConsumer)
+	}
+	select {
+	case <-fast.done:
+		t.Error("fast client was evicted")
+	default:
+	}
+	fast.close(websocket.CloseNormalClosure, "")
+}
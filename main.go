@@ -65,6 +65,34 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Magasin des clés de données des budgets, hors des sauvegardes de la base
+	keyStore, err := config.InitKeyStoreDB()
+	if err != nil {
+		utils.SafeError("Failed to connect to budget key store: %v", err)
+		os.Exit(1)
+	}
+	if keyStore != nil {
+		defer keyStore.Close()
+		if err := config.RunKeyStoreMigrations(keyStore); err != nil {
+			utils.SafeError("Failed to migrate budget key store: %v", err)
+			os.Exit(1)
+		}
+		services.UseBudgetKeyStore(keyStore)
+		moved, err := services.MoveBudgetKeysToStore(context.Background(), db)
+		if err != nil {
+			utils.SafeError("Failed to move budget data keys to the key store: %v", err)
+			os.Exit(1)
+		}
+		if moved > 0 {
+			utils.SafeInfo("✅ %d budget data keys moved to the key store", moved)
+		}
+	} else if utils.IsProduction {
+		utils.SafeWarn("⚠️  BUDGET_KEYS_DATABASE_URL not set: budget data keys share the main database and its backups")
+	}
+
+	// Identifiants bancaires encore en clair → chiffrés (une fois, en tâche de fond)
+	go encryptBankCredentials(db)
+
 	// Init Sentry (no-op si SENTRY_DSN n'est pas défini)
 	flushSentry := utils.InitSentry(AppName, AppVersion)
 	defer flushSentry()
@@ -76,7 +104,26 @@ func main() {
 	go scheduleMonthlyRecap(db)
 
 	// Initialiser le handler WebSocket
-	wsHandler := handlers.NewWSHandler()
+	wsHandler := handlers.NewWSHandler(db)
+
+	// Fan-out multi-instance (BROADCAST_BACKEND=postgres), mono-process sinon
+	if backend := services.NewBroadcastBackendFromEnv(db); backend != nil {
+		if err := wsHandler.UseBackend(backend); err != nil {
+			utils.SafeError("Broadcast backend disabled: %v", err)
+		} else {
+			defer backend.Close()
+			go scheduleBroadcastOutboxCleanup(db)
+		}
+	}
+
+	// Synchronisation bancaire en tâche de fond (BANK_SYNC_INTERVAL)
+	go scheduleBankSync(db, wsHandler)
+
+	// Expiration des consentements bancaires + emails de relance
+	go scheduleBankConsentCheck(db)
+
+	// Taux de change initiaux (FX_RATES_FILE, fichier BCE XML ou CSV)
+	go loadFXRatesFile(db)
 
 	// Créer le routeur Gin
 	router := gin.Default()
@@ -127,6 +174,8 @@ func main() {
 			"X-Admin-Secret", // ← requis pour /admin/stats
 			"X-Requested-With",
 			"Accept",
+			"If-Match",   // ← optimistic concurrency sur PUT /budgets/:id/data
+			"X-2FA-Code", // ← step-up 2FA (mot de passe, suppression de compte, membres)
 			"Upgrade",
 			"Connection",
 			"Sec-WebSocket-Key",
@@ -135,6 +184,7 @@ func main() {
 		},
 		ExposeHeaders: []string{
 			"Content-Length",
+			"ETag",
 			"X-RateLimit-Limit",
 			"X-RateLimit-Remaining",
 			"X-RateLimit-Reset",
@@ -218,6 +268,9 @@ func main() {
 		refreshService := services.NewRefreshTokenService(db, refreshLifetime)
 		utils.SafeInfo("Refresh tokens service initialized (lifetime=%s)", refreshLifetime)
 
+		// Révocation de toutes les sessions → fermeture des WebSockets du user
+		refreshService.OnRevokeAll(wsHandler.DisconnectUser)
+
 		// Cleanup périodique des tokens expirés
 		go scheduleRefreshTokenCleanup(refreshService)
 
@@ -237,8 +290,8 @@ func main() {
 			// FIXED: Appel explicite des routes au lieu de "SetupProtectedRoutes"
 			routes.SetupBudgetRoutes(protected, db, wsHandler)
 			routes.SetupUserRoutes(protected, db, refreshService)
-			routes.SetupInvitationRoutes(protected, db)
-			routes.SetupEnableBankingRoutes(protected, db)
+			routes.SetupInvitationRoutes(protected, db, wsHandler)
+			routes.SetupEnableBankingRoutes(protected, db, wsHandler)
 			routes.SetupMarketSuggestionsRoutes(protected, db, wsHandler)
 		}
 	}
@@ -271,6 +324,8 @@ func scheduleCacheCleaning(db *sql.DB) {
 	}
 }
 
+// cleanExpiredCache enchaîne des étapes indépendantes : une erreur est
+// journalisée et les suivantes s'exécutent quand même.
 func cleanExpiredCache(db *sql.DB) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -283,11 +338,7 @@ func cleanExpiredCache(db *sql.DB) {
 
 	if err != nil {
 		utils.SafeWarn("Failed to clean expired suggestions: %v", err)
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected > 0 {
+	} else if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
 		utils.SafeInfo("Cleaned %d expired cache entries", rowsAffected)
 	}
 
@@ -299,11 +350,7 @@ func cleanExpiredCache(db *sql.DB) {
 
 	if err != nil {
 		utils.SafeWarn("Failed to clean expired email tokens: %v", err)
-		return
-	}
-
-	rowsAffected, _ = result.RowsAffected()
-	if rowsAffected > 0 {
+	} else if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
 		utils.SafeInfo("Cleaned %d expired email verification tokens", rowsAffected)
 	}
 
@@ -315,11 +362,7 @@ func cleanExpiredCache(db *sql.DB) {
 
 	if err != nil {
 		utils.SafeWarn("Failed to clean expired password reset tokens: %v", err)
-		return
-	}
-
-	rowsAffected, _ = result.RowsAffected()
-	if rowsAffected > 0 {
+	} else if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
 		utils.SafeInfo("Cleaned %d expired password reset tokens", rowsAffected)
 	}
 
@@ -331,12 +374,132 @@ func cleanExpiredCache(db *sql.DB) {
 
 	if err != nil {
 		utils.SafeWarn("Failed to clean expired invitations: %v", err)
+	} else if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		utils.SafeInfo("Cleaned %d expired invitations", rowsAffected)
+	}
+
+	// Élaguer l'historique des révisions budget_data (N dernières + 1/jour)
+	policy := services.RevisionRetentionFromEnv()
+	pruned, err := services.NewBudgetService(db, nil, nil).PruneRevisions(ctx, policy)
+	if err != nil {
+		utils.SafeWarn("Failed to prune budget revisions: %v", err)
+	} else if pruned > 0 {
+		utils.SafeInfo("Pruned %d budget revisions (keep_latest=%d, keep_daily_days=%d)", pruned, policy.KeepLatest, policy.KeepDailyDays)
+	}
+
+	// Nettoyer les challenges WebAuthn expirés (cérémonies abandonnées)
+	rowsAffected, err := services.PruneWebAuthnSessions(ctx, db)
+	if err != nil {
+		utils.SafeWarn("Failed to clean expired passkey challenges: %v", err)
+	} else if rowsAffected > 0 {
+		utils.SafeInfo("Cleaned %d expired passkey challenges", rowsAffected)
+	}
+
+	// Tickets WebSocket expirés (usage unique, voir services/ws_tickets.go)
+	rowsAffected, err = services.PruneWSTicketUses(ctx, db)
+	if err != nil {
+		utils.SafeWarn("Failed to clean expired WebSocket tickets: %v", err)
+	} else if rowsAffected > 0 {
+		utils.SafeInfo("Cleaned %d expired WebSocket tickets", rowsAffected)
+	}
+
+	// Autorisations bancaires abandonnées entre le callback et la synchro
+	rowsAffected, err = services.PruneBankAuthorizations(ctx, db)
+	if err != nil {
+		utils.SafeWarn("Failed to clean expired bank authorizations: %v", err)
+	} else if rowsAffected > 0 {
+		utils.SafeInfo("Cleaned %d expired bank authorizations", rowsAffected)
+	}
+
+	// Clés de données des budgets supprimés restées dans le magasin séparé
+	orphans, err := services.PruneOrphanBudgetKeys(ctx, db)
+	if err != nil {
+		utils.SafeWarn("Failed to prune orphan budget data keys: %v", err)
+	} else if orphans > 0 {
+		utils.SafeInfo("Destroyed %d orphan budget data keys", orphans)
+	}
+}
+
+// scheduleBroadcastOutboxCleanup supprime toutes les heures les messages
+// WebSocket volumineux déjà relayés (plus d'une heure, voir
+// services.PruneBroadcastOutbox) : la table ne garde qu'environ deux heures
+// de fan-out.
+func scheduleBroadcastOutboxCleanup(db *sql.DB) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		rowsAffected, err := services.PruneBroadcastOutbox(ctx, db)
+		cancel()
+		if err != nil {
+			utils.SafeWarn("Failed to clean broadcast outbox: %v", err)
+		} else if rowsAffected > 0 {
+			utils.SafeInfo("Cleaned %d broadcast outbox entries", rowsAffected)
+		}
+	}
+}
+
+// scheduleBankSync rafraîchit soldes et transactions des connexions
+// bancaires actives. Chaque connexion porte son propre next_sync_at (cadence
+// BANK_SYNC_INTERVAL, backoff en cas d'erreur ou de 429) : le tick ne fait que
+// traiter celles qui sont échues.
+func scheduleBankSync(db *sql.DB, ws services.Broadcaster) {
+	cfg := services.BankSyncConfigFromEnv()
+	if cfg.Interval == 0 {
+		utils.SafeInfo("bank-sync: disabled (BANK_SYNC_INTERVAL=0)")
+		return
+	}
+	if provider, missing := services.BankingProviderConfig(); missing != "" {
+		utils.SafeWarn("bank-sync: provider %q not configured (%s not set), scheduler disabled", provider, missing)
 		return
 	}
 
-	rowsAffected, _ = result.RowsAffected()
-	if rowsAffected > 0 {
-		utils.SafeInfo("Cleaned %d expired invitations", rowsAffected)
+	scheduler := services.NewBankSyncScheduler(db, services.NewBankingProviderFromEnv(), ws, cfg)
+
+	tick := 15 * time.Minute
+	if cfg.Interval < tick {
+		tick = cfg.Interval
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	// Premier run après 2 min (évite la charge cold-start)
+	time.Sleep(2 * time.Minute)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), tick)
+		result, err := scheduler.RunOnce(ctx)
+		cancel()
+		if err != nil {
+			utils.SafeWarn("bank-sync: run failed: %v", err)
+		} else if result.Connections > 0 {
+			utils.SafeInfo("bank-sync: connections=%d ok=%d rate_limited=%d failed=%d interrupted=%d imported=%d",
+				result.Connections, result.Succeeded, result.RateLimited, result.Failed, result.Interrupted, result.TransactionsImported)
+		}
+		<-ticker.C
+	}
+}
+
+// scheduleBankConsentCheck tourne toutes les heures : passe les connexions
+// en expiring / expired selon leur valid_until et envoie les relances.
+func scheduleBankConsentCheck(db *sql.DB) {
+	consents := services.NewBankConsentService(db, services.NewEmailService())
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	// Premier run après 1 min (évite la charge cold-start)
+	time.Sleep(1 * time.Minute)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		result, err := consents.CheckConsents(ctx)
+		cancel()
+		if err != nil {
+			utils.SafeWarn("bank-consent: check failed: %v", err)
+		} else if result.Updated > 0 || result.Reminded > 0 {
+			utils.SafeInfo("bank-consent: status_changes=%d reminders=%d", result.Updated, result.Reminded)
+		}
+		<-ticker.C
 	}
 }
 
@@ -405,3 +568,31 @@ func scheduleRefreshTokenCleanup(s *services.RefreshTokenService) {
 		}
 	}
 }
+
+// loadFXRatesFile charge FX_RATES_FILE au démarrage. Les taux suivants
+// arrivent par POST /admin/fx-rates.
+func loadFXRatesFile(db *sql.DB) {
+	path := os.Getenv("FX_RATES_FILE")
+	if path == "" {
+		return
+	}
+	n, err := services.NewFXRateService(db).LoadFile(context.Background(), path)
+	if err != nil {
+		utils.SafeWarn("fx-rates: failed to load %s: %v", path, err)
+		return
+	}
+	utils.SafeInfo("fx-rates: %d rates loaded from %s", n, path)
+}
+
+// encryptBankCredentials chiffre les session_id et jetons bancaires
+// enregistrés en clair avant leur chiffrement au repos. Sans effet une fois
+// la migration marquée faite (data_migrations).
+func encryptBankCredentials(db *sql.DB) {
+	n, err := services.EncryptBankCredentials(context.Background(), db)
+	if err != nil {
+		utils.SafeWarn("bank-credentials: %v", err)
+	}
+	if n > 0 {
+		utils.SafeInfo("bank-credentials: %d values encrypted", n)
+	}
+}
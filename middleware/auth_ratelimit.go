@@ -30,6 +30,12 @@
 //   de le rafraîchir en boucle. 60 / heure laisse passer les usages normaux
 //   et flague les boucles.
 //
+// PASSKEY — par IP
+//   Raison : pas d'email dans une connexion par passkey. La signature est
+//   incassable ; la limite freine seulement le rejeu de réponses volées.
+//   Le begin, public, écrit un challenge en base à chaque appel : compté
+//   à chaque appel, réussi ou non.
+//
 // RESET-PASSWORD — par IP
 //   Raison : protéger contre le brute-force du token de reset (qui est un
 //   UUID, donc 122 bits d'entropie — déjà incassable, mais ceinture+bretelles).
@@ -98,6 +104,29 @@ func RefreshRateLimit() gin.HandlerFunc {
 	})
 }
 
+// PasskeyRateLimit : 10 échecs / 15 min par IP sur la fin des connexions
+// par passkey. Les connexions réussies ne consomment pas de tentative.
+func PasskeyRateLimit() gin.HandlerFunc {
+	return NewLimiter(LimiterConfig{
+		Name:          "passkey",
+		Limit:         10,
+		Window:        15 * time.Minute,
+		KeyFunc:       KeyByIP,
+		SkipOnSuccess: true,
+	})
+}
+
+// PasskeyBeginRateLimit : 20 ouvertures de connexion par passkey / 15 min
+// par IP, toutes comptées.
+func PasskeyBeginRateLimit() gin.HandlerFunc {
+	return NewLimiter(LimiterConfig{
+		Name:    "passkey_begin",
+		Limit:   20,
+		Window:  15 * time.Minute,
+		KeyFunc: KeyByIP,
+	})
+}
+
 // VerifyResendRateLimit : 3 renvois de mail de vérification / heure par email.
 func VerifyResendRateLimit() gin.HandlerFunc {
 	return NewLimiter(LimiterConfig{
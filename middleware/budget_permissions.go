@@ -0,0 +1,70 @@
+// middleware/budget_permissions.go
+// ============================================================================
+// BUDGET PERMISSIONS — contrôle d'accès par rôle sur les routes /budgets/:id
+// ============================================================================
+// Appliqué route par route dans routes/routes.go, après AuthMiddleware :
+//
+//   rg.PUT("/budgets/:id/data", middleware.RequireBudgetPermission(db, services.PermWrite), h.UpdateBudgetData)
+//
+//   - non-membre           → 404 "Budget not found" (on ne révèle pas l'existence)
+//   - permission manquante → 403 {"error": ..., "required": "<perm>"}
+//
+// L'accès résolu est posé dans le contexte ("budget_access") pour les
+// handlers qui veulent affiner (ex : ne pas retirer l'owner).
+// ============================================================================
+
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+const budgetAccessKey = "budget_access"
+
+// RequireBudgetPermission bloque la requête si l'utilisateur courant n'a pas
+// perm sur le budget :id.
+func RequireBudgetPermission(db *sql.DB, perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		budgetID := c.Param("id")
+		userID := GetUserID(c)
+
+		access, err := services.GetMemberAccess(c.Request.Context(), db, budgetID, userID)
+		if errors.Is(err, services.ErrNotBudgetMember) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+			return
+		}
+		if err != nil {
+			utils.SafeError("Failed to resolve budget access: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify budget access"})
+			return
+		}
+
+		if !access.Can(perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":    "Insufficient permissions",
+				"required": perm,
+			})
+			return
+		}
+
+		c.Set(budgetAccessKey, access)
+		c.Next()
+	}
+}
+
+// GetBudgetAccess renvoie l'accès résolu par RequireBudgetPermission, ou nil
+// si la route n'est pas protégée par le middleware.
+func GetBudgetAccess(c *gin.Context) *services.MemberAccess {
+	access, exists := c.Get(budgetAccessKey)
+	if !exists {
+		return nil
+	}
+	return access.(*services.MemberAccess)
+}
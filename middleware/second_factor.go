@@ -0,0 +1,155 @@
+// middleware/second_factor.go
+// ============================================================================
+// STEP-UP 2FA — code TOTP ou de récupération, ou passkey, pour les actions
+// sensibles
+// ============================================================================
+// Appliqué route par route dans routes/routes.go, après AuthMiddleware :
+//
+//   rg.POST("/user/password", middleware.RequireSecondFactor(db), userHandler.ChangePassword)
+//
+// La preuve est envoyée en en-tête (les DELETE n'ont pas de corps) :
+//   - X-2FA-Code : code TOTP ou de récupération ;
+//   - ou X-Passkey-Session + X-Passkey-Assertion : id de la cérémonie
+//     ouverte par POST /user/step-up/passkey et réponse de
+//     navigator.credentials.get() (JSON encodé en base64url).
+//
+// RequireSecondFactor laisse passer un utilisateur sans 2FA. Sinon :
+//   - preuve absente  → 403 {"error": "2FA code required", "requires_2fa": true}
+//   - code invalide   → 403 {"error": "Invalid 2FA code", "requires_2fa": true}
+//   - passkey refusée → 403 {"error": "Passkey verification failed", "requires_2fa": true}
+//   - trop d'échecs   → 429, même avec un code correct, pendant
+//     services.SecondFactorLockout (voir services/second_factor.go)
+//
+// RequireReauthentication exige une preuve de tous les utilisateurs : sans
+// 2FA, une passkey ou le mot de passe (X-Current-Password), sinon
+// 403 {"error": "Password confirmation required", "requires_password": true}.
+// Pour les actions qui créent ou retirent un moyen de connexion : un jeton
+// d'accès volé ne doit pas suffire.
+//
+// 403 et non 401 : le client ne doit pas y voir une session expirée.
+//
+// Le code n'est consommé que si l'action réussit : réservé avant le handler,
+// il est rendu quand celui-ci répond une erreur (statut >= 400).
+// ============================================================================
+
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/LovationAdmin/budget-api/services"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// En-têtes de step-up
+const (
+	SecondFactorHeader     = "X-2FA-Code"
+	PasskeySessionHeader   = "X-Passkey-Session"
+	PasskeyAssertionHeader = "X-Passkey-Assertion"
+	CurrentPasswordHeader  = "X-Current-Password"
+)
+
+// RequireSecondFactor exige un code TOTP ou de récupération frais, ou une
+// passkey, si l'utilisateur courant a activé la 2FA.
+func RequireSecondFactor(db *sql.DB) gin.HandlerFunc {
+	return stepUp(db, false)
+}
+
+// RequireReauthentication exige une preuve fraîche de tout utilisateur : la
+// 2FA si elle est activée, sinon une passkey ou le mot de passe.
+func RequireReauthentication(db *sql.DB) gin.HandlerFunc {
+	return stepUp(db, true)
+}
+
+func stepUp(db *sql.DB, always bool) gin.HandlerFunc {
+	secondFactor := services.NewSecondFactorService(db)
+	passkeys := services.NewPasskeyService(db)
+	return func(c *gin.Context) {
+		userID := GetUserID(c)
+		ctx := c.Request.Context()
+
+		// Passkey : vaut pour la 2FA comme pour la ré-authentification
+		if sessionID := c.GetHeader(PasskeySessionHeader); sessionID != "" {
+			assertion, err := base64.RawURLEncoding.DecodeString(c.GetHeader(PasskeyAssertionHeader))
+			if err != nil {
+				err = services.ErrPasskeyVerification
+			} else {
+				err = passkeys.VerifyStepUp(ctx, userID, sessionID, assertion)
+			}
+			if err != nil {
+				utils.LogAuthAction("StepUp-Passkey", GetUserEmail(c), false)
+				if !errors.Is(err, services.ErrPasskeyVerification) && !errors.Is(err, services.ErrPasskeyChallenge) {
+					utils.SafeError("Failed to verify step-up passkey: %v", err)
+				}
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error":        "Passkey verification failed",
+					"requires_2fa": true,
+				})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		claim, err := secondFactor.Claim(ctx, userID, c.GetHeader(SecondFactorHeader))
+		if err == nil && claim == nil && always {
+			// Pas de 2FA : le mot de passe confirme l'utilisateur
+			err = secondFactor.VerifyPassword(ctx, userID, c.GetHeader(CurrentPasswordHeader))
+		}
+		switch {
+		case errors.Is(err, services.ErrSecondFactorLocked):
+			utils.LogAuthAction("StepUp-Locked", GetUserEmail(c), false)
+			c.Header("Retry-After", strconv.Itoa(int(services.SecondFactorLockout.Seconds())))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":        "Too many invalid attempts, please try again later",
+				"requires_2fa": true,
+			})
+			return
+		case errors.Is(err, services.ErrSecondFactorRequired):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":        "2FA code required",
+				"requires_2fa": true,
+			})
+			return
+		case errors.Is(err, services.ErrInvalidSecondFactor):
+			utils.LogAuthAction("StepUp-2FA", GetUserEmail(c), false)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":        "Invalid 2FA code",
+				"requires_2fa": true,
+			})
+			return
+		case errors.Is(err, services.ErrPasswordRequired):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":             "Password confirmation required",
+				"requires_password": true,
+			})
+			return
+		case errors.Is(err, services.ErrInvalidPassword):
+			utils.LogAuthAction("StepUp-Password", GetUserEmail(c), false)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":             "Invalid password",
+				"requires_password": true,
+			})
+			return
+		case err != nil:
+			utils.SafeError("Failed to verify 2FA code: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify 2FA code"})
+			return
+		}
+
+		c.Next()
+
+		if claim != nil && c.Writer.Status() >= 400 {
+			if err := secondFactor.Release(context.Background(), claim); err != nil {
+				utils.SafeWarn("Failed to release 2FA code after a failed action: %v", err)
+			}
+		}
+	}
+}
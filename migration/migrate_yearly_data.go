@@ -17,7 +17,7 @@ import (
 	"log"
 	"time"
 
-	"github.com/LovationAdmin/budget-api/utils"
+	"github.com/LovationAdmin/budget-api/services"
 )
 
 // Mois français dans l'ordre (index 0 = Janvier)
@@ -270,7 +270,7 @@ func MigrateBudgetRecord(ctx context.Context, db *sql.DB, budgetID string, rawJS
 
 	if err := json.Unmarshal(rawJSON, &wrapper); err == nil && wrapper.Encrypted != "" {
 		// Données chiffrées
-		decryptedBytes, err := utils.Decrypt(wrapper.Encrypted)
+		decryptedBytes, err := services.DecryptBudgetData(ctx, db, budgetID, wrapper.Encrypted)
 		if err != nil {
 			return fmt.Errorf("failed to decrypt: %w", err)
 		}
@@ -300,7 +300,7 @@ func MigrateBudgetRecord(ctx context.Context, db *sql.DB, budgetID string, rawJS
 		return fmt.Errorf("failed to marshal migrated data: %w", err)
 	}
 
-	encryptedString, err := utils.Encrypt(migratedJSON)
+	encryptedString, err := services.EncryptBudgetData(ctx, db, budgetID, migratedJSON)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt: %w", err)
 	}
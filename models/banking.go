@@ -4,29 +4,39 @@ import (
 	"time"
 )
 
+// BankConnection est une connexion bancaire (banking_connections), quel que
+// soit le fournisseur qui l'a créée.
 type BankConnection struct {
-	ID                   string        `json:"id"`
-	UserID               string        `json:"user_id"`
-	InstitutionID        string        `json:"institution_id"`
-	InstitutionName      string        `json:"institution_name"`
-	ProviderConnectionID string        `json:"-"` // Internal use only
-	Status               string        `json:"status"`
-	ExpiresAt            time.Time     `json:"expires_at"`
-	CreatedAt            time.Time     `json:"created_at"`
-	UpdatedAt            time.Time     `json:"updated_at"`
-	Accounts             []BankAccount `json:"accounts,omitempty"`
+	ID                 string        `json:"id"`
+	UserID             string        `json:"user_id"`
+	Provider           string        `json:"provider"` // enablebanking, legacy
+	InstitutionName    string        `json:"institution_name"`
+	InstitutionCountry string        `json:"institution_country"`
+	Status             string        `json:"status"` // active, expiring, expired, revoked, error
+	ValidUntil         *time.Time    `json:"valid_until"`
+	SyncStatus         string        `json:"sync_status"`
+	LastSyncAt         *time.Time    `json:"last_sync_at"`
+	LastSyncError      string        `json:"last_sync_error,omitempty"`
+	CreatedAt          time.Time     `json:"created_at"`
+	UpdatedAt          time.Time     `json:"updated_at"`
+	AccountCount       int           `json:"account_count"`
+	Accounts           []BankAccount `json:"accounts"`
 }
 
+// BankAccount est un compte d'une connexion (banking_accounts).
 type BankAccount struct {
-	ID                string    `json:"id"`
-	ConnectionID      string    `json:"connection_id"`
-	ExternalAccountID string    `json:"-"` // Internal use only
-	Name              string    `json:"name"`
-	Mask              string    `json:"mask"`
-	Currency          string    `json:"currency"`
-	Balance           float64   `json:"balance"`
-	IsSavingsPool     bool      `json:"is_savings_pool"` // Critical for Reality Check
-	LastSyncedAt      time.Time `json:"last_synced_at"`
+	ID                string     `json:"id"`
+	ConnectionID      string     `json:"connection_id"`
+	ExternalAccountID string     `json:"-"` // Internal use only
+	Name              string     `json:"name"`
+	Mask              string     `json:"mask"`
+	Type              string     `json:"type"`
+	Currency          string     `json:"currency"`
+	Balance           float64    `json:"balance"`
+	IsSavingsPool     bool       `json:"is_savings_pool"` // Critical for Reality Check
+	LastSyncedAt      *time.Time `json:"last_synced_at"`
+	// Solde dans la devise du budget, nil sans taux de change
+	BalanceConverted *float64 `json:"balance_converted,omitempty"`
 }
 
 // Request to toggle the pool status
@@ -38,4 +48,186 @@ type UpdateAccountPoolRequest struct {
 type RealityCheckSummary struct {
 	TotalRealCash float64       `json:"total_real_cash"`
 	Accounts      []BankAccount `json:"accounts"`
-}
\ No newline at end of file
+}
+
+// BankTransaction est une ligne du ledger local (bank_transactions), alimenté
+// par la synchro incrémentale ou l'import de relevés. Amount est signé :
+// négatif pour un débit.
+type BankTransaction struct {
+	ID                    string    `json:"id"`
+	AccountID             string    `json:"account_id"`
+	AccountName           string    `json:"account_name"`
+	ProviderTransactionID string    `json:"-"` // Internal use only (dédoublonnage)
+	Amount                float64   `json:"amount"`
+	Currency              string    `json:"currency_code"`
+	CreditDebit           string    `json:"type"` // DBIT ou CRDT
+	Status                string    `json:"status"`
+	BookingDate           string    `json:"date"`
+	ValueDate             string    `json:"value_date,omitempty"`
+	Description           string    `json:"clean_description"`
+	Category              string    `json:"category,omitempty"` // relevés importés
+	CreatedAt             time.Time `json:"created_at"`
+	// Montant dans la devise du budget au taux du jour de l'opération
+	AmountConverted *float64 `json:"amount_converted,omitempty"`
+}
+
+// ReconciliationReport compare, pour un mois, le plan du budget (charges et
+// dépenses projets de budget_data) avec les transactions du ledger.
+type ReconciliationReport struct {
+	BudgetID   string                      `json:"budget_id"`
+	Month      string                      `json:"month"` // YYYY-MM
+	Charges    []ChargeReconciliation      `json:"charges"`
+	Projects   []ProjectReconciliation     `json:"projects"`
+	Unexpected []ReconciliationTransaction `json:"unexpected"` // débits hors plan
+	Totals     ReconciliationTotals        `json:"totals"`
+}
+
+type ChargeReconciliation struct {
+	ChargeID     string                      `json:"charge_id"`
+	Label        string                      `json:"label"`
+	Planned      float64                     `json:"planned"`
+	Actual       float64                     `json:"actual"`
+	Difference   float64                     `json:"difference"` // actual - planned
+	ExpectedDay  int                         `json:"expected_day,omitempty"`
+	Status       string                      `json:"status"` // paid, amount_mismatch, pending, missed
+	Transactions []ReconciliationTransaction `json:"transactions"`
+}
+
+type ProjectReconciliation struct {
+	ProjectID    string                      `json:"project_id"`
+	Label        string                      `json:"label"`
+	Planned      float64                     `json:"planned"`
+	Actual       float64                     `json:"actual"`
+	Difference   float64                     `json:"difference"`
+	Transactions []ReconciliationTransaction `json:"transactions"`
+}
+
+// ReconciliationTransaction est une transaction du ledger vue depuis la
+// réconciliation. Source vaut "auto" (proposé) ou "confirmed" (validé).
+type ReconciliationTransaction struct {
+	TransactionID string  `json:"transaction_id"`
+	Date          string  `json:"date"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency_code"`
+	Description   string  `json:"clean_description"`
+	Score         float64 `json:"score,omitempty"`
+	Source        string  `json:"source,omitempty"`
+}
+
+type ReconciliationTotals struct {
+	PlannedCharges  float64 `json:"planned_charges"`
+	ActualCharges   float64 `json:"actual_charges"`
+	PlannedProjects float64 `json:"planned_projects"`
+	ActualProjects  float64 `json:"actual_projects"`
+	Unexpected      float64 `json:"unexpected"`
+	MissedCharges   int     `json:"missed_charges"`
+}
+
+// RecurringChargeProposal est un débit périodique détecté dans l'historique
+// bancaire, proposé à l'import comme charge du budget.
+type RecurringChargeProposal struct {
+	Key              string   `json:"key"` // stable entre deux détections, sert à l'import
+	Label            string   `json:"label"`
+	Category         string   `json:"category"`
+	Frequency        string   `json:"frequency"`      // monthly, quarterly, yearly
+	Amount           float64  `json:"amount"`         // montant d'une échéance
+	MonthlyAmount    float64  `json:"monthly_amount"` // montant de la charge importée
+	Currency         string   `json:"currency_code"`
+	DayOfMonth       int      `json:"day_of_month,omitempty"`
+	Occurrences      int      `json:"occurrences"`
+	FirstSeen        string   `json:"first_seen"`
+	LastSeen         string   `json:"last_seen"`
+	NextExpected     string   `json:"next_expected"`
+	Confidence       float64  `json:"confidence"`
+	AlreadyInBudget  bool     `json:"already_in_budget"`
+	ExistingChargeID string   `json:"existing_charge_id,omitempty"`
+	TransactionIDs   []string `json:"transaction_ids"`
+}
+
+// ImportedCharge est une charge ajoutée au budget depuis une proposition.
+type ImportedCharge struct {
+	Key      string  `json:"key"`
+	ChargeID string  `json:"charge_id"`
+	Label    string  `json:"label"`
+	Amount   float64 `json:"amount"`
+	Category string  `json:"category"`
+}
+
+// StatementImportResult résume l'import d'un relevé (CSV, OFX, CAMT.053).
+// Duplicates compte les transactions déjà présentes dans le ledger, Skipped
+// les lignes illisibles du fichier.
+type StatementImportResult struct {
+	Format     string                   `json:"format"`
+	Preset     string                   `json:"preset,omitempty"` // CSV uniquement
+	Accounts   []StatementImportAccount `json:"accounts"`
+	Imported   int                      `json:"imported"`
+	Duplicates int                      `json:"duplicates"`
+	Skipped    int                      `json:"skipped"`
+}
+
+type StatementImportAccount struct {
+	AccountID  string `json:"account_id"`
+	Name       string `json:"name"`
+	Imported   int    `json:"imported"`
+	Duplicates int    `json:"duplicates"`
+	Skipped    int    `json:"skipped"`
+}
+
+// FXRate : nombre d'unités de Currency pour 1 EUR à la date Date
+// (convention BCE).
+type FXRate struct {
+	Date     string  `json:"date"` // YYYY-MM-DD
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+}
+
+// CurrencyTotals additionne des soldes de devises différentes dans la devise
+// du budget. Les devises sans taux sont listées dans MissingRates et exclues
+// de Total.
+type CurrencyTotals struct {
+	Currency     string              `json:"currency"`
+	Total        float64             `json:"total"`
+	Breakdown    []CurrencyBreakdown `json:"breakdown"`
+	MissingRates []string            `json:"missing_rates,omitempty"`
+}
+
+type CurrencyBreakdown struct {
+	Currency  string   `json:"currency"`
+	Amount    float64  `json:"amount"`    // dans la devise d'origine
+	Converted *float64 `json:"converted"` // nil sans taux
+	Rate      float64  `json:"rate,omitempty"`
+	RateDate  string   `json:"rate_date,omitempty"`
+}
+
+// BalanceTimeline : courbe des soldes par compte et du patrimoine agrégé,
+// dans la devise du budget. Chaque point est daté de la fin de sa période.
+type BalanceTimeline struct {
+	Currency        string                 `json:"currency"`
+	Interval        string                 `json:"interval"`
+	From            string                 `json:"from"`
+	To              string                 `json:"to"`
+	SavingsPoolOnly bool                   `json:"savings_pool_only"`
+	Accounts        []AccountBalanceSeries `json:"accounts"`
+	NetWorth        []NetWorthPoint        `json:"net_worth"`
+	MissingRates    []string               `json:"missing_rates,omitempty"`
+}
+
+type AccountBalanceSeries struct {
+	AccountID string         `json:"account_id"`
+	Name      string         `json:"name"`
+	Currency  string         `json:"currency"`
+	Points    []BalancePoint `json:"points"`
+}
+
+type BalancePoint struct {
+	Date      string   `json:"date"`
+	Balance   *float64 `json:"balance"`   // nil avant le premier solde connu
+	Converted *float64 `json:"converted"` // nil sans solde ou sans taux
+}
+
+type NetWorthPoint struct {
+	Start    string  `json:"start"`
+	Date     string  `json:"date"`
+	Total    float64 `json:"total"`
+	Accounts int     `json:"accounts"` // comptes inclus dans Total
+}
@@ -26,8 +26,8 @@ type BudgetMember struct {
 	BudgetID    string          `json:"budget_id"`
 	UserID      string          `json:"user_id"`
 	User        *User           `json:"user,omitempty"`
-	Role        string          `json:"role"`
-	Permissions json.RawMessage `json:"permissions"`
+	Role        string          `json:"role"`        // owner | editor | viewer
+	Permissions map[string]bool `json:"permissions"` // permissions effectives (rôle + droits custom)
 	JoinedAt    time.Time       `json:"joined_at"`
 	UserName    string          `json:"user_name"`
 	UserEmail   string          `json:"user_email"`
@@ -42,6 +42,19 @@ type BudgetData struct {
 	UpdatedAt time.Time       `json:"updated_at"`
 }
 
+// BudgetRevision is the metadata of one saved version of budget_data. The
+// (encrypted) document itself is only returned by the single-revision route.
+type BudgetRevision struct {
+	ID         string      `json:"id"`
+	BudgetID   string      `json:"budget_id"`
+	Version    int         `json:"version"`
+	SizeBytes  int         `json:"size_bytes"`
+	AuthorID   string      `json:"author_id,omitempty"`
+	AuthorName string      `json:"author_name,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Data       interface{} `json:"data,omitempty"`
+}
+
 type CreateBudgetRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Year     int    `json:"year"`
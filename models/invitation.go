@@ -27,4 +27,17 @@ type InvitationResponse struct {
 	Invitation Invitation `json:"invitation"`
 	Budget     Budget     `json:"budget"`
 	InviterName string    `json:"inviter_name"`
-}
\ No newline at end of file
+}
+// OwnershipTransfer est une demande de transfert de propriété d'un budget,
+// en attente de confirmation par le membre désigné.
+type OwnershipTransfer struct {
+	ID         string     `json:"id"`
+	BudgetID   string     `json:"budget_id"`
+	FromUserID string     `json:"from_user_id"`
+	ToUserID   string     `json:"to_user_id"`
+	ToUserName string     `json:"to_user_name,omitempty"`
+	Status     string     `json:"status"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
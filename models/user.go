@@ -35,4 +35,13 @@ type LoginResponse struct {
 	RefreshToken string `json:"refresh_token"`
 	User         User   `json:"user"`
 	Requires2FA  bool   `json:"requires_2fa,omitempty"`
-}
\ No newline at end of file
+}
+
+// Passkey : credential WebAuthn d'un utilisateur (sans la clé publique).
+type Passkey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Synced     bool       `json:"synced"` // sauvegardée chez le fournisseur (iCloud, Google...)
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
@@ -30,6 +30,11 @@ func SetupAuthRoutes(rg *gin.RouterGroup, db *sql.DB, rt *services.RefreshTokenS
 	// Password Reset
 	rg.POST("/auth/forgot-password", middleware.ForgotPasswordRateLimit(), authHandler.ForgotPassword)
 	rg.POST("/auth/reset-password", middleware.ResetPasswordRateLimit(), authHandler.ResetPassword)
+
+	// Passkeys : connexion sans mot de passe, ou second facteur après Login
+	rg.POST("/auth/passkey/login/begin", middleware.PasskeyBeginRateLimit(), authHandler.BeginPasskeyLogin)
+	rg.POST("/auth/passkey/login/finish", middleware.PasskeyRateLimit(), authHandler.FinishPasskeyLogin)
+	rg.POST("/auth/passkey/verify", middleware.PasskeyRateLimit(), authHandler.VerifyPasskeySecondFactor)
 }
 
 // SetupBudgetRoutes sets up protected budget and related routes.
@@ -47,22 +52,55 @@ func SetupBudgetRoutes(rg *gin.RouterGroup, db *sql.DB, wsHandler *handlers.WSHa
 	advisorService := services.NewBudgetAdvisorService(aiService)
 	advisorHandler := handlers.NewBudgetAdvisorHandler(advisorService)
 
+	// Rôles & permissions par budget (voir services/budget_roles.go).
+	// DELETE, le changement de rôle et le transfert de propriété restent
+	// réservés à l'owner, vérifié dans le handler / service.
+	read := middleware.RequireBudgetPermission(db, services.PermRead)
+	write := middleware.RequireBudgetPermission(db, services.PermWrite)
+	invite := middleware.RequireBudgetPermission(db, services.PermInvite)
+
 	rg.GET("/budgets", h.GetBudgets)
 	rg.POST("/budgets", h.CreateBudget)
-	rg.GET("/budgets/:id", h.GetBudget)
-	rg.PUT("/budgets/:id", h.UpdateBudget)
+	rg.GET("/budgets/:id", read, h.GetBudget)
+	rg.PUT("/budgets/:id", write, h.UpdateBudget)
 	rg.DELETE("/budgets/:id", h.DeleteBudget)
-	rg.GET("/budgets/:id/data", h.GetBudgetData)
-	rg.PUT("/budgets/:id/data", h.UpdateBudgetData)
-	rg.POST("/budgets/:id/invite", h.InviteMember)
+	rg.GET("/budgets/:id/data", read, h.GetBudgetData)
+	rg.PUT("/budgets/:id/data", write, h.UpdateBudgetData)
+	rg.PATCH("/budgets/:id/data", write, h.PatchBudgetData)
+	rg.GET("/budgets/:id/revisions", read, h.ListRevisions)
+	rg.GET("/budgets/:id/revisions/diff", read, h.DiffRevisions)
+	rg.GET("/budgets/:id/revisions/:version", read, h.GetRevision)
+	rg.POST("/budgets/:id/revisions/:version/restore", write, h.RestoreRevision)
+	rg.POST("/budgets/:id/invite", invite, h.InviteMember)
+	rg.PUT("/budgets/:id/members/:member_id/role", read, h.UpdateMemberRole)
 	rg.POST("/invitations/accept", h.AcceptInvitation)
 
+	// Transfert de propriété (owner / membre désigné vérifiés dans le service)
+	rg.POST("/budgets/:id/transfer-ownership", read, h.RequestOwnershipTransfer)
+	rg.GET("/budgets/:id/transfer-ownership", read, h.GetOwnershipTransfer)
+	rg.DELETE("/budgets/:id/transfer-ownership", read, h.WithdrawOwnershipTransfer)
+	rg.POST("/budgets/:id/transfer-ownership/accept", read, h.AcceptOwnershipTransfer)
+	rg.POST("/ownership-transfers/accept", h.AcceptOwnershipTransferByToken)
+
+	// Ticket court pour l'upgrade WebSocket (/api/v1/ws/budgets/:id?ticket=...)
+	rg.POST("/budgets/:id/ws-ticket", read, wsHandler.IssueTicket)
+	rg.GET("/budgets/:id/presence", read, wsHandler.GetPresence)
+
 	// Stateless generation, usable both at creation and on an existing budget.
 	rg.POST("/budgets/ai-proposal", advisorHandler.GenerateProposal)
 }
 
 func SetupUserRoutes(rg *gin.RouterGroup, db *sql.DB, rt *services.RefreshTokenService) {
-	userHandler := &handlers.UserHandler{DB: db, RefreshTokens: rt}
+	userHandler := &handlers.UserHandler{
+		DB:            db,
+		RefreshTokens: rt,
+		SecondFactor:  services.NewSecondFactorService(db),
+		Passkeys:      services.NewPasskeyService(db),
+	}
+	// Step-up : code TOTP ou de récupération frais (en-tête X-2FA-Code) ou
+	// passkey ; reauth demande en plus le mot de passe aux comptes sans 2FA
+	stepUp := middleware.RequireSecondFactor(db)
+	reauth := middleware.RequireReauthentication(db)
 	authHandler := handlers.NewAuthHandlerWithRefresh(db, rt)
 
 	// Logout multi-device : révoque tous les refresh tokens du user
@@ -73,23 +111,37 @@ func SetupUserRoutes(rg *gin.RouterGroup, db *sql.DB, rt *services.RefreshTokenS
 	rg.PUT("/user/profile", userHandler.UpdateProfile)
 
 	// Security
-	rg.POST("/user/password", userHandler.ChangePassword)
+	rg.POST("/user/password", stepUp, userHandler.ChangePassword)
 	rg.POST("/user/2fa/setup", userHandler.SetupTOTP)
 	rg.POST("/user/2fa/verify", userHandler.VerifyTOTP)
-	rg.POST("/user/2fa/disable", userHandler.DisableTOTP)
+	rg.POST("/user/2fa/disable", userHandler.DisableTOTP) // code dans le corps
+	rg.GET("/user/2fa/recovery-codes", userHandler.GetRecoveryCodes)
+	rg.POST("/user/2fa/recovery-codes", stepUp, userHandler.RegenerateRecoveryCodes)
+
+	// Passkeys (WebAuthn) ; en ajouter une crée un nouveau moyen de connexion
+	rg.GET("/user/passkeys", userHandler.ListPasskeys)
+	rg.POST("/user/passkeys/register/begin", reauth, userHandler.BeginPasskeyRegistration)
+	rg.POST("/user/passkeys/register/finish", userHandler.FinishPasskeyRegistration)
+	rg.PATCH("/user/passkeys/:passkey_id", userHandler.RenamePasskey)
+	rg.DELETE("/user/passkeys/:passkey_id", reauth, userHandler.DeletePasskey)
+	rg.POST("/user/step-up/passkey", userHandler.BeginPasskeyStepUp)
 
 	// Account Management
-	rg.DELETE("/user/account", userHandler.DeleteAccount)
+	rg.DELETE("/user/account", stepUp, userHandler.DeleteAccount)
 
 	// GDPR Data Export
 	rg.GET("/user/export-data", userHandler.ExportUserData)
 }
 
-func SetupInvitationRoutes(rg *gin.RouterGroup, db *sql.DB) {
-	invitationHandler := &handlers.InvitationHandler{DB: db}
-	rg.GET("/budgets/:id/invitations", invitationHandler.GetInvitations)
-	rg.DELETE("/budgets/:id/invitations/:invitation_id", invitationHandler.CancelInvitation)
-	rg.DELETE("/budgets/:id/members/:member_id", invitationHandler.RemoveMember)
+func SetupInvitationRoutes(rg *gin.RouterGroup, db *sql.DB, wsHandler *handlers.WSHandler) {
+	invitationHandler := &handlers.InvitationHandler{DB: db, WS: wsHandler}
+	rg.GET("/budgets/:id/invitations",
+		middleware.RequireBudgetPermission(db, services.PermRead), invitationHandler.GetInvitations)
+	rg.DELETE("/budgets/:id/invitations/:invitation_id",
+		middleware.RequireBudgetPermission(db, services.PermInvite), invitationHandler.CancelInvitation)
+	rg.DELETE("/budgets/:id/members/:member_id",
+		middleware.RequireBudgetPermission(db, services.PermManageMembers), middleware.RequireSecondFactor(db),
+		invitationHandler.RemoveMember)
 }
 
 func SetupAdminRoutes(rg *gin.RouterGroup, db *sql.DB) {
@@ -122,6 +174,16 @@ func SetupAdminRoutes(rg *gin.RouterGroup, db *sql.DB) {
 		services.NewBudgetService(db, nil, nil),
 	)
 	rg.POST("/admin/maintenance/backfill-locks", locksBackfillHandler.BackfillLocks)
+
+	// Rotation de DATA_ENCRYPTION_KEY : rechiffrement avec la clé active
+	reencryptHandler := handlers.NewAdminReencryptHandler(db, services.NewKeyRotationService(db))
+	rg.POST("/admin/maintenance/reencrypt", reencryptHandler.Reencrypt)
+	rg.GET("/admin/maintenance/reencrypt", reencryptHandler.ReencryptStatus)
+
+	// Taux de change (reality check multi-devises) : fichier BCE ou JSON
+	fxRatesHandler := handlers.NewAdminFXRatesHandler(db, services.NewFXRateService(db))
+	rg.POST("/admin/fx-rates", fxRatesHandler.UploadFXRates)
+	rg.GET("/admin/fx-rates", fxRatesHandler.ListFXRates)
 }
 
 // newMonthlyRecapService wires the recap service against a BudgetService.
@@ -143,18 +205,46 @@ func NewMonthlyRecapHandlerForScheduler(db *sql.DB) *handlers.AdminMonthlyRecapH
 	)
 }
 
-func SetupEnableBankingRoutes(rg *gin.RouterGroup, db *sql.DB) {
-	handler := handlers.NewEnableBankingHandler(db)
+func SetupEnableBankingRoutes(rg *gin.RouterGroup, db *sql.DB, wsHandler *handlers.WSHandler) {
+	handler := handlers.NewEnableBankingHandler(db, wsHandler)
 	rg.GET("/banking/enablebanking/banks", handler.GetBanks)
 	rg.POST("/banking/enablebanking/connect", handler.CreateConnection)
 	rg.GET("/banking/enablebanking/callback", handler.HandleCallback)
-	rg.GET("/budgets/:id/banking/enablebanking/connections", handler.GetConnections)
-	rg.POST("/budgets/:id/banking/enablebanking/sync", handler.SyncAccounts)
+	rg.GET("/budgets/:id/banking/enablebanking/connections",
+		middleware.RequireBudgetPermission(db, services.PermRead), handler.GetConnections)
+	rg.POST("/budgets/:id/banking/enablebanking/sync",
+		middleware.RequireBudgetPermission(db, services.PermManageBanking), handler.SyncAccounts)
+	rg.POST("/budgets/:id/banking/enablebanking/connections/:connection_id/reconnect",
+		middleware.RequireBudgetPermission(db, services.PermManageBanking), handler.ReconnectConnection)
+	rg.PUT("/budgets/:id/banking/accounts/:account_id/pool",
+		middleware.RequireBudgetPermission(db, services.PermManageBanking), handler.UpdateAccountPool)
+	rg.GET("/budgets/:id/banking/transactions",
+		middleware.RequireBudgetPermission(db, services.PermRead), handler.ListBudgetTransactions)
+	rg.POST("/budgets/:id/banking/transactions/sync",
+		middleware.RequireBudgetPermission(db, services.PermManageBanking), handler.SyncTransactions)
+	rg.GET("/budgets/:id/banking/reconciliation",
+		middleware.RequireBudgetPermission(db, services.PermRead), handler.GetReconciliation)
+	rg.PUT("/budgets/:id/banking/reconciliation/:transaction_id",
+		middleware.RequireBudgetPermission(db, services.PermWrite), handler.ConfirmReconciliationMatch)
+	rg.POST("/budgets/:id/banking/reconciliation/:transaction_id/reject",
+		middleware.RequireBudgetPermission(db, services.PermWrite), handler.RejectReconciliationMatch)
+	rg.DELETE("/budgets/:id/banking/reconciliation/:transaction_id",
+		middleware.RequireBudgetPermission(db, services.PermWrite), handler.ResetReconciliationMatch)
+	rg.GET("/budgets/:id/banking/recurring",
+		middleware.RequireBudgetPermission(db, services.PermRead), handler.DetectRecurringCharges)
+	rg.POST("/budgets/:id/banking/recurring/import",
+		middleware.RequireBudgetPermission(db, services.PermWrite), handler.ImportRecurringCharges)
+	rg.POST("/budgets/:id/banking/imports",
+		middleware.RequireBudgetPermission(db, services.PermManageBanking), handler.ImportBankStatement)
+	rg.GET("/budgets/:id/banking/balance-history",
+		middleware.RequireBudgetPermission(db, services.PermRead), handler.GetBalanceHistory)
+	rg.GET("/banking/imports/presets", handler.GetStatementPresets)
 
 	rg.POST("/banking/enablebanking/refresh", handler.RefreshBalances)
 	rg.GET("/banking/enablebanking/transactions", handler.GetTransactions)
 	rg.DELETE("/banking/enablebanking/connections/:id", handler.DeleteConnection)
-	rg.GET("/banking/budgets/:id/reality-check", handler.GetConnections)
+	rg.GET("/banking/budgets/:id/reality-check",
+		middleware.RequireBudgetPermission(db, services.PermRead), handler.RealityCheck)
 }
 
 func SetupMarketSuggestionsRoutes(rg *gin.RouterGroup, db *sql.DB, wsHandler *handlers.WSHandler) {
@@ -167,7 +257,8 @@ func SetupMarketSuggestionsRoutes(rg *gin.RouterGroup, db *sql.DB, wsHandler *ha
 
 	rg.POST("/suggestions/analyze", handler.AnalyzeCharge)
 	rg.GET("/suggestions/category/:category", handler.GetCategorySuggestions)
-	rg.POST("/budgets/:id/suggestions/bulk-analyze", handler.BulkAnalyzeCharges)
+	rg.POST("/budgets/:id/suggestions/bulk-analyze",
+		middleware.RequireBudgetPermission(db, services.PermWrite), handler.BulkAnalyzeCharges)
 
 	// FIXED: Updated method name to match handler definition
 	rg.POST("/categorize", handler.CategorizeLabel)
@@ -0,0 +1,322 @@
+// services/balance_history.go
+// ============================================================================
+// BALANCE HISTORY — soldes quotidiens et courbe de patrimoine
+// ============================================================================
+// banking_accounts.balance ne garde que le dernier solde. Chaque écriture de
+// solde (synchro planifiée, refresh, SaveAccount, import de relevé) ajoute
+// aussi un point dans bank_balance_snapshots : un par compte et par jour, le
+// dernier de la journée l'emporte. Un relevé importé date son point du jour
+// de son solde de clôture.
+//
+// Timeline découpe [from, to] en périodes (jour, semaine ISO, mois) ; la
+// valeur d'un compte pour une période est son dernier point à la fin de la
+// période (report du dernier solde connu, rien avant le premier point). Le
+// patrimoine agrège les comptes dans la devise du budget, au taux du jour de
+// fin de période.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// Découpages de la timeline
+const (
+	TimelineDay   = "day"
+	TimelineWeek  = "week"
+	TimelineMonth = "month"
+)
+
+// timelineMaxBuckets borne la taille de la réponse (≈ 2 ans au jour près).
+const timelineMaxBuckets = 750
+
+var ErrInvalidTimeline = errors.New("invalid timeline range")
+
+// sqlExecer : *sql.DB ou *sql.Tx
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordBalanceSnapshot copie le solde actuel du compte dans l'historique, à
+// la date donnée (YYYY-MM-DD) ou aujourd'hui si elle est vide.
+func recordBalanceSnapshot(ctx context.Context, db sqlExecer, accountID, date string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO bank_balance_snapshots (account_id, snapshot_date, balance, currency)
+		SELECT id, COALESCE(NULLIF($2, '')::date, CURRENT_DATE), balance, currency
+		FROM banking_accounts
+		WHERE id = $1 AND balance IS NOT NULL
+		ON CONFLICT (account_id, snapshot_date)
+		DO UPDATE SET balance = EXCLUDED.balance, currency = EXCLUDED.currency, updated_at = NOW()
+	`, accountID, date)
+	if err != nil {
+		return fmt.Errorf("record balance snapshot: %w", err)
+	}
+	return nil
+}
+
+// updateAccountBalance écrit le solde d'un compte et son point du jour.
+func updateAccountBalance(ctx context.Context, db *sql.DB, accountID string, balance float64) error {
+	return utils.WithTransaction(db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE banking_accounts SET balance = $1, last_sync_at = NOW() WHERE id = $2
+		`, balance, accountID); err != nil {
+			return err
+		}
+		return recordBalanceSnapshot(ctx, tx, accountID, "")
+	})
+}
+
+// ============================================================================
+// TIMELINE (pur)
+// ============================================================================
+
+type balanceSnapshot struct {
+	Date    string
+	Balance float64
+}
+
+type timelineAccount struct {
+	ID       string
+	Name     string
+	Currency string
+}
+
+// TimelineQuery : période, découpage et périmètre de la courbe.
+type TimelineQuery struct {
+	From            time.Time
+	To              time.Time
+	Interval        string
+	SavingsPoolOnly bool   // comptes épargne commune de tous les membres
+	AccountID       string // un seul compte (optionnel)
+}
+
+// timelineBuckets renvoie les périodes [début, fin] qui couvrent from..to ;
+// la dernière est tronquée à to.
+func timelineBuckets(from, to time.Time, interval string) ([][2]time.Time, error) {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: from is after to", ErrInvalidTimeline)
+	}
+
+	var buckets [][2]time.Time
+	for start := from; !start.After(to); {
+		var end time.Time
+		switch interval {
+		case TimelineDay:
+			end = start
+		case TimelineWeek:
+			// Semaine ISO : du lundi au dimanche
+			end = start.AddDate(0, 0, (7-int(start.Weekday()))%7)
+		case TimelineMonth:
+			end = time.Date(start.Year(), start.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+		default:
+			return nil, fmt.Errorf("%w: interval must be day, week or month", ErrInvalidTimeline)
+		}
+		if end.After(to) {
+			end = to
+		}
+		buckets = append(buckets, [2]time.Time{start, end})
+		if len(buckets) > timelineMaxBuckets {
+			return nil, fmt.Errorf("%w: too many %s buckets (max %d)", ErrInvalidTimeline, interval, timelineMaxBuckets)
+		}
+		start = end.AddDate(0, 0, 1)
+	}
+	return buckets, nil
+}
+
+// balancesAt renvoie, pour chaque date (croissantes), le dernier solde connu
+// à cette date ; nil avant le premier point.
+func balancesAt(snapshots []balanceSnapshot, dates []string) []*float64 {
+	values := make([]*float64, len(dates))
+	i := -1
+	for d, date := range dates {
+		for i+1 < len(snapshots) && snapshots[i+1].Date <= date {
+			i++
+		}
+		if i >= 0 {
+			v := snapshots[i].Balance
+			values[d] = &v
+		}
+	}
+	return values
+}
+
+// buildTimeline assemble séries par compte et patrimoine agrégé.
+func buildTimeline(accounts []timelineAccount, snapshots map[string][]balanceSnapshot, buckets [][2]time.Time, currency string, rates fxHistory) ([]models.AccountBalanceSeries, []models.NetWorthPoint, []string) {
+	dates := make([]string, len(buckets))
+	netWorth := make([]models.NetWorthPoint, len(buckets))
+	tables := make([]fxTable, len(buckets))
+	for i, b := range buckets {
+		dates[i] = b[1].Format(transactionDateLayout)
+		netWorth[i] = models.NetWorthPoint{Start: b[0].Format(transactionDateLayout), Date: dates[i]}
+		tables[i] = rates.on(dates[i])
+	}
+
+	missing := map[string]bool{}
+	series := make([]models.AccountBalanceSeries, 0, len(accounts))
+	for _, acc := range accounts {
+		s := models.AccountBalanceSeries{
+			AccountID: acc.ID,
+			Name:      acc.Name,
+			Currency:  acc.Currency,
+			Points:    make([]models.BalancePoint, len(dates)),
+		}
+		for i, v := range balancesAt(snapshots[acc.ID], dates) {
+			s.Points[i] = models.BalancePoint{Date: dates[i], Balance: v}
+			if v == nil {
+				continue
+			}
+			rate, _, ok := fxRateBetween(acc.Currency, currency, tables[i])
+			if !ok {
+				missing[acc.Currency] = true
+				continue
+			}
+			converted := roundCents(*v * rate)
+			s.Points[i].Converted = &converted
+			netWorth[i].Total += converted
+			netWorth[i].Accounts++
+		}
+		series = append(series, s)
+	}
+
+	for i := range netWorth {
+		netWorth[i].Total = roundCents(netWorth[i].Total)
+	}
+	var missingRates []string
+	for c := range missing {
+		missingRates = append(missingRates, c)
+	}
+	sort.Strings(missingRates)
+	return series, netWorth, missingRates
+}
+
+// ============================================================================
+// SERVICE
+// ============================================================================
+
+type BalanceHistoryService struct {
+	db *sql.DB
+	fx *FXRateService
+}
+
+func NewBalanceHistoryService(db *sql.DB, fx *FXRateService) *BalanceHistoryService {
+	return &BalanceHistoryService{db: db, fx: fx}
+}
+
+// Timeline renvoie la courbe des comptes que userID a connectés au budget,
+// ou des comptes épargne commune de tous les membres (SavingsPoolOnly).
+func (s *BalanceHistoryService) Timeline(ctx context.Context, budgetID, userID string, q TimelineQuery) (*models.BalanceTimeline, error) {
+	buckets, err := timelineBuckets(q.From, q.To, q.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	currency, err := s.fx.BudgetCurrency(ctx, budgetID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Périmètre commun aux deux requêtes
+	where := []string{"bc.budget_id = $1"}
+	args := []interface{}{budgetID}
+	add := func(clause string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+	if q.SavingsPoolOnly {
+		where = append(where, "ba.is_savings_pool = TRUE")
+	} else {
+		add("bc.user_id = $%d", userID)
+	}
+	if q.AccountID != "" {
+		add("ba.id = $%d", q.AccountID)
+	}
+	scope := `
+		FROM banking_accounts ba
+		JOIN banking_connections bc ON bc.id = ba.connection_id
+		WHERE ` + strings.Join(where, " AND ")
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ba.id, COALESCE(ba.account_name, ''), UPPER(COALESCE(NULLIF(ba.currency, ''), $`+fmt.Sprint(len(args)+1)+`))`+
+		scope+`
+		ORDER BY ba.account_name, ba.id
+	`, append(args, currency)...)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []timelineAccount
+	for rows.Next() {
+		var a timelineAccount
+		if err := rows.Scan(&a.ID, &a.Name, &a.Currency); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	from := buckets[0][0].Format(transactionDateLayout)
+	to := buckets[len(buckets)-1][1].Format(transactionDateLayout)
+
+	// Les points de la période, plus le dernier point avant from (report)
+	n := len(args)
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT bs.account_id, to_char(bs.snapshot_date, 'YYYY-MM-DD'), bs.balance
+		FROM bank_balance_snapshots bs
+		WHERE bs.account_id IN (SELECT ba.id`+scope+`)
+		  AND bs.snapshot_date <= $`+fmt.Sprint(n+2)+`::date
+		  AND bs.snapshot_date >= COALESCE((
+			SELECT MAX(p.snapshot_date) FROM bank_balance_snapshots p
+			WHERE p.account_id = bs.account_id AND p.snapshot_date < $`+fmt.Sprint(n+1)+`::date
+		  ), $`+fmt.Sprint(n+1)+`::date)
+		ORDER BY bs.account_id, bs.snapshot_date
+	`, append(args, from, to)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := map[string][]balanceSnapshot{}
+	for rows.Next() {
+		var accountID string
+		var snap balanceSnapshot
+		if err := rows.Scan(&accountID, &snap.Date, &snap.Balance); err != nil {
+			return nil, err
+		}
+		snapshots[accountID] = append(snapshots[accountID], snap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rates, err := s.fx.history(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	series, netWorth, missing := buildTimeline(accounts, snapshots, buckets, currency, rates)
+	return &models.BalanceTimeline{
+		Currency:        currency,
+		Interval:        q.Interval,
+		From:            from,
+		To:              to,
+		SavingsPoolOnly: q.SavingsPoolOnly,
+		Accounts:        series,
+		NetWorth:        netWorth,
+		MissingRates:    missing,
+	}, nil
+}
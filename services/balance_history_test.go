@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LovationAdmin/budget-api/models"
+)
+
+func TestTimelineBuckets(t *testing.T) {
+	cases := []struct {
+		name     string
+		from, to string
+		interval string
+		want     []string // "début..fin"
+	}{
+		{"day", "2026-02-27", "2026-03-01", TimelineDay,
+			[]string{"2026-02-27..2026-02-27", "2026-02-28..2026-02-28", "2026-03-01..2026-03-01"}},
+		// 2026-03-04 est un mercredi : première semaine partielle
+		{"week", "2026-03-04", "2026-03-18", TimelineWeek,
+			[]string{"2026-03-04..2026-03-08", "2026-03-09..2026-03-15", "2026-03-16..2026-03-18"}},
+		{"month", "2026-01-15", "2026-03-10", TimelineMonth,
+			[]string{"2026-01-15..2026-01-31", "2026-02-01..2026-02-28", "2026-03-01..2026-03-10"}},
+	}
+	for _, tc := range cases {
+		buckets, err := timelineBuckets(day(tc.from), day(tc.to), tc.interval)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var got []string
+		for _, b := range buckets {
+			got = append(got, b[0].Format(transactionDateLayout)+".."+b[1].Format(transactionDateLayout))
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s: buckets = %v", tc.name, got)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: bucket %d = %s, want %s", tc.name, i, got[i], tc.want[i])
+			}
+		}
+	}
+}
+
+func TestTimelineBucketsInvalid(t *testing.T) {
+	if _, err := timelineBuckets(day("2026-03-02"), day("2026-03-01"), TimelineDay); !errors.Is(err, ErrInvalidTimeline) {
+		t.Errorf("from after to: err = %v", err)
+	}
+	if _, err := timelineBuckets(day("2026-03-01"), day("2026-03-02"), "year"); !errors.Is(err, ErrInvalidTimeline) {
+		t.Errorf("unknown interval: err = %v", err)
+	}
+	if _, err := timelineBuckets(day("2020-01-01"), day("2026-01-01"), TimelineDay); !errors.Is(err, ErrInvalidTimeline) {
+		t.Errorf("too many buckets: err = %v", err)
+	}
+}
+
+func TestBalancesAt(t *testing.T) {
+	snapshots := []balanceSnapshot{
+		{Date: "2026-02-20", Balance: 100},
+		{Date: "2026-03-02", Balance: 150},
+		{Date: "2026-03-05", Balance: 120},
+	}
+	got := balancesAt(snapshots, []string{"2026-02-19", "2026-03-01", "2026-03-02", "2026-03-04", "2026-03-31"})
+	want := []float64{-1, 100, 150, 150, 120}
+	for i, v := range got {
+		if want[i] < 0 {
+			if v != nil {
+				t.Errorf("point %d = %v, want nil", i, *v)
+			}
+			continue
+		}
+		if v == nil || *v != want[i] {
+			t.Errorf("point %d = %v, want %v", i, v, want[i])
+		}
+	}
+}
+
+func TestBuildTimeline(t *testing.T) {
+	accounts := []timelineAccount{
+		{ID: "a", Name: "Compte joint", Currency: "EUR"},
+		{ID: "b", Name: "Livret USD", Currency: "USD"},
+		{ID: "c", Name: "Compte JPY", Currency: "JPY"},
+	}
+	snapshots := map[string][]balanceSnapshot{
+		"a": {{Date: "2026-02-25", Balance: 1000}, {Date: "2026-03-10", Balance: 1200.5}},
+		"b": {{Date: "2026-03-05", Balance: 216}},
+		"c": {{Date: "2026-03-01", Balance: 50000}},
+	}
+	rates := fxHistory{
+		"USD": {{Date: "2026-03-01", Currency: "USD", Rate: 1.08}, {Date: "2026-03-09", Currency: "USD", Rate: 1.2}},
+	}
+	buckets, _ := timelineBuckets(day("2026-03-02"), day("2026-03-15"), TimelineWeek)
+
+	series, netWorth, missing := buildTimeline(accounts, snapshots, buckets, "EUR", rates)
+
+	if len(series) != 3 || len(netWorth) != 2 {
+		t.Fatalf("series = %+v, net worth = %+v", series, netWorth)
+	}
+	// Semaine 1 (→ 08/03) : 1000 € + 216 $ à 1.08 ; semaine 2 (→ 15/03) : 1200.5 € + 216 $ à 1.2
+	want := []models.NetWorthPoint{
+		{Start: "2026-03-02", Date: "2026-03-08", Total: 1200, Accounts: 2},
+		{Start: "2026-03-09", Date: "2026-03-15", Total: 1380.5, Accounts: 2},
+	}
+	for i := range want {
+		if netWorth[i] != want[i] {
+			t.Errorf("net worth %d = %+v, want %+v", i, netWorth[i], want[i])
+		}
+	}
+	if p := series[1].Points[0]; p.Balance == nil || *p.Balance != 216 || p.Converted == nil || *p.Converted != 200 {
+		t.Errorf("USD point = %+v", p)
+	}
+	if p := series[2].Points[0]; p.Balance == nil || p.Converted != nil {
+		t.Errorf("JPY point without rate = %+v", p)
+	}
+	if len(missing) != 1 || missing[0] != "JPY" {
+		t.Errorf("missing rates = %v", missing)
+	}
+}
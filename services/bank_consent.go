@@ -0,0 +1,234 @@
+// services/bank_consent.go
+// ============================================================================
+// BANK CONSENT — expiration du consentement PSD2 et relances
+// ============================================================================
+// Une session Enable Banking n'est valable que jusqu'à access.valid_until
+// (90 jours max). banking_connections.expires_at porte cette date réelle et
+// banking_connections.status suit :
+//
+//   active   → consentement valide
+//   expiring → expire dans moins de BANK_CONSENT_REMINDER_DAYS (email envoyé)
+//   expired  → date dépassée, ou session EXPIRED côté banque
+//   revoked  → session REVOKED / CLOSED / INVALID côté banque
+//   error    → bankSyncErrorThreshold synchros en échec d'affilée
+//
+// expired et revoked sont terminaux : seule une reconnexion (même ASPSP,
+// nouvelle session, mêmes comptes) remet la connexion en active. Le
+// scheduler ne synchronise que active / expiring / error.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// Statuts d'une connexion bancaire (banking_connections.status)
+const (
+	ConnectionActive   = "active"
+	ConnectionExpiring = "expiring"
+	ConnectionExpired  = "expired"
+	ConnectionRevoked  = "revoked"
+	ConnectionError    = "error"
+)
+
+// DefaultConsentValidity est demandé à la banque lors de l'autorisation ; la
+// banque peut accorder moins, c'est alors son valid_until qui fait foi.
+const DefaultConsentValidity = 90 * 24 * time.Hour
+
+// ParseConsentValidUntil lit un valid_until Enable Banking (RFC 3339).
+func ParseConsentValidUntil(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// nextConsentStatus applique l'échéance du consentement au statut courant.
+func nextConsentStatus(current string, expiresAt, now time.Time, window time.Duration) string {
+	switch current {
+	case ConnectionExpired, ConnectionRevoked:
+		return current
+	}
+	if expiresAt.IsZero() {
+		return current
+	}
+	if !now.Before(expiresAt) {
+		return ConnectionExpired
+	}
+	if expiresAt.Sub(now) <= window {
+		return ConnectionExpiring
+	}
+	if current == ConnectionExpiring {
+		// Consentement prolongé (reconnexion)
+		return ConnectionActive
+	}
+	return current
+}
+
+// consentStatusFromSession traduit le statut d'une session Enable Banking ;
+// "" si la session est toujours utilisable.
+func consentStatusFromSession(sessionStatus string) string {
+	switch strings.ToUpper(sessionStatus) {
+	case "EXPIRED":
+		return ConnectionExpired
+	case "REVOKED", "CLOSED", "INVALID":
+		return ConnectionRevoked
+	}
+	return ""
+}
+
+// ConsentCheckResult résume un passage de CheckConsents.
+type ConsentCheckResult struct {
+	Updated  int
+	Reminded int
+}
+
+type BankConsentService struct {
+	db             *sql.DB
+	email          *EmailService
+	reminderWindow time.Duration
+}
+
+// NewBankConsentService lit BANK_CONSENT_REMINDER_DAYS (défaut 7).
+func NewBankConsentService(db *sql.DB, email *EmailService) *BankConsentService {
+	days := envInt("BANK_CONSENT_REMINDER_DAYS", 7)
+	if days < 1 {
+		days = 1
+	}
+	return &BankConsentService{
+		db:             db,
+		email:          email,
+		reminderWindow: time.Duration(days) * 24 * time.Hour,
+	}
+}
+
+// CheckConsents fait avancer les statuts selon expires_at puis envoie les
+// relances des connexions qui viennent de passer en expiring.
+func (s *BankConsentService) CheckConsents(ctx context.Context) (ConsentCheckResult, error) {
+	var result ConsentCheckResult
+
+	updated, err := s.updateStatuses(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Updated = updated
+
+	reminded, err := s.sendReminders(ctx)
+	result.Reminded = reminded
+	return result, err
+}
+
+func (s *BankConsentService) updateStatuses(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, status, expires_at
+		FROM banking_connections
+		WHERE status IN ($1, $2, $3) AND expires_at IS NOT NULL
+	`, ConnectionActive, ConnectionExpiring, ConnectionError)
+	if err != nil {
+		return 0, err
+	}
+
+	type change struct{ id, from, to string }
+	var changes []change
+	now := time.Now()
+	for rows.Next() {
+		var id, status string
+		var expiresAt time.Time
+		if err := rows.Scan(&id, &status, &expiresAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if next := nextConsentStatus(status, expiresAt, now, s.reminderWindow); next != status {
+			changes = append(changes, change{id, status, next})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, c := range changes {
+		// Condition sur l'ancien statut : une reconnexion concurrente gagne
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE banking_connections
+			SET status = $1, status_changed_at = NOW(), updated_at = NOW()
+			WHERE id = $2 AND status = $3
+		`, c.to, c.id, c.from)
+		if err != nil {
+			return updated, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			updated++
+			utils.LogBankingAction("ConsentStatus-"+c.to, c.id, "")
+		}
+	}
+	return updated, nil
+}
+
+// sendReminders réserve les relances (consent_reminder_sent_at) avant
+// l'envoi, pour qu'une seule instance écrive à l'utilisateur. Remis à NULL
+// si l'email échoue, la relance repart au passage suivant.
+func (s *BankConsentService) sendReminders(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE banking_connections bc
+		SET consent_reminder_sent_at = NOW()
+		FROM users u, budgets b
+		WHERE u.id = bc.user_id AND b.id = bc.budget_id
+		  AND bc.status = $1
+		  AND bc.consent_reminder_sent_at IS NULL
+		  AND bc.expires_at > NOW()
+		RETURNING bc.id, bc.budget_id, bc.aspsp_name, bc.expires_at, u.email, COALESCE(u.name, ''), COALESCE(b.name, '')
+	`, ConnectionExpiring)
+	if err != nil {
+		return 0, err
+	}
+
+	type reminder struct {
+		connectionID, budgetID, bankName string
+		email, userName, budgetName      string
+		expiresAt                        time.Time
+	}
+	var reminders []reminder
+	for rows.Next() {
+		var r reminder
+		if err := rows.Scan(&r.connectionID, &r.budgetID, &r.bankName, &r.expiresAt, &r.email, &r.userName, &r.budgetName); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		reminders = append(reminders, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	now := time.Now()
+	for _, r := range reminders {
+		daysLeft := int(math.Ceil(r.expiresAt.Sub(now).Hours() / 24))
+		if err := s.email.SendBankConsentReminder(r.email, r.userName, r.bankName, r.budgetName, r.budgetID, daysLeft); err != nil {
+			utils.SafeWarn("⚠️  Failed to send bank consent reminder: %v", err)
+			if _, err := s.db.ExecContext(ctx, `
+				UPDATE banking_connections SET consent_reminder_sent_at = NULL WHERE id = $1
+			`, r.connectionID); err != nil {
+				utils.SafeError("Failed to release bank consent reminder: %v", err)
+			}
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
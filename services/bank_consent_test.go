@@ -0,0 +1,67 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextConsentStatus(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	window := 7 * 24 * time.Hour
+	day := 24 * time.Hour
+
+	cases := []struct {
+		name      string
+		current   string
+		expiresAt time.Time
+		want      string
+	}{
+		{"active far from expiry", ConnectionActive, now.Add(30 * day), ConnectionActive},
+		{"active enters window", ConnectionActive, now.Add(5 * day), ConnectionExpiring},
+		{"error enters window", ConnectionError, now.Add(2 * day), ConnectionExpiring},
+		{"error far from expiry", ConnectionError, now.Add(30 * day), ConnectionError},
+		{"expiring after reconnect", ConnectionExpiring, now.Add(90 * day), ConnectionActive},
+		{"expiring reaches expiry", ConnectionExpiring, now, ConnectionExpired},
+		{"active past expiry", ConnectionActive, now.Add(-day), ConnectionExpired},
+		{"revoked is terminal", ConnectionRevoked, now.Add(30 * day), ConnectionRevoked},
+		{"expired is terminal", ConnectionExpired, now.Add(30 * day), ConnectionExpired},
+		{"unknown expiry", ConnectionActive, time.Time{}, ConnectionActive},
+	}
+	for _, tc := range cases {
+		if got := nextConsentStatus(tc.current, tc.expiresAt, now, window); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestConsentStatusFromSession(t *testing.T) {
+	cases := map[string]string{
+		"AUTHORIZED": "",
+		"":           "",
+		"EXPIRED":    ConnectionExpired,
+		"REVOKED":    ConnectionRevoked,
+		"closed":     ConnectionRevoked,
+		"INVALID":    ConnectionRevoked,
+	}
+	for status, want := range cases {
+		if got := consentStatusFromSession(status); got != want {
+			t.Errorf("consentStatusFromSession(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestParseConsentValidUntil(t *testing.T) {
+	got, ok := ParseConsentValidUntil("2026-06-01T12:30:00.123456+00:00")
+	if !ok {
+		t.Fatal("expected fractional RFC 3339 to parse")
+	}
+	if want := time.Date(2026, 6, 1, 12, 30, 0, 123456000, time.UTC); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	for _, value := range []string{"", "  ", "2026-06-01", "tomorrow"} {
+		if _, ok := ParseConsentValidUntil(value); ok {
+			t.Errorf("ParseConsentValidUntil(%q) should fail", value)
+		}
+	}
+}
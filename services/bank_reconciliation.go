@@ -0,0 +1,709 @@
+// services/bank_reconciliation.go
+// ============================================================================
+// BANK RECONCILIATION — le plan (budget_data) face au ledger bancaire
+// ============================================================================
+// Pour un mois donné, on rapproche les transactions du ledger (comptes que
+// les membres actuels ont connectés au budget) :
+//
+//   - des charges récurrentes actives : même devise que le budget, similarité
+//     du libellé, montant à reconcileAmountTolerance près, jour du mois
+//     (dayOfMonth de la charge, sinon médiane des rapprochements confirmés).
+//     Une charge = un débit.
+//   - des projets : même devise, similarité du libellé, montant libre,
+//     plusieurs débits.
+//
+// Les propositions sont recalculées à chaque lecture ; seules les décisions
+// des membres sont stockées (bank_transaction_matches), partagées par tout
+// le budget :
+//   confirmed → la transaction va sur cette cible (ou "none" : hors plan assumé)
+//   rejected  → ne plus proposer cette cible pour cette transaction
+//
+// Le rapport donne, par charge et par projet, prévu / réel / écart, les
+// charges non débitées (missed) et les débits hors plan (unexpected).
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// Cibles et décisions de rapprochement (bank_transaction_matches)
+const (
+	MatchTargetCharge  = "charge"
+	MatchTargetProject = "project"
+	MatchTargetNone    = "none"
+
+	MatchConfirmed = "confirmed"
+	MatchRejected  = "rejected"
+)
+
+// Statuts d'une charge dans le rapport
+const (
+	ChargePaid           = "paid"
+	ChargeAmountMismatch = "amount_mismatch"
+	ChargePending        = "pending"
+	ChargeMissed         = "missed"
+)
+
+const (
+	reconcileAmountTolerance = 0.10 // ±10 % du montant prévu
+	reconcileMinTolerance    = 2.0  // ... mais au moins 2 (petites charges)
+	reconcileMinScore        = 0.55
+	reconcileProjectMinLabel = 0.5
+	reconcileDayWindow       = 5 // jours d'écart avant que le score de date tombe à 0
+	reconcileGraceDays       = 3 // délai avant de déclarer une charge manquée
+	reconcileDayHistory      = 12 * 30 * 24 * time.Hour
+)
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrInvalidMatchTarget  = errors.New("invalid reconciliation target")
+)
+
+type ReconciliationService struct {
+	db     *sql.DB
+	budget *BudgetService
+}
+
+func NewReconciliationService(db *sql.DB, budget *BudgetService) *ReconciliationService {
+	return &ReconciliationService{db: db, budget: budget}
+}
+
+// ----------------------------------------------------------------------------
+// MATCHING (pur)
+// ----------------------------------------------------------------------------
+
+type reconcileTx struct {
+	ID          string
+	Date        string // YYYY-MM-DD
+	Day         int
+	Amount      float64 // signé, débit < 0
+	Currency    string
+	Description string
+}
+
+type plannedCharge struct {
+	ID          string
+	Label       string
+	Amount      float64
+	Currency    string // devise du budget, "" = inconnue
+	ExpectedDay int    // 0 = inconnu
+}
+
+type plannedProject struct {
+	ID       string
+	Label    string
+	Planned  float64
+	Currency string
+}
+
+type matchOverride struct {
+	TransactionID string
+	TargetType    string
+	TargetID      string
+	Status        string
+}
+
+type matchAssignment struct {
+	TargetType string
+	TargetID   string
+	Score      float64
+	Source     string // auto | confirmed
+}
+
+var labelAccents = strings.NewReplacer(
+	"à", "a", "â", "a", "ä", "a", "ç", "c", "é", "e", "è", "e", "ê", "e", "ë", "e",
+	"î", "i", "ï", "i", "ô", "o", "ö", "o", "ù", "u", "û", "u", "ü", "u", "ÿ", "y",
+)
+
+// labelNoise sont les mots des libellés bancaires qui ne disent rien du
+// bénéficiaire (prélèvement, carte, virement...).
+var labelNoise = map[string]bool{
+	"prlv": true, "prelevement": true, "sepa": true, "cb": true, "carte": true,
+	"vir": true, "virement": true, "paiement": true, "facture": true, "fact": true,
+	"echeance": true, "ech": true, "achat": true, "de": true, "du": true, "la": true,
+	"le": true, "les": true, "des": true, "et": true, "the": true, "sas": true,
+	"sa": true, "sarl": true, "mensuel": true, "mensualite": true, "ref": true,
+}
+
+func labelTokens(s string) []string {
+	s = labelAccents.Replace(strings.ToLower(s))
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z')
+	})
+	tokens := fields[:0]
+	for _, f := range fields {
+		if len(f) < 2 || labelNoise[f] {
+			continue
+		}
+		tokens = append(tokens, f)
+	}
+	return tokens
+}
+
+// labelSimilarity est la part des mots du libellé prévu retrouvés dans la
+// description bancaire (égalité, ou inclusion pour les mots d'au moins 4
+// lettres : "edf" ≠ "edfr" mais "netflix" ⊂ "netflixcom").
+func labelSimilarity(label, description string) float64 {
+	want := labelTokens(label)
+	if len(want) == 0 {
+		return 0
+	}
+	have := labelTokens(description)
+
+	found := 0
+	for _, w := range want {
+		for _, h := range have {
+			if w == h || (len(w) >= 4 && len(h) >= 4 && (strings.Contains(h, w) || strings.Contains(w, h))) {
+				found++
+				break
+			}
+		}
+	}
+	return float64(found) / float64(len(want))
+}
+
+// sameCurrency compare les devises du plan et de la transaction ; une devise
+// inconnue ne bloque pas le rapprochement.
+func sameCurrency(planned, actual string) bool {
+	return planned == "" || actual == "" || strings.EqualFold(planned, actual)
+}
+
+func amountTolerance(planned float64) float64 {
+	return math.Max(math.Abs(planned)*reconcileAmountTolerance, reconcileMinTolerance)
+}
+
+func amountWithinTolerance(planned, actual float64) bool {
+	return math.Abs(math.Abs(actual)-math.Abs(planned)) <= amountTolerance(planned)
+}
+
+// dayScore vaut 1 le jour attendu, 0 à reconcileDayWindow jours d'écart, et
+// 0.5 quand le jour attendu est inconnu.
+func dayScore(expected, actual int) float64 {
+	if expected <= 0 || actual <= 0 {
+		return 0.5
+	}
+	diff := expected - actual
+	if diff < 0 {
+		diff = -diff
+	}
+	// Fin de mois : le 30 et le 2 sont proches
+	if wrap := 31 - diff; wrap < diff {
+		diff = wrap
+	}
+	if diff >= reconcileDayWindow {
+		return 0
+	}
+	return 1 - float64(diff)/float64(reconcileDayWindow)
+}
+
+// chargeMatchScore note un débit face à une charge ; 0 si la devise diffère
+// ou si le montant est hors tolérance.
+func chargeMatchScore(ch plannedCharge, tx reconcileTx) float64 {
+	if tx.Amount >= 0 || !sameCurrency(ch.Currency, tx.Currency) || !amountWithinTolerance(ch.Amount, tx.Amount) {
+		return 0
+	}
+	closeness := 1 - math.Abs(math.Abs(tx.Amount)-math.Abs(ch.Amount))/amountTolerance(ch.Amount)
+	return 0.45*labelSimilarity(ch.Label, tx.Description) + 0.4*closeness + 0.15*dayScore(ch.ExpectedDay, tx.Day)
+}
+
+func overrideKey(txID, targetType, targetID string) string {
+	return txID + "|" + targetType + "|" + targetID
+}
+
+// matchTransactions affecte chaque transaction à au plus une cible : d'abord
+// les confirmations, puis les charges (meilleur score d'abord, un débit par
+// charge), puis les projets.
+func matchTransactions(charges []plannedCharge, projects []plannedProject, txs []reconcileTx, overrides []matchOverride) map[string]matchAssignment {
+	chargeByID := make(map[string]bool, len(charges))
+	for _, ch := range charges {
+		chargeByID[ch.ID] = true
+	}
+	projectByID := make(map[string]bool, len(projects))
+	for _, p := range projects {
+		projectByID[p.ID] = true
+	}
+
+	assigned := map[string]matchAssignment{}
+	chargeTaken := map[string]bool{}
+	rejected := map[string]bool{}
+
+	for _, o := range overrides {
+		if o.Status == MatchRejected {
+			rejected[overrideKey(o.TransactionID, o.TargetType, o.TargetID)] = true
+			continue
+		}
+		switch {
+		case o.TargetType == MatchTargetNone,
+			o.TargetType == MatchTargetCharge && chargeByID[o.TargetID],
+			o.TargetType == MatchTargetProject && projectByID[o.TargetID]:
+		default:
+			// Cible supprimée du budget depuis : retour au rapprochement auto
+			continue
+		}
+		assigned[o.TransactionID] = matchAssignment{
+			TargetType: o.TargetType,
+			TargetID:   o.TargetID,
+			Score:      1,
+			Source:     MatchConfirmed,
+		}
+		if o.TargetType == MatchTargetCharge {
+			chargeTaken[o.TargetID] = true
+		}
+	}
+
+	type candidate struct {
+		txID, chargeID string
+		score          float64
+	}
+	var candidates []candidate
+	for _, tx := range txs {
+		if _, ok := assigned[tx.ID]; ok || tx.Amount >= 0 {
+			continue
+		}
+		for _, ch := range charges {
+			if chargeTaken[ch.ID] || rejected[overrideKey(tx.ID, MatchTargetCharge, ch.ID)] {
+				continue
+			}
+			if score := chargeMatchScore(ch, tx); score >= reconcileMinScore {
+				candidates = append(candidates, candidate{tx.ID, ch.ID, score})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		if candidates[i].chargeID != candidates[j].chargeID {
+			return candidates[i].chargeID < candidates[j].chargeID
+		}
+		return candidates[i].txID < candidates[j].txID
+	})
+	for _, c := range candidates {
+		if _, ok := assigned[c.txID]; ok || chargeTaken[c.chargeID] {
+			continue
+		}
+		assigned[c.txID] = matchAssignment{TargetType: MatchTargetCharge, TargetID: c.chargeID, Score: c.score, Source: "auto"}
+		chargeTaken[c.chargeID] = true
+	}
+
+	for _, tx := range txs {
+		if _, ok := assigned[tx.ID]; ok || tx.Amount >= 0 {
+			continue
+		}
+		best, bestScore := "", 0.0
+		for _, p := range projects {
+			if rejected[overrideKey(tx.ID, MatchTargetProject, p.ID)] || !sameCurrency(p.Currency, tx.Currency) {
+				continue
+			}
+			if score := labelSimilarity(p.Label, tx.Description); score > bestScore {
+				best, bestScore = p.ID, score
+			}
+		}
+		if bestScore >= reconcileProjectMinLabel {
+			assigned[tx.ID] = matchAssignment{TargetType: MatchTargetProject, TargetID: best, Score: bestScore, Source: "auto"}
+		}
+	}
+	return assigned
+}
+
+// buildReconciliationReport met en forme prévu / réel pour le mois.
+func buildReconciliationReport(budgetID string, month, now time.Time, charges []plannedCharge, projects []plannedProject, txs []reconcileTx, assigned map[string]matchAssignment) *models.ReconciliationReport {
+	report := &models.ReconciliationReport{
+		BudgetID:   budgetID,
+		Month:      month.Format("2006-01"),
+		Charges:    []models.ChargeReconciliation{},
+		Projects:   []models.ProjectReconciliation{},
+		Unexpected: []models.ReconciliationTransaction{},
+	}
+
+	byTarget := map[string][]models.ReconciliationTransaction{}
+	for _, tx := range txs {
+		view := models.ReconciliationTransaction{
+			TransactionID: tx.ID,
+			Date:          tx.Date,
+			Amount:        tx.Amount,
+			Currency:      tx.Currency,
+			Description:   tx.Description,
+		}
+		a, ok := assigned[tx.ID]
+		if !ok {
+			if tx.Amount < 0 {
+				report.Unexpected = append(report.Unexpected, view)
+				report.Totals.Unexpected += -tx.Amount
+			}
+			continue
+		}
+		view.Score = math.Round(a.Score*100) / 100
+		view.Source = a.Source
+		byTarget[a.TargetType+"|"+a.TargetID] = append(byTarget[a.TargetType+"|"+a.TargetID], view)
+	}
+
+	monthOver := !now.Before(month.AddDate(0, 1, 0))
+	monthStarted := !now.Before(month)
+
+	for _, ch := range charges {
+		matched := byTarget[MatchTargetCharge+"|"+ch.ID]
+		actual := 0.0
+		for _, t := range matched {
+			actual -= t.Amount
+		}
+
+		var status string
+		switch {
+		case len(matched) > 0 && amountWithinTolerance(ch.Amount, actual):
+			status = ChargePaid
+		case len(matched) > 0:
+			status = ChargeAmountMismatch
+		case monthOver:
+			status = ChargeMissed
+		case monthStarted && ch.ExpectedDay > 0 && now.Day() > ch.ExpectedDay+reconcileGraceDays:
+			status = ChargeMissed
+		default:
+			status = ChargePending
+		}
+		if status == ChargeMissed {
+			report.Totals.MissedCharges++
+		}
+
+		if matched == nil {
+			matched = []models.ReconciliationTransaction{}
+		}
+		report.Charges = append(report.Charges, models.ChargeReconciliation{
+			ChargeID:     ch.ID,
+			Label:        ch.Label,
+			Planned:      ch.Amount,
+			Actual:       actual,
+			Difference:   actual - ch.Amount,
+			ExpectedDay:  ch.ExpectedDay,
+			Status:       status,
+			Transactions: matched,
+		})
+		report.Totals.PlannedCharges += ch.Amount
+		report.Totals.ActualCharges += actual
+	}
+
+	for _, p := range projects {
+		matched := byTarget[MatchTargetProject+"|"+p.ID]
+		if p.Planned == 0 && len(matched) == 0 {
+			continue
+		}
+		actual := 0.0
+		for _, t := range matched {
+			actual -= t.Amount
+		}
+		if matched == nil {
+			matched = []models.ReconciliationTransaction{}
+		}
+		report.Projects = append(report.Projects, models.ProjectReconciliation{
+			ProjectID:    p.ID,
+			Label:        p.Label,
+			Planned:      p.Planned,
+			Actual:       actual,
+			Difference:   actual - p.Planned,
+			Transactions: matched,
+		})
+		report.Totals.PlannedProjects += p.Planned
+		report.Totals.ActualProjects += actual
+	}
+
+	return report
+}
+
+// medianDay renvoie le jour médian, 0 pour une liste vide.
+func medianDay(days []int) int {
+	if len(days) == 0 {
+		return 0
+	}
+	sorted := append([]int(nil), days...)
+	sort.Ints(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// ----------------------------------------------------------------------------
+// SERVICE
+// ----------------------------------------------------------------------------
+
+// Reconcile construit le rapport du mois (premier jour du mois) sur les
+// comptes de tous les membres du budget.
+func (s *ReconciliationService) Reconcile(ctx context.Context, budgetID string, month time.Time) (*models.ReconciliationReport, error) {
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	next := month.AddDate(0, 1, 0)
+
+	payload, err := s.loadPayload(ctx, budgetID)
+	if err != nil {
+		return nil, err
+	}
+
+	var currency string
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(currency, '') FROM budgets WHERE id = $1
+	`, budgetID).Scan(&currency); err != nil {
+		return nil, fmt.Errorf("get budget currency: %w", err)
+	}
+
+	learned, err := s.learnedChargeDays(ctx, budgetID, month)
+	if err != nil {
+		return nil, err
+	}
+
+	year, monthIdx := month.Year(), int(month.Month())-1
+	var charges []plannedCharge
+	for _, c := range payload.Charges {
+		if c.ID == "" || !isChargeActive(c, year, monthIdx) {
+			continue
+		}
+		day := c.DayOfMonth
+		if day <= 0 || day > 31 {
+			day = learned[c.ID]
+		}
+		charges = append(charges, plannedCharge{ID: c.ID, Label: c.Label, Amount: c.Amount, Currency: currency, ExpectedDay: day})
+	}
+
+	yearData := payload.YearlyData[fmt.Sprintf("%d", year)]
+	var projects []plannedProject
+	for _, p := range payload.Projects {
+		if p.ID == "" {
+			continue
+		}
+		planned := 0.0
+		if monthIdx < len(yearData.Expenses) {
+			planned = yearData.Expenses[monthIdx][p.ID]
+		}
+		projects = append(projects, plannedProject{ID: p.ID, Label: p.Label, Planned: planned, Currency: currency})
+	}
+
+	txs, err := s.monthTransactions(ctx, budgetID, month, next)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := s.monthOverrides(ctx, budgetID, month, next)
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := matchTransactions(charges, projects, txs, overrides)
+	return buildReconciliationReport(budgetID, month, time.Now().UTC(), charges, projects, txs, assigned), nil
+}
+
+func (s *ReconciliationService) loadPayload(ctx context.Context, budgetID string) (*budgetPayload, error) {
+	raw, err := s.budget.GetData(ctx, budgetID)
+	if err != nil {
+		return nil, fmt.Errorf("get budget data: %w", err)
+	}
+	payload, err := decodeBudgetPayload(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode budget payload: %w", err)
+	}
+	return payload, nil
+}
+
+// learnedChargeDays : jour médian des débits confirmés par charge sur les
+// douze mois précédents, tous membres confondus.
+func (s *ReconciliationService) learnedChargeDays(ctx context.Context, budgetID string, month time.Time) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.target_id, EXTRACT(DAY FROM bt.booking_date)::int
+		FROM bank_transaction_matches m
+		JOIN bank_transactions bt ON bt.id = m.transaction_id
+		WHERE m.budget_id = $1
+		  AND m.target_type = $2 AND m.status = $3
+		  AND bt.booking_date >= $4 AND bt.booking_date < $5
+	`, budgetID, MatchTargetCharge, MatchConfirmed, month.Add(-reconcileDayHistory), month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := map[string][]int{}
+	for rows.Next() {
+		var chargeID string
+		var day int
+		if err := rows.Scan(&chargeID, &day); err != nil {
+			return nil, err
+		}
+		days[chargeID] = append(days[chargeID], day)
+	}
+
+	learned := make(map[string]int, len(days))
+	for id, d := range days {
+		learned[id] = medianDay(d)
+	}
+	return learned, rows.Err()
+}
+
+// monthTransactions : transactions du mois sur les comptes connectés au
+// budget par ses membres actuels (pas ceux d'un membre parti).
+func (s *ReconciliationService) monthTransactions(ctx context.Context, budgetID string, from, to time.Time) ([]reconcileTx, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT bt.id, to_char(bt.booking_date, 'YYYY-MM-DD'), EXTRACT(DAY FROM bt.booking_date)::int,
+		       bt.amount, COALESCE(bt.currency, ''), COALESCE(bt.encrypted_description, '')
+		FROM bank_transactions bt
+		JOIN banking_accounts ba ON ba.id = bt.account_id
+		JOIN banking_connections bc ON bc.id = ba.connection_id
+		JOIN budget_members bm ON bm.budget_id = bc.budget_id AND bm.user_id = bc.user_id
+		WHERE bc.budget_id = $1
+		  AND bt.booking_date >= $2 AND bt.booking_date < $3
+		ORDER BY bt.booking_date, bt.id
+	`, budgetID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []reconcileTx
+	for rows.Next() {
+		var tx reconcileTx
+		var encrypted string
+		if err := rows.Scan(&tx.ID, &tx.Date, &tx.Day, &tx.Amount, &tx.Currency, &encrypted); err != nil {
+			return nil, err
+		}
+		if encrypted != "" {
+			plain, err := utils.Decrypt(encrypted)
+			if err != nil {
+				utils.SafeWarn("⚠️  Failed to decrypt transaction description: %v", err)
+			} else {
+				tx.Description = string(plain)
+			}
+		}
+		txs = append(txs, tx)
+	}
+	return txs, rows.Err()
+}
+
+func (s *ReconciliationService) monthOverrides(ctx context.Context, budgetID string, from, to time.Time) ([]matchOverride, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.transaction_id, m.target_type, m.target_id, m.status
+		FROM bank_transaction_matches m
+		JOIN bank_transactions bt ON bt.id = m.transaction_id
+		WHERE m.budget_id = $1
+		  AND bt.booking_date >= $2 AND bt.booking_date < $3
+	`, budgetID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overrides []matchOverride
+	for rows.Next() {
+		var o matchOverride
+		if err := rows.Scan(&o.TransactionID, &o.TargetType, &o.TargetID, &o.Status); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+// checkMatchTarget vérifie que la transaction appartient aux comptes des
+// membres du budget et que la cible existe dans le budget.
+func (s *ReconciliationService) checkMatchTarget(ctx context.Context, budgetID, transactionID, targetType, targetID string) error {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM bank_transactions bt
+			JOIN banking_accounts ba ON ba.id = bt.account_id
+			JOIN banking_connections bc ON bc.id = ba.connection_id
+			JOIN budget_members bm ON bm.budget_id = bc.budget_id AND bm.user_id = bc.user_id
+			WHERE bt.id = $1 AND bc.budget_id = $2
+		)
+	`, transactionID, budgetID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTransactionNotFound
+	}
+
+	if targetType == MatchTargetNone {
+		return nil
+	}
+	if targetID == "" || (targetType != MatchTargetCharge && targetType != MatchTargetProject) {
+		return ErrInvalidMatchTarget
+	}
+
+	payload, err := s.loadPayload(ctx, budgetID)
+	if err != nil {
+		return err
+	}
+	if targetType == MatchTargetCharge {
+		for _, c := range payload.Charges {
+			if c.ID == targetID {
+				return nil
+			}
+		}
+	} else {
+		for _, p := range payload.Projects {
+			if p.ID == targetID {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidMatchTarget
+}
+
+// ConfirmMatch rattache la transaction à une charge, un projet, ou à rien
+// (MatchTargetNone : débit hors plan assumé). Remplace la confirmation
+// précédente.
+func (s *ReconciliationService) ConfirmMatch(ctx context.Context, budgetID, userID, transactionID, targetType, targetID string) error {
+	if targetType == MatchTargetNone {
+		targetID = ""
+	}
+	if err := s.checkMatchTarget(ctx, budgetID, transactionID, targetType, targetID); err != nil {
+		return err
+	}
+
+	return utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM bank_transaction_matches
+			WHERE budget_id = $1 AND transaction_id = $2
+			  AND (status = $3 OR (target_type = $4 AND target_id = $5))
+		`, budgetID, transactionID, MatchConfirmed, targetType, targetID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO bank_transaction_matches (budget_id, user_id, transaction_id, target_type, target_id, status)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, budgetID, userID, transactionID, targetType, targetID, MatchConfirmed)
+		return err
+	})
+}
+
+// RejectMatch écarte une proposition : la cible ne sera plus proposée pour
+// cette transaction.
+func (s *ReconciliationService) RejectMatch(ctx context.Context, budgetID, userID, transactionID, targetType, targetID string) error {
+	if targetType == MatchTargetNone {
+		return ErrInvalidMatchTarget
+	}
+	if err := s.checkMatchTarget(ctx, budgetID, transactionID, targetType, targetID); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO bank_transaction_matches (budget_id, user_id, transaction_id, target_type, target_id, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (budget_id, transaction_id, target_type, target_id)
+		DO UPDATE SET status = EXCLUDED.status, updated_at = NOW()
+	`, budgetID, userID, transactionID, targetType, targetID, MatchRejected)
+	return err
+}
+
+// ResetMatches efface les décisions de tous les membres sur une transaction
+// (retour à l'auto).
+func (s *ReconciliationService) ResetMatches(ctx context.Context, budgetID, transactionID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM bank_transaction_matches
+		WHERE budget_id = $1 AND transaction_id = $2
+	`, budgetID, transactionID)
+	return err
+}
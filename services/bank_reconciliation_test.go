@@ -0,0 +1,212 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLabelSimilarity(t *testing.T) {
+	cases := []struct {
+		label, description string
+		want               float64
+	}{
+		{"Netflix", "PRLV SEPA NETFLIX.COM", 1},
+		{"Électricité EDF", "PRLV SEPA EDF clients particuliers", 0.5},
+		{"Loyer appartement", "VIR SEPA LOYER MARS", 0.5},
+		{"Assurance habitation", "CB CARREFOUR PARIS", 0},
+		{"", "NETFLIX", 0},
+		{"Crèche", "PRLV CRECHE LES PETITS", 1},
+	}
+	for _, tc := range cases {
+		if got := labelSimilarity(tc.label, tc.description); got != tc.want {
+			t.Errorf("labelSimilarity(%q, %q) = %v, want %v", tc.label, tc.description, got, tc.want)
+		}
+	}
+}
+
+func TestDayScore(t *testing.T) {
+	cases := []struct {
+		expected, actual int
+		want             float64
+	}{
+		{0, 12, 0.5},
+		{5, 5, 1},
+		{5, 7, 0.6},
+		{5, 12, 0},
+		{30, 1, 0.6}, // fin de mois → début du suivant
+	}
+	for _, tc := range cases {
+		if got := dayScore(tc.expected, tc.actual); got != tc.want {
+			t.Errorf("dayScore(%d, %d) = %v, want %v", tc.expected, tc.actual, got, tc.want)
+		}
+	}
+}
+
+func TestAmountWithinTolerance(t *testing.T) {
+	if !amountWithinTolerance(100, -108) {
+		t.Error("8% over should be within tolerance")
+	}
+	if amountWithinTolerance(100, -115) {
+		t.Error("15% over should be outside tolerance")
+	}
+	// Petites charges : plancher de reconcileMinTolerance
+	if !amountWithinTolerance(9.99, -11.49) {
+		t.Error("1.50 on a 9.99 charge should be within the minimum tolerance")
+	}
+}
+
+func reconcileFixture() ([]plannedCharge, []plannedProject, []reconcileTx) {
+	charges := []plannedCharge{
+		{ID: "rent", Label: "Loyer", Amount: 900, ExpectedDay: 5},
+		{ID: "netflix", Label: "Netflix", Amount: 13.49},
+		{ID: "gym", Label: "Salle de sport", Amount: 35, ExpectedDay: 10},
+	}
+	projects := []plannedProject{
+		{ID: "holidays", Label: "Vacances Ryanair", Planned: 300},
+	}
+	txs := []reconcileTx{
+		{ID: "t1", Date: "2026-03-05", Day: 5, Amount: -900, Description: "VIR SEPA LOYER MARS"},
+		{ID: "t2", Date: "2026-03-12", Day: 12, Amount: -13.49, Description: "PRLV NETFLIX.COM"},
+		{ID: "t3", Date: "2026-03-14", Day: 14, Amount: -249.99, Description: "CB RYANAIR DUBLIN"},
+		{ID: "t4", Date: "2026-03-20", Day: 20, Amount: -62.10, Description: "CB CARREFOUR"},
+		{ID: "t5", Date: "2026-03-28", Day: 28, Amount: 2500, Description: "VIR SALAIRE"},
+	}
+	return charges, projects, txs
+}
+
+func TestMatchTransactionsAuto(t *testing.T) {
+	charges, projects, txs := reconcileFixture()
+
+	got := matchTransactions(charges, projects, txs, nil)
+
+	want := map[string]string{"t1": "charge|rent", "t2": "charge|netflix", "t3": "project|holidays"}
+	for txID, target := range want {
+		a, ok := got[txID]
+		if !ok || a.TargetType+"|"+a.TargetID != target {
+			t.Errorf("%s matched to %+v, want %s", txID, a, target)
+		}
+		if ok && a.Source != "auto" {
+			t.Errorf("%s source = %q, want auto", txID, a.Source)
+		}
+	}
+	for _, txID := range []string{"t4", "t5"} {
+		if a, ok := got[txID]; ok {
+			t.Errorf("%s should stay unmatched, got %+v", txID, a)
+		}
+	}
+}
+
+func TestMatchTransactionsOverrides(t *testing.T) {
+	charges, projects, txs := reconcileFixture()
+
+	overrides := []matchOverride{
+		// L'utilisateur dit : t4 est la salle de sport (montant différent)
+		{TransactionID: "t4", TargetType: MatchTargetCharge, TargetID: "gym", Status: MatchConfirmed},
+		// ... et t2 n'est pas Netflix
+		{TransactionID: "t2", TargetType: MatchTargetCharge, TargetID: "netflix", Status: MatchRejected},
+		// Cible supprimée du budget : ignorée
+		{TransactionID: "t3", TargetType: MatchTargetProject, TargetID: "deleted", Status: MatchConfirmed},
+	}
+
+	got := matchTransactions(charges, projects, txs, overrides)
+
+	if a := got["t4"]; a.TargetID != "gym" || a.Source != MatchConfirmed {
+		t.Errorf("t4 = %+v, want confirmed gym", a)
+	}
+	if a, ok := got["t2"]; ok {
+		t.Errorf("rejected t2 should stay unmatched, got %+v", a)
+	}
+	if a := got["t3"]; a.TargetID != "holidays" || a.Source != "auto" {
+		t.Errorf("t3 = %+v, want auto holidays", a)
+	}
+}
+
+func TestMatchTransactionsOneDebitPerCharge(t *testing.T) {
+	charges := []plannedCharge{{ID: "netflix", Label: "Netflix", Amount: 13.49}}
+	txs := []reconcileTx{
+		{ID: "a", Day: 3, Amount: -13.49, Description: "NETFLIX"},
+		{ID: "b", Day: 20, Amount: -13.99, Description: "NETFLIX"},
+	}
+
+	got := matchTransactions(charges, nil, txs, nil)
+
+	if got["a"].TargetID != "netflix" {
+		t.Errorf("closest amount should win, got %+v", got)
+	}
+	if _, ok := got["b"]; ok {
+		t.Error("a charge is matched to a single debit")
+	}
+}
+
+func TestMatchTransactionsCurrency(t *testing.T) {
+	charges := []plannedCharge{{ID: "netflix", Label: "Netflix", Amount: 13.49, Currency: "EUR"}}
+	projects := []plannedProject{{ID: "holidays", Label: "Vacances Ryanair", Planned: 300, Currency: "EUR"}}
+	txs := []reconcileTx{
+		// Même montant, autre devise : pas la charge
+		{ID: "gbp", Day: 3, Amount: -13.49, Currency: "GBP", Description: "NETFLIX"},
+		{ID: "usd", Day: 5, Amount: -120, Currency: "USD", Description: "RYANAIR"},
+		{ID: "eur", Day: 8, Amount: -13.49, Currency: "eur", Description: "NETFLIX"},
+	}
+
+	got := matchTransactions(charges, projects, txs, nil)
+
+	if got["eur"].TargetID != "netflix" {
+		t.Errorf("eur = %+v, want netflix", got["eur"])
+	}
+	for _, txID := range []string{"gbp", "usd"} {
+		if a, ok := got[txID]; ok {
+			t.Errorf("%s in another currency matched to %+v", txID, a)
+		}
+	}
+}
+
+func TestBuildReconciliationReport(t *testing.T) {
+	charges, projects, txs := reconcileFixture()
+	charges = append(charges, plannedCharge{ID: "insurance", Label: "Assurance", Amount: 40, ExpectedDay: 25})
+	assigned := matchTransactions(charges, projects, txs, nil)
+
+	month := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Mi-mars : la salle de sport (attendue le 10) est en retard, l'assurance
+	// (attendue le 25) pas encore
+	report := buildReconciliationReport("b1", month, time.Date(2026, 3, 16, 12, 0, 0, 0, time.UTC), charges, projects, txs, assigned)
+
+	status := map[string]string{}
+	for _, ch := range report.Charges {
+		status[ch.ChargeID] = ch.Status
+	}
+	want := map[string]string{"rent": ChargePaid, "netflix": ChargePaid, "gym": ChargeMissed, "insurance": ChargePending}
+	for id, s := range want {
+		if status[id] != s {
+			t.Errorf("charge %s status = %q, want %q", id, status[id], s)
+		}
+	}
+	if report.Month != "2026-03" {
+		t.Errorf("month = %q", report.Month)
+	}
+	if len(report.Unexpected) != 1 || report.Unexpected[0].TransactionID != "t4" {
+		t.Errorf("unexpected = %+v, want only t4", report.Unexpected)
+	}
+	if len(report.Projects) != 1 || math.Abs(report.Projects[0].Difference-(-50.01)) > 1e-9 {
+		t.Errorf("projects = %+v", report.Projects)
+	}
+	if report.Totals.MissedCharges != 1 || report.Totals.PlannedCharges != 900+13.49+35+40 {
+		t.Errorf("totals = %+v", report.Totals)
+	}
+
+	// Mois terminé : tout ce qui n'a pas été débité est manqué
+	report = buildReconciliationReport("b1", month, time.Date(2026, 4, 2, 0, 0, 0, 0, time.UTC), charges, projects, txs, assigned)
+	if report.Totals.MissedCharges != 2 {
+		t.Errorf("after month end missed = %d, want 2", report.Totals.MissedCharges)
+	}
+}
+
+func TestMedianDay(t *testing.T) {
+	if got := medianDay(nil); got != 0 {
+		t.Errorf("medianDay(nil) = %d", got)
+	}
+	if got := medianDay([]int{28, 2, 3}); got != 3 {
+		t.Errorf("medianDay = %d, want 3", got)
+	}
+}
@@ -0,0 +1,250 @@
+// services/bank_statement_import.go
+// ============================================================================
+// STATEMENT IMPORT — relevés déposés → ledger bank_transactions
+// ============================================================================
+// Les comptes importés vivent dans le schéma bancaire commun, sous une
+// connexion "Relevés importés" (provider = file) par utilisateur et budget :
+// ils apparaissent avec les autres comptes, comptent dans le reality check
+// et alimentent réconciliation et détection des charges récurrentes. Ils ne
+// sont jamais synchronisés ni révoqués auprès d'un fournisseur.
+//
+// Un compte du relevé est retrouvé par son IBAN / numéro (ou son nom pour
+// les CSV qui n'en donnent pas) ; account_id force un compte importé
+// existant. Les débits sont catégorisés par CategorizerService, une fois par
+// marchand (merchantKey).
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+const statementConnectionName = "Relevés importés"
+
+type StatementImportService struct {
+	db           *sql.DB
+	transactions *BankTransactionService
+	categorizer  *CategorizerService
+}
+
+func NewStatementImportService(db *sql.DB, transactions *BankTransactionService, categorizer *CategorizerService) *StatementImportService {
+	return &StatementImportService{db: db, transactions: transactions, categorizer: categorizer}
+}
+
+// statementAccountKey : identifiant provider (banking_accounts.account_id)
+// d'un compte importé.
+func statementAccountKey(acc StatementAccount, name string) string {
+	if id := strings.ToUpper(strings.Join(strings.Fields(acc.Identifier), "")); id != "" {
+		return "file:" + id
+	}
+	return "file:name:" + strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// statementAccountName : nom explicite, sinon celui du fichier, sinon un nom
+// dérivé de la banque et des derniers chiffres du compte.
+func statementAccountName(acc StatementAccount, requested, bank string) string {
+	if requested = strings.TrimSpace(requested); requested != "" {
+		return requested
+	}
+	if acc.Name != "" {
+		return acc.Name
+	}
+	name := "Compte importé"
+	if bank != "" {
+		name = "Compte " + bank
+	}
+	if mask := statementAccountMask(acc.Identifier); mask != "" {
+		name += " ••" + mask
+	}
+	return name
+}
+
+func statementAccountMask(identifier string) string {
+	id := strings.Join(strings.Fields(identifier), "")
+	if len(id) < 4 {
+		return ""
+	}
+	return id[len(id)-4:]
+}
+
+func csvPresetBank(name string) string {
+	for _, p := range csvPresets {
+		if p.Name == name {
+			return p.Bank
+		}
+	}
+	return ""
+}
+
+// Import enregistre le relevé sur le budget. accountID (banking_accounts.id
+// d'un compte importé) n'est accepté que pour un relevé mono-compte.
+func (s *StatementImportService) Import(ctx context.Context, budgetID, userID string, st *Statement, accountID, accountName string) (*models.StatementImportResult, error) {
+	if accountID != "" && len(st.Accounts) != 1 {
+		return nil, fmt.Errorf("%w: account_id requires a statement with a single account", ErrInvalidStatement)
+	}
+
+	categories := s.categorize(ctx, st)
+	bank := csvPresetBank(st.Preset)
+
+	result := &models.StatementImportResult{
+		Format:   st.Format,
+		Preset:   st.Preset,
+		Accounts: []models.StatementImportAccount{},
+	}
+	for _, acc := range st.Accounts {
+		if len(acc.Transactions) == 0 {
+			result.Skipped += acc.Skipped
+			continue
+		}
+
+		summary := models.StatementImportAccount{Skipped: acc.Skipped}
+		var err error
+		if accountID != "" {
+			summary.AccountID, summary.Name, err = s.existingAccount(ctx, budgetID, userID, accountID, acc)
+		} else {
+			summary.Name = statementAccountName(acc, accountName, bank)
+			summary.AccountID, err = s.upsertAccount(ctx, budgetID, userID, acc, summary.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ledger := make([]ledgerTransaction, 0, len(acc.Transactions))
+		for _, raw := range acc.Transactions {
+			t, err := normalizeTransaction(raw)
+			if err != nil {
+				summary.Skipped++
+				continue
+			}
+			if t.Amount < 0 {
+				t.Category = categories[merchantKey(t.Description)]
+			}
+			ledger = append(ledger, t)
+		}
+
+		inserted, err := s.transactions.storeLedger(ctx, summary.AccountID, ledger)
+		if err != nil {
+			return nil, err
+		}
+		summary.Imported = inserted
+		summary.Duplicates = len(ledger) - inserted
+
+		result.Accounts = append(result.Accounts, summary)
+		result.Imported += summary.Imported
+		result.Duplicates += summary.Duplicates
+		result.Skipped += summary.Skipped
+	}
+
+	utils.SafeInfo("✅ Statement imported (%s): %d new, %d duplicates, %d skipped",
+		st.Format, result.Imported, result.Duplicates, result.Skipped)
+	return result, nil
+}
+
+// categorize interroge CategorizerService une fois par marchand débiteur.
+func (s *StatementImportService) categorize(ctx context.Context, st *Statement) map[string]string {
+	categories := map[string]string{}
+	if s.categorizer == nil {
+		return categories
+	}
+	for _, acc := range st.Accounts {
+		for _, raw := range acc.Transactions {
+			if raw.CreditDebitIndicator != "DBIT" {
+				continue
+			}
+			key := merchantKey(strings.Join(raw.RemittanceInformation, " "))
+			if _, done := categories[key]; done || key == "" {
+				continue
+			}
+			// GetCategory ne renvoie pas d'erreur bloquante (OTHER en repli)
+			categories[key], _ = s.categorizer.GetCategory(ctx, key)
+		}
+	}
+	return categories
+}
+
+// existingAccount vérifie qu'accountID est un compte importé de userID sur
+// le budget et met à jour son solde si le relevé en donne un.
+func (s *StatementImportService) existingAccount(ctx context.Context, budgetID, userID, accountID string, acc StatementAccount) (string, string, error) {
+	var name string
+	err := utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, `
+			UPDATE banking_accounts ba
+			SET balance = COALESCE($5, ba.balance), last_sync_at = NOW()
+			FROM banking_connections bc
+			WHERE ba.id = $1 AND bc.id = ba.connection_id
+			  AND bc.budget_id = $2 AND bc.user_id = $3 AND bc.provider = $4
+			RETURNING COALESCE(ba.account_name, '')
+		`, accountID, budgetID, userID, ProviderFile, nullableFloat(acc.Balance)).Scan(&name); err != nil {
+			return err
+		}
+		if acc.Balance == nil {
+			return nil
+		}
+		return recordBalanceSnapshot(ctx, tx, accountID, acc.BalanceDate)
+	})
+	if err == sql.ErrNoRows {
+		return "", "", ErrBankAccountNotFound
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load account: %w", err)
+	}
+	return accountID, name, nil
+}
+
+// upsertAccount crée au besoin la connexion "Relevés importés" et le compte.
+func (s *StatementImportService) upsertAccount(ctx context.Context, budgetID, userID string, acc StatementAccount, name string) (string, error) {
+	sessionID, err := encryptCredential("file:" + userID)
+	if err != nil {
+		return "", err
+	}
+
+	var accountID string
+	err = utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		var connectionID string
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO banking_connections (
+				user_id, budget_id, provider, aspsp_name, aspsp_country, session_id,
+				status, sync_status, last_sync_at, created_at, updated_at
+			) VALUES ($1, $2, $3, $4, 'FR', $5, 'active', 'ok', NOW(), NOW(), NOW())
+			ON CONFLICT (user_id, budget_id, aspsp_name, aspsp_country)
+			DO UPDATE SET last_sync_at = NOW(), updated_at = NOW()
+			RETURNING id
+		`, userID, budgetID, ProviderFile, statementConnectionName, sessionID).Scan(&connectionID); err != nil {
+			return fmt.Errorf("failed to save import connection: %w", err)
+		}
+
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO banking_accounts (
+				connection_id, account_id, account_name, account_type, mask,
+				currency, balance, last_sync_at, created_at
+			) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, NOW(), NOW())
+			ON CONFLICT (connection_id, account_id)
+			DO UPDATE SET
+				balance = COALESCE(EXCLUDED.balance, banking_accounts.balance),
+				last_sync_at = NOW()
+			RETURNING id
+		`, connectionID, statementAccountKey(acc, name), name, acc.Type,
+			statementAccountMask(acc.Identifier), acc.Currency, nullableFloat(acc.Balance)).Scan(&accountID); err != nil {
+			return fmt.Errorf("failed to save imported account: %w", err)
+		}
+		if acc.Balance == nil {
+			return nil
+		}
+		return recordBalanceSnapshot(ctx, tx, accountID, acc.BalanceDate)
+	})
+	return accountID, err
+}
+
+func nullableFloat(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
+}
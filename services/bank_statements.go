@@ -0,0 +1,813 @@
+// services/bank_statements.go
+// ============================================================================
+// BANK STATEMENTS — lecture des relevés CSV, OFX/QFX et CAMT.053
+// ============================================================================
+// Pour les banques absentes d'Enable Banking (ou quand le consentement est
+// refusé), l'utilisateur dépose un export de sa banque. Chaque format est
+// converti en Transaction, le modèle des données synchronisées, pour passer
+// par le même ledger (normalizeTransaction / bank_transactions).
+//
+//   CSV      : presets de colonnes par banque, détectés sur la ligne d'en-tête
+//              (les lignes de préambule sont ignorées), ou mapping explicite.
+//              Séparateur ; , ou tabulation, montants "1 234,56", fichiers
+//              UTF-8 ou Windows-1252.
+//   OFX/QFX  : SGML (1.x, balises feuilles non fermées) ou XML (2.x).
+//   CAMT.053 : ISO 20022 XML, toutes versions (namespace ignoré).
+//
+// Dédoublonnage : l'id de la banque quand le fichier en donne un (FITID,
+// AcctSvcrRef, NtryRef), sinon une empreinte date + montant + libellé
+// complétée du rang de l'occurrence dans le fichier. Deux cafés identiques
+// le même jour restent deux transactions, et le même relevé déposé deux fois
+// ne crée aucun doublon.
+// ============================================================================
+
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats de relevés acceptés
+const (
+	StatementFormatCSV     = "csv"
+	StatementFormatOFX     = "ofx"
+	StatementFormatCAMT053 = "camt053"
+)
+
+// MaxStatementSize borne la taille d'un fichier déposé.
+const MaxStatementSize = 5 << 20
+
+// ErrInvalidStatement : fichier illisible ou incohérent (400 côté API).
+var ErrInvalidStatement = errors.New("invalid statement file")
+
+// StatementAccount regroupe les transactions d'un compte du relevé.
+type StatementAccount struct {
+	Identifier   string // IBAN ou numéro de compte, vide si le fichier n'en donne pas
+	Name         string // libellé du compte quand le fichier en donne un
+	Type         string // CACC, SVGS, CARD
+	Currency     string
+	Balance      *float64 // solde de clôture, si le fichier le donne
+	BalanceDate  string   // date du solde (YYYY-MM-DD), vide si inconnue
+	Transactions []Transaction
+	Skipped      int // lignes illisibles
+}
+
+// Statement est un relevé lu, avant import.
+type Statement struct {
+	Format   string
+	Preset   string // CSV uniquement
+	Accounts []StatementAccount
+}
+
+// StatementOptions précise le format et, pour un CSV, les colonnes. Tout est
+// optionnel : format et preset sont détectés.
+type StatementOptions struct {
+	Format  string
+	Preset  string
+	Mapping *CSVMapping
+}
+
+// ParseStatement lit un relevé. filename sert seulement à la détection du
+// format.
+func ParseStatement(filename string, data []byte, opts StatementOptions) (*Statement, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidStatement)
+	}
+
+	format := strings.ToLower(strings.TrimSpace(opts.Format))
+	if format == "" {
+		format = detectStatementFormat(filename, data)
+	}
+
+	var (
+		st  *Statement
+		err error
+	)
+	switch format {
+	case StatementFormatCSV:
+		st, err = parseCSVStatement(data, opts.Preset, opts.Mapping)
+	case StatementFormatOFX, "qfx":
+		st, err = parseOFXStatement(data)
+	case StatementFormatCAMT053, "camt":
+		st, err = parseCAMT053Statement(data)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q (csv, ofx, camt053)", ErrInvalidStatement, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for i := range st.Accounts {
+		assignStatementIDs(st.Format, st.Accounts[i].Transactions)
+		total += len(st.Accounts[i].Transactions)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%w: no transaction found", ErrInvalidStatement)
+	}
+	return st, nil
+}
+
+// detectStatementFormat se fie au contenu, puis à l'extension.
+func detectStatementFormat(filename string, data []byte) string {
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	upper := bytes.ToUpper(head)
+	switch {
+	case bytes.Contains(upper, []byte("OFXHEADER")) || bytes.Contains(upper, []byte("<OFX>")):
+		return StatementFormatOFX
+	case bytes.Contains(head, []byte("camt.053")) || bytes.Contains(head, []byte("BkToCstmrStmt")):
+		return StatementFormatCAMT053
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ofx", ".qfx":
+		return StatementFormatOFX
+	case ".xml":
+		return StatementFormatCAMT053
+	}
+	return StatementFormatCSV
+}
+
+// assignStatementIDs donne un id stable aux transactions sans id banque :
+// empreinte du contenu + rang de l'occurrence dans le fichier.
+func assignStatementIDs(format string, txs []Transaction) {
+	seen := map[string]int{}
+	for i := range txs {
+		if txs[i].TransactionID != "" {
+			continue
+		}
+		h := sha256.New()
+		for _, part := range []string{
+			txs[i].BookingDate,
+			txs[i].TransactionAmount.Amount,
+			txs[i].CreditDebitIndicator,
+			strings.Join(labelTokens(strings.Join(txs[i].RemittanceInformation, " ")), " "),
+		} {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+		fingerprint := hex.EncodeToString(h.Sum(nil))[:32]
+		txs[i].TransactionID = fmt.Sprintf("%s:%s:%d", format, fingerprint, seen[fingerprint])
+		seen[fingerprint]++
+	}
+}
+
+// statementTransaction construit une Transaction à partir d'un montant signé.
+func statementTransaction(date string, amount float64, currency string, labels ...string) Transaction {
+	indicator := "CRDT"
+	if amount < 0 {
+		indicator = "DBIT"
+	}
+	var remittance []string
+	for _, l := range labels {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			remittance = append(remittance, l)
+		}
+	}
+	return Transaction{
+		TransactionAmount:     AmountType{Currency: currency, Amount: strconv.FormatFloat(math.Abs(amount), 'f', 2, 64)},
+		CreditDebitIndicator:  indicator,
+		Status:                "BOOK",
+		BookingDate:           date,
+		ValueDate:             date,
+		RemittanceInformation: remittance,
+	}
+}
+
+// parseStatementAmount lit "1 234,56", "-12.50", "1.234,56 €", "+3,00".
+func parseStatementAmount(raw string) (float64, error) {
+	s := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '\u202f', '€', '\'':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(raw))
+	s = strings.TrimSuffix(strings.ToUpper(s), "EUR")
+	if s == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	comma, dot := strings.LastIndex(s, ","), strings.LastIndex(s, ".")
+	switch {
+	case comma >= 0 && dot >= 0:
+		// Le dernier séparateur est le séparateur décimal
+		if comma > dot {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	case comma >= 0:
+		s = strings.Replace(s, ",", ".", 1)
+	case strings.Count(s, ".") > 1:
+		s = strings.ReplaceAll(s, ".", "")
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", raw)
+	}
+	return v, nil
+}
+
+var statementDateLayouts = []string{
+	"02/01/2006", "2006-01-02", "02/01/06", "02-01-2006", "02.01.2006", "2006/01/02",
+}
+
+// parseStatementDate renvoie la date au format YYYY-MM-DD.
+func parseStatementDate(raw, layout string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	layouts := statementDateLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	for _, l := range layouts {
+		if d, err := time.Parse(l, raw); err == nil {
+			return d.Format(transactionDateLayout), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q", raw)
+}
+
+// ============================================================================
+// CSV
+// ============================================================================
+
+// CSVMapping nomme les colonnes d'un CSV. Chaque champ accepte plusieurs
+// noms séparés par "|" ; la casse et les accents sont ignorés. Amount, ou
+// Debit et Credit, sont requis.
+type CSVMapping struct {
+	Date       string
+	Label      string
+	Detail     string // complément de libellé, optionnel
+	Amount     string
+	Debit      string
+	Credit     string
+	Currency   string
+	Account    string // numéro de compte par ligne (exports multi-comptes)
+	DateFormat string // DD/MM/YYYY, YYYY-MM-DD... (détecté si vide)
+}
+
+type csvPreset struct {
+	Name    string
+	Bank    string
+	Mapping CSVMapping
+}
+
+// csvPresets : exports des principales banques françaises. L'ordre compte
+// pour la détection, du plus spécifique au plus générique.
+var csvPresets = []csvPreset{
+	{"boursorama", "Boursorama", CSVMapping{
+		Date: "dateop", Label: "label", Amount: "amount", Account: "accountnum",
+	}},
+	{"bnp", "BNP Paribas", CSVMapping{
+		Date: "date operation", Label: "libelle operation|libelle court",
+		Amount: "montant operation en euro|montant operation",
+	}},
+	{"societe_generale", "Société Générale", CSVMapping{
+		Date: "date de l'operation", Label: "libelle", Detail: "detail de l'ecriture",
+		Amount: "montant de l'operation", Currency: "devise",
+	}},
+	{"credit_agricole", "Crédit Agricole", CSVMapping{
+		Date: "date", Label: "libelle", Debit: "debit euros", Credit: "credit euros",
+	}},
+	{"caisse_epargne", "Caisse d'Epargne", CSVMapping{
+		Date: "date", Label: "libelle", Detail: "detail", Debit: "debit", Credit: "credit",
+	}},
+	{"la_banque_postale", "La Banque Postale", CSVMapping{
+		Date: "date", Label: "libelle", Amount: "montant(euros)|montant (euros)",
+	}},
+	{"generic", "", CSVMapping{
+		Date: "date|date operation|booking date", Label: "libelle|label|description|wording",
+		Amount: "montant|amount", Debit: "debit", Credit: "credit", Currency: "devise|currency",
+	}},
+}
+
+// CSVPresetNames liste les presets disponibles.
+func CSVPresetNames() []string {
+	names := make([]string, len(csvPresets))
+	for i, p := range csvPresets {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// csvColumns : index des colonnes d'un mapping dans une ligne d'en-tête.
+type csvColumns struct {
+	date, label, detail, amount, debit, credit, currency, account int
+}
+
+func normalizeCSVHeader(s string) string {
+	s = strings.ToLower(strings.TrimSpace(strings.Trim(s, "\"\ufeff")))
+	s = labelAccents.Replace(strings.ReplaceAll(s, "’", "'"))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func findCSVColumn(header []string, names string) int {
+	if names == "" {
+		return -1
+	}
+	for _, name := range strings.Split(names, "|") {
+		name = normalizeCSVHeader(name)
+		for i, h := range header {
+			if h == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// matchCSVHeader dit si la ligne est l'en-tête décrit par le mapping.
+func matchCSVHeader(row []string, m CSVMapping) (csvColumns, bool) {
+	header := make([]string, len(row))
+	for i, h := range row {
+		header[i] = normalizeCSVHeader(h)
+	}
+	cols := csvColumns{
+		date:     findCSVColumn(header, m.Date),
+		label:    findCSVColumn(header, m.Label),
+		detail:   findCSVColumn(header, m.Detail),
+		amount:   findCSVColumn(header, m.Amount),
+		debit:    findCSVColumn(header, m.Debit),
+		credit:   findCSVColumn(header, m.Credit),
+		currency: findCSVColumn(header, m.Currency),
+		account:  findCSVColumn(header, m.Account),
+	}
+	if cols.date < 0 || cols.label < 0 {
+		return cols, false
+	}
+	return cols, cols.amount >= 0 || (cols.debit >= 0 && cols.credit >= 0)
+}
+
+// csvDateLayout convertit DD/MM/YYYY en layout Go.
+func csvDateLayout(format string) string {
+	if format == "" {
+		return ""
+	}
+	return strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02").Replace(strings.ToUpper(format))
+}
+
+// windows1252 : caractères de la plage 0x80-0x9F (le reste coïncide avec
+// Latin-1).
+var windows1252 = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '‘',
+	0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜',
+	0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// decodeStatementText retire le BOM et convertit un export Windows-1252 en
+// UTF-8.
+func decodeStatementText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	var b strings.Builder
+	b.Grow(len(data) + len(data)/8)
+	for _, c := range data {
+		if r, ok := windows1252[c]; ok {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+func parseCSVStatement(data []byte, presetName string, custom *CSVMapping) (*Statement, error) {
+	text := decodeStatementText(data)
+
+	presets := csvPresets
+	if custom != nil {
+		presets = []csvPreset{{Name: "custom", Mapping: *custom}}
+	} else if presetName != "" {
+		presets = nil
+		for _, p := range csvPresets {
+			if p.Name == presetName {
+				presets = []csvPreset{p}
+			}
+		}
+		if presets == nil {
+			return nil, fmt.Errorf("%w: unknown preset %q (%s)", ErrInvalidStatement, presetName, strings.Join(CSVPresetNames(), ", "))
+		}
+	}
+
+	for _, delimiter := range []rune{';', ',', '\t'} {
+		r := csv.NewReader(strings.NewReader(text))
+		r.Comma = delimiter
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		rows, err := r.ReadAll()
+		if err != nil || len(rows) == 0 {
+			continue
+		}
+
+		// L'en-tête est cherché dans les premières lignes (préambules
+		// "Compte courant n°..." de certaines banques)
+		for i := 0; i < len(rows) && i < 20; i++ {
+			for _, p := range presets {
+				if cols, ok := matchCSVHeader(rows[i], p.Mapping); ok {
+					return csvStatementRows(rows[i+1:], p, cols)
+				}
+			}
+		}
+	}
+
+	if custom != nil || presetName != "" {
+		return nil, fmt.Errorf("%w: the CSV header does not match the column mapping", ErrInvalidStatement)
+	}
+	return nil, fmt.Errorf("%w: unrecognised CSV columns, choose a preset (%s) or map the columns", ErrInvalidStatement, strings.Join(CSVPresetNames(), ", "))
+}
+
+func csvStatementRows(rows [][]string, p csvPreset, cols csvColumns) (*Statement, error) {
+	layout := csvDateLayout(p.Mapping.DateFormat)
+	cell := func(row []string, i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	accounts := []StatementAccount{}
+	index := map[string]int{}
+	for _, row := range rows {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+
+		identifier := cell(row, cols.account)
+		i, ok := index[identifier]
+		if !ok {
+			i = len(accounts)
+			index[identifier] = i
+			accounts = append(accounts, StatementAccount{Identifier: identifier, Type: "CACC", Currency: "EUR"})
+		}
+		acc := &accounts[i]
+
+		date, err := parseStatementDate(cell(row, cols.date), layout)
+		if err != nil {
+			acc.Skipped++
+			continue
+		}
+
+		var amount float64
+		if cols.amount >= 0 {
+			amount, err = parseStatementAmount(cell(row, cols.amount))
+		} else {
+			// Débit et crédit séparés : le débit est parfois déjà négatif
+			debit, credit := cell(row, cols.debit), cell(row, cols.credit)
+			switch {
+			case debit != "":
+				amount, err = parseStatementAmount(debit)
+				amount = -math.Abs(amount)
+			case credit != "":
+				amount, err = parseStatementAmount(credit)
+				amount = math.Abs(amount)
+			default:
+				err = fmt.Errorf("no amount")
+			}
+		}
+		if err != nil || amount == 0 {
+			acc.Skipped++
+			continue
+		}
+
+		currency := strings.ToUpper(cell(row, cols.currency))
+		if len(currency) != 3 {
+			currency = acc.Currency
+		}
+		label, detail := cell(row, cols.label), cell(row, cols.detail)
+		if strings.Contains(strings.ToLower(label), strings.ToLower(detail)) {
+			detail = ""
+		}
+		acc.Transactions = append(acc.Transactions, statementTransaction(date, amount, currency, label, detail))
+	}
+
+	return &Statement{Format: StatementFormatCSV, Preset: p.Name, Accounts: accounts}, nil
+}
+
+// ============================================================================
+// OFX / QFX
+// ============================================================================
+
+var ofxTag = regexp.MustCompile(`<(/?)([A-Za-z0-9.]+)>([^<]*)`)
+
+func ofxDate(raw string) (string, error) {
+	if len(raw) < 8 {
+		return "", fmt.Errorf("invalid date %q", raw)
+	}
+	return parseStatementDate(raw[:8], "20060102")
+}
+
+func parseOFXStatement(data []byte) (*Statement, error) {
+	text := decodeStatementText(data)
+	if !strings.Contains(strings.ToUpper(text), "<OFX>") {
+		return nil, fmt.Errorf("%w: missing <OFX> element", ErrInvalidStatement)
+	}
+
+	st := &Statement{Format: StatementFormatOFX, Accounts: []StatementAccount{}}
+	var (
+		acc       *StatementAccount
+		tx        map[string]string
+		inBalance bool
+	)
+	closeAccount := func() {
+		if acc != nil {
+			st.Accounts = append(st.Accounts, *acc)
+			acc = nil
+		}
+	}
+
+	for _, m := range ofxTag.FindAllStringSubmatch(text, -1) {
+		closing, tag := m[1] == "/", strings.ToUpper(m[2])
+		value := strings.TrimSpace(html.UnescapeString(m[3]))
+
+		switch {
+		case tag == "STMTRS" || tag == "CCSTMTRS":
+			if closing {
+				closeAccount()
+				continue
+			}
+			closeAccount()
+			acc = &StatementAccount{Type: "CACC"}
+			if tag == "CCSTMTRS" {
+				acc.Type = "CARD"
+			}
+		case acc == nil || closing && tag != "STMTTRN" && tag != "LEDGERBAL":
+			continue
+		case tag == "STMTTRN":
+			if !closing {
+				tx = map[string]string{}
+				continue
+			}
+			if tx == nil {
+				continue
+			}
+			date, err := ofxDate(tx["DTPOSTED"])
+			if err != nil {
+				date, err = ofxDate(tx["DTUSER"])
+			}
+			amount, aerr := parseStatementAmount(tx["TRNAMT"])
+			if err != nil || aerr != nil || amount == 0 {
+				acc.Skipped++
+				tx = nil
+				continue
+			}
+			memo := tx["MEMO"]
+			if strings.Contains(tx["NAME"], memo) {
+				memo = ""
+			}
+			t := statementTransaction(date, amount, acc.Currency, tx["NAME"], memo)
+			t.TransactionID = tx["FITID"]
+			acc.Transactions = append(acc.Transactions, t)
+			tx = nil
+		case tag == "LEDGERBAL":
+			inBalance = !closing
+		case tx != nil:
+			tx[tag] = value
+		case tag == "CURDEF":
+			acc.Currency = strings.ToUpper(value)
+		case tag == "ACCTID":
+			acc.Identifier = value
+		case tag == "ACCTTYPE" && value == "SAVINGS":
+			acc.Type = "SVGS"
+		case tag == "BALAMT" && inBalance:
+			if v, err := parseStatementAmount(value); err == nil {
+				acc.Balance = &v
+			}
+		case tag == "DTASOF" && inBalance:
+			if d, err := ofxDate(value); err == nil {
+				acc.BalanceDate = d
+			}
+		}
+	}
+	closeAccount()
+
+	// Les transactions lues avant CURDEF n'ont pas de devise
+	for i := range st.Accounts {
+		if st.Accounts[i].Currency == "" {
+			st.Accounts[i].Currency = "EUR"
+		}
+		for j := range st.Accounts[i].Transactions {
+			if st.Accounts[i].Transactions[j].TransactionAmount.Currency == "" {
+				st.Accounts[i].Transactions[j].TransactionAmount.Currency = st.Accounts[i].Currency
+			}
+		}
+	}
+	return st, nil
+}
+
+// ============================================================================
+// CAMT.053 (ISO 20022)
+// ============================================================================
+
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	Account struct {
+		IBAN     string `xml:"Id>IBAN"`
+		Other    string `xml:"Id>Othr>Id"`
+		Type     string `xml:"Tp>Cd"`
+		Currency string `xml:"Ccy"`
+		Name     string `xml:"Nm"`
+	} `xml:"Acct"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtBalance struct {
+	Type        string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount      camtAmount `xml:"Amt"`
+	CreditDebit string     `xml:"CdtDbtInd"`
+	Date        camtDate   `xml:"Dt"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+func (d camtDate) value() string {
+	if d.Date != "" {
+		return d.Date
+	}
+	if len(d.DateTime) >= 10 {
+		return d.DateTime[:10]
+	}
+	return ""
+}
+
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+func (p camtParty) value() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.PartyName
+}
+
+type camtEntry struct {
+	Reference   string     `xml:"NtryRef"`
+	Amount      camtAmount `xml:"Amt"`
+	CreditDebit string     `xml:"CdtDbtInd"`
+	// Sts : texte jusqu'à camt.053.001.07, <Cd> ensuite
+	Status struct {
+		Text string `xml:",chardata"`
+		Code string `xml:"Cd"`
+	} `xml:"Sts"`
+	BookingDate    camtDate `xml:"BookgDt"`
+	ValueDate      camtDate `xml:"ValDt"`
+	ServicerRef    string   `xml:"AcctSvcrRef"`
+	AdditionalInfo string   `xml:"AddtlNtryInf"`
+	Details        []struct {
+		Unstructured []string  `xml:"RmtInf>Ustrd"`
+		Creditor     camtParty `xml:"RltdPties>Cdtr"`
+		Debtor       camtParty `xml:"RltdPties>Dbtr"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+func camtSigned(amount camtAmount, indicator string) (float64, error) {
+	v, err := parseStatementAmount(amount.Value)
+	if err != nil {
+		return 0, err
+	}
+	if indicator == "DBIT" {
+		return -math.Abs(v), nil
+	}
+	return math.Abs(v), nil
+}
+
+func parseCAMT053Statement(data []byte) (*Statement, error) {
+	var doc camtDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidStatement, err)
+	}
+	if len(doc.Statements) == 0 {
+		return nil, fmt.Errorf("%w: no camt.053 statement found", ErrInvalidStatement)
+	}
+
+	st := &Statement{Format: StatementFormatCAMT053, Accounts: []StatementAccount{}}
+	index := map[string]int{}
+	for _, s := range doc.Statements {
+		identifier := s.Account.IBAN
+		if identifier == "" {
+			identifier = s.Account.Other
+		}
+
+		// Un relevé par jour : plusieurs Stmt peuvent porter le même compte
+		i, ok := index[identifier]
+		if !ok {
+			i = len(st.Accounts)
+			index[identifier] = i
+			st.Accounts = append(st.Accounts, StatementAccount{
+				Identifier: identifier,
+				Name:       s.Account.Name,
+				Type:       "CACC",
+				Currency:   strings.ToUpper(s.Account.Currency),
+			})
+			if s.Account.Type != "" {
+				st.Accounts[i].Type = s.Account.Type
+			}
+		}
+		acc := &st.Accounts[i]
+
+		for _, b := range s.Balances {
+			if b.Type != "CLBD" {
+				continue
+			}
+			if v, err := camtSigned(b.Amount, b.CreditDebit); err == nil {
+				acc.Balance = &v
+				acc.BalanceDate = b.Date.value()
+			}
+			if acc.Currency == "" {
+				acc.Currency = b.Amount.Currency
+			}
+		}
+
+		for _, e := range s.Entries {
+			status := strings.TrimSpace(e.Status.Code)
+			if status == "" {
+				status = strings.TrimSpace(e.Status.Text)
+			}
+			if status != "BOOK" && status != "PDNG" {
+				continue // INFO, FUTR : pas encore des mouvements
+			}
+
+			date := e.BookingDate.value()
+			if date == "" {
+				date = e.ValueDate.value()
+			}
+			amount, err := camtSigned(e.Amount, e.CreditDebit)
+			if _, derr := time.Parse(transactionDateLayout, date); derr != nil || err != nil || amount == 0 {
+				acc.Skipped++
+				continue
+			}
+
+			currency := e.Amount.Currency
+			if currency == "" {
+				currency = acc.Currency
+			}
+
+			var labels []string
+			for _, d := range e.Details {
+				party := d.Creditor.value()
+				if e.CreditDebit == "CRDT" {
+					party = d.Debtor.value()
+				}
+				labels = append(labels, party)
+				labels = append(labels, d.Unstructured...)
+			}
+			if strings.TrimSpace(strings.Join(labels, "")) == "" {
+				labels = append(labels, e.AdditionalInfo)
+			}
+
+			t := statementTransaction(date, amount, currency, labels...)
+			t.Status = status
+			if v := e.ValueDate.value(); v != "" {
+				t.ValueDate = v
+			}
+			t.TransactionID = e.ServicerRef
+			if t.TransactionID == "" {
+				t.TransactionID = e.Reference
+			}
+			acc.Transactions = append(acc.Transactions, t)
+		}
+	}
+
+	for i := range st.Accounts {
+		if st.Accounts[i].Currency == "" {
+			st.Accounts[i].Currency = "EUR"
+		}
+	}
+	return st, nil
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseStatementAmount(t *testing.T) {
+	cases := map[string]float64{
+		"-12,50":     -12.5,
+		"1 234,56":   1234.56,
+		"1.234,56 €": 1234.56,
+		"-1,234.56":  -1234.56,
+		"+3,00":      3,
+		"1.234.567":  1234567,
+		"42.5 EUR":   42.5,
+		" -7,10":     -7.1,
+	}
+	for raw, want := range cases {
+		got, err := parseStatementAmount(raw)
+		if err != nil || got != want {
+			t.Errorf("parseStatementAmount(%q) = %v, %v; want %v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "abc", "€"} {
+		if _, err := parseStatementAmount(raw); err == nil {
+			t.Errorf("parseStatementAmount(%q) should fail", raw)
+		}
+	}
+}
+
+func TestDetectStatementFormat(t *testing.T) {
+	cases := []struct {
+		name, data, want string
+	}{
+		{"releve.csv", "Date;Libellé;Montant\n", StatementFormatCSV},
+		{"export.txt", "OFXHEADER:100\nDATA:OFXSGML\n<OFX>", StatementFormatOFX},
+		{"export.qfx", "garbage", StatementFormatOFX},
+		{"stmt.xml", `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">`, StatementFormatCAMT053},
+		{"stmt", `<?xml version="1.0"?><Document><BkToCstmrStmt>`, StatementFormatCAMT053},
+	}
+	for _, c := range cases {
+		if got := detectStatementFormat(c.name, []byte(c.data)); got != c.want {
+			t.Errorf("detectStatementFormat(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+const bnpCSV = `Compte de chèques ****1234;;;;
+Solde au 31/03/2026;;;;1 520,10
+Date operation;Libelle court;Type operation;Libelle operation;Montant operation en euro
+02/03/2026;PRLV SEPA;Prélèvement;PRLV SEPA EDF CLIENTS PARTICULIERS;-64,90
+05/03/2026;CARTE;Carte;CB CAFE DE LA GARE 04/03;-3,50
+05/03/2026;CARTE;Carte;CB CAFE DE LA GARE 04/03;-3,50
+28/03/2026;VIR;Virement;VIR SALAIRE ACME;2 450,00
+;;;;
+Total;;;;2 378,10
+`
+
+func TestParseCSVStatementPresetDetection(t *testing.T) {
+	st, err := ParseStatement("releve.csv", []byte(bnpCSV), StatementOptions{})
+	if err != nil {
+		t.Fatalf("ParseStatement: %v", err)
+	}
+	if st.Format != StatementFormatCSV || st.Preset != "bnp" || len(st.Accounts) != 1 {
+		t.Fatalf("statement = %+v", st)
+	}
+	acc := st.Accounts[0]
+	if len(acc.Transactions) != 4 || acc.Skipped != 1 {
+		t.Fatalf("transactions = %d, skipped = %d", len(acc.Transactions), acc.Skipped)
+	}
+
+	edf, err := normalizeTransaction(acc.Transactions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edf.Amount != -64.9 || edf.BookingDate != "2026-03-02" || edf.Currency != "EUR" ||
+		edf.Description != "PRLV SEPA EDF CLIENTS PARTICULIERS" {
+		t.Errorf("edf = %+v", edf)
+	}
+	salary, _ := normalizeTransaction(acc.Transactions[3])
+	if salary.Amount != 2450 || salary.CreditDebit != "CRDT" {
+		t.Errorf("salary = %+v", salary)
+	}
+
+	// Deux lignes identiques restent deux transactions distinctes...
+	coffee1, coffee2 := acc.Transactions[1].TransactionID, acc.Transactions[2].TransactionID
+	if coffee1 == coffee2 || !strings.HasPrefix(coffee1, "csv:") {
+		t.Errorf("identical rows must get distinct ids: %q, %q", coffee1, coffee2)
+	}
+	// ... et le même fichier redéposé donne les mêmes ids
+	again, _ := ParseStatement("copie.csv", []byte(bnpCSV), StatementOptions{})
+	for i, tx := range again.Accounts[0].Transactions {
+		if tx.TransactionID != acc.Transactions[i].TransactionID {
+			t.Fatalf("ids are not stable across uploads: %q vs %q", tx.TransactionID, acc.Transactions[i].TransactionID)
+		}
+	}
+}
+
+func TestParseCSVStatementDebitCreditWindows1252(t *testing.T) {
+	// Export Crédit Agricole : colonnes débit / crédit, encodage Windows-1252
+	raw := "Date;Libell\xe9;D\xe9bit euros;Cr\xe9dit euros\r\n" +
+		"03/02/2026;\"PRELEVEMENT NETFLIX.COM\";13,49;\r\n" +
+		"10/02/2026;\"VIREMENT REMBOURSEMENT S\xc9CU\";;25,00\r\n"
+
+	st, err := ParseStatement("ca.csv", []byte(raw), StatementOptions{})
+	if err != nil {
+		t.Fatalf("ParseStatement: %v", err)
+	}
+	if st.Preset != "credit_agricole" {
+		t.Fatalf("preset = %q", st.Preset)
+	}
+	txs := st.Accounts[0].Transactions
+	if len(txs) != 2 || txs[0].CreditDebitIndicator != "DBIT" || txs[0].TransactionAmount.Amount != "13.49" {
+		t.Fatalf("transactions = %+v", txs)
+	}
+	if txs[1].CreditDebitIndicator != "CRDT" || txs[1].RemittanceInformation[0] != "VIREMENT REMBOURSEMENT SÉCU" {
+		t.Errorf("credit = %+v", txs[1])
+	}
+}
+
+func TestParseCSVStatementCustomMapping(t *testing.T) {
+	raw := "when,what,value\n2026-01-15,Loyer janvier,-850.00\n2026-02-15,Loyer février,-850.00\n"
+
+	if _, err := ParseStatement("x.csv", []byte(raw), StatementOptions{}); !errors.Is(err, ErrInvalidStatement) {
+		t.Fatalf("unknown columns should be rejected, got %v", err)
+	}
+	if _, err := ParseStatement("x.csv", []byte(raw), StatementOptions{Preset: "unknown"}); !errors.Is(err, ErrInvalidStatement) {
+		t.Fatalf("unknown preset should be rejected, got %v", err)
+	}
+
+	st, err := ParseStatement("x.csv", []byte(raw), StatementOptions{Mapping: &CSVMapping{
+		Date: "When", Label: "What", Amount: "Value", DateFormat: "YYYY-MM-DD",
+	}})
+	if err != nil {
+		t.Fatalf("ParseStatement: %v", err)
+	}
+	txs := st.Accounts[0].Transactions
+	if st.Preset != "custom" || len(txs) != 2 || txs[1].BookingDate != "2026-02-15" {
+		t.Fatalf("statement = %+v", st)
+	}
+}
+
+const ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>20260401</SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><TRNUID>1<STMTRS>
+<CURDEF>EUR
+<BANKACCTFROM><BANKID>30004<BRANCHID>00001<ACCTID>00012345678<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST><DTSTART>20260301<DTEND>20260331
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20260305120000[+1:CET]<TRNAMT>-850.00<FITID>FIT-1<NAME>VIR SEPA LOYER<MEMO>MARS 2026</STMTTRN>
+<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20260328<TRNAMT>2450,00<FITID>FIT-2<NAME>SALAIRE ACME &amp; CO</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>bad<TRNAMT>-1.00<FITID>FIT-3<NAME>BROKEN</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL><BALAMT>1523.45<DTASOF>20260331</LEDGERBAL>
+<AVAILBAL><BALAMT>1400.00<DTASOF>20260331</AVAILBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFXStatement(t *testing.T) {
+	st, err := ParseStatement("releve.ofx", []byte(ofxSGML), StatementOptions{})
+	if err != nil {
+		t.Fatalf("ParseStatement: %v", err)
+	}
+	if len(st.Accounts) != 1 {
+		t.Fatalf("accounts = %+v", st.Accounts)
+	}
+	acc := st.Accounts[0]
+	if acc.Identifier != "00012345678" || acc.Currency != "EUR" || acc.Balance == nil || *acc.Balance != 1523.45 || acc.BalanceDate != "2026-03-31" {
+		t.Errorf("account = %+v", acc)
+	}
+	if len(acc.Transactions) != 2 || acc.Skipped != 1 {
+		t.Fatalf("transactions = %+v, skipped = %d", acc.Transactions, acc.Skipped)
+	}
+
+	rent, _ := normalizeTransaction(acc.Transactions[0])
+	if rent.ProviderID != "FIT-1" || rent.Amount != -850 || rent.BookingDate != "2026-03-05" || rent.Description != "VIR SEPA LOYER MARS 2026" {
+		t.Errorf("rent = %+v", rent)
+	}
+	salary, _ := normalizeTransaction(acc.Transactions[1])
+	if salary.Amount != 2450 || salary.Description != "SALAIRE ACME & CO" {
+		t.Errorf("salary = %+v", salary)
+	}
+}
+
+func TestParseOFXStatementXML(t *testing.T) {
+	raw := `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX><CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+<CURDEF>EUR</CURDEF><CCACCTFROM><ACCTID>4970XXXX1234</ACCTID></CCACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20260312</DTPOSTED><TRNAMT>-13.49</TRNAMT><NAME>NETFLIX.COM</NAME></STMTTRN>
+</BANKTRANLIST>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`
+
+	st, err := ParseStatement("cb.qfx", []byte(raw), StatementOptions{})
+	if err != nil {
+		t.Fatalf("ParseStatement: %v", err)
+	}
+	acc := st.Accounts[0]
+	if acc.Type != "CARD" || len(acc.Transactions) != 1 {
+		t.Fatalf("account = %+v", acc)
+	}
+	// Sans FITID, l'id est une empreinte
+	if id := acc.Transactions[0].TransactionID; !strings.HasPrefix(id, "ofx:") {
+		t.Errorf("transaction id = %q", id)
+	}
+}
+
+const camt053 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08">
+<BkToCstmrStmt>
+<GrpHdr><MsgId>1</MsgId></GrpHdr>
+<Stmt>
+  <Acct><Id><IBAN>FR7630006000011234567890189</IBAN></Id><Ccy>EUR</Ccy><Nm>Compte joint</Nm></Acct>
+  <Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">100.00</Amt><CdtDbtInd>CRDT</CdtDbtInd></Bal>
+  <Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">42.10</Amt><CdtDbtInd>DBIT</CdtDbtInd><Dt><Dt>2026-03-31</Dt></Dt></Bal>
+  <Ntry>
+    <Amt Ccy="EUR">64.90</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts><Cd>BOOK</Cd></Sts>
+    <BookgDt><Dt>2026-03-08</Dt></BookgDt><ValDt><Dt>2026-03-09</Dt></ValDt>
+    <AcctSvcrRef>REF-EDF</AcctSvcrRef>
+    <NtryDtls><TxDtls>
+      <RltdPties><Cdtr><Pty><Nm>EDF</Nm></Pty></Cdtr></RltdPties>
+      <RmtInf><Ustrd>Facture 0326</Ustrd></RmtInf>
+    </TxDtls></NtryDtls>
+  </Ntry>
+  <Ntry>
+    <Amt Ccy="EUR">2450.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts>
+    <BookgDt><DtTm>2026-03-28T08:00:00</DtTm></BookgDt>
+    <NtryDtls><TxDtls><RltdPties><Dbtr><Nm>ACME SAS</Nm></Dbtr></RltdPties></TxDtls></NtryDtls>
+  </Ntry>
+  <Ntry>
+    <Amt Ccy="EUR">10.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts><Cd>INFO</Cd></Sts>
+    <BookgDt><Dt>2026-03-30</Dt></BookgDt>
+  </Ntry>
+</Stmt>
+</BkToCstmrStmt>
+</Document>`
+
+func TestParseCAMT053Statement(t *testing.T) {
+	st, err := ParseStatement("camt.xml", []byte(camt053), StatementOptions{})
+	if err != nil {
+		t.Fatalf("ParseStatement: %v", err)
+	}
+	if st.Format != StatementFormatCAMT053 || len(st.Accounts) != 1 {
+		t.Fatalf("statement = %+v", st)
+	}
+	acc := st.Accounts[0]
+	if acc.Identifier != "FR7630006000011234567890189" || acc.Name != "Compte joint" || acc.Balance == nil || *acc.Balance != -42.1 || acc.BalanceDate != "2026-03-31" {
+		t.Errorf("account = %+v", acc)
+	}
+	if len(acc.Transactions) != 2 {
+		t.Fatalf("INFO entries must be ignored: %+v", acc.Transactions)
+	}
+
+	edf, _ := normalizeTransaction(acc.Transactions[0])
+	if edf.ProviderID != "REF-EDF" || edf.Amount != -64.9 || edf.ValueDate != "2026-03-09" || edf.Description != "EDF Facture 0326" {
+		t.Errorf("edf = %+v", edf)
+	}
+	salary, _ := normalizeTransaction(acc.Transactions[1])
+	if salary.Amount != 2450 || salary.BookingDate != "2026-03-28" || salary.Description != "ACME SAS" {
+		t.Errorf("salary = %+v", salary)
+	}
+
+	if _, err := ParseStatement("bad.xml", []byte("<Document><BkToCstmrStmt>"), StatementOptions{}); !errors.Is(err, ErrInvalidStatement) {
+		t.Errorf("truncated XML should be rejected, got %v", err)
+	}
+}
+
+func TestStatementAccountIdentity(t *testing.T) {
+	withIBAN := StatementAccount{Identifier: "FR76 3000 6000 0112 3456 7890 189"}
+	if got := statementAccountKey(withIBAN, "peu importe"); got != "file:FR7630006000011234567890189" {
+		t.Errorf("key = %q", got)
+	}
+	if got := statementAccountName(withIBAN, "", "BNP Paribas"); got != "Compte BNP Paribas ••0189" {
+		t.Errorf("name = %q", got)
+	}
+	if got := statementAccountName(withIBAN, " Joint ", "BNP Paribas"); got != "Joint" {
+		t.Errorf("requested name = %q", got)
+	}
+
+	noID := StatementAccount{}
+	if got := statementAccountKey(noID, "Compte  Courant"); got != "file:name:compte courant" {
+		t.Errorf("key = %q", got)
+	}
+}
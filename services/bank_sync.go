@@ -0,0 +1,426 @@
+// services/bank_sync.go
+// ============================================================================
+// BANK SYNC SCHEDULER — rafraîchissement des connexions en tâche de fond
+// ============================================================================
+// Lancé par scheduleBankSync (main.go). À chaque tick, on réserve les
+// connexions banking_connections actives dont next_sync_at est échu, puis
+// pour chacune : soldes de tous ses comptes + nouvelles transactions dans le
+// ledger (continuation keys suivies par le BankingProvider).
+//
+// Réservation : UPDATE ... FOR UPDATE SKIP LOCKED → sync_status='running',
+// donc plusieurs instances ne synchronisent jamais la même connexion. Une
+// réservation de plus de bankSyncStaleAfter (crash) est reprise.
+//
+// Résultat par connexion (sync_status) :
+//   ok           → next_sync_at = now + interval
+//   rate_limited → next_sync_at = now + max(Retry-After, backoff)
+//   error        → sync_failures++, next_sync_at = now + backoff exponentiel
+//
+// Une connexion coupée par l'échéance du passage (ctx du tick) n'est pas une
+// panne de la banque : elle est rendue telle quelle (sync_status d'avant la
+// réservation, next_sync_at inchangé) et reste échue pour le tick suivant.
+//
+// Chaque passage relit aussi la session (GET /sessions/{id}) : valid_until
+// met à jour expires_at, une session expirée ou révoquée fait sortir la
+// connexion de la synchro (voir bank_consent.go). Seules les connexions du
+// fournisseur actif sont synchronisées (ni les legacy, ni celles d'un autre
+// BANKING_PROVIDER).
+//
+//   BANK_SYNC_INTERVAL   cadence par connexion (défaut 6h, 0 = désactivé)
+//   BANK_SYNC_BATCH_SIZE connexions traitées par tick (défaut 20)
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+const (
+	// Statuts de synchro (banking_connections.sync_status)
+	SyncStatusIdle        = "idle"
+	SyncStatusRunning     = "running"
+	SyncStatusOK          = "ok"
+	SyncStatusRateLimited = "rate_limited"
+	SyncStatusError       = "error"
+
+	bankSyncStaleAfter   = time.Hour
+	bankSyncBaseBackoff  = 15 * time.Minute
+	bankSyncMaxBackoff   = 24 * time.Hour
+	bankSyncMaxErrorSize = 500
+
+	// Échecs consécutifs avant de passer la connexion en status 'error'
+	bankSyncErrorThreshold = 5
+)
+
+// BankSyncProvider est ce dont la synchro a besoin côté banque.
+type BankSyncProvider interface {
+	TransactionFetcher
+	GetBalances(ctx context.Context, sessionID, accountUID string) ([]Balance, error)
+	GetSession(ctx context.Context, sessionID string) (*SessionDetails, error)
+}
+
+// ConsentLostError signale une session que la banque n'honore plus.
+type ConsentLostError struct {
+	Status string // ConnectionExpired ou ConnectionRevoked
+}
+
+func (e *ConsentLostError) Error() string {
+	return "bank consent " + e.Status
+}
+
+// BankSyncConfig règle la cadence du scheduler.
+type BankSyncConfig struct {
+	Interval  time.Duration
+	BatchSize int
+}
+
+// BankSyncConfigFromEnv lit BANK_SYNC_INTERVAL et BANK_SYNC_BATCH_SIZE.
+func BankSyncConfigFromEnv() BankSyncConfig {
+	cfg := BankSyncConfig{
+		Interval:  6 * time.Hour,
+		BatchSize: envInt("BANK_SYNC_BATCH_SIZE", 20),
+	}
+	if raw := strings.TrimSpace(os.Getenv("BANK_SYNC_INTERVAL")); raw != "" {
+		if raw == "0" {
+			cfg.Interval = 0
+		} else if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+			cfg.Interval = d
+		} else {
+			utils.SafeWarn("Invalid BANK_SYNC_INTERVAL %q, using %s", raw, cfg.Interval)
+		}
+	}
+	return cfg
+}
+
+// BankSyncResult résume un passage du scheduler.
+type BankSyncResult struct {
+	Connections          int
+	Succeeded            int
+	RateLimited          int
+	Failed               int
+	Interrupted          int // coupées par l'échéance du passage, toujours échues
+	TransactionsImported int
+}
+
+type BankSyncScheduler struct {
+	db           *sql.DB
+	provider     BankingProvider
+	transactions *BankTransactionService
+	ws           Broadcaster // optionnel : prévient les membres connectés
+	cfg          BankSyncConfig
+}
+
+func NewBankSyncScheduler(db *sql.DB, provider BankingProvider, ws Broadcaster, cfg BankSyncConfig) *BankSyncScheduler {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 20
+	}
+	return &BankSyncScheduler{
+		db:           db,
+		provider:     provider,
+		transactions: NewBankTransactionService(db),
+		ws:           ws,
+		cfg:          cfg,
+	}
+}
+
+type dueConnection struct {
+	ID         string
+	BudgetID   string
+	SessionID  string
+	Status     string
+	Failures   int
+	SyncStatus string // avant la réservation
+}
+
+// RunOnce synchronise un lot de connexions échues.
+func (s *BankSyncScheduler) RunOnce(ctx context.Context) (BankSyncResult, error) {
+	var result BankSyncResult
+
+	due, err := s.claimDueConnections(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Connections = len(due)
+
+	for _, conn := range due {
+		if ctx.Err() != nil {
+			// Libère les connexions réservées mais non traitées
+			s.release(conn)
+			result.Interrupted++
+			continue
+		}
+
+		imported, err := s.syncConnection(ctx, conn)
+		if err != nil && ctx.Err() != nil {
+			// Coupée par l'échéance du passage : ni échec ni backoff
+			s.release(conn)
+			result.Interrupted++
+			result.TransactionsImported += imported
+			continue
+		}
+		status := s.finish(ctx, conn, imported, err)
+		switch status {
+		case SyncStatusOK:
+			result.Succeeded++
+			result.TransactionsImported += imported
+		case SyncStatusRateLimited:
+			result.RateLimited++
+		default:
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+// claimDueConnections réserve jusqu'à BatchSize connexions à synchroniser.
+func (s *BankSyncScheduler) claimDueConnections(ctx context.Context) ([]dueConnection, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE banking_connections bc
+		SET sync_status = $1, sync_started_at = NOW()
+		FROM (
+			SELECT id, COALESCE(sync_status, '') AS previous_sync_status
+			FROM banking_connections
+			WHERE status IN ($4, $5, $6) AND provider = $7
+			  AND (next_sync_at IS NULL OR next_sync_at <= NOW())
+			  AND (COALESCE(sync_status, '') <> $1 OR sync_started_at < NOW() - $2::interval)
+			ORDER BY next_sync_at NULLS FIRST
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		) due
+		WHERE bc.id = due.id
+		RETURNING bc.id, bc.budget_id, bc.session_id, bc.status, COALESCE(bc.sync_failures, 0), due.previous_sync_status
+	`, SyncStatusRunning, fmt.Sprintf("%d seconds", int(bankSyncStaleAfter.Seconds())), s.cfg.BatchSize,
+		ConnectionActive, ConnectionExpiring, ConnectionError, s.provider.Name())
+	if err != nil {
+		return nil, fmt.Errorf("claim bank connections: %w", err)
+	}
+	defer rows.Close()
+
+	var due []dueConnection
+	for rows.Next() {
+		var c dueConnection
+		if err := rows.Scan(&c.ID, &c.BudgetID, &c.SessionID, &c.Status, &c.Failures, &c.SyncStatus); err != nil {
+			return nil, err
+		}
+		due = append(due, c)
+	}
+	return due, rows.Err()
+}
+
+// syncConnection rafraîchit soldes et transactions de tous les comptes de la
+// connexion. Un 429 interrompt la connexion immédiatement.
+func (s *BankSyncScheduler) syncConnection(ctx context.Context, conn dueConnection) (int, error) {
+	sessionID, err := decryptCredential(conn.SessionID)
+	if err != nil {
+		return 0, err
+	}
+	conn.SessionID = sessionID
+
+	if err := s.refreshConsent(ctx, conn); err != nil {
+		return 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, account_id FROM banking_accounts WHERE connection_id = $1
+	`, conn.ID)
+	if err != nil {
+		return 0, err
+	}
+	type account struct{ id, uid string }
+	var accounts []account
+	for rows.Next() {
+		var a account
+		if err := rows.Scan(&a.id, &a.uid); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+
+	imported := 0
+	var firstErr error
+	for _, acc := range accounts {
+		balances, err := s.provider.GetBalances(ctx, conn.SessionID, acc.uid)
+		if err == nil && len(balances) > 0 {
+			if amount, perr := strconv.ParseFloat(balances[0].BalanceAmount.Amount, 64); perr == nil {
+				if err := updateAccountBalance(ctx, s.db, acc.id, amount); err != nil {
+					return imported, err
+				}
+			}
+		}
+		if isRateLimited(err) {
+			return imported, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("balances: %w", err)
+		}
+
+		n, err := s.transactions.SyncAccountTransactions(ctx, s.provider, acc.id, acc.uid)
+		imported += n
+		if isRateLimited(err) {
+			return imported, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("transactions: %w", err)
+		}
+	}
+	return imported, firstErr
+}
+
+// refreshConsent relit la session : expires_at suit le valid_until accordé
+// par la banque, une session morte arrête la synchro. Une erreur de lecture
+// (hors 429) n'empêche pas de tenter les comptes.
+func (s *BankSyncScheduler) refreshConsent(ctx context.Context, conn dueConnection) error {
+	details, err := s.provider.GetSession(ctx, conn.SessionID)
+	if isRateLimited(err) {
+		return err
+	}
+	if err != nil {
+		utils.SafeWarn("⚠️  Could not read bank session: %v", err)
+		return nil
+	}
+
+	if status := consentStatusFromSession(details.Status); status != "" {
+		return &ConsentLostError{Status: status}
+	}
+
+	if validUntil, ok := ParseConsentValidUntil(details.Access.ValidUntil); ok {
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE banking_connections SET expires_at = $1
+			WHERE id = $2 AND expires_at IS DISTINCT FROM $1
+		`, validUntil, conn.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release rend une connexion réservée sans compter de tentative : sync_status
+// reprend sa valeur d'avant la réservation, next_sync_at ne bouge pas.
+func (s *BankSyncScheduler) release(conn dueConnection) {
+	previous := conn.SyncStatus
+	if previous == "" || previous == SyncStatusRunning {
+		previous = SyncStatusIdle
+	}
+
+	// Le ctx du passage est échu : délai propre
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE banking_connections SET sync_status = $1, updated_at = NOW()
+		WHERE id = $2 AND sync_status = $3
+	`, previous, conn.ID, SyncStatusRunning); err != nil {
+		utils.SafeError("Failed to release bank connection: %v", err)
+	}
+}
+
+// finish enregistre le résultat de la synchro et planifie la suivante.
+func (s *BankSyncScheduler) finish(ctx context.Context, conn dueConnection, imported int, syncErr error) string {
+	status, failures, delay := nextBankSync(conn.Failures, syncErr, s.cfg.Interval)
+	connStatus := nextConnectionStatus(conn.Status, failures, syncErr)
+
+	var lastError interface{}
+	if syncErr != nil {
+		msg := syncErr.Error()
+		if len(msg) > bankSyncMaxErrorSize {
+			msg = msg[:bankSyncMaxErrorSize]
+		}
+		lastError = msg
+		utils.SafeWarn("Bank sync %s for connection: %v", status, syncErr)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE banking_connections
+		SET sync_status = $1,
+		    sync_failures = $2,
+		    last_sync_error = $3,
+		    last_sync_at = CASE WHEN $5 THEN NOW() ELSE last_sync_at END,
+		    next_sync_at = NOW() + $4::interval,
+		    status = $7,
+		    status_changed_at = CASE WHEN status = $7 THEN status_changed_at ELSE NOW() END,
+		    updated_at = NOW()
+		WHERE id = $6
+	`, status, failures, lastError, fmt.Sprintf("%d seconds", int(delay.Seconds())),
+		status == SyncStatusOK, conn.ID, connStatus)
+	if err != nil {
+		utils.SafeError("Failed to record bank sync status: %v", err)
+	}
+
+	if status == SyncStatusOK && imported > 0 && s.ws != nil {
+		s.ws.PublishEvent(NewBudgetEvent(conn.BudgetID, EventBankSyncCompleted, nil,
+			map[string]interface{}{
+				"connection_id":         conn.ID,
+				"transactions_imported": imported,
+				"source":                "scheduler",
+			},
+		), "")
+	}
+	return status
+}
+
+// nextBankSync calcule statut, compteur d'échecs et délai avant la prochaine
+// tentative.
+func nextBankSync(failures int, syncErr error, interval time.Duration) (string, int, time.Duration) {
+	if syncErr == nil {
+		return SyncStatusOK, 0, interval
+	}
+
+	var rl *RateLimitError
+	if errors.As(syncErr, &rl) {
+		// Le quota n'est pas une panne : pas d'incrément des échecs
+		delay := backoffDelay(failures)
+		if rl.RetryAfter > delay {
+			delay = rl.RetryAfter
+		}
+		return SyncStatusRateLimited, failures, delay
+	}
+
+	failures++
+	return SyncStatusError, failures, backoffDelay(failures)
+}
+
+// nextConnectionStatus fait évoluer banking_connections.status après une
+// synchro. L'échéance du consentement (expiring / expired) relève de
+// CheckConsents.
+func nextConnectionStatus(current string, failures int, syncErr error) string {
+	var lost *ConsentLostError
+	switch {
+	case errors.As(syncErr, &lost):
+		return lost.Status
+	case syncErr == nil:
+		if current == ConnectionError {
+			return ConnectionActive
+		}
+	case !isRateLimited(syncErr) && failures >= bankSyncErrorThreshold && current == ConnectionActive:
+		return ConnectionError
+	}
+	return current
+}
+
+// backoffDelay : 15 min, 30 min, 1h, ... plafonné à 24h.
+func backoffDelay(failures int) time.Duration {
+	delay := bankSyncBaseBackoff
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= bankSyncMaxBackoff {
+			return bankSyncMaxBackoff
+		}
+	}
+	return delay
+}
+
+func isRateLimited(err error) bool {
+	var rl *RateLimitError
+	return errors.As(err, &rl)
+}
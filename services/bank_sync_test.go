@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 15 * time.Minute},
+		{1, 15 * time.Minute},
+		{2, 30 * time.Minute},
+		{3, time.Hour},
+		{7, 16 * time.Hour},
+		{8, 24 * time.Hour},
+		{50, 24 * time.Hour},
+	}
+	for _, tc := range cases {
+		if got := backoffDelay(tc.failures); got != tc.want {
+			t.Errorf("backoffDelay(%d) = %s, want %s", tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestNextBankSync(t *testing.T) {
+	interval := 6 * time.Hour
+
+	status, failures, delay := nextBankSync(3, nil, interval)
+	if status != SyncStatusOK || failures != 0 || delay != interval {
+		t.Errorf("success = (%s, %d, %s)", status, failures, delay)
+	}
+
+	status, failures, delay = nextBankSync(1, errors.New("boom"), interval)
+	if status != SyncStatusError || failures != 2 || delay != 30*time.Minute {
+		t.Errorf("error = (%s, %d, %s)", status, failures, delay)
+	}
+
+	// 429 enveloppé : Retry-After plus long que le backoff l'emporte, et le
+	// compteur d'échecs ne bouge pas
+	wrapped := fmt.Errorf("transactions: %w", &RateLimitError{RetryAfter: 2 * time.Hour})
+	status, failures, delay = nextBankSync(1, wrapped, interval)
+	if status != SyncStatusRateLimited || failures != 1 || delay != 2*time.Hour {
+		t.Errorf("rate limited = (%s, %d, %s)", status, failures, delay)
+	}
+
+	status, _, delay = nextBankSync(0, &RateLimitError{}, interval)
+	if status != SyncStatusRateLimited || delay != 15*time.Minute {
+		t.Errorf("rate limited without Retry-After = (%s, %s)", status, delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tc := range cases {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestNextConnectionStatus(t *testing.T) {
+	boom := errors.New("boom")
+	rateLimited := &RateLimitError{RetryAfter: time.Minute}
+
+	cases := []struct {
+		name     string
+		current  string
+		failures int
+		err      error
+		want     string
+	}{
+		{"success keeps active", ConnectionActive, 0, nil, ConnectionActive},
+		{"success clears error", ConnectionError, 0, nil, ConnectionActive},
+		{"success keeps expiring", ConnectionExpiring, 0, nil, ConnectionExpiring},
+		{"few failures", ConnectionActive, bankSyncErrorThreshold - 1, boom, ConnectionActive},
+		{"threshold reached", ConnectionActive, bankSyncErrorThreshold, boom, ConnectionError},
+		{"expiring wins over error", ConnectionExpiring, bankSyncErrorThreshold, boom, ConnectionExpiring},
+		{"rate limit is not a failure", ConnectionActive, bankSyncErrorThreshold, rateLimited, ConnectionActive},
+		{"consent expired", ConnectionActive, 0, &ConsentLostError{Status: ConnectionExpired}, ConnectionExpired},
+		{"consent revoked", ConnectionError, 3, fmt.Errorf("sync: %w", &ConsentLostError{Status: ConnectionRevoked}), ConnectionRevoked},
+	}
+	for _, tc := range cases {
+		if got := nextConnectionStatus(tc.current, tc.failures, tc.err); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// deadlineProvider bloque sur la session jusqu'à l'échéance du passage.
+type deadlineProvider struct {
+	*MockBankingProvider
+}
+
+func (p deadlineProvider) GetSession(ctx context.Context, sessionID string) (*SessionDetails, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRunOnceDeadlineLeavesConnectionsDue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	provider := deadlineProvider{NewMockBankingProvider()}
+	s := NewBankSyncScheduler(db, provider, nil, BankSyncConfig{})
+
+	mock.ExpectQuery(`UPDATE banking_connections bc`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "budget_id", "session_id", "status", "sync_failures", "previous_sync_status"}).
+			AddRow("c1", "b1", "", ConnectionActive, 2, SyncStatusError).
+			AddRow("c2", "b1", "", ConnectionActive, 0, ""))
+	// Ni sync_failures ni next_sync_at : les deux connexions restent échues
+	mock.ExpectExec(`UPDATE banking_connections SET sync_status = \$1, updated_at = NOW\(\)`).
+		WithArgs(SyncStatusError, "c1", SyncStatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE banking_connections SET sync_status = \$1, updated_at = NOW\(\)`).
+		WithArgs(SyncStatusIdle, "c2", SyncStatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	result, err := s.RunOnce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Connections != 2 || result.Interrupted != 2 || result.Failed != 0 {
+		t.Errorf("result = %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
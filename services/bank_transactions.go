@@ -0,0 +1,349 @@
+// services/bank_transactions.go
+// ============================================================================
+// BANK TRANSACTIONS LEDGER — copie locale des transactions Enable Banking
+// ============================================================================
+// Avant : GetTransactions interrogeait la banque à chaque affichage, sur 90
+// jours fixes, avec des ids jetables ("eb-1"). Maintenant :
+//
+//   - SyncAccountTransactions importe les transactions d'un compte dans
+//     bank_transactions, de façon incrémentale : on repart de la dernière
+//     date connue moins transactionSyncOverlap (les PDNG deviennent BOOK,
+//     les banques publient parfois en retard), 90 jours au premier import.
+//   - Dédoublonnage sur (account_id, provider_transaction_id). L'id provider
+//     est transaction_id, sinon entry_reference, sinon une empreinte stable
+//     du contenu (certaines banques n'exposent aucun id), complétée du rang
+//     de l'occurrence dans le lot : deux cafés identiques le même jour
+//     restent deux transactions.
+//   - La description (libellé, contrepartie) est chiffrée au repos.
+//   - ListTransactions lit le ledger, paginé et filtrable.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+const (
+	transactionInitialHistory = 90 * 24 * time.Hour
+	transactionSyncOverlap    = 7 * 24 * time.Hour
+	transactionDateLayout     = "2006-01-02"
+)
+
+// TransactionFetcher est la partie du provider bancaire utilisée par la
+// synchro (EnableBankingService l'implémente).
+type TransactionFetcher interface {
+	GetTransactions(ctx context.Context, accountUID string, dateFrom, dateTo string) ([]Transaction, error)
+}
+
+type BankTransactionService struct {
+	db *sql.DB
+}
+
+func NewBankTransactionService(db *sql.DB) *BankTransactionService {
+	return &BankTransactionService{db: db}
+}
+
+// ledgerTransaction est une transaction provider normalisée pour le ledger.
+type ledgerTransaction struct {
+	ProviderID  string
+	Amount      float64
+	Currency    string
+	CreditDebit string
+	Status      string
+	BookingDate string
+	ValueDate   string
+	Description string
+	Category    string // catégorie CategorizerService, vide si inconnue
+}
+
+// normalizeTransaction convertit une transaction Enable Banking : montant
+// signé, date de référence, description lisible et id provider stable.
+func normalizeTransaction(tx Transaction) (ledgerTransaction, error) {
+	amount, err := strconv.ParseFloat(tx.TransactionAmount.Amount, 64)
+	if err != nil {
+		return ledgerTransaction{}, fmt.Errorf("invalid amount %q: %w", tx.TransactionAmount.Amount, err)
+	}
+	if tx.CreditDebitIndicator == "DBIT" && amount > 0 {
+		amount = -amount
+	}
+
+	bookingDate := tx.BookingDate
+	if bookingDate == "" {
+		bookingDate = tx.ValueDate
+	}
+	if bookingDate == "" {
+		bookingDate = tx.TransactionDate
+	}
+
+	description := strings.TrimSpace(strings.Join(tx.RemittanceInformation, " "))
+	if description == "" && tx.Creditor != nil {
+		description = tx.Creditor.Name
+	}
+	if description == "" && tx.Debtor != nil {
+		description = tx.Debtor.Name
+	}
+	if description == "" {
+		description = "Transaction"
+	}
+
+	return ledgerTransaction{
+		ProviderID:  providerTransactionID(tx),
+		Amount:      amount,
+		Currency:    tx.TransactionAmount.Currency,
+		CreditDebit: tx.CreditDebitIndicator,
+		Status:      tx.Status,
+		BookingDate: bookingDate,
+		ValueDate:   tx.ValueDate,
+		Description: description,
+	}, nil
+}
+
+// providerTransactionID retourne l'id fourni par la banque ou, à défaut, une
+// empreinte du contenu. Le statut n'en fait pas partie : une transaction
+// PDNG qui passe BOOK garde la même empreinte.
+func providerTransactionID(tx Transaction) string {
+	if tx.TransactionID != "" {
+		return tx.TransactionID
+	}
+	if tx.EntryReference != "" {
+		return "ref:" + tx.EntryReference
+	}
+
+	date := tx.BookingDate
+	if date == "" {
+		date = tx.ValueDate
+	}
+	if date == "" {
+		date = tx.TransactionDate
+	}
+	h := sha256.New()
+	for _, part := range []string{
+		date,
+		tx.TransactionAmount.Amount,
+		tx.TransactionAmount.Currency,
+		tx.CreditDebitIndicator,
+		strings.Join(tx.RemittanceInformation, "\n"),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return fingerprintIDPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintIDPrefix marque les ids calculés par providerTransactionID.
+const fingerprintIDPrefix = "sha256:"
+
+// rankFingerprintIDs ajoute aux empreintes le rang de l'occurrence dans le
+// lot, comme assignStatementIDs pour les relevés. La première occurrence
+// garde l'empreinte seule : les lignes déjà importées ne sont pas dupliquées.
+// Une synchro couvre des journées entières, donc tous les doublons d'un jour
+// sont dans le même lot et reçoivent les mêmes rangs d'une synchro à l'autre.
+func rankFingerprintIDs(ledger []ledgerTransaction) {
+	seen := map[string]int{}
+	for i := range ledger {
+		id := ledger[i].ProviderID
+		if !strings.HasPrefix(id, fingerprintIDPrefix) {
+			continue
+		}
+		if rank := seen[id]; rank > 0 {
+			ledger[i].ProviderID = fmt.Sprintf("%s:%d", id, rank)
+		}
+		seen[id]++
+	}
+}
+
+// syncWindowStart renvoie la date de début de la prochaine synchro.
+func syncWindowStart(lastBooking sql.NullTime, now time.Time) time.Time {
+	if !lastBooking.Valid {
+		return now.Add(-transactionInitialHistory)
+	}
+	return lastBooking.Time.Add(-transactionSyncOverlap)
+}
+
+// SyncAccountTransactions importe les nouvelles transactions d'un compte
+// (banking_accounts.id) et renvoie le nombre de lignes ajoutées.
+func (s *BankTransactionService) SyncAccountTransactions(ctx context.Context, fetcher TransactionFetcher, accountID, accountUID string) (int, error) {
+	var lastBooking sql.NullTime
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT MAX(booking_date) FROM bank_transactions WHERE account_id = $1
+	`, accountID).Scan(&lastBooking); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	dateFrom := syncWindowStart(lastBooking, now).Format(transactionDateLayout)
+	dateTo := now.Format(transactionDateLayout)
+
+	transactions, err := fetcher.GetTransactions(ctx, accountUID, dateFrom, dateTo)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.storeTransactions(ctx, accountID, transactions)
+}
+
+// storeTransactions upsert les transactions dans le ledger.
+func (s *BankTransactionService) storeTransactions(ctx context.Context, accountID string, transactions []Transaction) (int, error) {
+	ledger := make([]ledgerTransaction, 0, len(transactions))
+	for _, raw := range transactions {
+		t, err := normalizeTransaction(raw)
+		if err != nil {
+			utils.SafeWarn("⚠️  Skipping bank transaction: %v", err)
+			continue
+		}
+		ledger = append(ledger, t)
+	}
+	rankFingerprintIDs(ledger)
+	return s.storeLedger(ctx, accountID, ledger)
+}
+
+// storeLedger upsert des transactions déjà normalisées et renvoie le nombre
+// de lignes ajoutées. Une catégorie vide ne remplace pas celle déjà connue.
+func (s *BankTransactionService) storeLedger(ctx context.Context, accountID string, transactions []ledgerTransaction) (int, error) {
+	inserted := 0
+	err := utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, `
+			INSERT INTO bank_transactions (
+				account_id, provider_transaction_id, amount, currency, credit_debit,
+				status, booking_date, value_date, encrypted_description, category
+			) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::date, NULLIF($8, '')::date, $9, NULLIF($10, ''))
+			ON CONFLICT (account_id, provider_transaction_id)
+			DO UPDATE SET
+				amount = EXCLUDED.amount,
+				status = EXCLUDED.status,
+				booking_date = EXCLUDED.booking_date,
+				value_date = EXCLUDED.value_date,
+				encrypted_description = EXCLUDED.encrypted_description,
+				category = COALESCE(EXCLUDED.category, bank_transactions.category),
+				updated_at = NOW()
+			RETURNING (xmax = 0)
+		`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, t := range transactions {
+			encrypted, err := utils.Encrypt([]byte(t.Description))
+			if err != nil {
+				return fmt.Errorf("encrypt description: %w", err)
+			}
+
+			var isNew bool
+			if err := stmt.QueryRowContext(ctx,
+				accountID, t.ProviderID, t.Amount, t.Currency, t.CreditDebit,
+				t.Status, t.BookingDate, t.ValueDate, encrypted, t.Category,
+			).Scan(&isNew); err != nil {
+				return fmt.Errorf("store transaction: %w", err)
+			}
+			if isNew {
+				inserted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+// TransactionFilter restreint ListTransactions. Les dates sont au format
+// YYYY-MM-DD, bornes incluses.
+type TransactionFilter struct {
+	AccountID string
+	From      string
+	To        string
+	Type      string // DBIT, CRDT ou vide
+	Limit     int
+	Offset    int
+}
+
+// ListTransactions lit le ledger des comptes que userID a connectés sur le
+// budget, plus récentes d'abord. Renvoie aussi le total avant pagination.
+func (s *BankTransactionService) ListTransactions(ctx context.Context, budgetID, userID string, f TransactionFilter) ([]models.BankTransaction, int, error) {
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+
+	where := []string{"bc.budget_id = $1", "bc.user_id = $2"}
+	args := []interface{}{budgetID, userID}
+	add := func(clause string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+	if f.AccountID != "" {
+		add("bt.account_id = $%d", f.AccountID)
+	}
+	if f.From != "" {
+		add("bt.booking_date >= $%d::date", f.From)
+	}
+	if f.To != "" {
+		add("bt.booking_date <= $%d::date", f.To)
+	}
+	if f.Type != "" {
+		add("bt.credit_debit = $%d", f.Type)
+	}
+
+	from := `
+		FROM bank_transactions bt
+		JOIN banking_accounts ba ON ba.id = bt.account_id
+		JOIN banking_connections bc ON bc.id = ba.connection_id
+		WHERE ` + strings.Join(where, " AND ")
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, f.Limit, f.Offset)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT bt.id, bt.account_id, COALESCE(ba.account_name, ''), bt.provider_transaction_id,
+		       bt.amount, COALESCE(bt.currency, ''), COALESCE(bt.credit_debit, ''), COALESCE(bt.status, ''),
+		       COALESCE(to_char(bt.booking_date, 'YYYY-MM-DD'), ''),
+		       COALESCE(to_char(bt.value_date, 'YYYY-MM-DD'), ''),
+		       COALESCE(bt.encrypted_description, ''), COALESCE(bt.category, ''), bt.created_at`+from+fmt.Sprintf(`
+		ORDER BY bt.booking_date DESC NULLS LAST, bt.created_at DESC, bt.id
+		LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	transactions := []models.BankTransaction{}
+	for rows.Next() {
+		var t models.BankTransaction
+		var encrypted string
+		if err := rows.Scan(
+			&t.ID, &t.AccountID, &t.AccountName, &t.ProviderTransactionID,
+			&t.Amount, &t.Currency, &t.CreditDebit, &t.Status,
+			&t.BookingDate, &t.ValueDate, &encrypted, &t.Category, &t.CreatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		if encrypted != "" {
+			plain, err := utils.Decrypt(encrypted)
+			if err != nil {
+				utils.SafeWarn("⚠️  Failed to decrypt transaction description: %v", err)
+			} else {
+				t.Description = string(plain)
+			}
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, total, rows.Err()
+}
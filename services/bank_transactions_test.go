@@ -0,0 +1,115 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ebTransaction(amount, indicator, booking string, remittance ...string) Transaction {
+	return Transaction{
+		TransactionAmount:     AmountType{Currency: "EUR", Amount: amount},
+		CreditDebitIndicator:  indicator,
+		Status:                "BOOK",
+		BookingDate:           booking,
+		RemittanceInformation: remittance,
+	}
+}
+
+func TestNormalizeTransaction(t *testing.T) {
+	debit := ebTransaction("42.50", "DBIT", "2026-03-02", "CB CARREFOUR", "PARIS")
+	debit.TransactionID = "tx-1"
+
+	got, err := normalizeTransaction(debit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Amount != -42.5 {
+		t.Errorf("amount = %v, want -42.5", got.Amount)
+	}
+	if got.ProviderID != "tx-1" {
+		t.Errorf("provider id = %q, want tx-1", got.ProviderID)
+	}
+	if got.Description != "CB CARREFOUR PARIS" {
+		t.Errorf("description = %q", got.Description)
+	}
+
+	credit := ebTransaction("1200", "CRDT", "")
+	credit.ValueDate = "2026-03-01"
+	credit.Debtor = &struct {
+		Name string `json:"name"`
+	}{Name: "EMPLOYEUR SA"}
+	got, err = normalizeTransaction(credit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Amount != 1200 || got.BookingDate != "2026-03-01" || got.Description != "EMPLOYEUR SA" {
+		t.Errorf("unexpected credit normalisation: %+v", got)
+	}
+
+	if _, err := normalizeTransaction(ebTransaction("n/a", "DBIT", "2026-03-02")); err == nil {
+		t.Error("expected an error for an unparsable amount")
+	}
+}
+
+func TestProviderTransactionID(t *testing.T) {
+	withRef := ebTransaction("10", "DBIT", "2026-03-02", "A")
+	withRef.EntryReference = "E1"
+	if got := providerTransactionID(withRef); got != "ref:E1" {
+		t.Errorf("got %q, want ref:E1", got)
+	}
+
+	pending := ebTransaction("10", "DBIT", "2026-03-02", "NETFLIX")
+	pending.Status = "PDNG"
+	booked := ebTransaction("10", "DBIT", "2026-03-02", "NETFLIX")
+
+	a, b := providerTransactionID(pending), providerTransactionID(booked)
+	if !strings.HasPrefix(a, "sha256:") {
+		t.Errorf("expected a content fingerprint, got %q", a)
+	}
+	if a != b {
+		t.Error("fingerprint must not depend on the booking status")
+	}
+	if a == providerTransactionID(ebTransaction("11", "DBIT", "2026-03-02", "NETFLIX")) {
+		t.Error("different amounts must give different fingerprints")
+	}
+}
+
+func TestRankFingerprintIDs(t *testing.T) {
+	coffee := ebTransaction("2.50", "DBIT", "2026-03-02", "CB CAFE")
+	var ledger []ledgerTransaction
+	for _, raw := range []Transaction{coffee, coffee, ebTransaction("9.99", "DBIT", "2026-03-02", "CB KIOSQUE"), coffee} {
+		lt, err := normalizeTransaction(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger = append(ledger, lt)
+	}
+	withID := ledger[2]
+	withID.ProviderID = "tx-1"
+	ledger = append(ledger, withID, withID)
+
+	rankFingerprintIDs(ledger)
+
+	fp := providerTransactionID(coffee)
+	want := []string{fp, fp + ":1", providerTransactionID(ebTransaction("9.99", "DBIT", "2026-03-02", "CB KIOSQUE")), fp + ":2", "tx-1", "tx-1"}
+	for i, w := range want {
+		if ledger[i].ProviderID != w {
+			t.Errorf("ledger[%d] id = %q, want %q", i, ledger[i].ProviderID, w)
+		}
+	}
+}
+
+func TestSyncWindowStart(t *testing.T) {
+	now := time.Date(2026, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	if got := syncWindowStart(sql.NullTime{}, now); !got.Equal(now.Add(-transactionInitialHistory)) {
+		t.Errorf("first sync should start %v back, got %v", transactionInitialHistory, got)
+	}
+
+	last := time.Date(2026, 6, 20, 0, 0, 0, 0, time.UTC)
+	if got := syncWindowStart(sql.NullTime{Time: last, Valid: true}, now); !got.Equal(last.Add(-transactionSyncOverlap)) {
+		t.Errorf("incremental sync should overlap the last booking date, got %v", got)
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 	"fmt"
 
@@ -11,6 +12,24 @@ import (
 
 )
 
+// Fournisseurs connus de banking_connections.provider
+const (
+	ProviderEnableBanking = "enablebanking"
+	// ProviderLegacy : connexions reprises de l'ancien schéma
+	// (bank_connections), non synchronisables.
+	ProviderLegacy = "legacy"
+	// ProviderFile : comptes alimentés par l'import de relevés, jamais
+	// synchronisés.
+	ProviderFile = "file"
+)
+
+var (
+	ErrBankConnectionNotFound = errors.New("bank connection not found")
+	ErrBankAccountNotFound    = errors.New("bank account not found")
+)
+
+// BankingService lit et écrit le schéma bancaire unique
+// (banking_connections / banking_accounts), quel que soit le fournisseur.
 type BankingService struct {
 	db *sql.DB
 }
@@ -19,97 +38,178 @@ func NewBankingService(db *sql.DB) *BankingService {
 	return &BankingService{db: db}
 }
 
-// GetBudgetConnections renvoie les connexions pour un BUDGET spécifique
-func (s *BankingService) GetBudgetConnections(ctx context.Context, budgetID string) ([]models.BankConnection, error) {
-	query := `
-		SELECT id, institution_id, institution_name, status, expires_at, created_at
-		FROM bank_connections
-		WHERE budget_id = $1
+// GetBudgetConnections renvoie les connexions que userID a créées sur le
+// budget, avec leurs comptes.
+func (s *BankingService) GetBudgetConnections(ctx context.Context, budgetID, userID string) ([]models.BankConnection, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, COALESCE(provider, $3), aspsp_name, aspsp_country,
+		       COALESCE(status, 'active'), expires_at, COALESCE(sync_status, 'idle'),
+		       last_sync_at, COALESCE(last_sync_error, ''), created_at, updated_at
+		FROM banking_connections
+		WHERE budget_id = $1 AND user_id = $2
 		ORDER BY created_at DESC
-	`
-
-	rows, err := s.db.QueryContext(ctx, query, budgetID)
+	`, budgetID, userID, ProviderEnableBanking)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var connections []models.BankConnection
+	connections := []models.BankConnection{}
+	index := map[string]int{}
 	for rows.Next() {
 		var conn models.BankConnection
-		err := rows.Scan(&conn.ID, &conn.InstitutionID, &conn.InstitutionName, &conn.Status, &conn.ExpiresAt, &conn.CreatedAt)
-		if err != nil {
+		if err := rows.Scan(&conn.ID, &conn.UserID, &conn.Provider, &conn.InstitutionName, &conn.InstitutionCountry,
+			&conn.Status, &conn.ValidUntil, &conn.SyncStatus, &conn.LastSyncAt,
+			&conn.LastSyncError, &conn.CreatedAt, &conn.UpdatedAt); err != nil {
 			return nil, err
 		}
-
-		accounts, err := s.GetAccountsByConnection(ctx, conn.ID)
-		if err == nil {
-			conn.Accounts = accounts
-		}
-
+		conn.Accounts = []models.BankAccount{}
+		index[conn.ID] = len(connections)
 		connections = append(connections, conn)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(connections) == 0 {
+		return connections, nil
+	}
 
+	accounts, err := s.queryAccounts(ctx, `
+		SELECT ba.id, ba.connection_id, ba.account_id, COALESCE(ba.account_name, ''), COALESCE(ba.mask, ''),
+		       COALESCE(ba.account_type, ''), COALESCE(ba.currency, ''), COALESCE(ba.balance, 0),
+		       ba.is_savings_pool, ba.last_sync_at
+		FROM banking_accounts ba
+		JOIN banking_connections bc ON bc.id = ba.connection_id
+		WHERE bc.budget_id = $1 AND bc.user_id = $2
+		ORDER BY ba.account_name
+	`, budgetID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, acc := range accounts {
+		if i, ok := index[acc.ConnectionID]; ok {
+			connections[i].Accounts = append(connections[i].Accounts, acc)
+			connections[i].AccountCount++
+		}
+	}
 	return connections, nil
 }
 
 // GetAccountsByConnection fetches accounts for a specific connection
 func (s *BankingService) GetAccountsByConnection(ctx context.Context, connectionID string) ([]models.BankAccount, error) {
-	query := `
-		SELECT id, connection_id, name, mask, currency, balance, is_savings_pool, last_synced_at
-		FROM bank_accounts
+	return s.queryAccounts(ctx, `
+		SELECT id, connection_id, account_id, COALESCE(account_name, ''), COALESCE(mask, ''),
+		       COALESCE(account_type, ''), COALESCE(currency, ''), COALESCE(balance, 0),
+		       is_savings_pool, last_sync_at
+		FROM banking_accounts
 		WHERE connection_id = $1
-		ORDER BY name
-	`
-	rows, err := s.db.QueryContext(ctx, query, connectionID)
+		ORDER BY account_name
+	`, connectionID)
+}
+
+func (s *BankingService) queryAccounts(ctx context.Context, query string, args ...interface{}) ([]models.BankAccount, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var accounts []models.BankAccount
+	accounts := []models.BankAccount{}
 	for rows.Next() {
 		var acc models.BankAccount
-		err := rows.Scan(
-			&acc.ID, &acc.ConnectionID, &acc.Name, &acc.Mask,
-			&acc.Currency, &acc.Balance, &acc.IsSavingsPool, &acc.LastSyncedAt,
-		)
-		if err != nil {
-			continue
+		if err := rows.Scan(
+			&acc.ID, &acc.ConnectionID, &acc.ExternalAccountID, &acc.Name, &acc.Mask,
+			&acc.Type, &acc.Currency, &acc.Balance, &acc.IsSavingsPool, &acc.LastSyncedAt,
+		); err != nil {
+			return nil, err
 		}
 		accounts = append(accounts, acc)
 	}
-	return accounts, nil
+	return accounts, rows.Err()
 }
 
-// GetRealityCheckSum calcule le total pour un BUDGET spécifique
-func (s *BankingService) GetRealityCheckSum(ctx context.Context, budgetID string) (float64, error) {
-	query := `
-		SELECT COALESCE(SUM(ba.balance), 0)
-		FROM bank_accounts ba
-		JOIN bank_connections bc ON ba.connection_id = bc.id
+// GetRealityCheckBalances : épargne réelle du BUDGET, soldes des comptes que
+// les membres ont marqués is_savings_pool, par devise (la devise du budget
+// pour les comptes qui n'en ont pas).
+func (s *BankingService) GetRealityCheckBalances(ctx context.Context, budgetID string) (map[string]float64, error) {
+	return s.balancesByCurrency(ctx, `
+		SELECT UPPER(COALESCE(NULLIF(ba.currency, ''), NULLIF(b.currency, ''), 'EUR')), COALESCE(SUM(ba.balance), 0)
+		FROM banking_accounts ba
+		JOIN banking_connections bc ON ba.connection_id = bc.id
+		JOIN budgets b ON b.id = bc.budget_id
 		WHERE bc.budget_id = $1 AND ba.is_savings_pool = TRUE
-	`
-	var total float64
-	err := s.db.QueryRowContext(ctx, query, budgetID).Scan(&total)
-	return total, err
+		GROUP BY 1
+	`, budgetID)
 }
 
-// UpdateAccountPool toggles whether an account counts towards the Reality Check
-func (s *BankingService) UpdateAccountPool(ctx context.Context, accountID string, isSavingsPool bool) error {
-	_, err := s.db.ExecContext(ctx, "UPDATE bank_accounts SET is_savings_pool = $1 WHERE id = $2", isSavingsPool, accountID)
-	return err
+// GetUserCashBalances : soldes des comptes que userID a connectés au budget,
+// par devise.
+func (s *BankingService) GetUserCashBalances(ctx context.Context, budgetID, userID string) (map[string]float64, error) {
+	return s.balancesByCurrency(ctx, `
+		SELECT UPPER(COALESCE(NULLIF(ba.currency, ''), NULLIF(b.currency, ''), 'EUR')), COALESCE(SUM(ba.balance), 0)
+		FROM banking_accounts ba
+		JOIN banking_connections bc ON ba.connection_id = bc.id
+		JOIN budgets b ON b.id = bc.budget_id
+		WHERE bc.budget_id = $1 AND bc.user_id = $2
+		GROUP BY 1
+	`, budgetID, userID)
 }
 
-// DeleteConnection removes a connection and its accounts
-func (s *BankingService) DeleteConnection(ctx context.Context, connectionID string) error {
+func (s *BankingService) balancesByCurrency(ctx context.Context, query string, args ...interface{}) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := map[string]float64{}
+	for rows.Next() {
+		var currency string
+		var total float64
+		if err := rows.Scan(&currency, &total); err != nil {
+			return nil, err
+		}
+		balances[currency] = total
+	}
+	return balances, rows.Err()
+}
+
+// UpdateAccountPool toggles whether an account counts towards the Reality
+// Check. Seul l'utilisateur qui a connecté le compte peut le partager.
+func (s *BankingService) UpdateAccountPool(ctx context.Context, budgetID, userID, accountID string, isSavingsPool bool) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE banking_accounts ba
+		SET is_savings_pool = $1
+		FROM banking_connections bc
+		WHERE ba.id = $2 AND bc.id = ba.connection_id
+		  AND bc.budget_id = $3 AND bc.user_id = $4
+	`, isSavingsPool, accountID, budgetID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBankAccountNotFound
+	}
+	return nil
+}
+
+// DeleteConnection removes a connection of userID and its accounts
+// (transactions included, ON DELETE CASCADE).
+func (s *BankingService) DeleteConnection(ctx context.Context, connectionID, userID string) error {
 	return utils.WithTransaction(s.db, func(tx *sql.Tx) error {
-		if _, err := tx.ExecContext(ctx, "DELETE FROM bank_accounts WHERE connection_id = $1", connectionID); err != nil {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM banking_accounts
+			WHERE connection_id = (SELECT id FROM banking_connections WHERE id = $1 AND user_id = $2)
+		`, connectionID, userID); err != nil {
 			return err
 		}
-		if _, err := tx.ExecContext(ctx, "DELETE FROM bank_connections WHERE id = $1", connectionID); err != nil {
+		res, err := tx.ExecContext(ctx, "DELETE FROM banking_connections WHERE id = $1 AND user_id = $2", connectionID, userID)
+		if err != nil {
 			return err
 		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrBankConnectionNotFound
+		}
 		return nil
 	})
 }
@@ -137,6 +237,7 @@ func (s *BankingService) SaveConnectionWithTokens(
 		INSERT INTO banking_connections (
 			user_id,
 			budget_id,
+			provider,
 			aspsp_name,
 			aspsp_country,
 			session_id,
@@ -145,28 +246,48 @@ func (s *BankingService) SaveConnectionWithTokens(
 			status,
 			created_at,
 			updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		) VALUES ($1, $2, $9, $3, $4, $5, NULLIF($6, ''), $7, $8, NOW(), NOW())
 		ON CONFLICT (user_id, budget_id, aspsp_name, aspsp_country)
 		DO UPDATE SET
+			provider = EXCLUDED.provider,
 			session_id = EXCLUDED.session_id,
 			access_token = EXCLUDED.access_token,
 			expires_at = EXCLUDED.expires_at,
+			-- Reconnexion : nouveau consentement, on repart de zéro
+			status = EXCLUDED.status,
+			status_changed_at = CASE WHEN banking_connections.status = EXCLUDED.status
+				THEN banking_connections.status_changed_at ELSE NOW() END,
+			consent_reminder_sent_at = CASE WHEN banking_connections.expires_at IS DISTINCT FROM EXCLUDED.expires_at
+				THEN NULL ELSE banking_connections.consent_reminder_sent_at END,
+			sync_failures = 0,
+			last_sync_error = NULL,
 			updated_at = NOW()
 		RETURNING id
 	`
 	
+	// Identifiants chiffrés au repos (voir banking_credentials.go)
+	encryptedSession, err := encryptCredential(sessionID)
+	if err != nil {
+		return "", err
+	}
+	encryptedToken, err := encryptCredential(accessToken)
+	if err != nil {
+		return "", err
+	}
+
 	var connectionID string
-	err := s.db.QueryRowContext(
+	err = s.db.QueryRowContext(
 		ctx,
 		query,
 		userID,
 		budgetID,
 		bankName,
 		country,
-		sessionID,
-		accessToken,
+		encryptedSession,
+		encryptedToken,
 		expiresAt,
 		"active",
+		provider,
 	).Scan(&connectionID)
 	
 	if err != nil {
@@ -176,7 +297,8 @@ func (s *BankingService) SaveConnectionWithTokens(
 	return connectionID, nil
 }
 
-// SaveAccount sauvegarde un compte bancaire Enable Banking
+// SaveAccount sauvegarde un compte bancaire Enable Banking et renvoie son id
+// (banking_accounts.id)
 func (s *BankingService) SaveAccount(
 	ctx context.Context,
 	connectionID string,
@@ -185,8 +307,31 @@ func (s *BankingService) SaveAccount(
 	mask string,
 	currency string,
 	balance float64,
-) error {
-	
+	identificationHash string, // stable entre sessions, peut être vide
+) (string, error) {
+
+	// L'UID change à chaque session : après une reconnexion, on rattache le
+	// compte existant (et son historique de transactions) au nouvel UID.
+	// Repli sur nom + devise pour les comptes enregistrés sans empreinte.
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE banking_accounts
+		SET account_id = $2, identification_hash = COALESCE(NULLIF($3::text, ''), identification_hash)
+		WHERE id = (
+			SELECT id FROM banking_accounts
+			WHERE connection_id = $1
+			  AND account_id <> $2
+			  AND (
+				(NULLIF($3::text, '') IS NOT NULL AND identification_hash = $3::text)
+				OR (identification_hash IS NULL AND account_name = $4 AND currency = $5)
+			  )
+			ORDER BY (identification_hash IS NOT NULL) DESC, created_at
+			LIMIT 1
+		)
+		AND NOT EXISTS (SELECT 1 FROM banking_accounts WHERE connection_id = $1 AND account_id = $2)
+	`, connectionID, accountID, identificationHash, name, currency); err != nil {
+		return "", fmt.Errorf("failed to reattach account: %w", err)
+	}
+
 	query := `
 		INSERT INTO banking_accounts (
 			connection_id,
@@ -196,17 +341,23 @@ func (s *BankingService) SaveAccount(
 			currency,
 			balance,
 			last_sync_at,
-			created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+			created_at,
+			identification_hash,
+			mask
+		) VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW(), NULLIF($7, ''), NULLIF($8, ''))
 		ON CONFLICT (connection_id, account_id)
 		DO UPDATE SET
 			account_name = EXCLUDED.account_name,
 			currency = EXCLUDED.currency,
 			balance = EXCLUDED.balance,
+			identification_hash = COALESCE(EXCLUDED.identification_hash, banking_accounts.identification_hash),
+			mask = COALESCE(EXCLUDED.mask, banking_accounts.mask),
 			last_sync_at = NOW()
+		RETURNING id
 	`
 	
-	_, err := s.db.ExecContext(
+	var id string
+	err := s.db.QueryRowContext(
 		ctx,
 		query,
 		connectionID,
@@ -215,11 +366,18 @@ func (s *BankingService) SaveAccount(
 		"CACC", // Type par défaut, pourrait être passé en paramètre
 		currency,
 		balance,
-	)
+		identificationHash,
+		mask,
+	).Scan(&id)
 	
 	if err != nil {
-		return fmt.Errorf("failed to save account: %w", err)
+		return "", fmt.Errorf("failed to save account: %w", err)
 	}
-	
-	return nil
+
+	// Le compte est enregistré : un historique manquant n'est pas bloquant
+	if err := recordBalanceSnapshot(ctx, s.db, id, ""); err != nil {
+		utils.SafeWarn("⚠️ %v", err)
+	}
+
+	return id, nil
 }
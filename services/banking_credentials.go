@@ -0,0 +1,341 @@
+// services/banking_credentials.go
+// ============================================================================
+// BANKING CREDENTIALS — identifiants de session et jetons chiffrés
+// ============================================================================
+// session_id, access_token et refresh_token de banking_connections sont
+// chiffrés avec la clé maître (utils.Encrypt, comme les clés de données des
+// budgets) et ne sont déchiffrés qu'ici, au moment d'appeler le fournisseur :
+// les handlers passent par BankingService et ne lisent jamais ces colonnes.
+//
+// Entre le callback OAuth et SyncAccounts, la nouvelle session attend dans
+// banking_authorizations, chiffrée et indexée par le state de l'autorisation
+// (créé par CreateConnection / ReconnectConnection pour un utilisateur et un
+// budget). Le client ne voit que le state, jamais la session.
+//
+// Les valeurs enregistrées en clair avant le chiffrement sont chiffrées une
+// fois, en tâche de fond au démarrage (EncryptBankCredentials) ; d'ici là, decryptCredential les
+// renvoie telles quelles. Seule une valeur qui n'a pas la forme d'un texte
+// chiffré (utils.IsTaggedCiphertext) est prise pour du clair : un chiffré
+// illisible, clé inconnue comprise, est une erreur. Les jetons repris des
+// anciennes tables bank_connections sont des chiffrés sans préfixe (format
+// d'avant le trousseau) : une valeur sans préfixe est d'abord déchiffrée
+// comme tel, et n'est du clair que si ce déchiffrement échoue.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// ErrBankProviderMismatch : la connexion a été créée par un autre fournisseur
+// que celui configuré (BANKING_PROVIDER).
+var ErrBankProviderMismatch = errors.New("bank connection belongs to another provider")
+
+// ErrBankAuthorizationNotFound : state inconnu, expiré, ou créé par un autre
+// utilisateur ou pour un autre budget.
+var ErrBankAuthorizationNotFound = errors.New("bank authorization not found or expired")
+
+// BankAuthorizationTTL : durée de vie d'une autorisation en attente, du
+// lancement à SyncAccounts.
+const BankAuthorizationTTL = time.Hour
+
+// encryptCredential chiffre un identifiant ou un jeton ; "" reste "".
+func encryptCredential(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	encrypted, err := utils.Encrypt([]byte(plain))
+	if err != nil {
+		return "", fmt.Errorf("encrypt bank credential: %w", err)
+	}
+	return encrypted, nil
+}
+
+// decryptCredential déchiffre une valeur de banking_connections. Une valeur
+// sans préfixe de chiffré est un ancien chiffré sans key id, sinon une
+// valeur enregistrée en clair.
+func decryptCredential(stored string) (string, error) {
+	if stored == "" {
+		return "", nil
+	}
+	if !utils.IsTaggedCiphertext(stored) {
+		return string(legacyCredential(stored)), nil
+	}
+	plain, err := utils.Decrypt(stored)
+	if err != nil {
+		return "", fmt.Errorf("decrypt bank credential: %w", err)
+	}
+	return string(plain), nil
+}
+
+// legacyCredential lit une valeur sans préfixe : chiffré d'avant le trousseau
+// (reprise de bank_connections, essayé avec chaque clé) ou clair.
+func legacyCredential(stored string) []byte {
+	if plain, err := utils.Decrypt(stored); err == nil {
+		return plain
+	}
+	return []byte(stored)
+}
+
+// bankCredentialColumns : colonnes du job de rotation (key_rotation.go)
+// chiffrées par EncryptBankCredentials.
+var bankCredentialColumns = []string{"bank_session_ids", "bank_access_tokens", "bank_refresh_tokens"}
+
+// bankCredentialsMigration : ligne de data_migrations posée quand tous les
+// identifiants bancaires sont chiffrés.
+const bankCredentialsMigration = "encrypt_bank_credentials"
+
+// EncryptBankCredentials chiffre en place les identifiants bancaires encore
+// en clair (ou chiffrés avec une ancienne clé maître). Ne parcourt la table
+// qu'une fois : après un passage sans échec, la migration est marquée faite
+// et les appels suivants ne font rien (les rotations de clé passent ensuite
+// par POST /admin/maintenance/reencrypt). Idempotent.
+func EncryptBankCredentials(ctx context.Context, db *sql.DB) (int, error) {
+	var done bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM data_migrations WHERE name = $1)
+	`, bankCredentialsMigration).Scan(&done)
+	if err != nil || done {
+		return 0, err
+	}
+
+	res, err := NewKeyRotationService(db).Reencrypt(ctx, ReencryptOptions{Columns: bankCredentialColumns})
+	if err != nil {
+		return 0, err
+	}
+	encrypted := 0
+	for _, p := range res.Columns {
+		encrypted += p.Reencrypted
+	}
+	if len(res.Failures) > 0 {
+		return encrypted, fmt.Errorf("%d bank credentials could not be encrypted", len(res.Failures))
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO data_migrations (name) VALUES ($1) ON CONFLICT (name) DO NOTHING
+	`, bankCredentialsMigration); err != nil {
+		return encrypted, err
+	}
+	return encrypted, nil
+}
+
+// connectionSession renvoie la session déchiffrée et le fournisseur d'une
+// connexion ; userID vide = sans contrôle du propriétaire.
+func (s *BankingService) connectionSession(ctx context.Context, connectionID, userID string) (string, string, error) {
+	var stored, provider string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT session_id, provider
+		FROM banking_connections
+		WHERE id = $1 AND ($2 = '' OR user_id::text = $2)
+	`, connectionID, userID).Scan(&stored, &provider)
+	if err == sql.ErrNoRows {
+		return "", "", ErrBankConnectionNotFound
+	}
+	if err != nil {
+		return "", "", err
+	}
+	sessionID, err := decryptCredential(stored)
+	return sessionID, provider, err
+}
+
+// ============================================================================
+// AUTORISATIONS EN ATTENTE
+// ============================================================================
+
+// SaveBankAuthorization enregistre le state d'une autorisation lancée par
+// userID pour budgetID.
+func (s *BankingService) SaveBankAuthorization(ctx context.Context, state, userID, budgetID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO banking_authorizations (state, user_id, budget_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, state, userID, budgetID, time.Now().Add(BankAuthorizationTTL))
+	return err
+}
+
+// BankAuthorizationBudget renvoie le budget d'une autorisation en attente
+// de userID, avant l'échange du code au callback.
+func (s *BankingService) BankAuthorizationBudget(ctx context.Context, state, userID string) (string, error) {
+	var budgetID string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT budget_id FROM banking_authorizations
+		WHERE state = $1 AND user_id = $2 AND expires_at > NOW()
+	`, state, userID).Scan(&budgetID)
+	if err == sql.ErrNoRows {
+		return "", ErrBankAuthorizationNotFound
+	}
+	return budgetID, err
+}
+
+// AttachBankSession garde, chiffrée, la session obtenue au callback.
+func (s *BankingService) AttachBankSession(ctx context.Context, state, userID, sessionID string) error {
+	encrypted, err := encryptCredential(sessionID)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE banking_authorizations SET session_id = $3
+		WHERE state = $1 AND user_id = $2 AND expires_at > NOW()
+	`, state, userID, encrypted)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBankAuthorizationNotFound
+	}
+	return nil
+}
+
+// BankAuthorizationSession renvoie la session déchiffrée d'une autorisation
+// terminée (callback passé) de userID sur budgetID. La ligne reste jusqu'à
+// expiration : SyncAccounts peut être relancé.
+func (s *BankingService) BankAuthorizationSession(ctx context.Context, state, userID, budgetID string) (string, error) {
+	var stored string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT session_id FROM banking_authorizations
+		WHERE state = $1 AND user_id = $2 AND budget_id = $3
+		  AND session_id IS NOT NULL AND expires_at > NOW()
+	`, state, userID, budgetID).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return "", ErrBankAuthorizationNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return decryptCredential(stored)
+}
+
+// PruneBankAuthorizations supprime les autorisations expirées.
+func PruneBankAuthorizations(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM banking_authorizations WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RevokeProviderSession révoque la session chez le fournisseur avant la
+// suppression locale de la connexion. Les connexions d'un autre fournisseur
+// n'ont rien à révoquer.
+func (s *BankingService) RevokeProviderSession(ctx context.Context, provider BankingProvider, connectionID, userID string) error {
+	sessionID, connProvider, err := s.connectionSession(ctx, connectionID, userID)
+	if err != nil {
+		return err
+	}
+	if sessionID == "" || connProvider != provider.Name() {
+		return nil
+	}
+	return provider.DeleteSession(ctx, sessionID)
+}
+
+// authorizeConnection vérifie que userID possède la connexion ou a la
+// permission manage_banking sur son budget ; sinon ErrBankConnectionNotFound,
+// comme pour une connexion inexistante.
+func (s *BankingService) authorizeConnection(ctx context.Context, connectionID, userID string) error {
+	if userID == "" {
+		return ErrBankConnectionNotFound
+	}
+	var ownerID, budgetID string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT user_id, budget_id FROM banking_connections WHERE id = $1
+	`, connectionID).Scan(&ownerID, &budgetID)
+	if err == sql.ErrNoRows {
+		return ErrBankConnectionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if ownerID == userID {
+		return nil
+	}
+	access, err := GetMemberAccess(ctx, s.db, budgetID, userID)
+	if errors.Is(err, ErrNotBudgetMember) {
+		return ErrBankConnectionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !access.Can(PermManageBanking) {
+		return ErrBankConnectionNotFound
+	}
+	return nil
+}
+
+// RefreshConnectionBalances relit le solde de chaque compte de la connexion
+// chez le fournisseur, pour son propriétaire ou un membre du budget ayant
+// manage_banking. Renvoie le nombre de comptes mis à jour et un message par
+// compte en échec.
+func (s *BankingService) RefreshConnectionBalances(ctx context.Context, provider BankingProvider, connectionID, userID string) (int, []string, error) {
+	if err := s.authorizeConnection(ctx, connectionID, userID); err != nil {
+		return 0, nil, err
+	}
+	sessionID, connProvider, err := s.connectionSession(ctx, connectionID, "")
+	if err != nil {
+		return 0, nil, err
+	}
+	if connProvider != provider.Name() {
+		return 0, nil, ErrBankProviderMismatch
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, account_id, COALESCE(account_name, '')
+		FROM banking_accounts
+		WHERE connection_id = $1
+	`, connectionID)
+	if err != nil {
+		return 0, nil, err
+	}
+	type account struct{ id, uid, name string }
+	var accounts []account
+	for rows.Next() {
+		var a account
+		if err := rows.Scan(&a.id, &a.uid, &a.name); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	updated := 0
+	failures := []string{}
+	for _, acc := range accounts {
+		// ✅ LOGGING SÉCURISÉ
+		utils.SafeDebug("💰 Refreshing balance for: %s", acc.name)
+
+		balances, err := provider.GetBalances(ctx, sessionID, acc.uid)
+		if err != nil {
+			msg := fmt.Sprintf("Error fetching balance for %s", acc.name)
+			utils.SafeWarn("❌ %s: %v", msg, err)
+			failures = append(failures, msg)
+			continue
+		}
+		if len(balances) == 0 {
+			continue
+		}
+		balance, err := strconv.ParseFloat(balances[0].BalanceAmount.Amount, 64)
+		if err != nil {
+			continue
+		}
+		if err := updateAccountBalance(ctx, s.db, acc.id, balance); err != nil {
+			msg := fmt.Sprintf("Failed to update balance for %s", acc.name)
+			utils.SafeError("❌ %s: %v", msg, err)
+			failures = append(failures, msg)
+			continue
+		}
+		// ✅ LOGGING SÉCURISÉ - Ne pas logger le montant
+		utils.SafeInfo("✅ Updated balance for %s", acc.name)
+		updated++
+	}
+	return updated, failures, nil
+}
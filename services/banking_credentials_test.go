@@ -0,0 +1,72 @@
+// services/banking_credentials_test.go
+// ============================================================================
+// TESTS — chiffrement des identifiants bancaires
+// ============================================================================
+// Lancer : go test ./services -run Credential -v
+// ============================================================================
+
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+const testCredentialKey = "0123456789abcdef0123456789abcdef"
+
+func TestCredentialRoundTrip(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", testCredentialKey)
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+
+	stored, err := encryptCredential("session-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == "session-123" || !strings.HasPrefix(stored, "k1:") {
+		t.Fatalf("stored = %q, want a k1 ciphertext", stored)
+	}
+	plain, err := decryptCredential(stored)
+	if err != nil || plain != "session-123" {
+		t.Fatalf("decrypt = %q, %v", plain, err)
+	}
+
+	if stored, _ := encryptCredential(""); stored != "" {
+		t.Errorf("empty credential stored as %q", stored)
+	}
+}
+
+func TestDecryptCredentialPlaintext(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", testCredentialKey)
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+
+	// Valeurs d'avant le chiffrement : UUID, ids de fichier, jetons opaques
+	for _, v := range []string{"3f2b8c1e-0000-4000-8000-000000000000", "file:42", "abcdEFGH"} {
+		plain, err := decryptCredential(v)
+		if err != nil || plain != v {
+			t.Errorf("decrypt(%q) = %q, %v; want it unchanged", v, plain, err)
+		}
+	}
+
+	// Chiffré avec une clé connue mais altéré : erreur, pas de repli
+	stored, err := encryptCredential("session-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptCredential(stored[:len(stored)-4] + "AAAA"); err == nil {
+		t.Error("tampered credential decrypted")
+	}
+
+	// Jeton repris de bank_connections : chiffré sans key id
+	legacy := strings.TrimPrefix(stored, "k1:")
+	if plain, err := decryptCredential(legacy); err != nil || plain != "session-123" {
+		t.Errorf("decrypt(untagged ciphertext) = %q, %v; want session-123", plain, err)
+	}
+
+	// Chiffré avec une clé retirée du trousseau : erreur, jamais un jeton en clair
+	orphan := "k0" + strings.TrimPrefix(stored, "k1")
+	if plain, err := decryptCredential(orphan); err == nil {
+		t.Errorf("credential with unknown key id returned as %q", plain)
+	}
+}
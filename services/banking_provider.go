@@ -0,0 +1,86 @@
+// services/banking_provider.go
+// ============================================================================
+// BANKING PROVIDER — abstraction des agrégateurs open banking
+// ============================================================================
+// Les handlers et la synchro ne parlent qu'à un BankingProvider. Les types
+// échangés (ASPSP, AuthRequest, SessionResponse, Account, Balance,
+// Transaction...) sont ceux de l'API Enable Banking, qui servent de format
+// commun : un autre agrégateur les remplit depuis sa propre API.
+//
+//   BANKING_PROVIDER=enablebanking (défaut) → EnableBankingService
+//   BANKING_PROVIDER=mock                   → MockBankingProvider, en
+//                                             mémoire, sans réseau ni clé
+//
+// banking_connections.provider garde le Name() du fournisseur qui a créé la
+// connexion : la synchro ne traite que celles du fournisseur actif.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// ProviderMock est le Name() de MockBankingProvider.
+const ProviderMock = "mock"
+
+type BankingProvider interface {
+	BankSyncProvider // transactions, soldes, état de la session
+
+	// Name est stocké dans banking_connections.provider.
+	Name() string
+	// GetASPSPs liste les établissements disponibles pour un pays.
+	GetASPSPs(ctx context.Context, country string) ([]ASPSP, error)
+	// CreateAuthRequest démarre l'autorisation : l'utilisateur est envoyé
+	// sur URL, puis revient sur RedirectURL avec ?code=...&state=...
+	CreateAuthRequest(ctx context.Context, authReq AuthRequest) (*AuthResponse, error)
+	// CreateSession échange le code contre une session et ses comptes.
+	CreateSession(ctx context.Context, code, state string) (*SessionResponse, error)
+	// DeleteSession révoque le consentement côté fournisseur.
+	DeleteSession(ctx context.Context, sessionID string) error
+}
+
+var (
+	_ BankingProvider = (*EnableBankingService)(nil)
+	_ BankingProvider = (*MockBankingProvider)(nil)
+)
+
+// BankingProviderConfig renvoie le fournisseur retenu par BANKING_PROVIDER et
+// la variable d'environnement qui lui manque ("" s'il est configuré).
+func BankingProviderConfig() (provider, missing string) {
+	if bankingProviderName() == ProviderMock {
+		return ProviderMock, ""
+	}
+	if os.Getenv("ENABLE_BANKING_APP_ID") == "" {
+		return ProviderEnableBanking, "ENABLE_BANKING_APP_ID"
+	}
+	return ProviderEnableBanking, ""
+}
+
+// NewBankingProviderFromEnv construit le fournisseur choisi par
+// BANKING_PROVIDER.
+func NewBankingProviderFromEnv() BankingProvider {
+	switch name := bankingProviderName(); name {
+	case ProviderMock:
+		if utils.IsProduction {
+			utils.SafeWarn("⚠️  BANKING_PROVIDER=mock in production: bank data is fake")
+		}
+		return NewMockBankingProvider()
+	case ProviderEnableBanking:
+	default:
+		utils.SafeWarn("⚠️  Unknown BANKING_PROVIDER %q, using %s", name, ProviderEnableBanking)
+	}
+	return NewEnableBankingService()
+}
+
+func bankingProviderName() string {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("BANKING_PROVIDER")))
+	if name == "" {
+		return ProviderEnableBanking
+	}
+	return name
+}
@@ -0,0 +1,301 @@
+// services/banking_provider_mock.go
+// ============================================================================
+// MOCK BANKING PROVIDER — fournisseur local, déterministe (BANKING_PROVIDER=mock)
+// ============================================================================
+// Aucun réseau, aucune clé, aucun état : tout est dérivé des identifiants.
+//
+//   CreateAuthRequest → URL = RedirectURL?code=mock-<banque>-<hash>&state=...
+//                       (l'utilisateur "autorise" en suivant simplement l'URL)
+//   CreateSession     → session mock-<banque>-<hash(code, state)>, deux comptes
+//                       (courant + livret) dont l'UID change à chaque session
+//                       et l'identification_hash non, comme en vrai
+//   GetTransactions   → historique généré jour par jour : loyer, EDF,
+//                       Netflix, eau (trimestrielle), salaire, courses du
+//                       samedi, virement d'épargne. Les ids ne dépendent que
+//                       de la banque, du compte et de la date : une
+//                       resynchro ou une reconnexion ne crée pas de doublons.
+//
+// "Mock Expired Bank" renvoie des sessions EXPIRED pour tester le parcours
+// de reconnexion.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var mockInstitutions = []ASPSP{
+	{Name: "Mock Bank", BIC: "MOCKFRPP"},
+	{Name: "Mock Savings Bank", BIC: "MOCKFRP2"},
+	{Name: "Mock Expired Bank", BIC: "MOCKFRP3", Beta: true},
+}
+
+const mockExpiredInstitution = 2
+
+type mockAccountTemplate struct {
+	Name    string
+	Type    string
+	Balance string
+}
+
+var mockAccountTemplates = []mockAccountTemplate{
+	{Name: "Compte courant", Type: "CACC", Balance: "1523.45"},
+	{Name: "Livret A", Type: "SVGS", Balance: "8200.00"},
+}
+
+var mockNamespace = uuid.MustParse("6f1c3d2e-9a47-4b8e-b0d5-0c2f5e8a7b91")
+
+// MockBankingProvider implémente BankingProvider en mémoire.
+type MockBankingProvider struct {
+	// Now fixe l'horloge (tests) ; time.Now par défaut.
+	Now func() time.Time
+}
+
+func NewMockBankingProvider() *MockBankingProvider {
+	return &MockBankingProvider{Now: time.Now}
+}
+
+func (p *MockBankingProvider) Name() string {
+	return ProviderMock
+}
+
+func (p *MockBankingProvider) now() time.Time {
+	if p.Now == nil {
+		return time.Now().UTC()
+	}
+	return p.Now().UTC()
+}
+
+func mockHash(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// parseMockSession lit l'index de la banque dans "mock-<banque>-<hash>".
+func parseMockSession(sessionID string) (int, bool) {
+	parts := strings.Split(sessionID, "-")
+	if len(parts) != 3 || parts[0] != "mock" {
+		return 0, false
+	}
+	bank, err := strconv.Atoi(parts[1])
+	if err != nil || bank < 0 || bank >= len(mockInstitutions) {
+		return 0, false
+	}
+	return bank, true
+}
+
+// parseMockAccount lit banque et compte dans "<session>-acc-<compte>".
+func parseMockAccount(accountUID string) (int, int, bool) {
+	i := strings.LastIndex(accountUID, "-acc-")
+	if i < 0 {
+		return 0, 0, false
+	}
+	bank, ok := parseMockSession(accountUID[:i])
+	if !ok {
+		return 0, 0, false
+	}
+	account, err := strconv.Atoi(accountUID[i+len("-acc-"):])
+	if err != nil || account < 0 || account >= len(mockAccountTemplates) {
+		return 0, 0, false
+	}
+	return bank, account, true
+}
+
+func mockIdentificationHash(bank, account int) string {
+	return "mock-" + mockHash("account", strconv.Itoa(bank), strconv.Itoa(account))
+}
+
+func (p *MockBankingProvider) GetASPSPs(ctx context.Context, country string) ([]ASPSP, error) {
+	if country == "" {
+		country = "FR"
+	}
+	banks := make([]ASPSP, len(mockInstitutions))
+	for i, b := range mockInstitutions {
+		b.Country = strings.ToUpper(country)
+		banks[i] = b
+	}
+	return banks, nil
+}
+
+func (p *MockBankingProvider) CreateAuthRequest(ctx context.Context, authReq AuthRequest) (*AuthResponse, error) {
+	bank := -1
+	for i, b := range mockInstitutions {
+		if strings.EqualFold(b.Name, authReq.ASPSP.Name) {
+			bank = i
+			break
+		}
+	}
+	if bank < 0 {
+		return nil, fmt.Errorf("mock provider: unknown institution %q", authReq.ASPSP.Name)
+	}
+
+	code := fmt.Sprintf("mock-%d-%s", bank, mockHash("code", authReq.State))
+	redirect, err := url.Parse(authReq.RedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("mock provider: invalid redirect URL: %w", err)
+	}
+	q := redirect.Query()
+	q.Set("code", code)
+	q.Set("state", authReq.State)
+	redirect.RawQuery = q.Encode()
+
+	return &AuthResponse{
+		URL:             redirect.String(),
+		AuthorizationID: uuid.NewSHA1(mockNamespace, []byte("auth|"+authReq.State)).String(),
+	}, nil
+}
+
+func (p *MockBankingProvider) CreateSession(ctx context.Context, code, state string) (*SessionResponse, error) {
+	bank, ok := parseMockSession(code)
+	if !ok {
+		return nil, fmt.Errorf("mock provider: invalid authorization code")
+	}
+	sessionID := fmt.Sprintf("mock-%d-%s", bank, mockHash("session", code, state))
+
+	resp := &SessionResponse{
+		SessionID: sessionID,
+		PSUType:   "personal",
+		Access:    Access{ValidUntil: p.now().Add(DefaultConsentValidity).Format(time.RFC3339)},
+	}
+	resp.ASPSP.Name = mockInstitutions[bank].Name
+	resp.ASPSP.Country = "FR"
+
+	for i, tpl := range mockAccountTemplates {
+		resp.Accounts = append(resp.Accounts, Account{
+			AccountID:          AccountIdentification{IBAN: fmt.Sprintf("FR76300060000%d%010d", bank, i+1)},
+			Name:               tpl.Name,
+			Currency:           "EUR",
+			CashAccountType:    tpl.Type,
+			UID:                fmt.Sprintf("%s-acc-%d", sessionID, i),
+			IdentificationHash: mockIdentificationHash(bank, i),
+		})
+	}
+	return resp, nil
+}
+
+func (p *MockBankingProvider) GetSession(ctx context.Context, sessionID string) (*SessionDetails, error) {
+	bank, ok := parseMockSession(sessionID)
+	if !ok {
+		return nil, fmt.Errorf("mock provider: unknown session")
+	}
+
+	details := &SessionDetails{
+		Status: "AUTHORIZED",
+		Access: Access{ValidUntil: p.now().Add(DefaultConsentValidity).Format(time.RFC3339)},
+	}
+	if bank == mockExpiredInstitution {
+		details.Status = "EXPIRED"
+		details.Access.ValidUntil = p.now().Add(-24 * time.Hour).Format(time.RFC3339)
+	}
+	for i := range mockAccountTemplates {
+		details.AccountsData = append(details.AccountsData, SessionAccount{
+			UID:                fmt.Sprintf("%s-acc-%d", sessionID, i),
+			IdentificationHash: mockIdentificationHash(bank, i),
+		})
+	}
+	return details, nil
+}
+
+func (p *MockBankingProvider) GetBalances(ctx context.Context, sessionID, accountUID string) ([]Balance, error) {
+	_, account, ok := parseMockAccount(accountUID)
+	if !ok {
+		return nil, fmt.Errorf("mock provider: unknown account")
+	}
+	return []Balance{{
+		Name:          "Solde",
+		BalanceAmount: AmountType{Currency: "EUR", Amount: mockAccountTemplates[account].Balance},
+		BalanceType:   "CLBD",
+		ReferenceDate: p.now().Format(transactionDateLayout),
+	}}, nil
+}
+
+func (p *MockBankingProvider) GetTransactions(ctx context.Context, accountUID string, dateFrom, dateTo string) ([]Transaction, error) {
+	bank, account, ok := parseMockAccount(accountUID)
+	if !ok {
+		return nil, fmt.Errorf("mock provider: unknown account")
+	}
+
+	today := p.now().Truncate(24 * time.Hour)
+	from, err := time.Parse(transactionDateLayout, dateFrom)
+	if err != nil {
+		from = today.Add(-transactionInitialHistory)
+	}
+	to, err := time.Parse(transactionDateLayout, dateTo)
+	if err != nil || to.After(today) {
+		to = today
+	}
+
+	var txs []Transaction
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		for _, e := range mockDailyEntries(account, d) {
+			date := d.Format(transactionDateLayout)
+			status := "BOOK"
+			if d.Equal(today) {
+				status = "PDNG"
+			}
+			txs = append(txs, Transaction{
+				TransactionID:         fmt.Sprintf("mock-%d-%d-%s-%s", bank, account, date, e.kind),
+				TransactionAmount:     AmountType{Currency: "EUR", Amount: e.amount},
+				CreditDebitIndicator:  e.creditDebit,
+				Status:                status,
+				BookingDate:           date,
+				ValueDate:             date,
+				RemittanceInformation: []string{e.label},
+			})
+		}
+	}
+	return txs, nil
+}
+
+func (p *MockBankingProvider) DeleteSession(ctx context.Context, sessionID string) error {
+	return nil
+}
+
+type mockEntry struct {
+	kind, label, amount, creditDebit string
+}
+
+// mockDailyEntries est l'échéancier d'un compte pour un jour donné.
+func mockDailyEntries(account int, d time.Time) []mockEntry {
+	var entries []mockEntry
+	month := strings.ToUpper(labelAccents.Replace(strings.ToLower(frMonthsCanonical[d.Month()-1])))
+
+	switch account {
+	case 0: // Compte courant
+		switch d.Day() {
+		case 5:
+			entries = append(entries, mockEntry{"rent", "VIR SEPA LOYER " + month, "850.00", "DBIT"})
+		case 8:
+			entries = append(entries, mockEntry{"energy", "PRLV SEPA EDF CLIENTS PARTICULIERS", "64.90", "DBIT"})
+		case 12:
+			entries = append(entries, mockEntry{"streaming", "PRLV NETFLIX.COM", "13.49", "DBIT"})
+		case 15:
+			if d.Month()%3 == 1 {
+				entries = append(entries, mockEntry{"water", "PRLV SEPA VEOLIA EAU", "96.00", "DBIT"})
+			}
+		case 28:
+			entries = append(entries, mockEntry{"salary", "VIR SALAIRE ACME", "2450.00", "CRDT"})
+		}
+		if d.Weekday() == time.Saturday {
+			// Montant variable mais stable pour une date donnée
+			cents, _ := strconv.ParseInt(mockHash("groceries", d.Format(transactionDateLayout))[:4], 16, 64)
+			amount := 40 + float64(cents%8000)/100
+			entries = append(entries, mockEntry{"groceries", "CB CARREFOUR MARKET", strconv.FormatFloat(amount, 'f', 2, 64), "DBIT"})
+		}
+	case 1: // Livret
+		if d.Day() == 1 {
+			entries = append(entries, mockEntry{"savings", "VIR EPARGNE MENSUELLE", "200.00", "CRDT"})
+		}
+	}
+	return entries
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func mockAuthorize(t *testing.T, p *MockBankingProvider, bank, state string) *SessionResponse {
+	t.Helper()
+	ctx := context.Background()
+
+	auth, err := p.CreateAuthRequest(ctx, AuthRequest{
+		ASPSP:       ASPSPIdentifier{Name: bank, Country: "FR"},
+		State:       state,
+		RedirectURL: "http://localhost:3000/beta2/callback",
+	})
+	if err != nil {
+		t.Fatalf("CreateAuthRequest: %v", err)
+	}
+
+	// L'utilisateur suit l'URL et revient sur le callback
+	redirect, err := url.Parse(auth.URL)
+	if err != nil {
+		t.Fatalf("invalid auth URL %q: %v", auth.URL, err)
+	}
+	if redirect.Path != "/beta2/callback" || redirect.Query().Get("state") != state {
+		t.Fatalf("auth URL = %q", auth.URL)
+	}
+
+	session, err := p.CreateSession(ctx, redirect.Query().Get("code"), redirect.Query().Get("state"))
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	return session
+}
+
+func TestMockProviderConnectAndSync(t *testing.T) {
+	now := time.Date(2026, 6, 20, 10, 0, 0, 0, time.UTC)
+	p := &MockBankingProvider{Now: func() time.Time { return now }}
+	ctx := context.Background()
+
+	banks, err := p.GetASPSPs(ctx, "fr")
+	if err != nil || len(banks) != len(mockInstitutions) || banks[0].Country != "FR" {
+		t.Fatalf("GetASPSPs = %+v, %v", banks, err)
+	}
+
+	session := mockAuthorize(t, p, "Mock Bank", "budget-1|state-1")
+	if session.ASPSP.Name != "Mock Bank" || len(session.Accounts) != 2 {
+		t.Fatalf("session = %+v", session)
+	}
+	if validUntil, ok := ParseConsentValidUntil(session.Access.ValidUntil); !ok || !validUntil.Equal(now.Add(DefaultConsentValidity)) {
+		t.Errorf("valid_until = %q", session.Access.ValidUntil)
+	}
+
+	details, err := p.GetSession(ctx, session.SessionID)
+	if err != nil || consentStatusFromSession(details.Status) != "" || len(details.AccountsData) != 2 {
+		t.Fatalf("GetSession = %+v, %v", details, err)
+	}
+	if details.AccountsData[0].UID != session.Accounts[0].UID {
+		t.Errorf("session accounts do not match: %+v", details.AccountsData)
+	}
+
+	checking := session.Accounts[0].UID
+	balances, err := p.GetBalances(ctx, session.SessionID, checking)
+	if err != nil || len(balances) != 1 || balances[0].BalanceAmount.Amount != "1523.45" {
+		t.Fatalf("GetBalances = %+v, %v", balances, err)
+	}
+
+	txs, err := p.GetTransactions(ctx, checking, "2026-01-01", "2026-12-31")
+	if err != nil {
+		t.Fatalf("GetTransactions: %v", err)
+	}
+
+	var history []historyTx
+	seen := map[string]bool{}
+	for _, tx := range txs {
+		lt, err := normalizeTransaction(tx)
+		if err != nil {
+			t.Fatalf("normalizeTransaction(%+v): %v", tx, err)
+		}
+		if seen[lt.ProviderID] {
+			t.Fatalf("duplicate transaction id %s", lt.ProviderID)
+		}
+		seen[lt.ProviderID] = true
+		if lt.BookingDate > "2026-06-20" {
+			t.Fatalf("transaction in the future: %+v", lt)
+		}
+		if (lt.CreditDebit == "DBIT") != (lt.Amount < 0) {
+			t.Fatalf("amount sign does not follow credit_debit: %+v", lt)
+		}
+		date, _ := time.Parse(transactionDateLayout, lt.BookingDate)
+		history = append(history, historyTx{ID: lt.ProviderID, Date: date, Amount: lt.Amount, Description: lt.Description})
+	}
+	if last := txs[len(txs)-1]; last.BookingDate != "2026-06-20" || last.Status != "PDNG" {
+		t.Errorf("today's transaction should be pending, got %+v", last)
+	}
+
+	// L'historique généré contient les charges récurrentes attendues
+	found := map[string]string{}
+	for _, c := range detectRecurring(history, now) {
+		found[c.Merchant] = c.Frequency.Name
+	}
+	for merchant, freq := range map[string]string{
+		"loyer":                    FrequencyMonthly,
+		"edf clients particuliers": FrequencyMonthly,
+		"netflix com":              FrequencyMonthly,
+		"veolia eau":               FrequencyQuarterly,
+	} {
+		if found[merchant] != freq {
+			t.Errorf("recurring %q = %q, want %q (found %v)", merchant, found[merchant], freq, found)
+		}
+	}
+}
+
+func TestMockProviderReconnectKeepsIdentity(t *testing.T) {
+	p := &MockBankingProvider{Now: func() time.Time { return time.Date(2026, 6, 20, 0, 0, 0, 0, time.UTC) }}
+	ctx := context.Background()
+
+	first := mockAuthorize(t, p, "Mock Bank", "budget-1|a")
+	second := mockAuthorize(t, p, "Mock Bank", "budget-1|b")
+
+	if first.SessionID == second.SessionID || first.Accounts[0].UID == second.Accounts[0].UID {
+		t.Fatal("each session gets new session and account ids")
+	}
+	if first.Accounts[0].IdentificationHash != second.Accounts[0].IdentificationHash {
+		t.Fatal("identification hash must survive a reconnection")
+	}
+
+	a, _ := p.GetTransactions(ctx, first.Accounts[0].UID, "2026-05-01", "2026-05-31")
+	b, _ := p.GetTransactions(ctx, second.Accounts[0].UID, "2026-05-01", "2026-05-31")
+	if len(a) == 0 || len(a) != len(b) || a[0].TransactionID != b[0].TransactionID {
+		t.Fatal("transaction ids must not depend on the session")
+	}
+
+	other := mockAuthorize(t, p, "Mock Savings Bank", "budget-1|c")
+	if other.Accounts[0].IdentificationHash == first.Accounts[0].IdentificationHash {
+		t.Fatal("accounts of different banks must not share an identity")
+	}
+}
+
+func TestMockProviderExpiredAndErrors(t *testing.T) {
+	p := NewMockBankingProvider()
+	ctx := context.Background()
+
+	session := mockAuthorize(t, p, "mock expired bank", "budget-1|x")
+	details, err := p.GetSession(ctx, session.SessionID)
+	if err != nil || consentStatusFromSession(details.Status) != ConnectionExpired {
+		t.Fatalf("expired bank session = %+v, %v", details, err)
+	}
+
+	if _, err := p.CreateAuthRequest(ctx, AuthRequest{ASPSP: ASPSPIdentifier{Name: "BNP Paribas"}, RedirectURL: "http://x"}); err == nil {
+		t.Error("unknown institution should fail")
+	}
+	if _, err := p.CreateSession(ctx, "not-a-code", "state"); err == nil {
+		t.Error("invalid code should fail")
+	}
+	if _, err := p.GetTransactions(ctx, "mock-0-abc", "", ""); err == nil {
+		t.Error("unknown account should fail")
+	}
+}
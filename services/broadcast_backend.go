@@ -0,0 +1,268 @@
+// services/broadcast_backend.go
+// ============================================================================
+// BROADCAST BACKENDS — fan-out WebSocket entre instances de l'API
+// ============================================================================
+// WSHandler garde ses sessions dans une map locale au process. Avec plusieurs
+// instances (Render scale > 1), une sauvegarde traitée par l'instance A doit
+// aussi atteindre les membres connectés à l'instance B.
+//
+// WSHandler (qui implémente Broadcaster) délivre toujours en local, puis
+// publie le message sur un BroadcastBackend ; chaque instance relaie vers ses
+// propres sessions les messages venant des AUTRES instances.
+//
+//   BROADCAST_BACKEND=local    (défaut) : pas de backend, un seul process
+//   BROADCAST_BACKEND=postgres          : LISTEN/NOTIFY sur DATABASE_URL
+//
+// NOTIFY est limité à 8000 octets : au-delà (suggestions_ready, gros patchs),
+// le message est chiffré dans broadcast_outbox et seul son id circule.
+// Les messages émis pendant une reconnexion du listener sont perdus ; les
+// clients se resynchronisent via GET /data et l'ETag.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// Types de messages relayés entre instances
+const (
+	BroadcastKindJSON             = "json"              // payload brut vers les sessions d'un budget
+	BroadcastKindDisconnectUser   = "disconnect_user"   // révocation de toutes les sessions d'un user
+	BroadcastKindDisconnectMember = "disconnect_member" // membre retiré d'un budget
+	BroadcastKindPresence         = "presence"          // instantané de présence d'une instance, pas pour les clients
+)
+
+// BroadcastMessage est l'unité échangée entre instances. Pour BroadcastKindJSON,
+// ExcludeUserID / OnlyUserID filtrent les destinataires du budget.
+type BroadcastMessage struct {
+	Origin        string          `json:"origin,omitempty"`
+	Kind          string          `json:"kind"`
+	BudgetID      string          `json:"budget_id,omitempty"`
+	UserID        string          `json:"user_id,omitempty"`
+	ExcludeUserID string          `json:"exclude_user_id,omitempty"`
+	OnlyUserID    string          `json:"only_user_id,omitempty"`
+	EventID       string          `json:"event_id,omitempty"` // non vide = rejouable (BudgetEvent.ID)
+	Payload       json.RawMessage `json:"payload,omitempty"`
+
+	// Ref pointe vers broadcast_outbox quand le message dépasse la limite NOTIFY
+	Ref int64 `json:"ref,omitempty"`
+}
+
+// BroadcastBackend transporte les messages vers les autres instances.
+// Start ne doit livrer que les messages publiés par une autre instance.
+type BroadcastBackend interface {
+	Publish(ctx context.Context, msg BroadcastMessage) error
+	Start(deliver func(BroadcastMessage)) error
+	Close() error
+}
+
+// NewBroadcastBackendFromEnv retourne le backend choisi par BROADCAST_BACKEND,
+// ou nil pour le mode mono-instance historique.
+func NewBroadcastBackendFromEnv(db *sql.DB) BroadcastBackend {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("BROADCAST_BACKEND"))) {
+	case "postgres", "pg":
+		return NewPostgresBroadcastBackend(db, os.Getenv("DATABASE_URL"))
+	case "", "local":
+		return nil
+	default:
+		utils.SafeWarn("Unknown BROADCAST_BACKEND %q, falling back to local", os.Getenv("BROADCAST_BACKEND"))
+		return nil
+	}
+}
+
+// ============================================================================
+// POSTGRES LISTEN/NOTIFY
+// ============================================================================
+
+const (
+	broadcastChannel = "budget_ws_broadcast"
+	// Marge sous la limite de 8000 octets de NOTIFY
+	maxNotifyPayload = 7500
+)
+
+// PostgresBroadcastBackend relaie les messages via pg_notify. Chaque process
+// a un instanceID aléatoire pour ignorer ses propres notifications.
+type PostgresBroadcastBackend struct {
+	db         *sql.DB
+	dsn        string
+	instanceID string
+	listener   *pq.Listener
+	done       chan struct{}
+}
+
+func NewPostgresBroadcastBackend(db *sql.DB, dsn string) *PostgresBroadcastBackend {
+	return &PostgresBroadcastBackend{
+		db:         db,
+		dsn:        dsn,
+		instanceID: uuid.New().String(),
+		done:       make(chan struct{}),
+	}
+}
+
+// Publish envoie le message aux autres instances.
+func (b *PostgresBroadcastBackend) Publish(ctx context.Context, msg BroadcastMessage) error {
+	msg.Origin = b.instanceID
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if len(raw) > maxNotifyPayload {
+		raw, err = b.storeInOutbox(ctx, raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, broadcastChannel, string(raw)); err != nil {
+		return fmt.Errorf("pg_notify: %w", err)
+	}
+	return nil
+}
+
+// storeInOutbox chiffre le message complet (il peut contenir des données
+// budget) et renvoie la notification de remplacement qui ne porte que l'id.
+func (b *PostgresBroadcastBackend) storeInOutbox(ctx context.Context, raw []byte) ([]byte, error) {
+	encrypted, err := utils.Encrypt(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int64
+	err = b.db.QueryRowContext(ctx, `
+		INSERT INTO broadcast_outbox (payload) VALUES ($1) RETURNING id
+	`, encrypted).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("store broadcast outbox: %w", err)
+	}
+
+	return json.Marshal(BroadcastMessage{Origin: b.instanceID, Ref: id})
+}
+
+func (b *PostgresBroadcastBackend) loadFromOutbox(ctx context.Context, id int64) (BroadcastMessage, error) {
+	var msg BroadcastMessage
+	var encrypted string
+	err := b.db.QueryRowContext(ctx, `SELECT payload FROM broadcast_outbox WHERE id = $1`, id).Scan(&encrypted)
+	if err != nil {
+		return msg, err
+	}
+	raw, err := utils.Decrypt(encrypted)
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(raw, &msg)
+	return msg, err
+}
+
+// Start ouvre le LISTEN et livre les messages des autres instances. La
+// connexion du listener est dédiée (hors pool) et se reconnecte seule.
+func (b *PostgresBroadcastBackend) Start(deliver func(BroadcastMessage)) error {
+	if b.dsn == "" {
+		return fmt.Errorf("DATABASE_URL not set")
+	}
+
+	b.listener = pq.NewListener(b.dsn, time.Second, 30*time.Second, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			utils.SafeWarn("Broadcast listener disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			utils.SafeInfo("Broadcast listener reconnected")
+		case pq.ListenerEventConnectionAttemptFailed:
+			utils.SafeWarn("Broadcast listener connection attempt failed: %v", err)
+		}
+	})
+
+	// Listen bloque jusqu'à la première connexion : ne pas retarder le boot
+	go func() {
+		if err := b.listener.Listen(broadcastChannel); err != nil {
+			utils.SafeError("Broadcast listener LISTEN failed: %v", err)
+			return
+		}
+		utils.SafeInfo("Broadcast backend: listening on %s (instance %s)", broadcastChannel, b.instanceID)
+	}()
+
+	go b.loop(deliver)
+	return nil
+}
+
+func (b *PostgresBroadcastBackend) loop(deliver func(BroadcastMessage)) {
+	for {
+		select {
+		case <-b.done:
+			return
+
+		case n := <-b.listener.NotificationChannel():
+			// nil = reconnexion, les notifications intermédiaires sont perdues
+			if n == nil {
+				continue
+			}
+			if msg, ok := b.receive(n.Extra); ok {
+				deliver(msg)
+			}
+
+		case <-time.After(90 * time.Second):
+			// Détecte une connexion morte sans trafic
+			go b.listener.Ping()
+		}
+	}
+}
+
+// receive décode une notification ; false pour les messages de cette
+// instance et les notifications illisibles.
+func (b *PostgresBroadcastBackend) receive(extra string) (BroadcastMessage, bool) {
+	var msg BroadcastMessage
+	if err := json.Unmarshal([]byte(extra), &msg); err != nil {
+		utils.SafeWarn("Invalid broadcast notification: %v", err)
+		return msg, false
+	}
+	if msg.Origin == b.instanceID {
+		return msg, false
+	}
+	if msg.Ref > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		full, err := b.loadFromOutbox(ctx, msg.Ref)
+		if err != nil {
+			utils.SafeWarn("Failed to load broadcast outbox %d: %v", msg.Ref, err)
+			return msg, false
+		}
+		msg = full
+	}
+	return msg, true
+}
+
+func (b *PostgresBroadcastBackend) Close() error {
+	select {
+	case <-b.done:
+		return nil
+	default:
+		close(b.done)
+	}
+	if b.listener != nil {
+		return b.listener.Close()
+	}
+	return nil
+}
+
+// PruneBroadcastOutbox supprime les messages volumineux déjà relayés.
+func PruneBroadcastOutbox(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM broadcast_outbox WHERE created_at < NOW() - INTERVAL '1 hour'
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
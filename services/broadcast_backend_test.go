@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// notifyArg garde le payload passé à pg_notify.
+type notifyArg struct{ payload string }
+
+func (a *notifyArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	a.payload = s
+	return ok
+}
+
+func newBroadcastMock(t *testing.T) (*PostgresBroadcastBackend, *PostgresBroadcastBackend, sqlmock.Sqlmock) {
+	t.Helper()
+	t.Setenv("DATA_ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// Deux instances sur la même base
+	return NewPostgresBroadcastBackend(db, ""), NewPostgresBroadcastBackend(db, ""), mock
+}
+
+func TestBroadcastRelaySmallMessage(t *testing.T) {
+	a, b, mock := newBroadcastMock(t)
+	notified := &notifyArg{}
+	mock.ExpectExec(`SELECT pg_notify`).WithArgs(broadcastChannel, notified).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	msg := BroadcastMessage{Kind: BroadcastKindJSON, BudgetID: "b1", ExcludeUserID: "u1", Payload: json.RawMessage(`{"type":"budget_updated"}`)}
+	if err := a.Publish(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// L'instance émettrice ignore sa propre notification, l'autre la relaie
+	if _, ok := a.receive(notified.payload); ok {
+		t.Error("an instance must not deliver its own notifications")
+	}
+	got, ok := b.receive(notified.payload)
+	if !ok || got.Origin != a.instanceID || got.BudgetID != "b1" || got.ExcludeUserID != "u1" ||
+		string(got.Payload) != `{"type":"budget_updated"}` {
+		t.Errorf("relayed = %+v, %v", got, ok)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBroadcastRelayThroughOutbox(t *testing.T) {
+	a, b, mock := newBroadcastMock(t)
+	stored := &notifyArg{}
+	notified := &notifyArg{}
+	mock.ExpectQuery(`INSERT INTO broadcast_outbox`).WithArgs(stored).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectExec(`SELECT pg_notify`).WithArgs(broadcastChannel, notified).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Au-delà de la limite NOTIFY : seul l'id circule, le message est chiffré
+	big := `{"type":"suggestions_ready","data":"` + strings.Repeat("x", maxNotifyPayload) + `"}`
+	msg := BroadcastMessage{Kind: BroadcastKindJSON, BudgetID: "b1", Payload: json.RawMessage(big)}
+	if err := a.Publish(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(notified.payload) > maxNotifyPayload || strings.Contains(notified.payload, "suggestions_ready") {
+		t.Fatalf("notification carries the message: %d bytes", len(notified.payload))
+	}
+	if strings.Contains(stored.payload, "suggestions_ready") {
+		t.Fatal("outbox payload is not encrypted")
+	}
+
+	mock.ExpectQuery(`SELECT payload FROM broadcast_outbox WHERE id = \$1`).WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"payload"}).AddRow(stored.payload))
+	got, ok := b.receive(notified.payload)
+	if !ok || got.Origin != a.instanceID || got.BudgetID != "b1" || string(got.Payload) != big {
+		t.Errorf("relayed message differs (ok=%v, budget=%q, %d bytes)", ok, got.BudgetID, len(got.Payload))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 type Broadcaster interface {
 	BroadcastUpdate(budgetID string, updateType string, userWhoUpdated string)
 	BroadcastUpdateExcludingUser(budgetID string, updateType string, userWhoUpdated string, userIDToExclude string)
+	PublishEvent(event BudgetEvent, excludeUserID string)
 }
 
 type BudgetService struct {
@@ -40,6 +42,14 @@ func (s *BudgetService) GetDB() *sql.DB {
 	return s.db
 }
 
+// ErrVersionConflict is returned by UpdateDataIfVersion when the caller's
+// expected version is no longer the stored head (someone saved in between).
+var ErrVersionConflict = errors.New("budget data version conflict")
+
+// ErrInvalidPatch wraps any JSON Patch that cannot be applied to the current
+// document (missing path, failed test op, ...).
+var ErrInvalidPatch = errors.New("invalid budget data patch")
+
 // Helper struct for DB storage of encrypted blobs
 type EncryptedData struct {
 	Encrypted string `json:"encrypted"`
@@ -219,30 +229,59 @@ func (s *BudgetService) BumpLastViewed(ctx context.Context, budgetID string) err
 
 // Delete deletes a budget completely
 func (s *BudgetService) Delete(ctx context.Context, budgetID string) error {
-	return utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+	err := utils.WithTransaction(s.db, func(tx *sql.Tx) error {
 		// Delete related records first
 		if _, err := tx.ExecContext(ctx, "DELETE FROM budget_members WHERE budget_id = $1", budgetID); err != nil { return err }
 		if _, err := tx.ExecContext(ctx, "DELETE FROM invitations WHERE budget_id = $1", budgetID); err != nil { return err }
 		if _, err := tx.ExecContext(ctx, "DELETE FROM budget_data WHERE budget_id = $1", budgetID); err != nil { return err }
+		if _, err := tx.ExecContext(ctx, "DELETE FROM budget_data_revisions WHERE budget_id = $1", budgetID); err != nil { return err }
 		// Delete budget
 		if _, err := tx.ExecContext(ctx, "DELETE FROM budgets WHERE id = $1", budgetID); err != nil { return err }
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	// Destroy the data key once the delete is committed: it may live in the
+	// separate key store, outside this transaction
+	if err := shredBudgetKey(ctx, s.db, budgetID); err != nil {
+		utils.SafeWarn("⚠️  Budget %s deleted but its data key was not: %v (left to the orphan key prune)", budgetID, err)
+	}
+	return nil
 }
 
 // GetData gets the data for a budget and DECRYPTS it
 func (s *BudgetService) GetData(ctx context.Context, budgetID string) (interface{}, error) {
-	query := `SELECT data FROM budget_data WHERE budget_id = $1 ORDER BY updated_at DESC LIMIT 1`
+	data, _, err := s.GetDataWithVersion(ctx, budgetID)
+	return data, err
+}
+
+// GetDataWithVersion is GetData plus the current budget_data.version (0 when
+// the budget has never been saved). Clients echo this version back through
+// If-Match so concurrent saves from two household members can be detected.
+func (s *BudgetService) GetDataWithVersion(ctx context.Context, budgetID string) (interface{}, int, error) {
+	query := `SELECT data, COALESCE(version, 1) FROM budget_data WHERE budget_id = $1 ORDER BY updated_at DESC LIMIT 1`
 
 	var rawJSON []byte
-	err := s.db.QueryRowContext(ctx, query, budgetID).Scan(&rawJSON)
+	var version int
+	err := s.db.QueryRowContext(ctx, query, budgetID).Scan(&rawJSON, &version)
 	if err == sql.ErrNoRows {
-		return map[string]interface{}{}, nil
+		return map[string]interface{}{}, 0, nil
 	}
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
+	data, err := decodeStoredData(ctx, s.db, budgetID, rawJSON)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, version, nil
+}
+
+// decodeStoredData turns a budget_data.data JSONB value back into the
+// decrypted document (see budget_keys.go for the keys).
+func decodeStoredData(ctx context.Context, q sqlQueryer, budgetID string, rawJSON []byte) (interface{}, error) {
 	if len(rawJSON) == 0 {
 		return map[string]interface{}{}, nil
 	}
@@ -251,11 +290,11 @@ func (s *BudgetService) GetData(ctx context.Context, budgetID string) (interface
 	var wrapper EncryptedData
 	if err := json.Unmarshal(rawJSON, &wrapper); err == nil && wrapper.Encrypted != "" {
 		// 2. It IS encrypted -> Decrypt it
-		decryptedBytes, err := utils.Decrypt(wrapper.Encrypted)
+		decryptedBytes, err := decryptBudgetData(ctx, q, budgetID, wrapper.Encrypted)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decrypt data: %w", err)
 		}
-		
+
 		// 3. Unmarshal the real data
 		var realData interface{}
 		if err := json.Unmarshal(decryptedBytes, &realData); err != nil {
@@ -273,63 +312,134 @@ func (s *BudgetService) GetData(ctx context.Context, budgetID string) (interface
 	return data, nil
 }
 
-// UpdateData ENCRYPTS the data before saving it
-// 🔥 UPDATED: Now accepts userID and userName to exclude the user from notifications
-func (s *BudgetService) UpdateData(ctx context.Context, budgetID string, data interface{}, userID string, userName string) error {
+// encodeForStorage ENCRYPTS the document with the budget's data key and wraps
+// it so the JSONB column accepts it.
+func encodeForStorage(ctx context.Context, q sqlQueryer, budgetID string, data interface{}) ([]byte, error) {
 	// 1. Convert real data to JSON bytes
 	realDataJSON, err := json.Marshal(data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 2. Encrypt the bytes
-	encryptedString, err := utils.Encrypt(realDataJSON)
+	encryptedString, err := encryptBudgetData(ctx, q, budgetID, realDataJSON)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 3. Wrap in a JSON object so Postgres JSONB column accepts it
-	wrapper := EncryptedData{Encrypted: encryptedString}
-	storageJSON, err := json.Marshal(wrapper)
-	if err != nil {
-		return err
+	return json.Marshal(EncryptedData{Encrypted: encryptedString})
+}
+
+// lockHead locks the budget row, then the current budget_data row, and
+// returns its id, version and raw stored value. A budget that was never saved
+// yields an empty id and version 0.
+//
+// The budget row is what serializes writers: a head that does not exist yet
+// cannot be locked, so two concurrent first saves would both INSERT.
+// FOR NO KEY UPDATE still lets other tables reference the budget meanwhile.
+func lockHead(ctx context.Context, tx *sql.Tx, budgetID string) (string, int, []byte, error) {
+	if _, err := tx.ExecContext(ctx, `
+		SELECT 1 FROM budgets WHERE id = $1 FOR NO KEY UPDATE
+	`, budgetID); err != nil {
+		return "", 0, nil, err
 	}
 
-	// 4. Save to DB
 	var existingID string
-	checkQuery := `SELECT id FROM budget_data WHERE budget_id = $1 LIMIT 1`
-	err = s.db.QueryRowContext(ctx, checkQuery, budgetID).Scan(&existingID)
-
+	var currentVersion int
+	var rawJSON []byte
+	checkQuery := `
+		SELECT id, COALESCE(version, 1), data FROM budget_data
+		WHERE budget_id = $1
+		ORDER BY updated_at DESC
+		LIMIT 1
+		FOR UPDATE
+	`
+	err := tx.QueryRowContext(ctx, checkQuery, budgetID).Scan(&existingID, &currentVersion, &rawJSON)
 	if err == sql.ErrNoRows {
+		return "", 0, nil, nil
+	}
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return existingID, currentVersion, rawJSON, nil
+}
+
+// writeHead stores storageJSON as version currentVersion+1 (insert when
+// existingID is empty) and appends it to the revision history.
+func writeHead(ctx context.Context, tx *sql.Tx, budgetID, existingID string, currentVersion int, storageJSON []byte, userID string) (int, error) {
+	if existingID == "" {
+		newID := uuid.New().String()
 		insertQuery := `
-			INSERT INTO budget_data (id, budget_id, data, version, updated_at)
-			VALUES ($1, $2, $3, 1, $4)
+			INSERT INTO budget_data (id, budget_id, data, version, updated_by, updated_at)
+			VALUES ($1, $2, $3, 1, NULLIF($4, '')::uuid, $5)
 		`
-		_, err = s.db.ExecContext(ctx, insertQuery, uuid.New().String(), budgetID, storageJSON, time.Now())
-		if err != nil {
-			return err
+		if _, err := tx.ExecContext(ctx, insertQuery, newID, budgetID, storageJSON, userID, time.Now()); err != nil {
+			return 0, err
 		}
-	} else if err != nil {
-		return err
-	} else {
-		updateQuery := `
-			UPDATE budget_data
-			SET data = $1, version = version + 1, updated_at = $2
-			WHERE budget_id = $3
-		`
-		_, err = s.db.ExecContext(ctx, updateQuery, storageJSON, time.Now(), budgetID)
+		return 1, recordRevision(ctx, tx, newID)
+	}
+
+	// Heads saved before revisions existed have no history row yet:
+	// snapshot them before overwriting so the first save is undoable too.
+	if err := recordRevision(ctx, tx, existingID); err != nil {
+		return 0, err
+	}
+
+	updateQuery := `
+		UPDATE budget_data
+		SET data = $1, version = $2, updated_by = NULLIF($3, '')::uuid, updated_at = $4
+		WHERE budget_id = $5
+	`
+	newVersion := currentVersion + 1
+	if _, err := tx.ExecContext(ctx, updateQuery, storageJSON, newVersion, userID, time.Now(), budgetID); err != nil {
+		return 0, err
+	}
+	return newVersion, recordRevision(ctx, tx, existingID)
+}
+
+// UpdateData ENCRYPTS the data before saving it
+// 🔥 UPDATED: Now accepts userID and userName to exclude the user from notifications
+func (s *BudgetService) UpdateData(ctx context.Context, budgetID string, data interface{}, userID string, userName string) error {
+	_, err := s.UpdateDataIfVersion(ctx, budgetID, data, 0, userID, userName)
+	return err
+}
+
+// UpdateDataIfVersion saves the document only if the stored version still
+// equals expectedVersion, and returns the new version. expectedVersion = 0
+// disables the check (legacy last-writer-wins). The budget and head rows are
+// locked (see lockHead) so the compare-and-swap is atomic across API
+// instances, first save included.
+func (s *BudgetService) UpdateDataIfVersion(ctx context.Context, budgetID string, data interface{}, expectedVersion int, userID string, userName string) (int, error) {
+	storageJSON, err := encodeForStorage(ctx, s.db, budgetID, data)
+	if err != nil {
+		return 0, err
+	}
+
+	var newVersion int
+	err = utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		existingID, currentVersion, _, err := lockHead(ctx, tx, budgetID)
 		if err != nil {
 			return err
 		}
+		if expectedVersion > 0 && expectedVersion != currentVersion {
+			return ErrVersionConflict
+		}
+		newVersion, err = writeHead(ctx, tx, budgetID, existingID, currentVersion, storageJSON, userID)
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	// 5. 🔥 TRIGGER NOTIFICATION VIA WEBSOCKET - EXCLUDING THE USER WHO MADE THE UPDATE
-	if s.ws != nil {
-		// We fire this asynchronously so it doesn't block the HTTP response
-		go s.ws.BroadcastUpdateExcludingUser(budgetID, "budget_updated", userName, userID) 
-	}
+	// 🔥 TRIGGER NOTIFICATION VIA WEBSOCKET - EXCLUDING THE USER WHO MADE THE UPDATE
+	// We fire this asynchronously so it doesn't block the HTTP response
+	go s.PublishEvent(NewBudgetEvent(budgetID, EventBudgetUpdated,
+		&EventActor{ID: userID, Name: userName},
+		map[string]interface{}{"version": newVersion},
+	), userID)
 
-	// 6. 🗑️ INVALIDATE MARKET SUGGESTIONS CACHE - COMMENTED OUT TO FIX CACHE ISSUE
+	// 🗑️ INVALIDATE MARKET SUGGESTIONS CACHE - COMMENTED OUT TO FIX CACHE ISSUE
 	// if s.marketAnalyzer != nil {
 	// 	// Récupérer le pays de l'utilisateur
 	// 	var country string
@@ -349,15 +459,66 @@ func (s *BudgetService) UpdateData(ctx context.Context, budgetID string, data in
 	// 	}()
 	// }
 
-	return nil
+	return newVersion, nil
+}
+
+// PatchData applies an RFC 6902 JSON Patch to the stored document under the
+// same row lock as UpdateDataIfVersion, so concurrent patches touching
+// different parts of the budget no longer overwrite each other. Other members
+// receive the patch itself ("budget_patched") instead of a refetch signal.
+func (s *BudgetService) PatchData(ctx context.Context, budgetID string, ops []utils.PatchOperation, expectedVersion int, userID string, userName string) (int, error) {
+	var baseVersion, newVersion int
+	err := utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		existingID, currentVersion, rawJSON, err := lockHead(ctx, tx, budgetID)
+		if err != nil {
+			return err
+		}
+		if expectedVersion > 0 && expectedVersion != currentVersion {
+			return ErrVersionConflict
+		}
+
+		doc, err := decodeStoredData(ctx, tx, budgetID, rawJSON)
+		if err != nil {
+			return err
+		}
+		patched, err := utils.ApplyJSONPatch(doc, ops)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		storageJSON, err := encodeForStorage(ctx, tx, budgetID, patched)
+		if err != nil {
+			return err
+		}
+
+		baseVersion = currentVersion
+		newVersion, err = writeHead(ctx, tx, budgetID, existingID, currentVersion, storageJSON, userID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Clients holding base_version apply the ops locally; anyone else refetches.
+	go s.PublishEvent(NewBudgetEvent(budgetID, EventBudgetPatched,
+		&EventActor{ID: userID, Name: userName},
+		map[string]interface{}{
+			"base_version": baseVersion,
+			"version":      newVersion,
+			"patch":        ops,
+		},
+	), userID)
+
+	return newVersion, nil
 }
 
 // GetMembers gets all members of a budget (Populates Avatar)
 func (s *BudgetService) GetMembers(ctx context.Context, budgetID string) ([]models.BudgetMember, error) {
 	query := `
-		SELECT bm.id, bm.user_id, bm.role, bm.joined_at, u.name, u.email, COALESCE(u.avatar, '')
+		SELECT bm.id, bm.user_id, bm.role, bm.permissions, b.owner_id = bm.user_id,
+		       bm.joined_at, u.name, u.email, COALESCE(u.avatar, '')
 		FROM budget_members bm
 		JOIN users u ON bm.user_id = u.id
+		JOIN budgets b ON b.id = bm.budget_id
 		WHERE bm.budget_id = $1
 		ORDER BY bm.joined_at
 	`
@@ -372,11 +533,16 @@ func (s *BudgetService) GetMembers(ctx context.Context, budgetID string) ([]mode
 	for rows.Next() {
 		var member models.BudgetMember
 		var avatar string
+		var role sql.NullString
+		var storedPerms []byte
+		var isOwner bool
 
 		err := rows.Scan(
 			&member.ID,
 			&member.UserID,
-			&member.Role,
+			&role,
+			&storedPerms,
+			&isOwner,
 			&member.JoinedAt,
 			&member.UserName,
 			&member.UserEmail,
@@ -385,6 +551,12 @@ func (s *BudgetService) GetMembers(ctx context.Context, budgetID string) ([]mode
 		if err != nil {
 			return nil, err
 		}
+
+		// Même résolution que le middleware de permissions
+		access := memberAccess(role.String, isOwner, storedPerms)
+		member.BudgetID = budgetID
+		member.Role = access.Role
+		member.Permissions = access.Permissions
 		
 		member.User = &models.User{
 			ID:    member.UserID,
@@ -508,9 +680,9 @@ func (s *BudgetService) AcceptInvitation(ctx context.Context, token, userID stri
 		return sql.ErrNoRows
 	}
 
-	return utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+	var userName string
+	err = utils.WithTransaction(s.db, func(tx *sql.Tx) error {
         // 1. Get User Name for Notification
-        var userName string
         if err := tx.QueryRowContext(ctx, "SELECT name FROM users WHERE id = $1", userID).Scan(&userName); err != nil {
             return err
         }
@@ -520,7 +692,7 @@ func (s *BudgetService) AcceptInvitation(ctx context.Context, token, userID stri
 			INSERT INTO budget_members (id, budget_id, user_id, role, joined_at)
 			VALUES ($1, $2, $3, $4, $5)
 		`
-		if _, err := tx.ExecContext(ctx, memberQuery, uuid.New().String(), invitation.BudgetID, userID, "member", time.Now()); err != nil {
+		if _, err := tx.ExecContext(ctx, memberQuery, uuid.New().String(), invitation.BudgetID, userID, RoleEditor, time.Now()); err != nil {
 			return err
 		}
 
@@ -540,9 +712,16 @@ func (s *BudgetService) AcceptInvitation(ctx context.Context, token, userID stri
             return err
         }
 
-        // 5. NOTIFICATION TRIGGER 
-		// (Optional: You could trigger a WS update here if you have access to the handler, 
-		// but standard flow is usually to just let the client refresh on navigation)
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// 5. NOTIFICATION TRIGGER
+	s.PublishEvent(NewBudgetEvent(invitation.BudgetID, EventMemberJoined,
+		&EventActor{ID: userID, Name: userName},
+		map[string]interface{}{"user_id": userID},
+	), userID)
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,105 @@
+// services/budget_events.go
+// ============================================================================
+// BUDGET EVENTS — enveloppe versionnée des messages WebSocket
+// ============================================================================
+// Tout message poussé aux clients d'un budget suit la même enveloppe :
+//
+//   {"v":1, "id":"0190...", "budget_id":"...", "type":"budget_updated",
+//    "actor":{"id":"...","name":"Alice"}, "payload":{...}, "ts":"..."}
+//
+// Les événements durables portent un id (UUID v7, ordonné dans le temps) et
+// sont conservés dans le ring buffer de replay du WSHandler : un client qui se
+// reconnecte avec ?last_event_id=... reçoit ce qu'il a manqué au lieu de tout
+// recharger. Les événements éphémères (présence, édition) n'ont pas d'id et ne
+// sont jamais rejoués.
+// ============================================================================
+
+package services
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventEnvelopeVersion est incrémenté à chaque changement incompatible.
+const EventEnvelopeVersion = 1
+
+// Types d'événements durables (rejouables)
+const (
+	EventBudgetUpdated       = "budget_updated"
+	EventBudgetPatched       = "budget_patched"
+	EventMemberJoined        = "member_joined"
+	EventMemberRemoved       = "member_removed"
+	EventMemberRoleChanged   = "member_role_changed"
+	EventInvitationCreated   = "invitation_created"
+	EventInvitationCancelled = "invitation_cancelled"
+	EventBankSyncCompleted   = "bank_sync_completed"
+	EventSuggestionsReady    = "suggestions_ready"
+
+	EventOwnershipTransferRequested = "ownership_transfer_requested"
+	EventOwnershipTransferCancelled = "ownership_transfer_cancelled" // annulé par l'owner ou refusé
+	EventOwnershipTransferred       = "ownership_transferred"
+)
+
+// Types d'événements éphémères et de contrôle
+const (
+	EventPresenceJoin    = "presence_join"
+	EventPresenceLeave   = "presence_leave"
+	EventEditing         = "editing"
+	EventResyncRequired  = "resync_required"
+	EventReplayCompleted = "replay_completed"
+)
+
+// EventActor identifie le membre à l'origine d'un événement.
+type EventActor struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// BudgetEvent est l'enveloppe envoyée aux clients.
+type BudgetEvent struct {
+	V         int         `json:"v"`
+	ID        string      `json:"id,omitempty"`
+	BudgetID  string      `json:"budget_id"`
+	Type      string      `json:"type"`
+	Actor     *EventActor `json:"actor,omitempty"`
+	Payload   interface{} `json:"payload,omitempty"`
+	Timestamp time.Time   `json:"ts"`
+
+	// Deprecated: alias de Actor.Name pour les fronts antérieurs à l'enveloppe
+	// ({type, user}). À retirer quand plus aucun client ne le lit.
+	User string `json:"user,omitempty"`
+}
+
+// NewBudgetEvent crée un événement durable, rejouable à la reconnexion.
+func NewBudgetEvent(budgetID, eventType string, actor *EventActor, payload interface{}) BudgetEvent {
+	event := NewEphemeralEvent(budgetID, eventType, actor, payload)
+	event.ID = uuid.Must(uuid.NewV7()).String()
+	return event
+}
+
+// NewEphemeralEvent crée un événement sans id, jamais rejoué.
+func NewEphemeralEvent(budgetID, eventType string, actor *EventActor, payload interface{}) BudgetEvent {
+	event := BudgetEvent{
+		V:         EventEnvelopeVersion,
+		BudgetID:  budgetID,
+		Type:      eventType,
+		Actor:     actor,
+		Payload:   payload,
+		Timestamp: time.Now().UTC(),
+	}
+	if actor != nil {
+		event.User = actor.Name
+	}
+	return event
+}
+
+// PublishEvent pousse un événement aux membres connectés du budget, sauf
+// excludeUserID. No-op quand le service est câblé sans WebSocket (admin, jobs).
+func (s *BudgetService) PublishEvent(event BudgetEvent, excludeUserID string) {
+	if s.ws == nil {
+		return
+	}
+	s.ws.PublishEvent(event, excludeUserID)
+}
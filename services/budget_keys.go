@@ -0,0 +1,242 @@
+// services/budget_keys.go
+// ============================================================================
+// BUDGET DATA KEYS — chiffrement enveloppe par budget
+// ============================================================================
+// Chaque budget a sa propre clé de données (32 octets aléatoires), stockée
+// dans budget_data_keys chiffrée par la clé maître (utils.Encrypt, donc
+// rechiffrée par le job de rotation). budget_data et ses révisions sont
+// chiffrés avec cette clé : les textes portent le préfixe utils.DataKeyID
+// ("bk:...").
+//
+// Magasin de clés : avec BUDGET_KEYS_DATABASE_URL, budget_data_keys vit dans
+// une base à part, exclue des sauvegardes de la base principale
+// (UseBudgetKeyStore). Supprimer un budget y détruit sa clé : une sauvegarde
+// de la base principale, même restaurée avec la clé maître, ne contient plus
+// que des chiffrés illisibles. Les clés de la base principale y sont
+// déplacées au démarrage (MoveBudgetKeysToStore). Sans magasin séparé, la
+// table reste dans la base principale et ses sauvegardes gardent les clés des
+// budgets supprimés.
+//
+// Les budgets enregistrés avant l'enveloppe restent lisibles avec la clé
+// maître et passent sur leur clé de données à la sauvegarde suivante (ou via
+// POST /admin/maintenance/reencrypt).
+//
+// Supprimer un budget détruit sa clé (Delete). Les autres chemins (compte
+// supprimé, ON DELETE CASCADE) laissent une clé orpheline dans le magasin
+// séparé, retirée par PruneOrphanBudgetKeys (nettoyage quotidien).
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// ErrBudgetKeyNotFound : texte chiffré avec une clé de données détruite (ou
+// jamais créée).
+var ErrBudgetKeyNotFound = errors.New("budget data key not found")
+
+// sqlQueryer : *sql.DB ou *sql.Tx
+type sqlQueryer interface {
+	sqlExecer
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// budgetKeyStore : base du magasin de clés séparé, nil si budget_data_keys
+// est dans la base principale.
+var budgetKeyStore *sql.DB
+
+// UseBudgetKeyStore range les clés de données dans db (base ouverte par
+// config.InitKeyStoreDB). À appeler au démarrage, avant le routeur.
+func UseBudgetKeyStore(db *sql.DB) {
+	budgetKeyStore = db
+}
+
+// keyStoreQueryer : le magasin séparé s'il existe, sinon q (la transaction
+// de l'appelant).
+func keyStoreQueryer(q sqlQueryer) sqlQueryer {
+	if budgetKeyStore != nil {
+		return budgetKeyStore
+	}
+	return q
+}
+
+// budgetKeyring renvoie le trousseau de la clé de données du budget, créée
+// au besoin si create est vrai.
+func budgetKeyring(ctx context.Context, q sqlQueryer, budgetID string, create bool) (*utils.Keyring, error) {
+	q = keyStoreQueryer(q)
+	var wrapped string
+	err := q.QueryRowContext(ctx, `
+		SELECT wrapped_key FROM budget_data_keys WHERE budget_id = $1
+	`, budgetID).Scan(&wrapped)
+
+	if err == sql.ErrNoRows && create {
+		key, genErr := utils.GenerateDataKey()
+		if genErr != nil {
+			return nil, genErr
+		}
+		newWrapped, encErr := utils.Encrypt(key)
+		if encErr != nil {
+			return nil, encErr
+		}
+		// Deux premières sauvegardes concurrentes : la première clé gagne
+		err = q.QueryRowContext(ctx, `
+			INSERT INTO budget_data_keys (budget_id, wrapped_key)
+			VALUES ($1, $2)
+			ON CONFLICT (budget_id) DO UPDATE SET budget_id = EXCLUDED.budget_id
+			RETURNING wrapped_key
+		`, budgetID, newWrapped).Scan(&wrapped)
+	}
+	if err == sql.ErrNoRows {
+		return nil, ErrBudgetKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load budget data key: %w", err)
+	}
+
+	key, err := utils.Decrypt(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap budget data key: %w", err)
+	}
+	return utils.NewDataKeyring(key)
+}
+
+// encryptBudgetData chiffre avec la clé de données du budget.
+func encryptBudgetData(ctx context.Context, q sqlQueryer, budgetID string, plaintext []byte) (string, error) {
+	keyring, err := budgetKeyring(ctx, q, budgetID, true)
+	if err != nil {
+		return "", err
+	}
+	return keyring.Encrypt(plaintext)
+}
+
+// decryptBudgetData déchiffre un texte de budget_data : clé de données du
+// budget, ou clé maître pour les budgets pas encore migrés.
+func decryptBudgetData(ctx context.Context, q sqlQueryer, budgetID, cryptoText string) ([]byte, error) {
+	if utils.CiphertextKeyID(cryptoText) != utils.DataKeyID {
+		return utils.Decrypt(cryptoText)
+	}
+	keyring, err := budgetKeyring(ctx, q, budgetID, false)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Decrypt(cryptoText)
+}
+
+// shredBudgetKey détruit la clé de données du budget dans le magasin de clés.
+func shredBudgetKey(ctx context.Context, q sqlQueryer, budgetID string) error {
+	if _, err := keyStoreQueryer(q).ExecContext(ctx, `DELETE FROM budget_data_keys WHERE budget_id = $1`, budgetID); err != nil {
+		return fmt.Errorf("shred budget data key: %w", err)
+	}
+	return nil
+}
+
+// MoveBudgetKeysToStore déplace les clés encore dans la base principale vers
+// le magasin séparé, puis les efface de la base principale. Sans effet sans
+// magasin séparé ; idempotent. Renvoie le nombre de clés déplacées.
+func MoveBudgetKeysToStore(ctx context.Context, db *sql.DB) (int, error) {
+	if budgetKeyStore == nil {
+		return 0, nil
+	}
+	rows, err := db.QueryContext(ctx, `SELECT budget_id::text, wrapped_key FROM budget_data_keys`)
+	if err != nil {
+		return 0, err
+	}
+	type key struct{ budgetID, wrapped string }
+	var keys []key
+	for rows.Next() {
+		var k key
+		if err := rows.Scan(&k.budgetID, &k.wrapped); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, k := range keys {
+		// Clé déjà présente dans le magasin : c'est elle qui chiffre les
+		// données écrites depuis, la copie de la base principale est périmée
+		if _, err := budgetKeyStore.ExecContext(ctx, `
+			INSERT INTO budget_data_keys (budget_id, wrapped_key)
+			VALUES ($1, $2)
+			ON CONFLICT (budget_id) DO NOTHING
+		`, k.budgetID, k.wrapped); err != nil {
+			return moved, fmt.Errorf("copy budget data key: %w", err)
+		}
+		if _, err := db.ExecContext(ctx, `DELETE FROM budget_data_keys WHERE budget_id = $1`, k.budgetID); err != nil {
+			return moved, fmt.Errorf("remove copied budget data key: %w", err)
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// PruneOrphanBudgetKeys retire du magasin séparé les clés des budgets qui
+// n'existent plus (suppressions sans Delete, ou Delete dont la destruction
+// de clé a échoué). Sans magasin séparé, ON DELETE CASCADE s'en charge.
+func PruneOrphanBudgetKeys(ctx context.Context, db *sql.DB) (int, error) {
+	if budgetKeyStore == nil {
+		return 0, nil
+	}
+	// Clés d'au moins un jour : une clé créée dans la transaction (pas encore
+	// validée) qui crée le budget ne doit pas passer pour orpheline
+	rows, err := budgetKeyStore.QueryContext(ctx, `
+		SELECT budget_id::text FROM budget_data_keys
+		WHERE created_at < NOW() - INTERVAL '1 day'
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, id := range ids {
+		var exists bool
+		if err := db.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM budgets WHERE id = $1)
+		`, id).Scan(&exists); err != nil {
+			return pruned, err
+		}
+		if exists {
+			continue
+		}
+		if err := shredBudgetKey(ctx, budgetKeyStore, id); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// EncryptBudgetData chiffre un document budget_data hors BudgetService
+// (migrations admin).
+func EncryptBudgetData(ctx context.Context, db *sql.DB, budgetID string, plaintext []byte) (string, error) {
+	return encryptBudgetData(ctx, db, budgetID, plaintext)
+}
+
+// DecryptBudgetData est l'inverse d'EncryptBudgetData.
+func DecryptBudgetData(ctx context.Context, db *sql.DB, budgetID, cryptoText string) ([]byte, error) {
+	return decryptBudgetData(ctx, db, budgetID, cryptoText)
+}
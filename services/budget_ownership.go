@@ -0,0 +1,303 @@
+// services/budget_ownership.go
+// ============================================================================
+// BUDGET OWNERSHIP TRANSFER — handing a budget over to another member
+// ============================================================================
+// 1. The owner nominates an existing member (RequestOwnershipTransfer). Any
+//    previous pending request for the budget is cancelled.
+// 2. The target confirms, either in-app (AcceptOwnershipTransfer) or through
+//    the emailed link (AcceptOwnershipTransferByToken). Either way they must
+//    be logged in as the nominated member.
+// 3. budgets.owner_id and both budget_members rows are swapped in a single
+//    transaction: the new owner gets the owner role, the former owner becomes
+//    an editor. Every connected member receives "ownership_transferred".
+//
+// The owner can cancel and the target can decline while the request is
+// pending. Requests expire after ownershipTransferTTL.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+const ownershipTransferTTL = 7 * 24 * time.Hour
+
+// Statuts d'un transfert
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+	TransferExpired   = "expired"
+)
+
+var (
+	ErrTransferNotFound      = errors.New("no pending ownership transfer")
+	ErrTransferExpired       = errors.New("ownership transfer has expired")
+	ErrTransferNotForUser    = errors.New("ownership transfer is addressed to another member")
+	ErrInvalidTransferTarget = errors.New("the owner cannot transfer the budget to themselves")
+)
+
+// RequestOwnershipTransfer creates a pending transfer from the owner to
+// toUserID. The raw token is returned once, for the confirmation email.
+func (s *BudgetService) RequestOwnershipTransfer(ctx context.Context, budgetID, ownerID, toUserID string) (*models.OwnershipTransfer, string, error) {
+	actor, err := s.GetMemberAccess(ctx, budgetID, ownerID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !actor.IsOwner() {
+		return nil, "", ErrNotBudgetOwner
+	}
+	if toUserID == ownerID {
+		return nil, "", ErrInvalidTransferTarget
+	}
+	if _, err := s.GetMemberAccess(ctx, budgetID, toUserID); err != nil {
+		return nil, "", err
+	}
+
+	rawToken, err := generateRawToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	transfer := &models.OwnershipTransfer{
+		BudgetID:   budgetID,
+		FromUserID: ownerID,
+		ToUserID:   toUserID,
+		Status:     TransferPending,
+		ExpiresAt:  time.Now().Add(ownershipTransferTTL),
+	}
+
+	err = utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE budget_ownership_transfers
+			SET status = $1, resolved_at = NOW()
+			WHERE budget_id = $2 AND status = $3
+		`, TransferCancelled, budgetID, TransferPending); err != nil {
+			return err
+		}
+
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO budget_ownership_transfers (budget_id, from_user_id, to_user_id, token_hash, status, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`, budgetID, ownerID, toUserID, hashToken(rawToken), TransferPending, transfer.ExpiresAt,
+		).Scan(&transfer.ID, &transfer.CreatedAt)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.PublishEvent(NewBudgetEvent(budgetID, EventOwnershipTransferRequested,
+		&EventActor{ID: ownerID},
+		map[string]interface{}{
+			"transfer_id": transfer.ID,
+			"to_user_id":  toUserID,
+			"expires_at":  transfer.ExpiresAt,
+		},
+	), ownerID)
+
+	return transfer, rawToken, nil
+}
+
+// GetPendingOwnershipTransfer returns the pending transfer of a budget, or
+// ErrTransferNotFound.
+func (s *BudgetService) GetPendingOwnershipTransfer(ctx context.Context, budgetID string) (*models.OwnershipTransfer, error) {
+	var t models.OwnershipTransfer
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.budget_id, t.from_user_id, t.to_user_id, COALESCE(u.name, ''),
+		       t.status, t.expires_at, t.created_at
+		FROM budget_ownership_transfers t
+		LEFT JOIN users u ON u.id = t.to_user_id
+		WHERE t.budget_id = $1 AND t.status = $2 AND t.expires_at > NOW()
+	`, budgetID, TransferPending).Scan(
+		&t.ID, &t.BudgetID, &t.FromUserID, &t.ToUserID, &t.ToUserName,
+		&t.Status, &t.ExpiresAt, &t.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// WithdrawOwnershipTransfer ends the pending transfer of a budget: the owner
+// cancels it, the nominated member declines it.
+func (s *BudgetService) WithdrawOwnershipTransfer(ctx context.Context, budgetID, userID string) (string, error) {
+	pending, err := s.GetPendingOwnershipTransfer(ctx, budgetID)
+	if err != nil {
+		return "", err
+	}
+
+	var status string
+	switch userID {
+	case pending.FromUserID:
+		status = TransferCancelled
+	case pending.ToUserID:
+		status = TransferDeclined
+	default:
+		return "", ErrTransferNotForUser
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE budget_ownership_transfers
+		SET status = $1, resolved_at = NOW()
+		WHERE id = $2 AND status = $3
+	`, status, pending.ID, TransferPending)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrTransferNotFound
+	}
+
+	s.PublishEvent(NewBudgetEvent(budgetID, EventOwnershipTransferCancelled,
+		&EventActor{ID: userID},
+		map[string]interface{}{"transfer_id": pending.ID, "status": status},
+	), userID)
+	return status, nil
+}
+
+// AcceptOwnershipTransfer confirms the pending transfer of a budget in-app.
+func (s *BudgetService) AcceptOwnershipTransfer(ctx context.Context, budgetID, userID string) error {
+	pending, err := s.GetPendingOwnershipTransfer(ctx, budgetID)
+	if err != nil {
+		return err
+	}
+	_, err = s.completeOwnershipTransfer(ctx, pending.ID, userID)
+	return err
+}
+
+// AcceptOwnershipTransferByToken confirms a transfer from the emailed link and
+// returns the budget id.
+func (s *BudgetService) AcceptOwnershipTransferByToken(ctx context.Context, rawToken, userID string) (string, error) {
+	var transferID string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM budget_ownership_transfers WHERE token_hash = $1 AND status = $2
+	`, hashToken(rawToken), TransferPending).Scan(&transferID)
+	if err == sql.ErrNoRows {
+		return "", ErrTransferNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.completeOwnershipTransfer(ctx, transferID, userID)
+}
+
+// completeOwnershipTransfer swaps owner_id and member roles in one
+// transaction. The budgets row is locked so a concurrent transfer or delete
+// cannot interleave.
+func (s *BudgetService) completeOwnershipTransfer(ctx context.Context, transferID, userID string) (string, error) {
+	ownerPerms, _ := json.Marshal(RolePermissions(RoleOwner))
+	editorPerms, _ := json.Marshal(RolePermissions(RoleEditor))
+
+	var budgetID, fromUserID string
+	var staleStatus string
+	err := utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		var toUserID, status string
+		var expiresAt time.Time
+		err := tx.QueryRowContext(ctx, `
+			SELECT budget_id, from_user_id, to_user_id, status, expires_at
+			FROM budget_ownership_transfers
+			WHERE id = $1
+			FOR UPDATE
+		`, transferID).Scan(&budgetID, &fromUserID, &toUserID, &status, &expiresAt)
+		if err == sql.ErrNoRows || (err == nil && status != TransferPending) {
+			return ErrTransferNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if toUserID != userID {
+			return ErrTransferNotForUser
+		}
+		if time.Now().After(expiresAt) {
+			staleStatus = TransferExpired
+			return ErrTransferExpired
+		}
+
+		var ownerID string
+		if err := tx.QueryRowContext(ctx, `SELECT owner_id FROM budgets WHERE id = $1 FOR UPDATE`, budgetID).Scan(&ownerID); err != nil {
+			return err
+		}
+		// Le budget a changé de mains entre-temps (autre transfert)
+		if ownerID != fromUserID {
+			staleStatus = TransferCancelled
+			return ErrTransferNotFound
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			UPDATE budget_members SET role = $1, permissions = $2
+			WHERE budget_id = $3 AND user_id = $4
+		`, RoleOwner, string(ownerPerms), budgetID, userID)
+		if err != nil {
+			return err
+		}
+		// Retiré du budget depuis la demande
+		if n, _ := res.RowsAffected(); n == 0 {
+			staleStatus = TransferCancelled
+			return ErrNotBudgetMember
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE budget_members SET role = $1, permissions = $2
+			WHERE budget_id = $3 AND user_id = $4
+		`, RoleEditor, string(editorPerms), budgetID, fromUserID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE budgets SET owner_id = $1, updated_at = NOW() WHERE id = $2
+		`, userID, budgetID); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE budget_ownership_transfers SET status = $1, resolved_at = NOW() WHERE id = $2
+		`, TransferAccepted, transferID)
+		return err
+	})
+	if err != nil {
+		if staleStatus != "" {
+			s.closeOwnershipTransfer(ctx, transferID, staleStatus)
+		}
+		return "", err
+	}
+
+	utils.LogBudgetAction("OwnershipTransferred", budgetID, userID)
+
+	var userName string
+	if err := s.db.QueryRowContext(ctx, "SELECT name FROM users WHERE id = $1", userID).Scan(&userName); err != nil {
+		userName = "Un membre"
+	}
+	s.PublishEvent(NewBudgetEvent(budgetID, EventOwnershipTransferred,
+		&EventActor{ID: userID, Name: userName},
+		map[string]interface{}{
+			"transfer_id":  transferID,
+			"from_user_id": fromUserID,
+			"to_user_id":   userID,
+		},
+	), "")
+	return budgetID, nil
+}
+
+// closeOwnershipTransfer marks a transfer that can no longer complete, outside
+// the rolled-back accept transaction. Best effort.
+func (s *BudgetService) closeOwnershipTransfer(ctx context.Context, transferID, status string) {
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE budget_ownership_transfers SET status = $1, resolved_at = NOW()
+		WHERE id = $2 AND status = $3
+	`, status, transferID, TransferPending); err != nil {
+		utils.SafeWarn("Failed to close ownership transfer: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// eventRecorder garde les événements publiés par le service.
+type eventRecorder struct {
+	events []BudgetEvent
+}
+
+func (r *eventRecorder) BroadcastUpdate(string, string, string)                      {}
+func (r *eventRecorder) BroadcastUpdateExcludingUser(string, string, string, string) {}
+func (r *eventRecorder) PublishEvent(event BudgetEvent, excludeUserID string) {
+	r.events = append(r.events, event)
+}
+
+func newOwnershipMock(t *testing.T) (*BudgetService, sqlmock.Sqlmock, *eventRecorder) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	recorder := &eventRecorder{}
+
+	// Lien du mail : transfert t1 de u1 vers u2 sur b1
+	mock.ExpectQuery(`SELECT id FROM budget_ownership_transfers WHERE token_hash = \$1`).
+		WithArgs(hashToken("raw-token"), TransferPending).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("t1"))
+	mock.ExpectBegin()
+	return NewBudgetService(db, recorder, nil), mock, recorder
+}
+
+func expectTransferRow(mock sqlmock.Sqlmock, expiresAt time.Time) {
+	mock.ExpectQuery(`FROM budget_ownership_transfers\s+WHERE id = \$1\s+FOR UPDATE`).WithArgs("t1").
+		WillReturnRows(sqlmock.NewRows([]string{"budget_id", "from_user_id", "to_user_id", "status", "expires_at"}).
+			AddRow("b1", "u1", "u2", TransferPending, expiresAt))
+}
+
+func TestAcceptOwnershipTransferByToken(t *testing.T) {
+	s, mock, recorder := newOwnershipMock(t)
+	expectTransferRow(mock, time.Now().Add(time.Hour))
+	mock.ExpectQuery(`SELECT owner_id FROM budgets WHERE id = \$1 FOR UPDATE`).WithArgs("b1").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("u1"))
+	mock.ExpectExec(`UPDATE budget_members SET role`).WithArgs(RoleOwner, sqlmock.AnyArg(), "b1", "u2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE budget_members SET role`).WithArgs(RoleEditor, sqlmock.AnyArg(), "b1", "u1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE budgets SET owner_id`).WithArgs("u2", "b1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE budget_ownership_transfers SET status`).WithArgs(TransferAccepted, "t1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT name FROM users`).WithArgs("u2").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("User u2"))
+
+	budgetID, err := s.AcceptOwnershipTransferByToken(context.Background(), "raw-token", "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budgetID != "b1" {
+		t.Errorf("budget = %q, want b1", budgetID)
+	}
+	if len(recorder.events) != 1 || recorder.events[0].Type != EventOwnershipTransferred || recorder.events[0].ID == "" {
+		t.Errorf("events = %+v", recorder.events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAcceptOwnershipTransferRejected(t *testing.T) {
+	cases := []struct {
+		name    string
+		userID  string
+		expires time.Time
+		ownerID string // propriétaire actuel ; vide = non lu
+		closeAs string // statut posé hors transaction ; vide = transfert intact
+		want    error
+	}{
+		{"another member", "u3", time.Now().Add(time.Hour), "", "", ErrTransferNotForUser},
+		{"expired", "u2", time.Now().Add(-time.Hour), "", TransferExpired, ErrTransferExpired},
+		{"owner changed since", "u2", time.Now().Add(time.Hour), "u4", TransferCancelled, ErrTransferNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, mock, recorder := newOwnershipMock(t)
+			expectTransferRow(mock, tc.expires)
+			if tc.ownerID != "" {
+				mock.ExpectQuery(`SELECT owner_id FROM budgets`).WithArgs("b1").
+					WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(tc.ownerID))
+			}
+			mock.ExpectRollback()
+			if tc.closeAs != "" {
+				mock.ExpectExec(`UPDATE budget_ownership_transfers SET status = \$1, resolved_at = NOW\(\)\s+WHERE id = \$2 AND status = \$3`).
+					WithArgs(tc.closeAs, "t1", TransferPending).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			_, err := s.AcceptOwnershipTransferByToken(context.Background(), "raw-token", tc.userID)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+			if len(recorder.events) != 0 {
+				t.Errorf("events published for a rejected transfer: %+v", recorder.events)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+// services/budget_revisions.go
+// ============================================================================
+// BUDGET DATA REVISIONS — append-only history of budget_data saves
+// ============================================================================
+// Every UpdateDataIfVersion call appends the new head (same encrypted wrapper
+// as budget_data.data) to budget_data_revisions inside the save transaction.
+// A bad save or a buggy convert step on the frontend can then be undone by
+// restoring an older revision, which simply becomes a new head.
+//
+// Retention is enforced by the daily cleanup loop in main.go: we keep the N
+// latest revisions of each budget plus the last revision of every day over a
+// sliding window (see RevisionRetention).
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LovationAdmin/budget-api/models"
+)
+
+// ErrRevisionNotFound is returned when the requested version has been pruned
+// or never existed.
+var ErrRevisionNotFound = errors.New("budget revision not found")
+
+// recordRevision copies the budget_data row identified by dataID into the
+// history table. Idempotent on (budget_id, version), which lets the save path
+// call it both before (legacy head without history) and after an update.
+func recordRevision(ctx context.Context, tx *sql.Tx, dataID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO budget_data_revisions (budget_id, version, data, size_bytes, author_id, created_at)
+		SELECT budget_id, COALESCE(version, 1), data, octet_length(data::text), updated_by, COALESCE(updated_at, NOW())
+		FROM budget_data
+		WHERE id = $1
+		ON CONFLICT (budget_id, version) DO NOTHING
+	`, dataID)
+	if err != nil {
+		return fmt.Errorf("record revision: %w", err)
+	}
+	return nil
+}
+
+// ListRevisions returns revision metadata, newest first.
+func (s *BudgetService) ListRevisions(ctx context.Context, budgetID string, limit int) ([]models.BudgetRevision, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.budget_id, r.version, r.size_bytes,
+		       COALESCE(r.author_id::text, ''), COALESCE(u.name, ''), r.created_at
+		FROM budget_data_revisions r
+		LEFT JOIN users u ON u.id = r.author_id
+		WHERE r.budget_id = $1
+		ORDER BY r.version DESC
+		LIMIT $2
+	`, budgetID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.BudgetRevision{}
+	for rows.Next() {
+		var rev models.BudgetRevision
+		if err := rows.Scan(&rev.ID, &rev.BudgetID, &rev.Version, &rev.SizeBytes,
+			&rev.AuthorID, &rev.AuthorName, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// GetRevision returns one revision with its document decrypted.
+func (s *BudgetService) GetRevision(ctx context.Context, budgetID string, version int) (*models.BudgetRevision, error) {
+	var rev models.BudgetRevision
+	var rawJSON []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT r.id, r.budget_id, r.version, r.size_bytes,
+		       COALESCE(r.author_id::text, ''), COALESCE(u.name, ''), r.created_at, r.data
+		FROM budget_data_revisions r
+		LEFT JOIN users u ON u.id = r.author_id
+		WHERE r.budget_id = $1 AND r.version = $2
+	`, budgetID, version).Scan(&rev.ID, &rev.BudgetID, &rev.Version, &rev.SizeBytes,
+		&rev.AuthorID, &rev.AuthorName, &rev.CreatedAt, &rawJSON)
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeStoredData(ctx, s.db, budgetID, rawJSON)
+	if err != nil {
+		return nil, err
+	}
+	rev.Data = data
+	return &rev, nil
+}
+
+// RestoreRevision makes an older revision the new head. The restore itself
+// is a regular save, so it gets its own revision and broadcast.
+func (s *BudgetService) RestoreRevision(ctx context.Context, budgetID string, version int, userID, userName string) (int, error) {
+	rev, err := s.GetRevision(ctx, budgetID, version)
+	if err != nil {
+		return 0, err
+	}
+	return s.UpdateDataIfVersion(ctx, budgetID, rev.Data, 0, userID, userName)
+}
+
+// ----------------------------------------------------------------------------
+// DIFF
+// ----------------------------------------------------------------------------
+
+// RevisionChange is one leaf-level difference between two documents. Path is
+// a JSON Pointer (RFC 6901) into the document.
+type RevisionChange struct {
+	Op       string      `json:"op"` // added | removed | changed
+	Path     string      `json:"path"`
+	OldValue interface{} `json:"old_value,omitempty"`
+	NewValue interface{} `json:"new_value,omitempty"`
+}
+
+// DiffRevisions compares two revisions of the same budget.
+func (s *BudgetService) DiffRevisions(ctx context.Context, budgetID string, fromVersion, toVersion int) ([]RevisionChange, error) {
+	from, err := s.GetRevision(ctx, budgetID, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.GetRevision(ctx, budgetID, toVersion)
+	if err != nil {
+		return nil, err
+	}
+	return diffDocuments(from.Data, to.Data), nil
+}
+
+// diffDocuments walks both decoded JSON trees and reports leaf changes in a
+// deterministic order (object keys sorted, arrays by index).
+func diffDocuments(a, b interface{}) []RevisionChange {
+	changes := []RevisionChange{}
+	diffValues("", a, b, &changes)
+	return changes
+}
+
+func diffValues(path string, a, b interface{}, out *[]RevisionChange) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, seen := av[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "/" + escapePointerToken(k)
+			aChild, inA := av[k]
+			bChild, inB := bv[k]
+			switch {
+			case !inA:
+				*out = append(*out, RevisionChange{Op: "added", Path: child, NewValue: bChild})
+			case !inB:
+				*out = append(*out, RevisionChange{Op: "removed", Path: child, OldValue: aChild})
+			default:
+				diffValues(child, aChild, bChild, out)
+			}
+		}
+		return
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			child := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(av):
+				*out = append(*out, RevisionChange{Op: "added", Path: child, NewValue: bv[i]})
+			case i >= len(bv):
+				*out = append(*out, RevisionChange{Op: "removed", Path: child, OldValue: av[i]})
+			default:
+				diffValues(child, av[i], bv[i], out)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*out = append(*out, RevisionChange{Op: "changed", Path: path, OldValue: a, NewValue: b})
+	}
+}
+
+// escapePointerToken applies the RFC 6901 escaping rules (~ then /).
+func escapePointerToken(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
+
+// ----------------------------------------------------------------------------
+// RETENTION
+// ----------------------------------------------------------------------------
+
+// RevisionRetention describes which revisions survive pruning: the KeepLatest
+// newest of each budget, plus the last revision of each day for the past
+// KeepDailyDays days.
+type RevisionRetention struct {
+	KeepLatest    int
+	KeepDailyDays int
+}
+
+// RevisionRetentionFromEnv reads BUDGET_REVISIONS_KEEP_LATEST (default 50)
+// and BUDGET_REVISIONS_KEEP_DAILY_DAYS (default 30).
+func RevisionRetentionFromEnv() RevisionRetention {
+	return RevisionRetention{
+		KeepLatest:    envInt("BUDGET_REVISIONS_KEEP_LATEST", 50),
+		KeepDailyDays: envInt("BUDGET_REVISIONS_KEEP_DAILY_DAYS", 30),
+	}
+}
+
+func envInt(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return fallback
+	}
+	return v
+}
+
+// PruneRevisions deletes every revision not covered by the retention policy
+// and returns how many rows were removed. The current head always survives
+// because it is the newest revision of its budget.
+func (s *BudgetService) PruneRevisions(ctx context.Context, policy RevisionRetention) (int64, error) {
+	keepLatest := policy.KeepLatest
+	if keepLatest < 1 {
+		keepLatest = 1
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM budget_data_revisions r
+		USING (
+			SELECT id, created_at,
+			       ROW_NUMBER() OVER (PARTITION BY budget_id ORDER BY version DESC) AS rn_latest,
+			       ROW_NUMBER() OVER (PARTITION BY budget_id, date_trunc('day', created_at) ORDER BY version DESC) AS rn_day
+			FROM budget_data_revisions
+		) ranked
+		WHERE r.id = ranked.id
+		  AND ranked.rn_latest > $1
+		  AND NOT (ranked.rn_day = 1 AND ranked.created_at >= NOW() - make_interval(days => $2))
+	`, keepLatest, policy.KeepDailyDays)
+	if err != nil {
+		return 0, fmt.Errorf("prune revisions: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
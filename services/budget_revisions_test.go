@@ -0,0 +1,61 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, raw string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("bad fixture %q: %v", raw, err)
+	}
+	return v
+}
+
+func TestDiffDocuments(t *testing.T) {
+	a := decodeJSON(t, `{
+		"budgetTitle": "Famille",
+		"charges": [{"id": "c1", "amount": 40}, {"id": "c2", "amount": 10}],
+		"lockedMonths": {"Janvier": true},
+		"a/b": 1
+	}`)
+	b := decodeJSON(t, `{
+		"budgetTitle": "Famille",
+		"charges": [{"id": "c1", "amount": 45}],
+		"lockedMonths": {"Janvier": true, "Février": true},
+		"currentYear": 2026
+	}`)
+
+	got := diffDocuments(a, b)
+	want := []RevisionChange{
+		{Op: "removed", Path: "/a~1b", OldValue: float64(1)},
+		{Op: "changed", Path: "/charges/0/amount", OldValue: float64(40), NewValue: float64(45)},
+		{Op: "removed", Path: "/charges/1", OldValue: map[string]interface{}{"id": "c2", "amount": float64(10)}},
+		{Op: "added", Path: "/currentYear", NewValue: float64(2026)},
+		{Op: "added", Path: "/lockedMonths/Février", NewValue: true},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("diff mismatch\n got: %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestDiffDocuments_Identical(t *testing.T) {
+	doc := decodeJSON(t, `{"people": [{"name": "Alice"}], "currentYear": 2026}`)
+	if got := diffDocuments(doc, doc); len(got) != 0 {
+		t.Fatalf("expected no changes, got %#v", got)
+	}
+}
+
+func TestDiffDocuments_TypeChange(t *testing.T) {
+	a := decodeJSON(t, `{"months": [1, 2]}`)
+	b := decodeJSON(t, `{"months": {"Janvier": 1}}`)
+
+	got := diffDocuments(a, b)
+	if len(got) != 1 || got[0].Op != "changed" || got[0].Path != "/months" {
+		t.Fatalf("expected a single change at /months, got %#v", got)
+	}
+}
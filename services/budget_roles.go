@@ -0,0 +1,233 @@
+// services/budget_roles.go
+// ============================================================================
+// BUDGET ROLES & PERMISSIONS — what a member may do on a shared budget
+// ============================================================================
+// budget_members.role is one of owner / editor / viewer. Each role has a
+// default permission set; budget_members.permissions (JSONB) stores the
+// effective set for non-owner members, so an owner can hand out custom
+// grants on top of a role (e.g. a viewer who may manage bank connections).
+//
+//   owner  : everything, cannot be restricted (single owner per budget)
+//   editor : read, write
+//   viewer : read
+//
+// "read" is implied by membership and cannot be revoked. Deleting the budget
+// and changing roles stay owner-only and are not grantable.
+//
+// Enforcement lives in middleware.RequireBudgetPermission, wired per route in
+// routes/routes.go.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Roles
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+
+	// roleLegacyMember is what AcceptInvitation used to insert; read as editor.
+	roleLegacyMember = "member"
+)
+
+// Permissions
+const (
+	PermRead          = "read"           // view budget, data, history, presence
+	PermWrite         = "write"          // save data, restore revisions, rename
+	PermInvite        = "invite"         // send and cancel invitations
+	PermManageMembers = "manage_members" // remove members
+	PermManageBanking = "manage_banking" // connect and sync bank accounts
+)
+
+// AllPermissions lists every grantable permission, in display order.
+var AllPermissions = []string{PermRead, PermWrite, PermInvite, PermManageMembers, PermManageBanking}
+
+var (
+	ErrNotBudgetMember   = errors.New("not a budget member")
+	ErrNotBudgetOwner    = errors.New("only the budget owner can do this")
+	ErrInvalidRole       = errors.New("invalid role")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrOwnerRoleChange   = errors.New("the owner role can only change through an ownership transfer")
+)
+
+// MemberAccess is the resolved role and effective permissions of a member.
+type MemberAccess struct {
+	Role        string          `json:"role"`
+	Permissions map[string]bool `json:"permissions"`
+}
+
+// Can reports whether the member holds perm.
+func (a *MemberAccess) Can(perm string) bool {
+	return a != nil && a.Permissions[perm]
+}
+
+// IsOwner reports whether the member owns the budget.
+func (a *MemberAccess) IsOwner() bool {
+	return a != nil && a.Role == RoleOwner
+}
+
+// NormalizeRole maps legacy and unknown values onto a known role.
+func NormalizeRole(role string) string {
+	switch role {
+	case RoleOwner, RoleEditor, RoleViewer:
+		return role
+	case roleLegacyMember, "":
+		return RoleEditor
+	default:
+		return RoleViewer
+	}
+}
+
+// RolePermissions returns the default permission set of a role.
+func RolePermissions(role string) map[string]bool {
+	perms := make(map[string]bool, len(AllPermissions))
+	for _, p := range AllPermissions {
+		perms[p] = false
+	}
+
+	switch NormalizeRole(role) {
+	case RoleOwner:
+		for _, p := range AllPermissions {
+			perms[p] = true
+		}
+	case RoleEditor:
+		perms[PermRead] = true
+		perms[PermWrite] = true
+	case RoleViewer:
+		perms[PermRead] = true
+	}
+	return perms
+}
+
+// resolveAccess combines a stored role and permissions column into the
+// effective access. Stored flags override role defaults, except for the owner
+// (always everything) and "read" (always granted).
+func resolveAccess(role string, stored []byte) *MemberAccess {
+	role = NormalizeRole(role)
+	perms := RolePermissions(role)
+
+	if role != RoleOwner && len(stored) > 0 {
+		var flags map[string]bool
+		if err := json.Unmarshal(stored, &flags); err == nil {
+			for p, v := range flags {
+				if _, known := perms[p]; known {
+					perms[p] = v
+				}
+			}
+		}
+	}
+	perms[PermRead] = true
+
+	return &MemberAccess{Role: role, Permissions: perms}
+}
+
+// buildPermissions validates custom grants and merges them over the role
+// defaults. The result is what gets stored in budget_members.permissions.
+func buildPermissions(role string, overrides map[string]bool) (map[string]bool, error) {
+	perms := RolePermissions(role)
+	for p, v := range overrides {
+		if _, known := perms[p]; !known {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+		perms[p] = v
+	}
+	perms[PermRead] = true
+	return perms, nil
+}
+
+// GetMemberAccess resolves the access of userID on budgetID. Package-level so
+// middleware can use it without a BudgetService (same as PruneBroadcastOutbox).
+func GetMemberAccess(ctx context.Context, db *sql.DB, budgetID, userID string) (*MemberAccess, error) {
+	var role sql.NullString
+	var isOwner bool
+	var stored []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT bm.role, b.owner_id = bm.user_id, bm.permissions
+		FROM budget_members bm
+		JOIN budgets b ON b.id = bm.budget_id
+		WHERE bm.budget_id = $1 AND bm.user_id = $2
+	`, budgetID, userID).Scan(&role, &isOwner, &stored)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotBudgetMember
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return memberAccess(role.String, isOwner, stored), nil
+}
+
+// memberAccess resolves a budget_members row. budgets.owner_id is the source
+// of truth for ownership, whatever the row's role column says.
+func memberAccess(role string, isOwner bool, stored []byte) *MemberAccess {
+	if isOwner {
+		return resolveAccess(RoleOwner, nil)
+	}
+	if role == RoleOwner {
+		role = RoleEditor
+	}
+	return resolveAccess(role, stored)
+}
+
+// GetMemberAccess is the BudgetService shortcut for the package function.
+func (s *BudgetService) GetMemberAccess(ctx context.Context, budgetID, userID string) (*MemberAccess, error) {
+	return GetMemberAccess(ctx, s.db, budgetID, userID)
+}
+
+// SetMemberRole changes the role (and optional custom grants) of a member.
+// Only the owner may call it, and the owner's own row cannot be changed here.
+func (s *BudgetService) SetMemberRole(ctx context.Context, budgetID, actorID, memberUserID, role string, overrides map[string]bool) (*MemberAccess, error) {
+	actor, err := s.GetMemberAccess(ctx, budgetID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.IsOwner() {
+		return nil, ErrNotBudgetOwner
+	}
+
+	switch role {
+	case RoleEditor, RoleViewer:
+	case RoleOwner:
+		return nil, ErrOwnerRoleChange
+	default:
+		return nil, ErrInvalidRole
+	}
+	if memberUserID == actorID {
+		return nil, ErrOwnerRoleChange
+	}
+
+	perms, err := buildPermissions(role, overrides)
+	if err != nil {
+		return nil, err
+	}
+	permsJSON, err := json.Marshal(perms)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE budget_members SET role = $1, permissions = $2
+		WHERE budget_id = $3 AND user_id = $4
+	`, role, string(permsJSON), budgetID, memberUserID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotBudgetMember
+	}
+
+	access := &MemberAccess{Role: role, Permissions: perms}
+	s.PublishEvent(NewBudgetEvent(budgetID, EventMemberRoleChanged,
+		&EventActor{ID: actorID},
+		map[string]interface{}{"user_id": memberUserID, "role": role, "permissions": perms},
+	), actorID)
+	return access, nil
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemberAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		isOwner bool
+		stored  string
+		can     []string
+		cannot  []string
+		want    string
+	}{
+		{
+			name: "legacy member row reads as editor",
+			role: "member", stored: `{"read": true, "write": true}`,
+			want: RoleEditor, can: []string{PermRead, PermWrite}, cannot: []string{PermInvite, PermManageBanking},
+		},
+		{
+			name: "viewer",
+			role: RoleViewer, stored: `{"read": true}`,
+			want: RoleViewer, can: []string{PermRead}, cannot: []string{PermWrite},
+		},
+		{
+			name: "viewer with custom banking grant",
+			role: RoleViewer, stored: `{"read": true, "write": false, "manage_banking": true}`,
+			want: RoleViewer, can: []string{PermRead, PermManageBanking}, cannot: []string{PermWrite, PermInvite},
+		},
+		{
+			name: "read cannot be revoked",
+			role: RoleEditor, stored: `{"read": false}`,
+			want: RoleEditor, can: []string{PermRead, PermWrite},
+		},
+		{
+			name: "owner ignores stored restrictions",
+			role: RoleOwner, isOwner: true, stored: `{"write": false}`,
+			want: RoleOwner, can: AllPermissions,
+		},
+		{
+			name: "stale owner role without budgets.owner_id is not owner",
+			role: RoleOwner, stored: `{"read": true, "write": true}`,
+			want: RoleEditor, can: []string{PermWrite}, cannot: []string{PermManageMembers},
+		},
+		{
+			name: "unknown role and garbage permissions fall back to read-only",
+			role: "admin", stored: `not json`,
+			want: RoleViewer, can: []string{PermRead}, cannot: []string{PermWrite},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access := memberAccess(tt.role, tt.isOwner, []byte(tt.stored))
+			if access.Role != tt.want {
+				t.Errorf("role = %q, want %q", access.Role, tt.want)
+			}
+			for _, p := range tt.can {
+				if !access.Can(p) {
+					t.Errorf("expected %q to be granted", p)
+				}
+			}
+			for _, p := range tt.cannot {
+				if access.Can(p) {
+					t.Errorf("expected %q to be denied", p)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPermissions(t *testing.T) {
+	perms, err := buildPermissions(RoleViewer, map[string]bool{PermInvite: true, PermRead: false})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !perms[PermRead] || !perms[PermInvite] || perms[PermWrite] {
+		t.Errorf("unexpected permissions: %v", perms)
+	}
+	if len(perms) != len(AllPermissions) {
+		t.Errorf("stored set should list every permission, got %v", perms)
+	}
+
+	if _, err := buildPermissions(RoleEditor, map[string]bool{"delete_budget": true}); !errors.Is(err, ErrUnknownPermission) {
+		t.Errorf("err = %v, want ErrUnknownPermission", err)
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// newBudgetDataMock prépare un BudgetService sur sqlmock dont le budget b1
+// a déjà sa clé de données.
+func newBudgetDataMock(t *testing.T) (*BudgetService, sqlmock.Sqlmock) {
+	t.Helper()
+	t.Setenv("DATA_ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+
+	key, err := utils.GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := utils.Encrypt(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mock.ExpectQuery(`SELECT wrapped_key FROM budget_data_keys`).WithArgs("b1").
+		WillReturnRows(sqlmock.NewRows([]string{"wrapped_key"}).AddRow(wrapped))
+	return NewBudgetService(db, nil, nil), mock
+}
+
+func TestUpdateDataIfVersionFirstSaveLocksBudget(t *testing.T) {
+	s, mock := newBudgetDataMock(t)
+
+	// Pas encore de head : seul le verrou sur budgets sérialise les deux
+	// premières sauvegardes
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT 1 FROM budgets WHERE id = \$1 FOR NO KEY UPDATE`).WithArgs("b1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT id, COALESCE\(version, 1\), data FROM budget_data`).WithArgs("b1").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`INSERT INTO budget_data \(id, budget_id`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO budget_data_revisions`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	version, err := s.UpdateDataIfVersion(context.Background(), "b1", map[string]interface{}{"budgetTitle": "Famille"}, 0, "u1", "User u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("version = %d, want 1", version)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateDataIfVersionConflict(t *testing.T) {
+	s, mock := newBudgetDataMock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT 1 FROM budgets WHERE id = \$1 FOR NO KEY UPDATE`).WithArgs("b1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT id, COALESCE\(version, 1\), data FROM budget_data`).WithArgs("b1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "data"}).AddRow("d1", 3, []byte(`{}`)))
+	mock.ExpectRollback()
+
+	_, err := s.UpdateDataIfVersion(context.Background(), "b1", map[string]interface{}{}, 2, "u1", "User u1")
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("err = %v, want ErrVersionConflict", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
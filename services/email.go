@@ -18,6 +18,16 @@ func (s *EmailService) SendInvitation(toEmail, inviterName, budgetName, invitati
 	return utils.SendInvitationEmail(toEmail, inviterName, budgetName, invitationToken)
 }
 
+// SendOwnershipTransfer wrapper calling utils
+func (s *EmailService) SendOwnershipTransfer(toEmail, ownerName, budgetName, transferToken string) error {
+	return utils.SendOwnershipTransferEmail(toEmail, ownerName, budgetName, transferToken)
+}
+
+// SendBankConsentReminder wrapper calling utils
+func (s *EmailService) SendBankConsentReminder(toEmail, userName, bankName, budgetName, budgetID string, daysLeft int) error {
+	return utils.SendBankConsentReminderEmail(toEmail, userName, bankName, budgetName, budgetID, daysLeft)
+}
+
 // SendVerificationEmail wrapper calling utils
 // Renamed from SendVerification to match handlers/auth.go
 func (s *EmailService) SendVerificationEmail(toEmail, userName, token string) error {
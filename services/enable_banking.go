@@ -12,7 +12,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -54,6 +56,11 @@ func NewEnableBankingService() *EnableBankingService {
 	}
 }
 
+// Name identifie le fournisseur (banking_connections.provider).
+func (s *EnableBankingService) Name() string {
+	return ProviderEnableBanking
+}
+
 func loadPrivateKey() *rsa.PrivateKey {
 	log.Println("🔑 Loading private key...")
 	var pemData []byte
@@ -207,6 +214,9 @@ type Account struct {
 	Details         string                `json:"details,omitempty"`
 	Product         string                `json:"product,omitempty"`
 	UID             string                `json:"uid"`
+	// Stable d'une session à l'autre (contrairement à l'UID) : sert à
+	// rattacher les comptes existants après une reconnexion
+	IdentificationHash string `json:"identification_hash,omitempty"`
 }
 
 type SessionResponse struct {
@@ -217,6 +227,19 @@ type SessionResponse struct {
 		Country string `json:"country"`
 	} `json:"aspsp"`
 	PSUType string `json:"psu_type"`
+	Access  Access `json:"access"`
+}
+
+// SessionDetails est l'état d'une session existante (GET /sessions/{id}).
+type SessionDetails struct {
+	Status       string           `json:"status"` // AUTHORIZED, EXPIRED, REVOKED, CLOSED, INVALID...
+	Access       Access           `json:"access"`
+	AccountsData []SessionAccount `json:"accounts_data"`
+}
+
+type SessionAccount struct {
+	UID                string `json:"uid"`
+	IdentificationHash string `json:"identification_hash"`
 }
 
 type AmountType struct {
@@ -379,6 +402,38 @@ func (s *EnableBankingService) CreateSession(ctx context.Context, code, state st
 	return &sessionResp, nil
 }
 
+// GetSession récupère l'état et la validité du consentement d'une session
+func (s *EnableBankingService) GetSession(ctx context.Context, sessionID string) (*SessionDetails, error) {
+	url := fmt.Sprintf("%s/sessions/%s", s.BaseURL, sessionID)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err := s.setHeaders(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, newRateLimitError(resp)
+	}
+	if resp.StatusCode != 200 {
+		log.Printf("❌ Session lookup failed: %s", string(respBody))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var details SessionDetails
+	if err := json.Unmarshal(respBody, &details); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &details, nil
+}
+
 // GetBalances récupère les soldes d'un compte
 func (s *EnableBankingService) GetBalances(ctx context.Context, sessionID, accountUID string) ([]Balance, error) {
 	url := fmt.Sprintf("%s/accounts/%s/balances", s.BaseURL, accountUID)
@@ -397,6 +452,9 @@ func (s *EnableBankingService) GetBalances(ctx context.Context, sessionID, accou
 
 	respBody, _ := io.ReadAll(resp.Body)
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, newRateLimitError(resp)
+	}
 	if resp.StatusCode != 200 {
 		log.Printf("❌ Error response: %s", string(respBody))
 		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(respBody))
@@ -415,16 +473,53 @@ func (s *EnableBankingService) GetBalances(ctx context.Context, sessionID, accou
 	return balancesResp.Balances, nil
 }
 
-// GetTransactions récupère les transactions d'un compte
+// maxTransactionPages borne le suivi des continuation keys (historiques
+// très longs ou provider qui renverrait toujours une clé).
+const maxTransactionPages = 100
+
+// GetTransactions récupère les transactions d'un compte, en suivant les
+// continuation keys jusqu'à la dernière page.
 func (s *EnableBankingService) GetTransactions(ctx context.Context, accountUID string, dateFrom, dateTo string) ([]Transaction, error) {
-	url := fmt.Sprintf("%s/accounts/%s/transactions", s.BaseURL, accountUID)
-	if dateFrom != "" && dateTo != "" {
-		url += fmt.Sprintf("?date_from=%s&date_to=%s", dateFrom, dateTo)
+	log.Printf("💳 Fetching transactions for account: %s (from %s to %s)", accountUID, dateFrom, dateTo)
+
+	var all []Transaction
+	continuationKey := ""
+	for page := 1; ; page++ {
+		resp, err := s.getTransactionsPage(ctx, accountUID, dateFrom, dateTo, continuationKey)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Transactions...)
+
+		if resp.ContinuationKey == "" || resp.ContinuationKey == continuationKey {
+			break
+		}
+		if page >= maxTransactionPages {
+			log.Printf("⚠️  Stopping after %d transaction pages for account %s", page, accountUID)
+			break
+		}
+		continuationKey = resp.ContinuationKey
 	}
 
-	log.Printf("💳 Fetching transactions for account: %s (from %s to %s)", accountUID, dateFrom, dateTo)
+	log.Printf("✅ Retrieved %d transactions", len(all))
+	return all, nil
+}
 
-	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+func (s *EnableBankingService) getTransactionsPage(ctx context.Context, accountUID, dateFrom, dateTo, continuationKey string) (*TransactionsResponse, error) {
+	params := url.Values{}
+	if dateFrom != "" && dateTo != "" {
+		params.Set("date_from", dateFrom)
+		params.Set("date_to", dateTo)
+	}
+	if continuationKey != "" {
+		params.Set("continuation_key", continuationKey)
+	}
+	endpoint := fmt.Sprintf("%s/accounts/%s/transactions", s.BaseURL, accountUID)
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err := s.setHeaders(req); err != nil {
 		return nil, err
 	}
@@ -437,6 +532,9 @@ func (s *EnableBankingService) GetTransactions(ctx context.Context, accountUID s
 
 	respBody, _ := io.ReadAll(resp.Body)
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, newRateLimitError(resp)
+	}
 	if resp.StatusCode != 200 {
 		log.Printf("❌ Error response: %s", string(respBody))
 		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(respBody))
@@ -446,9 +544,7 @@ func (s *EnableBankingService) GetTransactions(ctx context.Context, accountUID s
 	if err := json.Unmarshal(respBody, &transResp); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
-
-	log.Printf("✅ Retrieved %d transactions", len(transResp.Transactions))
-	return transResp.Transactions, nil
+	return &transResp, nil
 }
 
 // DeleteSession supprime une session
@@ -477,6 +573,42 @@ func (s *EnableBankingService) DeleteSession(ctx context.Context, sessionID stri
 	return nil
 }
 
+// ============================================================================
+// RATE LIMITING
+// ============================================================================
+
+// RateLimitError signale un HTTP 429 du provider. RetryAfter vaut 0 si la
+// réponse n'indiquait pas de délai.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("provider rate limit reached, retry after %s", e.RetryAfter)
+	}
+	return "provider rate limit reached"
+}
+
+func newRateLimitError(resp *http.Response) *RateLimitError {
+	log.Printf("⏳ Provider rate limit reached (%s)", resp.Request.URL.Path)
+	return &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+}
+
+// parseRetryAfter lit un header Retry-After en secondes ou en date HTTP.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
 // ============================================================================
 // UTILITY FUNCTIONS
 // ============================================================================
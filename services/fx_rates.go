@@ -0,0 +1,443 @@
+// services/fx_rates.go
+// ============================================================================
+// FX RATES — taux de change et conversion dans la devise du budget
+// ============================================================================
+// Les comptes d'un budget peuvent être en EUR, CHF, GBP... alors que le
+// budget a sa propre devise (budgets.currency). Les taux sont stockés comme
+// la BCE les publie : unités de devise pour 1 EUR, un jeu par jour
+// (fx_rates). Conversion X → Y = montant / taux(X) × taux(Y), l'EUR valant 1.
+//
+// Sources acceptées (ParseFXRates) :
+//   - XML BCE : eurofxref-daily.xml, eurofxref-hist.xml
+//   - CSV BCE : eurofxref.csv (date "02 March 2026"), eurofxref-hist.csv
+//     (une ligne par jour, "N/A" pour les devises non cotées)
+//
+// Le taux retenu pour une date est le dernier publié à cette date ou avant
+// (pas de cotation le week-end). Sans taux, le montant n'est pas converti et
+// la devise est signalée (missing_rates) plutôt que comptée au pair.
+// ============================================================================
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// FXBaseCurrency : devise pivot des taux stockés.
+const FXBaseCurrency = "EUR"
+
+// fxHistoryLookback : marge avant la première date demandée pour trouver le
+// dernier taux publié (week-ends, jours fériés).
+const fxHistoryLookback = 14 * 24 * time.Hour
+
+var ErrInvalidFXRates = errors.New("invalid FX rates file")
+
+type FXRateService struct {
+	db *sql.DB
+}
+
+func NewFXRateService(db *sql.DB) *FXRateService {
+	return &FXRateService{db: db}
+}
+
+// ============================================================================
+// PARSING (formats BCE)
+// ============================================================================
+
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseFXRates lit un fichier de taux BCE, XML ou CSV.
+func ParseFXRates(data []byte) ([]models.FXRate, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\ufeff")))
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidFXRates)
+	}
+
+	var (
+		rates []models.FXRate
+		err   error
+	)
+	if data[0] == '<' {
+		rates, err = parseECBXML(data)
+	} else {
+		rates, err = parseECBCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("%w: no rate found", ErrInvalidFXRates)
+	}
+	return rates, nil
+}
+
+func validFXRate(currency string, rate float64) bool {
+	return len(currency) == 3 && currency != FXBaseCurrency && rate > 0 && !math.IsInf(rate, 0)
+}
+
+func parseECBXML(data []byte) ([]models.FXRate, error) {
+	var env ecbEnvelope
+	if err := xml.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFXRates, err)
+	}
+
+	var rates []models.FXRate
+	for _, day := range env.Days {
+		if _, err := time.Parse(transactionDateLayout, day.Time); err != nil {
+			return nil, fmt.Errorf("%w: invalid date %q", ErrInvalidFXRates, day.Time)
+		}
+		for _, r := range day.Rates {
+			currency := strings.ToUpper(strings.TrimSpace(r.Currency))
+			rate, err := strconv.ParseFloat(strings.TrimSpace(r.Rate), 64)
+			if err != nil || !validFXRate(currency, rate) {
+				continue
+			}
+			rates = append(rates, models.FXRate{Date: day.Time, Currency: currency, Rate: rate})
+		}
+	}
+	return rates, nil
+}
+
+func parseECBDate(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range []string{transactionDateLayout, "02 January 2006", "2 January 2006"} {
+		if d, err := time.Parse(layout, raw); err == nil {
+			return d.Format(transactionDateLayout), nil
+		}
+	}
+	return "", fmt.Errorf("%w: invalid date %q", ErrInvalidFXRates, raw)
+}
+
+func parseECBCSV(data []byte) ([]models.FXRate, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFXRates, err)
+	}
+	if len(rows) < 2 || !strings.EqualFold(strings.TrimSpace(rows[0][0]), "date") {
+		return nil, fmt.Errorf("%w: expected a Date column followed by currencies", ErrInvalidFXRates)
+	}
+
+	header := rows[0]
+	var rates []models.FXRate
+	for _, row := range rows[1:] {
+		if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		date, err := parseECBDate(row[0])
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i < len(row) && i < len(header); i++ {
+			currency := strings.ToUpper(strings.TrimSpace(header[i]))
+			rate, err := strconv.ParseFloat(strings.TrimSpace(row[i]), 64)
+			if err != nil || !validFXRate(currency, rate) {
+				continue // N/A, colonne vide finale
+			}
+			rates = append(rates, models.FXRate{Date: date, Currency: currency, Rate: rate})
+		}
+	}
+	return rates, nil
+}
+
+// ============================================================================
+// CONVERSION (pur)
+// ============================================================================
+
+// fxTable : taux en vigueur à une date, par devise (EUR implicite).
+type fxTable map[string]models.FXRate
+
+func (t fxTable) rate(currency string) (models.FXRate, bool) {
+	if currency == FXBaseCurrency {
+		return models.FXRate{Currency: FXBaseCurrency, Rate: 1}, true
+	}
+	r, ok := t[currency]
+	return r, ok
+}
+
+// fxRateBetween renvoie le taux from → to et la date du taux le plus ancien
+// utilisé.
+func fxRateBetween(from, to string, rates fxTable) (float64, string, bool) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == "" || from == to {
+		return 1, "", true
+	}
+	rFrom, ok := rates.rate(from)
+	if !ok {
+		return 0, "", false
+	}
+	rTo, ok := rates.rate(to)
+	if !ok {
+		return 0, "", false
+	}
+	date := rFrom.Date
+	if date == "" || (rTo.Date != "" && rTo.Date < date) {
+		date = rTo.Date
+	}
+	return rTo.Rate / rFrom.Rate, date, true
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// convertTotals additionne des soldes par devise dans la devise to.
+func convertTotals(balances map[string]float64, to string, rates fxTable) *models.CurrencyTotals {
+	currencies := make([]string, 0, len(balances))
+	for c := range balances {
+		currencies = append(currencies, c)
+	}
+	sort.Strings(currencies)
+
+	totals := &models.CurrencyTotals{Currency: to, Breakdown: []models.CurrencyBreakdown{}}
+	for _, c := range currencies {
+		line := models.CurrencyBreakdown{Currency: c, Amount: balances[c]}
+		if rate, date, ok := fxRateBetween(c, to, rates); ok {
+			converted := roundCents(balances[c] * rate)
+			line.Converted = &converted
+			line.Rate = rate
+			line.RateDate = date
+			totals.Total += converted
+		} else {
+			totals.MissingRates = append(totals.MissingRates, c)
+		}
+		totals.Breakdown = append(totals.Breakdown, line)
+	}
+	totals.Total = roundCents(totals.Total)
+	return totals
+}
+
+// fxHistory : taux triés par date croissante, par devise.
+type fxHistory map[string][]models.FXRate
+
+// on renvoie, pour chaque devise, le dernier taux publié à date ou avant.
+func (h fxHistory) on(date string) fxTable {
+	table := fxTable{}
+	for currency, rates := range h {
+		i := sort.Search(len(rates), func(i int) bool { return rates[i].Date > date })
+		if i > 0 {
+			table[currency] = rates[i-1]
+		}
+	}
+	return table
+}
+
+// ============================================================================
+// STOCKAGE ET LECTURE
+// ============================================================================
+
+// Store upsert des taux et renvoie le nombre de lignes écrites.
+func (s *FXRateService) Store(ctx context.Context, rates []models.FXRate, source string) (int, error) {
+	stored := 0
+	err := utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, `
+			INSERT INTO fx_rates (rate_date, currency, rate, source)
+			VALUES ($1::date, $2, $3, $4)
+			ON CONFLICT (rate_date, currency)
+			DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source, created_at = NOW()
+		`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, r := range rates {
+			currency := strings.ToUpper(r.Currency)
+			if _, err := time.Parse(transactionDateLayout, r.Date); err != nil || !validFXRate(currency, r.Rate) {
+				return fmt.Errorf("%w: invalid rate %s %s %v", ErrInvalidFXRates, r.Date, r.Currency, r.Rate)
+			}
+			if _, err := stmt.ExecContext(ctx, r.Date, currency, r.Rate, source); err != nil {
+				return fmt.Errorf("store rate: %w", err)
+			}
+			stored++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return stored, nil
+}
+
+// LoadFile importe un fichier BCE (FX_RATES_FILE au démarrage).
+func (s *FXRateService) LoadFile(ctx context.Context, path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	rates, err := ParseFXRates(data)
+	if err != nil {
+		return 0, err
+	}
+	return s.Store(ctx, rates, "ecb")
+}
+
+// RatesOn renvoie les taux en vigueur à la date donnée.
+func (s *FXRateService) RatesOn(ctx context.Context, date time.Time) (fxTable, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (currency) currency, rate, to_char(rate_date, 'YYYY-MM-DD')
+		FROM fx_rates
+		WHERE rate_date <= $1::date
+		ORDER BY currency, rate_date DESC
+	`, date.Format(transactionDateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	table := fxTable{}
+	for rows.Next() {
+		var r models.FXRate
+		if err := rows.Scan(&r.Currency, &r.Rate, &r.Date); err != nil {
+			return nil, err
+		}
+		table[r.Currency] = r
+	}
+	return table, rows.Err()
+}
+
+// ListRates : taux en vigueur à une date, triés par devise.
+func (s *FXRateService) ListRates(ctx context.Context, date time.Time) ([]models.FXRate, error) {
+	table, err := s.RatesOn(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	rates := make([]models.FXRate, 0, len(table))
+	for _, r := range table {
+		rates = append(rates, r)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Currency < rates[j].Currency })
+	return rates, nil
+}
+
+// history charge les taux utiles pour convertir des montants datés de
+// from à to.
+func (s *FXRateService) history(ctx context.Context, from, to string) (fxHistory, error) {
+	start, err := time.Parse(transactionDateLayout, from)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT currency, rate, to_char(rate_date, 'YYYY-MM-DD')
+		FROM fx_rates
+		WHERE rate_date BETWEEN $1::date AND $2::date
+		ORDER BY currency, rate_date
+	`, start.Add(-fxHistoryLookback).Format(transactionDateLayout), to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h := fxHistory{}
+	for rows.Next() {
+		var r models.FXRate
+		if err := rows.Scan(&r.Currency, &r.Rate, &r.Date); err != nil {
+			return nil, err
+		}
+		h[r.Currency] = append(h[r.Currency], r)
+	}
+	return h, rows.Err()
+}
+
+// BudgetCurrency renvoie la devise du budget (EUR par défaut).
+func (s *FXRateService) BudgetCurrency(ctx context.Context, budgetID string) (string, error) {
+	var currency string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(NULLIF(currency, ''), $2) FROM budgets WHERE id = $1
+	`, budgetID, FXBaseCurrency).Scan(&currency)
+	return strings.ToUpper(currency), err
+}
+
+// ConvertBalances convertit des soldes par devise aux derniers taux connus.
+func (s *FXRateService) ConvertBalances(ctx context.Context, balances map[string]float64, to string) (*models.CurrencyTotals, error) {
+	rates, err := s.RatesOn(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return convertTotals(balances, to, rates), nil
+}
+
+// ConvertAccounts renseigne BalanceConverted des comptes des connexions.
+func (s *FXRateService) ConvertAccounts(ctx context.Context, to string, connections []models.BankConnection) error {
+	rates, err := s.RatesOn(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range connections {
+		for j := range connections[i].Accounts {
+			acc := &connections[i].Accounts[j]
+			if rate, _, ok := fxRateBetween(acc.Currency, to, rates); ok {
+				converted := roundCents(acc.Balance * rate)
+				acc.BalanceConverted = &converted
+			}
+		}
+	}
+	return nil
+}
+
+// ConvertTransactions renseigne AmountConverted au taux du jour de chaque
+// opération.
+func (s *FXRateService) ConvertTransactions(ctx context.Context, to string, transactions []models.BankTransaction) error {
+	from, until := "", ""
+	for _, t := range transactions {
+		if t.BookingDate == "" || strings.EqualFold(t.Currency, to) {
+			continue
+		}
+		if from == "" || t.BookingDate < from {
+			from = t.BookingDate
+		}
+		if t.BookingDate > until {
+			until = t.BookingDate
+		}
+	}
+
+	var h fxHistory
+	if from != "" {
+		var err error
+		if h, err = s.history(ctx, from, until); err != nil {
+			return err
+		}
+	}
+
+	for i := range transactions {
+		t := &transactions[i]
+		if strings.EqualFold(t.Currency, to) || t.Currency == "" {
+			amount := t.Amount
+			t.AmountConverted = &amount
+			continue
+		}
+		if t.BookingDate == "" {
+			continue
+		}
+		if rate, _, ok := fxRateBetween(t.Currency, to, h.on(t.BookingDate)); ok {
+			converted := roundCents(t.Amount * rate)
+			t.AmountConverted = &converted
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/LovationAdmin/budget-api/models"
+)
+
+const ecbDailyXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2026-03-03">
+			<Cube currency="USD" rate="1.0850"/>
+			<Cube currency="CHF" rate="0.9400"/>
+		</Cube>
+		<Cube time="2026-03-02">
+			<Cube currency="USD" rate="1.0800"/>
+			<Cube currency="GBP" rate="0.8500"/>
+			<Cube currency="XXX" rate="abc"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestParseFXRatesECBXML(t *testing.T) {
+	rates, err := ParseFXRates([]byte(ecbDailyXML))
+	if err != nil {
+		t.Fatalf("ParseFXRates: %v", err)
+	}
+	if len(rates) != 4 {
+		t.Fatalf("rates = %+v", rates)
+	}
+	if rates[0] != (models.FXRate{Date: "2026-03-03", Currency: "USD", Rate: 1.085}) {
+		t.Errorf("first rate = %+v", rates[0])
+	}
+}
+
+func TestParseFXRatesECBCSV(t *testing.T) {
+	hist := "Date,USD,JPY,CYP,\n2026-03-03,1.0850,162.10,N/A,\n2026-03-02,1.0800,161.50,N/A,\n"
+	rates, err := ParseFXRates([]byte(hist))
+	if err != nil {
+		t.Fatalf("ParseFXRates(hist): %v", err)
+	}
+	if len(rates) != 4 {
+		t.Fatalf("N/A values must be skipped: %+v", rates)
+	}
+
+	daily := "Date, USD, JPY, \n03 March 2026, 1.0850, 162.10, \n"
+	rates, err = ParseFXRates([]byte(daily))
+	if err != nil {
+		t.Fatalf("ParseFXRates(daily): %v", err)
+	}
+	if len(rates) != 2 || rates[1] != (models.FXRate{Date: "2026-03-03", Currency: "JPY", Rate: 162.1}) {
+		t.Errorf("rates = %+v", rates)
+	}
+
+	for _, bad := range []string{"", "Currency,Rate\nUSD,1.08\n", "Date,USD\nyesterday,1.08\n", "<Cube>"} {
+		if _, err := ParseFXRates([]byte(bad)); !errors.Is(err, ErrInvalidFXRates) {
+			t.Errorf("ParseFXRates(%q) error = %v", bad, err)
+		}
+	}
+}
+
+func TestFXRateBetween(t *testing.T) {
+	rates := fxTable{
+		"USD": {Date: "2026-03-03", Currency: "USD", Rate: 1.25},
+		"CHF": {Date: "2026-03-02", Currency: "CHF", Rate: 0.5},
+	}
+	cases := []struct {
+		from, to string
+		want     float64
+		date     string
+		ok       bool
+	}{
+		{"EUR", "EUR", 1, "", true},
+		{"", "CHF", 1, "", true},
+		{"USD", "EUR", 0.8, "2026-03-03", true},
+		{"eur", "usd", 1.25, "2026-03-03", true},
+		{"USD", "CHF", 0.4, "2026-03-02", true},
+		{"GBP", "EUR", 0, "", false},
+		{"EUR", "GBP", 0, "", false},
+	}
+	for _, c := range cases {
+		got, date, ok := fxRateBetween(c.from, c.to, rates)
+		if ok != c.ok || math.Abs(got-c.want) > 1e-9 || date != c.date {
+			t.Errorf("fxRateBetween(%s, %s) = %v, %q, %v; want %v, %q, %v", c.from, c.to, got, date, ok, c.want, c.date, c.ok)
+		}
+	}
+}
+
+func TestConvertTotals(t *testing.T) {
+	rates := fxTable{
+		"CHF": {Date: "2026-03-02", Currency: "CHF", Rate: 0.94},
+	}
+	totals := convertTotals(map[string]float64{"EUR": 1000, "CHF": 470, "GBP": 200}, "EUR", rates)
+
+	if totals.Currency != "EUR" || totals.Total != 1500 {
+		t.Errorf("total = %v %s, want 1500 EUR", totals.Total, totals.Currency)
+	}
+	if len(totals.MissingRates) != 1 || totals.MissingRates[0] != "GBP" {
+		t.Errorf("missing rates = %v", totals.MissingRates)
+	}
+	if len(totals.Breakdown) != 3 || totals.Breakdown[0].Currency != "CHF" {
+		t.Fatalf("breakdown = %+v", totals.Breakdown)
+	}
+	chf := totals.Breakdown[0]
+	if chf.Amount != 470 || chf.Converted == nil || *chf.Converted != 500 || chf.RateDate != "2026-03-02" {
+		t.Errorf("CHF line = %+v", chf)
+	}
+	if gbp := totals.Breakdown[2]; gbp.Converted != nil {
+		t.Errorf("GBP must stay unconverted: %+v", gbp)
+	}
+}
+
+func TestFXHistoryOn(t *testing.T) {
+	h := fxHistory{
+		"USD": {
+			{Date: "2026-02-27", Currency: "USD", Rate: 1.07},
+			{Date: "2026-03-02", Currency: "USD", Rate: 1.08},
+			{Date: "2026-03-03", Currency: "USD", Rate: 1.09},
+		},
+		"CHF": {{Date: "2026-03-03", Currency: "CHF", Rate: 0.94}},
+	}
+
+	// Dimanche : le taux du vendredi s'applique
+	sunday := h.on("2026-03-01")
+	if sunday["USD"].Rate != 1.07 {
+		t.Errorf("USD on Sunday = %+v", sunday["USD"])
+	}
+	if _, ok := sunday["CHF"]; ok {
+		t.Error("no CHF rate was published yet")
+	}
+	if got := h.on("2026-03-02")["USD"].Rate; got != 1.08 {
+		t.Errorf("USD on publication day = %v", got)
+	}
+	if got := h.on("2026-12-31")["USD"].Rate; got != 1.09 {
+		t.Errorf("USD after last publication = %v", got)
+	}
+}
@@ -0,0 +1,390 @@
+// services/key_rotation.go
+// ============================================================================
+// KEY ROTATION — rechiffrement des données avec la clé active
+// ============================================================================
+// Après un changement de DATA_ENCRYPTION_KEY (voir utils/crypto.go), chaque
+// colonne chiffrée est relue avec le trousseau et réécrite avec la clé
+// active. Les lignes déjà chiffrées avec la clé active ne sont pas lues : le
+// job est idempotent et reprend là où il s'est arrêté, le curseur (dernier
+// id traité par colonne) évitant en plus de repasser sur les lignes en échec.
+//
+// Les clés de données des budgets (budget_data_keys) sont rechiffrées comme
+// le reste, dans le magasin de clés séparé s'il existe. budget_data et ses révisions ne dépendent pas de la clé maître
+// une fois sur leur clé de données : le job y migre les documents encore
+// chiffrés avec la clé maître (voir budget_keys.go).
+//
+// Chaque ligne est réécrite seule, à condition que son chiffré n'ait pas
+// changé entre-temps (une écriture concurrente utilise déjà la clé active).
+// broadcast_outbox n'est pas concernée : ses lignes vivent moins d'une heure.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+const (
+	reencryptBatchSize = 200
+	reencryptThrottle  = 100 * time.Millisecond
+)
+
+// encryptedColumn décrit une colonne chiffrée.
+type encryptedColumn struct {
+	Name  string // nom exposé par l'API admin
+	Table string
+	ID    string // clé primaire UUID (défaut "id")
+	Value string // expression SQL du texte chiffré
+	Set   string // affectation SET, nouveau chiffré en $2
+	// Budget : colonne du budget_id ; les valeurs sont alors chiffrées avec
+	// la clé de données du budget et non avec la clé maître
+	Budget string
+	// MayBePlain : la colonne peut contenir des valeurs sans key id, en clair
+	// ou chiffrées d'avant le trousseau (identifiants bancaires), réécrites
+	// avec la clé active au passage
+	MayBePlain bool
+	// KeyStore : la table est dans le magasin de clés (voir budget_keys.go)
+	KeyStore bool
+}
+
+func (col encryptedColumn) id() string {
+	if col.ID == "" {
+		return "id"
+	}
+	return col.ID
+}
+
+// currentPrefix : préfixe des valeurs qui n'ont plus besoin d'être réécrites.
+func (col encryptedColumn) currentPrefix(keyring *utils.Keyring) string {
+	if col.Budget != "" {
+		return utils.DataKeyID + ":"
+	}
+	return keyring.ActiveKeyID() + ":"
+}
+
+var encryptedColumns = []encryptedColumn{
+	{
+		Name:     "budget_data_keys",
+		Table:    "budget_data_keys",
+		ID:       "budget_id",
+		Value:    "wrapped_key",
+		Set:      "wrapped_key = $2",
+		KeyStore: true,
+	},
+	{
+		Name:   "budget_data",
+		Table:  "budget_data",
+		Value:  "data->>'encrypted'",
+		Set:    "data = jsonb_set(data, '{encrypted}', to_jsonb($2::text))",
+		Budget: "budget_id",
+	},
+	{
+		Name:   "budget_data_revisions",
+		Table:  "budget_data_revisions",
+		Value:  "data->>'encrypted'",
+		Set:    "data = jsonb_set(data, '{encrypted}', to_jsonb($2::text))",
+		Budget: "budget_id",
+	},
+	{
+		Name:  "bank_transactions",
+		Table: "bank_transactions",
+		Value: "encrypted_description",
+		Set:   "encrypted_description = $2",
+	},
+	{
+		Name:       "bank_session_ids",
+		Table:      "banking_connections",
+		Value:      "session_id",
+		Set:        "session_id = $2",
+		MayBePlain: true,
+	},
+	{
+		Name:       "bank_access_tokens",
+		Table:      "banking_connections",
+		Value:      "access_token",
+		Set:        "access_token = $2",
+		MayBePlain: true,
+	},
+	{
+		Name:       "bank_refresh_tokens",
+		Table:      "banking_connections",
+		Value:      "refresh_token",
+		Set:        "refresh_token = $2",
+		MayBePlain: true,
+	},
+}
+
+// EncryptedColumnNames : colonnes prises en charge, dans l'ordre du job.
+func EncryptedColumnNames() []string {
+	names := make([]string, len(encryptedColumns))
+	for i, col := range encryptedColumns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// ReencryptOptions : paramètres d'un passage du job.
+type ReencryptOptions struct {
+	DryRun  bool
+	Limit   int               // lignes lues au plus (0 = sans limite)
+	Columns []string          // vide = toutes
+	Cursor  map[string]string // dernier id traité par colonne (reprise)
+}
+
+// ReencryptProgress : avancement d'une colonne.
+type ReencryptProgress struct {
+	Scanned     int    `json:"scanned"`
+	Reencrypted int    `json:"reencrypted"`
+	Plaintext   int    `json:"plaintext,omitempty"` // MayBePlain : valeurs en clair
+	Conflicts   int    `json:"conflicts,omitempty"` // modifiées pendant le job
+	Failed      int    `json:"failed"`
+	Remaining   int    `json:"remaining"` // pas encore sur la clé active
+	Cursor      string `json:"cursor,omitempty"`
+	Done        bool   `json:"done"`
+}
+
+type ReencryptFailure struct {
+	Column string `json:"column"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type ReencryptResult struct {
+	DryRun      bool                          `json:"dry_run"`
+	ActiveKeyID string                        `json:"active_key_id"`
+	KeyIDs      []string                      `json:"key_ids"`
+	Columns     map[string]*ReencryptProgress `json:"columns"`
+	Done        bool                          `json:"done"`
+	DurationMs  int64                         `json:"duration_ms"`
+	Failures    []ReencryptFailure            `json:"failures,omitempty"`
+}
+
+type KeyRotationService struct {
+	db *sql.DB
+}
+
+func NewKeyRotationService(db *sql.DB) *KeyRotationService {
+	return &KeyRotationService{db: db}
+}
+
+// dbFor : base qui contient la table de la colonne.
+func (s *KeyRotationService) dbFor(col encryptedColumn) *sql.DB {
+	if col.KeyStore && budgetKeyStore != nil {
+		return budgetKeyStore
+	}
+	return s.db
+}
+
+func selectColumns(names []string) ([]encryptedColumn, error) {
+	if len(names) == 0 {
+		return encryptedColumns, nil
+	}
+	var cols []encryptedColumn
+	for _, name := range names {
+		found := false
+		for _, col := range encryptedColumns {
+			if col.Name == name {
+				cols = append(cols, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return cols, nil
+}
+
+// Status compte, par colonne, les valeurs pas encore chiffrées avec la clé
+// active (jetons bancaires en clair compris).
+func (s *KeyRotationService) Status(ctx context.Context) (*ReencryptResult, error) {
+	keyring, err := utils.KeyringFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	res := &ReencryptResult{
+		ActiveKeyID: keyring.ActiveKeyID(),
+		KeyIDs:      keyring.KeyIDs(),
+		Columns:     map[string]*ReencryptProgress{},
+		Done:        true,
+	}
+	for _, col := range encryptedColumns {
+		remaining, err := s.remaining(ctx, col, keyring)
+		if err != nil {
+			return nil, err
+		}
+		res.Columns[col.Name] = &ReencryptProgress{Remaining: remaining, Done: remaining == 0}
+		res.Done = res.Done && remaining == 0
+	}
+	return res, nil
+}
+
+func (s *KeyRotationService) remaining(ctx context.Context, col encryptedColumn, keyring *utils.Keyring) (int, error) {
+	var n int
+	err := s.dbFor(col).QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT COUNT(*) FROM %s
+		WHERE %s IS NOT NULL AND LEFT(%s, length($1)) <> $1
+	`, col.Table, col.Value, col.Value), col.currentPrefix(keyring)).Scan(&n)
+	return n, err
+}
+
+// Reencrypt rechiffre les colonnes demandées avec la clé active. Le job
+// s'arrête à Limit lignes lues ou à l'annulation de ctx ; le Cursor de
+// chaque colonne non terminée permet de le relancer.
+func (s *KeyRotationService) Reencrypt(ctx context.Context, opts ReencryptOptions) (*ReencryptResult, error) {
+	keyring, err := utils.KeyringFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	cols, err := selectColumns(opts.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res := &ReencryptResult{
+		DryRun:      opts.DryRun,
+		ActiveKeyID: keyring.ActiveKeyID(),
+		KeyIDs:      keyring.KeyIDs(),
+		Columns:     map[string]*ReencryptProgress{},
+		Done:        true,
+	}
+	budget := opts.Limit
+
+	for _, col := range cols {
+		progress := &ReencryptProgress{Cursor: opts.Cursor[col.Name]}
+		res.Columns[col.Name] = progress
+
+		for !progress.Done && ctx.Err() == nil && (opts.Limit <= 0 || budget > 0) {
+			batch := reencryptBatchSize
+			if opts.Limit > 0 && budget < batch {
+				batch = budget
+			}
+			n, err := s.reencryptBatch(ctx, keyring, col, opts.DryRun, batch, progress, res)
+			if err != nil && ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", col.Name, err)
+			}
+			budget -= n
+			if n < batch {
+				progress.Done = true
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(reencryptThrottle):
+			}
+		}
+
+		// Compté hors ctx : la requête HTTP a pu être annulée entre-temps
+		if remaining, err := s.remaining(context.Background(), col, keyring); err == nil {
+			progress.Remaining = remaining
+		}
+		if progress.Done {
+			progress.Cursor = ""
+		}
+		res.Done = res.Done && progress.Done
+	}
+
+	res.DurationMs = time.Since(start).Milliseconds()
+	return res, nil
+}
+
+// reencryptBatch traite au plus limit lignes après progress.Cursor et
+// renvoie le nombre de lignes lues.
+func (s *KeyRotationService) reencryptBatch(ctx context.Context, keyring *utils.Keyring, col encryptedColumn, dryRun bool, limit int, progress *ReencryptProgress, res *ReencryptResult) (int, error) {
+	cursor := progress.Cursor
+	if cursor == "" {
+		cursor = "00000000-0000-0000-0000-000000000000"
+	}
+	budgetID := "''"
+	if col.Budget != "" {
+		budgetID = col.Budget
+	}
+	rows, err := s.dbFor(col).QueryContext(ctx, fmt.Sprintf(`
+		SELECT %[1]s::text, %[2]s, %[3]s::text FROM %[4]s
+		WHERE %[1]s > $1::uuid AND %[2]s IS NOT NULL AND LEFT(%[2]s, length($2)) <> $2
+		ORDER BY %[1]s
+		LIMIT $3
+	`, col.id(), col.Value, budgetID, col.Table), cursor, col.currentPrefix(keyring), limit)
+	if err != nil {
+		return 0, err
+	}
+	type row struct{ id, value, budgetID string }
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.value, &r.budgetID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range batch {
+		var plaintext []byte
+		var err error
+		if col.MayBePlain && !utils.IsTaggedCiphertext(r.value) {
+			// Ancien chiffré sans key id, ou enregistrée avant le
+			// chiffrement : chiffrée telle quelle
+			plaintext = legacyCredential(r.value)
+			if string(plaintext) == r.value {
+				progress.Plaintext++
+			}
+		} else {
+			plaintext, err = keyring.Decrypt(r.value)
+		}
+		switch {
+		case err != nil:
+			progress.Failed++
+			res.Failures = append(res.Failures, ReencryptFailure{Column: col.Name, ID: r.id, Reason: err.Error()})
+		case dryRun:
+			progress.Reencrypted++
+		default:
+			var encrypted string
+			if col.Budget != "" {
+				encrypted, err = encryptBudgetData(ctx, s.db, r.budgetID, plaintext)
+			} else {
+				encrypted, err = keyring.Encrypt(plaintext)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return len(batch), err
+				}
+				progress.Failed++
+				res.Failures = append(res.Failures, ReencryptFailure{Column: col.Name, ID: r.id, Reason: "encrypt: " + err.Error()})
+				break
+			}
+			result, err := s.dbFor(col).ExecContext(ctx, fmt.Sprintf(`
+				UPDATE %s SET %s WHERE %s = $1::uuid AND %s = $3
+			`, col.Table, col.Set, col.id(), col.Value), r.id, encrypted, r.value)
+			if err != nil {
+				if ctx.Err() != nil {
+					return len(batch), err
+				}
+				progress.Failed++
+				res.Failures = append(res.Failures, ReencryptFailure{Column: col.Name, ID: r.id, Reason: "update: " + err.Error()})
+			} else if n, _ := result.RowsAffected(); n == 0 {
+				progress.Conflicts++
+			} else {
+				progress.Reencrypted++
+			}
+		}
+		progress.Scanned++
+		progress.Cursor = r.id
+	}
+	return len(batch), nil
+}
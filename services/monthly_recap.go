@@ -427,6 +427,9 @@ type budgetCharge struct {
 	Amount    float64 `json:"amount"`
 	StartDate string  `json:"startDate,omitempty"`
 	EndDate   string  `json:"endDate,omitempty"`
+	// Optional debit day (1-31), used by bank reconciliation. When absent the
+	// day is learned from confirmed matches.
+	DayOfMonth int `json:"dayOfMonth,omitempty"`
 }
 
 type budgetProject struct {
@@ -0,0 +1,591 @@
+// services/passkeys.go
+// ============================================================================
+// PASSKEYS — WebAuthn : enregistrement, connexion sans mot de passe, 2FA
+// ============================================================================
+// Un utilisateur peut enregistrer plusieurs passkeys (nommées, révocables).
+// Une passkey sert :
+//   - à se connecter sans mot de passe (credential découvrable, vérification
+//     de l'utilisateur exigée : PIN, biométrie) ;
+//   - de second facteur au login, à la place du code TOTP, quand la 2FA est
+//     activée ;
+//   - de step-up pour les actions sensibles (BeginStepUp / VerifyStepUp, voir
+//     middleware/second_factor.go).
+//
+// Chaque cérémonie (Begin*/Finish*) garde son challenge dans
+// webauthn_sessions, à usage unique, PasskeyCeremonyTTL au plus : le client
+// renvoie le session_id reçu au Begin avec la réponse de l'authentificateur.
+//
+// La partie de confiance (RP) vient de l'environnement :
+//   WEBAUTHN_RP_ID       domaine des passkeys (défaut : hôte de FRONTEND_URL)
+//   WEBAUTHN_RP_ORIGINS  origines autorisées, séparées par des virgules
+//                        (défaut : FRONTEND_URL)
+//   WEBAUTHN_RP_NAME     nom affiché (défaut "Budget Famille")
+// ============================================================================
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// PasskeyCeremonyTTL : durée de vie d'un challenge WebAuthn.
+const PasskeyCeremonyTTL = 5 * time.Minute
+
+// passkeyNameMaxLen : longueur max du nom donné à une passkey.
+const passkeyNameMaxLen = 100
+
+// Cérémonies stockées dans webauthn_sessions
+const (
+	passkeyPurposeRegister     = "register"
+	passkeyPurposeLogin        = "login"
+	passkeyPurposeSecondFactor = "second_factor"
+	passkeyPurposeStepUp       = "step_up"
+)
+
+var (
+	ErrPasskeysUnavailable = errors.New("passkeys are not configured")
+	ErrPasskeyNotFound     = errors.New("passkey not found")
+	ErrNoPasskeys          = errors.New("user has no passkey")
+	ErrPasskeyChallenge    = errors.New("passkey challenge expired or already used")
+	ErrPasskeyVerification = errors.New("passkey verification failed")
+	ErrInvalidPasskeyName  = errors.New("passkey name must be 1 to 100 characters")
+)
+
+// WebAuthnConfigFromEnv lit la configuration RP (voir l'en-tête).
+func WebAuthnConfigFromEnv() (*webauthn.Config, error) {
+	var origins []string
+	for _, o := range strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	if len(origins) == 0 {
+		frontendURL := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/")
+		if frontendURL == "" {
+			frontendURL = "http://localhost:3000"
+		}
+		origins = []string{frontendURL}
+	}
+
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		u, err := url.Parse(origins[0])
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("WEBAUTHN_RP_ID: cannot derive it from origin %q", origins[0])
+		}
+		rpID = u.Hostname()
+	}
+
+	name := os.Getenv("WEBAUTHN_RP_NAME")
+	if name == "" {
+		name = "Budget Famille"
+	}
+
+	return &webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: name,
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	}, nil
+}
+
+// userHandle : identifiant WebAuthn d'un utilisateur, les 16 octets de son
+// UUID (opaque, sans donnée personnelle).
+func userHandle(userID string) ([]byte, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+	return id[:], nil
+}
+
+func userIDFromHandle(handle []byte) (string, error) {
+	id, err := uuid.FromBytes(handle)
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// normalizePasskeyName : nom saisi par l'utilisateur, espaces rognés.
+func normalizePasskeyName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > passkeyNameMaxLen {
+		return "", ErrInvalidPasskeyName
+	}
+	return name, nil
+}
+
+// passkeyUser implémente webauthn.User.
+type passkeyUser struct {
+	handle      []byte
+	email       string
+	name        string
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return u.handle }
+func (u *passkeyUser) WebAuthnName() string                       { return u.email }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return u.name }
+func (u *passkeyUser) WebAuthnIcon() string                       { return "" }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// ============================================================================
+// SERVICE
+// ============================================================================
+
+type PasskeyService struct {
+	db        *sql.DB
+	wa        *webauthn.WebAuthn
+	configErr error
+}
+
+// NewPasskeyService lit la configuration RP ; si elle est invalide, chaque
+// appel renvoie ErrPasskeysUnavailable.
+func NewPasskeyService(db *sql.DB) *PasskeyService {
+	s := &PasskeyService{db: db}
+	cfg, err := WebAuthnConfigFromEnv()
+	if err == nil {
+		s.wa, err = webauthn.New(cfg)
+	}
+	if err != nil {
+		utils.SafeWarn("⚠️ Passkeys disabled: %v", err)
+		s.configErr = err
+	}
+	return s
+}
+
+func (s *PasskeyService) ready() error {
+	if s.configErr != nil {
+		return fmt.Errorf("%w: %v", ErrPasskeysUnavailable, s.configErr)
+	}
+	return nil
+}
+
+// loadUser charge l'utilisateur et ses passkeys.
+func (s *PasskeyService) loadUser(ctx context.Context, userID string) (*passkeyUser, error) {
+	handle, err := userHandle(userID)
+	if err != nil {
+		return nil, err
+	}
+	u := &passkeyUser{handle: handle}
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT email, name FROM users WHERE id = $1
+	`, userID).Scan(&u.email, &u.name); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT credential_id, public_key, COALESCE(attestation_type, ''), COALESCE(transports, ''),
+		       aaguid, sign_count, backup_eligible, backup_state
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cred webauthn.Credential
+		var credentialID, transports string
+		var signCount int64
+		if err := rows.Scan(&credentialID, &cred.PublicKey, &cred.AttestationType, &transports,
+			&cred.Authenticator.AAGUID, &signCount, &cred.Flags.BackupEligible, &cred.Flags.BackupState); err != nil {
+			return nil, err
+		}
+		if cred.ID, err = base64.RawURLEncoding.DecodeString(credentialID); err != nil {
+			return nil, fmt.Errorf("stored passkey id: %w", err)
+		}
+		cred.Authenticator.SignCount = uint32(signCount)
+		for _, t := range strings.Split(transports, ",") {
+			if t != "" {
+				cred.Transport = append(cred.Transport, protocol.AuthenticatorTransport(t))
+			}
+		}
+		u.credentials = append(u.credentials, cred)
+	}
+	return u, rows.Err()
+}
+
+// saveSession garde le challenge d'une cérémonie et renvoie son id.
+func (s *PasskeyService) saveSession(ctx context.Context, userID, purpose, name string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO webauthn_sessions (user_id, purpose, passkey_name, session_data, expires_at)
+		VALUES (NULLIF($1, '')::uuid, $2, NULLIF($3, ''), $4, $5)
+		RETURNING id
+	`, userID, purpose, name, string(data), time.Now().Add(PasskeyCeremonyTTL)).Scan(&id)
+	if err != nil {
+		return "", fmt.Errorf("save passkey challenge: %w", err)
+	}
+	return id, nil
+}
+
+// takeSession consomme un challenge (usage unique) ; renvoie l'utilisateur
+// et le nom de passkey enregistrés au Begin.
+func (s *PasskeyService) takeSession(ctx context.Context, sessionID, purpose string) (string, string, webauthn.SessionData, error) {
+	var session webauthn.SessionData
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return "", "", session, ErrPasskeyChallenge
+	}
+
+	var userID, name, data string
+	err := s.db.QueryRowContext(ctx, `
+		DELETE FROM webauthn_sessions
+		WHERE id = $1 AND purpose = $2 AND expires_at > NOW()
+		RETURNING COALESCE(user_id::text, ''), COALESCE(passkey_name, ''), session_data
+	`, sessionID, purpose).Scan(&userID, &name, &data)
+	if err == sql.ErrNoRows {
+		return "", "", session, ErrPasskeyChallenge
+	}
+	if err != nil {
+		return "", "", session, err
+	}
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return "", "", session, err
+	}
+	return userID, name, session, nil
+}
+
+// ============================================================================
+// ENREGISTREMENT ET GESTION
+// ============================================================================
+
+// BeginRegistration prépare l'ajout d'une passkey nommée name.
+func (s *PasskeyService) BeginRegistration(ctx context.Context, userID, name string) (*protocol.CredentialCreation, string, error) {
+	if err := s.ready(); err != nil {
+		return nil, "", err
+	}
+	name, err := normalizePasskeyName(name)
+	if err != nil {
+		return nil, "", err
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Pas deux fois le même authentificateur
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, cred := range user.credentials {
+		exclusions = append(exclusions, cred.Descriptor())
+	}
+
+	creation, session, err := s.wa.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, "", err
+	}
+	sessionID, err := s.saveSession(ctx, userID, passkeyPurposeRegister, name, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, sessionID, nil
+}
+
+// FinishRegistration vérifie la réponse de navigator.credentials.create()
+// et enregistre la passkey.
+func (s *PasskeyService) FinishRegistration(ctx context.Context, userID, sessionID string, credential []byte) (*models.Passkey, error) {
+	if err := s.ready(); err != nil {
+		return nil, err
+	}
+	owner, name, session, err := s.takeSession(ctx, sessionID, passkeyPurposeRegister)
+	if err != nil {
+		return nil, err
+	}
+	if owner != userID {
+		return nil, ErrPasskeyChallenge
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(credential))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyVerification, err)
+	}
+	cred, err := s.wa.CreateCredential(user, session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyVerification, err)
+	}
+
+	transports := make([]string, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+
+	passkey := &models.Passkey{Name: name}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO webauthn_credentials (
+			user_id, credential_id, public_key, attestation_type, transports,
+			aaguid, sign_count, backup_eligible, backup_state, name
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at
+	`, userID, base64.RawURLEncoding.EncodeToString(cred.ID), cred.PublicKey, cred.AttestationType,
+		strings.Join(transports, ","), cred.Authenticator.AAGUID, int64(cred.Authenticator.SignCount),
+		cred.Flags.BackupEligible, cred.Flags.BackupState, name,
+	).Scan(&passkey.ID, &passkey.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("save passkey: %w", err)
+	}
+	passkey.Synced = cred.Flags.BackupState
+	return passkey, nil
+}
+
+// List renvoie les passkeys de l'utilisateur, les plus anciennes d'abord.
+func (s *PasskeyService) List(ctx context.Context, userID string) ([]models.Passkey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, backup_state, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []models.Passkey{}
+	for rows.Next() {
+		var p models.Passkey
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&p.ID, &p.Name, &p.Synced, &p.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			p.LastUsedAt = &lastUsed.Time
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+// Rename change le nom d'une passkey de l'utilisateur.
+func (s *PasskeyService) Rename(ctx context.Context, userID, passkeyID, name string) error {
+	name, err := normalizePasskeyName(name)
+	if err != nil {
+		return err
+	}
+	return s.expectOne(s.db.ExecContext(ctx, `
+		UPDATE webauthn_credentials SET name = $3
+		WHERE id::text = $1 AND user_id = $2
+	`, passkeyID, userID, name))
+}
+
+// Delete révoque une passkey de l'utilisateur.
+func (s *PasskeyService) Delete(ctx context.Context, userID, passkeyID string) error {
+	return s.expectOne(s.db.ExecContext(ctx, `
+		DELETE FROM webauthn_credentials WHERE id::text = $1 AND user_id = $2
+	`, passkeyID, userID))
+}
+
+func (s *PasskeyService) expectOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// ============================================================================
+// CONNEXION
+// ============================================================================
+
+// BeginLogin prépare une connexion sans mot de passe : le navigateur propose
+// les passkeys du site, l'utilisateur se vérifie sur l'appareil.
+func (s *PasskeyService) BeginLogin(ctx context.Context) (*protocol.CredentialAssertion, string, error) {
+	if err := s.ready(); err != nil {
+		return nil, "", err
+	}
+	assertion, session, err := s.wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+	sessionID, err := s.saveSession(ctx, "", passkeyPurposeLogin, "", session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, sessionID, nil
+}
+
+// FinishLogin vérifie l'assertion et renvoie l'utilisateur authentifié.
+func (s *PasskeyService) FinishLogin(ctx context.Context, sessionID string, credential []byte) (string, error) {
+	if err := s.ready(); err != nil {
+		return "", err
+	}
+	_, _, session, err := s.takeSession(ctx, sessionID, passkeyPurposeLogin)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(credential))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrPasskeyVerification, err)
+	}
+
+	var userID string
+	cred, err := s.wa.ValidateDiscoverableLogin(func(_, handle []byte) (webauthn.User, error) {
+		id, err := userIDFromHandle(handle)
+		if err != nil {
+			return nil, err
+		}
+		userID = id
+		return s.loadUser(ctx, id)
+	}, session, parsed)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrPasskeyVerification, err)
+	}
+	if err := s.recordUse(ctx, userID, cred); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+// BeginSecondFactor prépare la vérification par passkey après le mot de
+// passe ; ErrNoPasskeys si l'utilisateur n'en a pas.
+func (s *PasskeyService) BeginSecondFactor(ctx context.Context, userID string) (*protocol.CredentialAssertion, string, error) {
+	if err := s.ready(); err != nil {
+		return nil, "", err
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(user.credentials) == 0 {
+		return nil, "", ErrNoPasskeys
+	}
+	assertion, session, err := s.wa.BeginLogin(user)
+	if err != nil {
+		return nil, "", err
+	}
+	sessionID, err := s.saveSession(ctx, userID, passkeyPurposeSecondFactor, "", session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, sessionID, nil
+}
+
+// FinishSecondFactor vérifie l'assertion et renvoie l'utilisateur dont le
+// mot de passe a été vérifié au BeginSecondFactor.
+func (s *PasskeyService) FinishSecondFactor(ctx context.Context, sessionID string, credential []byte) (string, error) {
+	if err := s.ready(); err != nil {
+		return "", err
+	}
+	userID, _, session, err := s.takeSession(ctx, sessionID, passkeyPurposeSecondFactor)
+	if err != nil {
+		return "", err
+	}
+	if err := s.validateUserAssertion(ctx, userID, session, credential); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+// BeginStepUp prépare la confirmation d'une action sensible par passkey ;
+// ErrNoPasskeys si l'utilisateur n'en a pas.
+func (s *PasskeyService) BeginStepUp(ctx context.Context, userID string) (*protocol.CredentialAssertion, string, error) {
+	if err := s.ready(); err != nil {
+		return nil, "", err
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(user.credentials) == 0 {
+		return nil, "", ErrNoPasskeys
+	}
+	assertion, session, err := s.wa.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+	sessionID, err := s.saveSession(ctx, userID, passkeyPurposeStepUp, "", session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, sessionID, nil
+}
+
+// VerifyStepUp vérifie l'assertion d'un BeginStepUp de userID. Le challenge
+// est consommé même en cas d'échec.
+func (s *PasskeyService) VerifyStepUp(ctx context.Context, userID, sessionID string, credential []byte) error {
+	if err := s.ready(); err != nil {
+		return err
+	}
+	owner, _, session, err := s.takeSession(ctx, sessionID, passkeyPurposeStepUp)
+	if err != nil {
+		return err
+	}
+	if owner != userID {
+		return ErrPasskeyChallenge
+	}
+	return s.validateUserAssertion(ctx, userID, session, credential)
+}
+
+// validateUserAssertion vérifie une assertion pour un utilisateur connu et
+// enregistre l'usage de la passkey.
+func (s *PasskeyService) validateUserAssertion(ctx context.Context, userID string, session webauthn.SessionData, credential []byte) error {
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(credential))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPasskeyVerification, err)
+	}
+	cred, err := s.wa.ValidateLogin(user, session, parsed)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPasskeyVerification, err)
+	}
+	return s.recordUse(ctx, userID, cred)
+}
+
+// recordUse met à jour compteur et date d'usage. Un compteur qui recule
+// signale un authentificateur cloné : la connexion est refusée.
+func (s *PasskeyService) recordUse(ctx context.Context, userID string, cred *webauthn.Credential) error {
+	if cred.Authenticator.CloneWarning {
+		utils.SafeWarn("⚠️ Passkey sign counter went backwards for user %s, possible clone", userID)
+		return fmt.Errorf("%w: sign counter went backwards", ErrPasskeyVerification)
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE webauthn_credentials
+		SET sign_count = $3, backup_state = $4, last_used_at = NOW()
+		WHERE credential_id = $1 AND user_id = $2
+	`, base64.RawURLEncoding.EncodeToString(cred.ID), userID, int64(cred.Authenticator.SignCount), cred.Flags.BackupState)
+	return err
+}
+
+// PruneWebAuthnSessions supprime les challenges expirés (nettoyage quotidien).
+func PruneWebAuthnSessions(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM webauthn_sessions WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,513 @@
+// services/passkeys_test.go
+// ============================================================================
+// TESTS — configuration WebAuthn, helpers et cérémonies des passkeys
+// ============================================================================
+// Les cérémonies tournent contre un faux authentificateur (clé P-256,
+// attestation "none") et une base sqlmock.
+//
+// Lancer : go test ./services -run 'WebAuthn|Passkey|UserHandle' -v
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+func TestWebAuthnConfigFromEnv(t *testing.T) {
+	t.Run("defaults from FRONTEND_URL", func(t *testing.T) {
+		t.Setenv("WEBAUTHN_RP_ID", "")
+		t.Setenv("WEBAUTHN_RP_ORIGINS", "")
+		t.Setenv("WEBAUTHN_RP_NAME", "")
+		t.Setenv("FRONTEND_URL", "https://www.budgetfamille.com/")
+
+		cfg, err := WebAuthnConfigFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.RPID != "www.budgetfamille.com" {
+			t.Errorf("RPID = %q", cfg.RPID)
+		}
+		if !reflect.DeepEqual(cfg.RPOrigins, []string{"https://www.budgetfamille.com"}) {
+			t.Errorf("RPOrigins = %v", cfg.RPOrigins)
+		}
+		if cfg.RPDisplayName != "Budget Famille" {
+			t.Errorf("RPDisplayName = %q", cfg.RPDisplayName)
+		}
+	})
+
+	t.Run("explicit values", func(t *testing.T) {
+		t.Setenv("WEBAUTHN_RP_ID", "budgetfamille.com")
+		t.Setenv("WEBAUTHN_RP_ORIGINS", "https://budgetfamille.com, https://www.budgetfamille.com")
+		t.Setenv("WEBAUTHN_RP_NAME", "Budget")
+
+		cfg, err := WebAuthnConfigFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"https://budgetfamille.com", "https://www.budgetfamille.com"}
+		if cfg.RPID != "budgetfamille.com" || !reflect.DeepEqual(cfg.RPOrigins, want) || cfg.RPDisplayName != "Budget" {
+			t.Errorf("config = %q %v %q", cfg.RPID, cfg.RPOrigins, cfg.RPDisplayName)
+		}
+	})
+
+	t.Run("origin without host", func(t *testing.T) {
+		t.Setenv("WEBAUTHN_RP_ID", "")
+		t.Setenv("WEBAUTHN_RP_ORIGINS", "not-a-url")
+
+		if _, err := WebAuthnConfigFromEnv(); err == nil {
+			t.Error("expected an error when the RP id cannot be derived")
+		}
+	})
+}
+
+func TestUserHandleRoundTrip(t *testing.T) {
+	const userID = "3f2b8c1e-5d4a-4b6f-9c1e-2a7d8e9f0a1b"
+	handle, err := userHandle(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handle) != 16 {
+		t.Fatalf("handle is %d bytes, want 16", len(handle))
+	}
+	got, err := userIDFromHandle(handle)
+	if err != nil || got != userID {
+		t.Errorf("userIDFromHandle = %q, %v", got, err)
+	}
+
+	if _, err := userHandle("not-a-uuid"); err == nil {
+		t.Error("invalid user id accepted")
+	}
+	if _, err := userIDFromHandle([]byte("short")); err == nil {
+		t.Error("short handle accepted")
+	}
+}
+
+func TestNormalizePasskeyName(t *testing.T) {
+	if got, err := normalizePasskeyName("  iPhone de Léa "); err != nil || got != "iPhone de Léa" {
+		t.Errorf("normalize = %q, %v", got, err)
+	}
+	for _, name := range []string{"", "   ", strings.Repeat("é", passkeyNameMaxLen+1)} {
+		if _, err := normalizePasskeyName(name); !errors.Is(err, ErrInvalidPasskeyName) {
+			t.Errorf("normalize(%d chars) err = %v", len([]rune(name)), err)
+		}
+	}
+	if _, err := normalizePasskeyName(strings.Repeat("é", passkeyNameMaxLen)); err != nil {
+		t.Errorf("name of %d characters rejected: %v", passkeyNameMaxLen, err)
+	}
+}
+
+// ============================================================================
+// CÉRÉMONIES
+// ============================================================================
+
+const (
+	testPasskeyRPID   = "budgetfamille.com"
+	testPasskeyOrigin = "https://budgetfamille.com"
+	testPasskeyUser   = "3f2b8c1e-5d4a-4b6f-9c1e-2a7d8e9f0a1b"
+)
+
+// Drapeaux des données d'authentificateur
+const (
+	authFlagUserPresent  = 0x01
+	authFlagUserVerified = 0x04
+	authFlagAttestedData = 0x40
+)
+
+// fakeAuthenticator joue le rôle de navigator.credentials : une clé P-256,
+// un compteur de signatures et le user handle du compte.
+type fakeAuthenticator struct {
+	key     *ecdsa.PrivateKey
+	id      []byte
+	handle  []byte
+	counter uint32
+}
+
+func newFakeAuthenticator(t *testing.T) *fakeAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	handle, err := userHandle(testPasskeyUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeAuthenticator{key: key, id: id, handle: handle}
+}
+
+// publicKey : clé publique au format COSE, telle que stockée en base.
+func (a *fakeAuthenticator) publicKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func (a *fakeAuthenticator) authData(t *testing.T, flags byte) []byte {
+	t.Helper()
+	rpIDHash := sha256.Sum256([]byte(testPasskeyRPID))
+	data := append(rpIDHash[:], flags|authFlagUserPresent|authFlagUserVerified)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	if flags&authFlagAttestedData != 0 {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, a.publicKey(t)...)
+	}
+	return data
+}
+
+func clientDataJSON(t *testing.T, ceremony, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    testPasskeyOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// create : réponse de navigator.credentials.create() pour challenge.
+func (a *fakeAuthenticator) create(t *testing.T, challenge string) []byte {
+	t.Helper()
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(t, authFlagAttestedData),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    encodeB64(clientDataJSON(t, "webauthn.create", challenge)),
+		"attestationObject": encodeB64(attestation),
+	})
+}
+
+// get : réponse de navigator.credentials.get() pour challenge ; le compteur
+// avance à chaque signature.
+func (a *fakeAuthenticator) get(t *testing.T, challenge string) []byte {
+	t.Helper()
+	a.counter++
+	authData := a.authData(t, 0)
+	clientData := clientDataJSON(t, "webauthn.get", challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    encodeB64(clientData),
+		"authenticatorData": encodeB64(authData),
+		"signature":         encodeB64(signature),
+		"userHandle":        encodeB64(a.handle),
+	})
+}
+
+func (a *fakeAuthenticator) credential(t *testing.T, response map[string]string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       encodeB64(a.id),
+		"rawId":    encodeB64(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encodeB64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// capturedArg accepte n'importe quelle valeur et la garde (session_data
+// écrite au Begin, relue au Finish).
+type capturedArg struct{ value string }
+
+func (c *capturedArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	c.value = s
+	return ok
+}
+
+func newPasskeyMock(t *testing.T) (*PasskeyService, sqlmock.Sqlmock) {
+	t.Helper()
+	t.Setenv("WEBAUTHN_RP_ID", testPasskeyRPID)
+	t.Setenv("WEBAUTHN_RP_ORIGINS", testPasskeyOrigin)
+	t.Setenv("WEBAUTHN_RP_NAME", "")
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := NewPasskeyService(db)
+	if err := s.ready(); err != nil {
+		t.Fatal(err)
+	}
+	return s, mock
+}
+
+// expectLoadUser : loadUser avec les passkeys données, compteur signCount.
+func expectLoadUser(t *testing.T, mock sqlmock.Sqlmock, signCount int64, authenticators ...*fakeAuthenticator) {
+	t.Helper()
+	mock.ExpectQuery(`SELECT email, name FROM users`).
+		WithArgs(testPasskeyUser).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "name"}).AddRow("lea@example.com", "Léa"))
+	rows := sqlmock.NewRows([]string{"credential_id", "public_key", "attestation_type", "transports",
+		"aaguid", "sign_count", "backup_eligible", "backup_state"})
+	for _, a := range authenticators {
+		rows.AddRow(encodeB64(a.id), a.publicKey(t), "none", "internal", make([]byte, 16), signCount, false, false)
+	}
+	mock.ExpectQuery(`FROM webauthn_credentials`).WithArgs(testPasskeyUser).WillReturnRows(rows)
+}
+
+// expectSaveSession attend l'écriture d'un challenge et garde son contenu.
+func expectSaveSession(mock sqlmock.Sqlmock, userID, purpose, sessionID string) *capturedArg {
+	data := &capturedArg{}
+	mock.ExpectQuery(`INSERT INTO webauthn_sessions`).
+		WithArgs(userID, purpose, sqlmock.AnyArg(), data, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(sessionID))
+	return data
+}
+
+func expectTakeSession(mock sqlmock.Sqlmock, sessionID, purpose, userID, name, data string) {
+	mock.ExpectQuery(`DELETE FROM webauthn_sessions`).
+		WithArgs(sessionID, purpose).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "passkey_name", "session_data"}).AddRow(userID, name, data))
+}
+
+func expectRecordUse(mock sqlmock.Sqlmock, a *fakeAuthenticator) {
+	mock.ExpectExec(`UPDATE webauthn_credentials\s+SET sign_count`).
+		WithArgs(encodeB64(a.id), testPasskeyUser, int64(a.counter), false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+const testPasskeySession = "9d1c7a52-0b7e-4c1f-8e2a-5f3b6d4c2e10"
+
+func TestPasskeyRegistration(t *testing.T) {
+	s, mock := newPasskeyMock(t)
+	ctx := context.Background()
+	a := newFakeAuthenticator(t)
+
+	expectLoadUser(t, mock, 0)
+	session := expectSaveSession(mock, testPasskeyUser, passkeyPurposeRegister, testPasskeySession)
+	creation, sessionID, err := s.BeginRegistration(ctx, testPasskeyUser, " iPhone ")
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	if sessionID != testPasskeySession {
+		t.Errorf("session id = %q", sessionID)
+	}
+
+	expectTakeSession(mock, testPasskeySession, passkeyPurposeRegister, testPasskeyUser, "iPhone", session.value)
+	expectLoadUser(t, mock, 0)
+	mock.ExpectQuery(`INSERT INTO webauthn_credentials`).
+		WithArgs(testPasskeyUser, encodeB64(a.id), a.publicKey(t), "none", "", make([]byte, 16), int64(0), false, false, "iPhone").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("passkey-1", time.Now()))
+
+	passkey, err := s.FinishRegistration(ctx, testPasskeyUser, sessionID, a.create(t, creation.Response.Challenge.String()))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if passkey.ID != "passkey-1" || passkey.Name != "iPhone" {
+		t.Errorf("passkey = %+v", passkey)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasskeyRegistrationOtherUser(t *testing.T) {
+	s, mock := newPasskeyMock(t)
+	a := newFakeAuthenticator(t)
+
+	// Challenge ouvert par un autre compte : refusé avant toute vérification
+	expectTakeSession(mock, testPasskeySession, passkeyPurposeRegister, "a0000000-0000-4000-8000-000000000000", "iPhone", "{}")
+	_, err := s.FinishRegistration(context.Background(), testPasskeyUser, testPasskeySession, a.create(t, "challenge"))
+	if !errors.Is(err, ErrPasskeyChallenge) {
+		t.Fatalf("FinishRegistration = %v, want ErrPasskeyChallenge", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasskeyDiscoverableLogin(t *testing.T) {
+	s, mock := newPasskeyMock(t)
+	ctx := context.Background()
+	a := newFakeAuthenticator(t)
+
+	session := expectSaveSession(mock, "", passkeyPurposeLogin, testPasskeySession)
+	assertion, sessionID, err := s.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if len(assertion.Response.AllowedCredentials) != 0 {
+		t.Error("discoverable login must not list credentials")
+	}
+
+	expectTakeSession(mock, testPasskeySession, passkeyPurposeLogin, "", "", session.value)
+	expectLoadUser(t, mock, 0, a)
+	credential := a.get(t, assertion.Response.Challenge.String())
+	expectRecordUse(mock, a)
+
+	userID, err := s.FinishLogin(ctx, sessionID, credential)
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if userID != testPasskeyUser {
+		t.Errorf("user = %q, want %q", userID, testPasskeyUser)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasskeySecondFactor(t *testing.T) {
+	s, mock := newPasskeyMock(t)
+	ctx := context.Background()
+	a := newFakeAuthenticator(t)
+
+	expectLoadUser(t, mock, 0, a)
+	session := expectSaveSession(mock, testPasskeyUser, passkeyPurposeSecondFactor, testPasskeySession)
+	assertion, sessionID, err := s.BeginSecondFactor(ctx, testPasskeyUser)
+	if err != nil {
+		t.Fatalf("BeginSecondFactor: %v", err)
+	}
+
+	expectTakeSession(mock, testPasskeySession, passkeyPurposeSecondFactor, testPasskeyUser, "", session.value)
+	expectLoadUser(t, mock, 0, a)
+	credential := a.get(t, assertion.Response.Challenge.String())
+	expectRecordUse(mock, a)
+
+	userID, err := s.FinishSecondFactor(ctx, sessionID, credential)
+	if err != nil || userID != testPasskeyUser {
+		t.Fatalf("FinishSecondFactor = %q, %v", userID, err)
+	}
+
+	// Sans passkey, pas de challenge
+	expectLoadUser(t, mock, 0)
+	if _, _, err := s.BeginSecondFactor(ctx, testPasskeyUser); !errors.Is(err, ErrNoPasskeys) {
+		t.Errorf("BeginSecondFactor without passkey = %v, want ErrNoPasskeys", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasskeyStepUpOtherUser(t *testing.T) {
+	s, mock := newPasskeyMock(t)
+	a := newFakeAuthenticator(t)
+
+	// Un challenge de step-up ne vaut que pour le compte qui l'a ouvert
+	expectTakeSession(mock, testPasskeySession, passkeyPurposeStepUp, "a0000000-0000-4000-8000-000000000000", "", "{}")
+	err := s.VerifyStepUp(context.Background(), testPasskeyUser, testPasskeySession, a.get(t, "challenge"))
+	if !errors.Is(err, ErrPasskeyChallenge) {
+		t.Fatalf("VerifyStepUp = %v, want ErrPasskeyChallenge", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasskeyChallengeSingleUse(t *testing.T) {
+	s, mock := newPasskeyMock(t)
+	ctx := context.Background()
+	a := newFakeAuthenticator(t)
+
+	expectLoadUser(t, mock, 0, a)
+	session := expectSaveSession(mock, testPasskeyUser, passkeyPurposeStepUp, testPasskeySession)
+	assertion, sessionID, err := s.BeginStepUp(ctx, testPasskeyUser)
+	if err != nil {
+		t.Fatalf("BeginStepUp: %v", err)
+	}
+	credential := a.get(t, assertion.Response.Challenge.String())
+
+	expectTakeSession(mock, testPasskeySession, passkeyPurposeStepUp, testPasskeyUser, "", session.value)
+	expectLoadUser(t, mock, 0, a)
+	expectRecordUse(mock, a)
+	if err := s.VerifyStepUp(ctx, testPasskeyUser, sessionID, credential); err != nil {
+		t.Fatalf("VerifyStepUp: %v", err)
+	}
+
+	// Le DELETE … RETURNING a consommé le challenge : le rejeu ne trouve rien
+	mock.ExpectQuery(`DELETE FROM webauthn_sessions`).
+		WithArgs(testPasskeySession, passkeyPurposeStepUp).
+		WillReturnError(sql.ErrNoRows)
+	if err := s.VerifyStepUp(ctx, testPasskeyUser, sessionID, credential); !errors.Is(err, ErrPasskeyChallenge) {
+		t.Errorf("replayed VerifyStepUp = %v, want ErrPasskeyChallenge", err)
+	}
+
+	// Id qui n'est pas un UUID : refusé sans requête
+	if err := s.VerifyStepUp(ctx, testPasskeyUser, "not-a-session", credential); !errors.Is(err, ErrPasskeyChallenge) {
+		t.Errorf("VerifyStepUp with a malformed id = %v, want ErrPasskeyChallenge", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasskeyCloneWarning(t *testing.T) {
+	s, mock := newPasskeyMock(t)
+	ctx := context.Background()
+	a := newFakeAuthenticator(t)
+
+	expectLoadUser(t, mock, 5, a)
+	session := expectSaveSession(mock, testPasskeyUser, passkeyPurposeSecondFactor, testPasskeySession)
+	assertion, sessionID, err := s.BeginSecondFactor(ctx, testPasskeyUser)
+	if err != nil {
+		t.Fatalf("BeginSecondFactor: %v", err)
+	}
+
+	// Compteur en base à 5, l'authentificateur signe avec 3 : copie probable.
+	// Pas de mise à jour du compteur attendue.
+	a.counter = 2
+	credential := a.get(t, assertion.Response.Challenge.String())
+	expectTakeSession(mock, testPasskeySession, passkeyPurposeSecondFactor, testPasskeyUser, "", session.value)
+	expectLoadUser(t, mock, 5, a)
+
+	userID, err := s.FinishSecondFactor(ctx, sessionID, credential)
+	if !errors.Is(err, ErrPasskeyVerification) || userID != "" {
+		t.Fatalf("FinishSecondFactor with a cloned authenticator = %q, %v, want ErrPasskeyVerification", userID, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,487 @@
+// services/recurring_charges.go
+// ============================================================================
+// RECURRING CHARGES — détection des débits périodiques dans le ledger
+// ============================================================================
+// Les débits des comptes que l'utilisateur a connectés au budget sont
+// regroupés par bénéficiaire (mots utiles du libellé bancaire, sans les noms
+// de mois) puis par montant (même tolérance que la réconciliation). Un groupe
+// est récurrent quand l'écart médian entre deux débits tombe dans une
+// fréquence connue (mensuelle, trimestrielle, annuelle), que les écarts sont
+// réguliers et que le dernier débit n'est pas trop ancien (abonnement résilié).
+//
+// Chaque proposition est catégorisée par CategorizerService.GetCategory et
+// marquée already_in_budget quand une charge du budget lui correspond déjà.
+// L'import ajoute les propositions choisies à budget_data.charges via
+// PatchData : montant ramené au mois, startDate = premier débit observé.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/LovationAdmin/budget-api/models"
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// Fréquences des charges détectées
+const (
+	FrequencyMonthly   = "monthly"
+	FrequencyQuarterly = "quarterly"
+	FrequencyYearly    = "yearly"
+)
+
+type recurringFrequency struct {
+	Name           string
+	MinDays        float64
+	MaxDays        float64
+	MinOccurrences int
+	Months         int
+}
+
+var recurringFrequencies = []recurringFrequency{
+	{FrequencyMonthly, 25, 36, 3, 1},
+	{FrequencyQuarterly, 82, 99, 2, 3},
+	{FrequencyYearly, 350, 380, 2, 12},
+}
+
+const (
+	recurringHistory      = 400 * 24 * time.Hour // couvre deux échéances annuelles
+	recurringStaleGrace   = 10                   // jours de retard tolérés après l'échéance attendue
+	recurringMerchantSize = 3                    // mots retenus pour identifier le bénéficiaire
+)
+
+// recurringMonthTokens changent d'un mois à l'autre dans les libellés
+// ("LOYER MARS", "FACTURE JANVIER") et ne doivent pas séparer les débits.
+var recurringMonthTokens = map[string]bool{
+	"janvier": true, "janv": true, "jan": true, "fevrier": true, "fevr": true, "fev": true,
+	"mars": true, "avril": true, "avr": true, "mai": true, "juin": true, "juillet": true,
+	"juil": true, "aout": true, "septembre": true, "sept": true, "sep": true,
+	"octobre": true, "oct": true, "novembre": true, "nov": true, "decembre": true, "dec": true,
+	"january": true, "february": true, "feb": true, "march": true, "mar": true, "april": true,
+	"apr": true, "may": true, "june": true, "jun": true, "july": true, "jul": true,
+	"august": true, "aug": true, "september": true, "october": true, "november": true,
+	"december": true,
+}
+
+type RecurringChargeService struct {
+	db          *sql.DB
+	budget      *BudgetService
+	categorizer *CategorizerService
+}
+
+func NewRecurringChargeService(db *sql.DB, budget *BudgetService, categorizer *CategorizerService) *RecurringChargeService {
+	return &RecurringChargeService{db: db, budget: budget, categorizer: categorizer}
+}
+
+// ----------------------------------------------------------------------------
+// DÉTECTION (pur)
+// ----------------------------------------------------------------------------
+
+type historyTx struct {
+	ID          string
+	Date        time.Time
+	Amount      float64 // signé, débit < 0
+	Currency    string
+	Description string
+}
+
+type recurringCandidate struct {
+	Key          string
+	Merchant     string
+	Label        string
+	Frequency    recurringFrequency
+	Amount       float64
+	Currency     string
+	DayOfMonth   int
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	Confidence   float64
+	Transactions []string
+}
+
+// MonthlyAmount est le montant de la charge importée (les charges du budget
+// sont mensuelles).
+func (c recurringCandidate) MonthlyAmount() float64 {
+	return math.Round(c.Amount/float64(c.Frequency.Months)*100) / 100
+}
+
+// merchantKey garde les premiers mots utiles du libellé bancaire.
+func merchantKey(description string) string {
+	var tokens []string
+	for _, t := range labelTokens(description) {
+		if recurringMonthTokens[t] {
+			continue
+		}
+		tokens = append(tokens, t)
+		if len(tokens) == recurringMerchantSize {
+			break
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+func merchantLabel(key string) string {
+	words := strings.Fields(key)
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// clusterByAmount sépare les débits d'un même bénéficiaire par montant (deux
+// abonnements chez le même marchand), chaque groupe restant trié par date.
+func clusterByAmount(txs []historyTx) [][]historyTx {
+	sorted := append([]historyTx(nil), txs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return math.Abs(sorted[i].Amount) < math.Abs(sorted[j].Amount)
+	})
+
+	var clusters [][]historyTx
+	for _, tx := range sorted {
+		n := len(clusters)
+		if n > 0 && amountWithinTolerance(clusters[n-1][0].Amount, tx.Amount) {
+			clusters[n-1] = append(clusters[n-1], tx)
+			continue
+		}
+		clusters = append(clusters, []historyTx{tx})
+	}
+
+	for _, cl := range clusters {
+		sort.SliceStable(cl, func(i, j int) bool { return cl[i].Date.Before(cl[j].Date) })
+	}
+	return clusters
+}
+
+func medianFloat(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// periodicCandidate décide si des débits triés par date forment une charge
+// récurrente encore en cours à now.
+func periodicCandidate(merchant string, txs []historyTx, now time.Time) (recurringCandidate, bool) {
+	if len(txs) < 2 {
+		return recurringCandidate{}, false
+	}
+
+	intervals := make([]float64, 0, len(txs)-1)
+	for i := 1; i < len(txs); i++ {
+		intervals = append(intervals, txs[i].Date.Sub(txs[i-1].Date).Hours()/24)
+	}
+	median := medianFloat(intervals)
+
+	var freq recurringFrequency
+	found := false
+	for _, f := range recurringFrequencies {
+		if median >= f.MinDays && median <= f.MaxDays {
+			freq, found = f, true
+			break
+		}
+	}
+	if !found || len(txs) < freq.MinOccurrences {
+		return recurringCandidate{}, false
+	}
+
+	// Un écart hors fréquence toléré pour quatre. Un débit décalé produit
+	// deux écarts (long puis court) dont la somme fait deux périodes : il ne
+	// compte qu'une fois.
+	inRange := func(d float64, periods float64) bool {
+		return d >= freq.MinDays*periods && d <= freq.MaxDays*periods
+	}
+	irregular := 0
+	for i := 0; i < len(intervals); i++ {
+		if inRange(intervals[i], 1) {
+			continue
+		}
+		irregular++
+		if i+1 < len(intervals) && !inRange(intervals[i+1], 1) && inRange(intervals[i]+intervals[i+1], 2) {
+			i++
+		}
+	}
+	if irregular > len(intervals)/4 {
+		return recurringCandidate{}, false
+	}
+
+	last := txs[len(txs)-1]
+	if now.Sub(last.Date).Hours()/24 > freq.MaxDays+recurringStaleGrace {
+		return recurringCandidate{}, false
+	}
+
+	amounts := make([]float64, len(txs))
+	days := make([]int, len(txs))
+	ids := make([]string, len(txs))
+	minAmount, maxAmount := math.Inf(1), 0.0
+	for i, tx := range txs {
+		a := math.Abs(tx.Amount)
+		amounts[i] = a
+		days[i] = tx.Date.Day()
+		ids[i] = tx.ID
+		minAmount = math.Min(minAmount, a)
+		maxAmount = math.Max(maxAmount, a)
+	}
+	amount := math.Round(medianFloat(amounts)*100) / 100
+
+	// Confiance : nombre d'échéances, régularité des écarts, stabilité du montant
+	volume := math.Min(1, float64(len(txs))/float64(freq.MinOccurrences+2))
+	regularity := 1 - float64(irregular)/float64(len(intervals))
+	stability := 1 - math.Min(1, (maxAmount-minAmount)/(2*amountTolerance(amount)))
+	confidence := math.Round((0.5*volume+0.25*regularity+0.25*stability)*100) / 100
+
+	c := recurringCandidate{
+		Key:          fmt.Sprintf("%s|%s|%.0f", merchant, freq.Name, math.Round(amount)),
+		Merchant:     merchant,
+		Label:        merchantLabel(merchant),
+		Frequency:    freq,
+		Amount:       amount,
+		Currency:     last.Currency,
+		FirstSeen:    txs[0].Date,
+		LastSeen:     last.Date,
+		Confidence:   confidence,
+		Transactions: ids,
+	}
+	if freq.Name == FrequencyMonthly {
+		c.DayOfMonth = medianDay(days)
+	}
+	return c, true
+}
+
+// detectRecurring renvoie les charges récurrentes des débits de txs, plus
+// gros montants mensuels d'abord.
+func detectRecurring(txs []historyTx, now time.Time) []recurringCandidate {
+	groups := map[string][]historyTx{}
+	for _, tx := range txs {
+		if tx.Amount >= 0 {
+			continue
+		}
+		if key := merchantKey(tx.Description); key != "" {
+			groups[key] = append(groups[key], tx)
+		}
+	}
+
+	merchants := make([]string, 0, len(groups))
+	for m := range groups {
+		merchants = append(merchants, m)
+	}
+	sort.Strings(merchants)
+
+	var candidates []recurringCandidate
+	for _, m := range merchants {
+		for _, cluster := range clusterByAmount(groups[m]) {
+			if c, ok := periodicCandidate(m, cluster, now); ok {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].MonthlyAmount() > candidates[j].MonthlyAmount()
+	})
+	return candidates
+}
+
+// existingChargeFor renvoie l'id de la charge du budget qui couvre déjà la
+// proposition : libellé contenant tout le bénéficiaire, ou libellé proche et
+// même montant (mensuel ou par échéance).
+func existingChargeFor(charges []budgetCharge, c recurringCandidate) string {
+	for _, ch := range charges {
+		if labelSimilarity(c.Merchant, ch.Label) >= 1 {
+			return ch.ID
+		}
+		similarity := math.Max(labelSimilarity(ch.Label, c.Merchant), labelSimilarity(c.Merchant, ch.Label))
+		if similarity >= 0.5 && (amountWithinTolerance(ch.Amount, c.MonthlyAmount()) || amountWithinTolerance(ch.Amount, c.Amount)) {
+			return ch.ID
+		}
+	}
+	return ""
+}
+
+// ----------------------------------------------------------------------------
+// SERVICE
+// ----------------------------------------------------------------------------
+
+// Detect analyse l'historique des comptes que userID a connectés au budget
+// (accountID restreint à un compte) et renvoie les propositions.
+func (s *RecurringChargeService) Detect(ctx context.Context, budgetID, userID, accountID string) ([]models.RecurringChargeProposal, error) {
+	proposals, _, err := s.detect(ctx, budgetID, userID, accountID)
+	return proposals, err
+}
+
+func (s *RecurringChargeService) detect(ctx context.Context, budgetID, userID, accountID string) ([]models.RecurringChargeProposal, []recurringCandidate, error) {
+	now := time.Now().UTC()
+
+	txs, err := s.history(ctx, budgetID, userID, accountID, now.Add(-recurringHistory))
+	if err != nil {
+		return nil, nil, err
+	}
+	candidates := detectRecurring(txs, now)
+	if len(candidates) == 0 {
+		return []models.RecurringChargeProposal{}, nil, nil
+	}
+
+	raw, err := s.budget.GetData(ctx, budgetID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get budget data: %w", err)
+	}
+	payload, err := decodeBudgetPayload(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode budget payload: %w", err)
+	}
+
+	proposals := make([]models.RecurringChargeProposal, 0, len(candidates))
+	for _, c := range candidates {
+		// GetCategory ne renvoie pas d'erreur bloquante (OTHER en repli)
+		category, _ := s.categorizer.GetCategory(ctx, c.Merchant)
+		existing := existingChargeFor(payload.Charges, c)
+
+		proposals = append(proposals, models.RecurringChargeProposal{
+			Key:              c.Key,
+			Label:            c.Label,
+			Category:         category,
+			Frequency:        c.Frequency.Name,
+			Amount:           c.Amount,
+			MonthlyAmount:    c.MonthlyAmount(),
+			Currency:         c.Currency,
+			DayOfMonth:       c.DayOfMonth,
+			Occurrences:      len(c.Transactions),
+			FirstSeen:        c.FirstSeen.Format("2006-01-02"),
+			LastSeen:         c.LastSeen.Format("2006-01-02"),
+			NextExpected:     c.LastSeen.AddDate(0, c.Frequency.Months, 0).Format("2006-01-02"),
+			Confidence:       c.Confidence,
+			AlreadyInBudget:  existing != "",
+			ExistingChargeID: existing,
+			TransactionIDs:   c.Transactions,
+		})
+	}
+	return proposals, candidates, nil
+}
+
+// Import ajoute au budget les propositions dont la clé figure dans keys, sauf
+// celles déjà présentes dans les charges. Renvoie les charges créées et la
+// nouvelle version (0 si rien n'a été ajouté). ErrVersionConflict si le
+// budget a changé pendant l'import.
+func (s *RecurringChargeService) Import(ctx context.Context, budgetID, userID, userName, accountID string, keys []string) ([]models.ImportedCharge, int, error) {
+	proposals, candidates, err := s.detect(ctx, budgetID, userID, accountID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	wanted := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		wanted[k] = true
+	}
+
+	raw, version, err := s.budget.GetDataWithVersion(ctx, budgetID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("get budget data: %w", err)
+	}
+
+	var ops []utils.PatchOperation
+	// Budget jamais enregistré, ou sans charges : créer le tableau
+	if doc, ok := raw.(map[string]interface{}); ok {
+		if _, has := doc["charges"].([]interface{}); !has {
+			ops = append(ops, utils.PatchOperation{Op: "add", Path: "/charges", Value: json.RawMessage("[]")})
+		}
+	}
+
+	imported := []models.ImportedCharge{}
+	for i, p := range proposals {
+		if !wanted[p.Key] || p.AlreadyInBudget {
+			continue
+		}
+		wanted[p.Key] = false // une clé n'est importée qu'une fois
+
+		charge := map[string]interface{}{
+			"id":        uuid.New().String(),
+			"label":     p.Label,
+			"amount":    p.MonthlyAmount,
+			"category":  p.Category,
+			"startDate": candidates[i].FirstSeen.Format("2006-01-02"),
+		}
+		if p.DayOfMonth > 0 {
+			charge["dayOfMonth"] = p.DayOfMonth
+		}
+		value, err := json.Marshal(charge)
+		if err != nil {
+			return nil, 0, err
+		}
+		ops = append(ops, utils.PatchOperation{Op: "add", Path: "/charges/-", Value: value})
+
+		imported = append(imported, models.ImportedCharge{
+			Key:      p.Key,
+			ChargeID: charge["id"].(string),
+			Label:    p.Label,
+			Amount:   p.MonthlyAmount,
+			Category: p.Category,
+		})
+	}
+	if len(imported) == 0 {
+		return imported, 0, nil
+	}
+
+	// version 0 = budget jamais enregistré : pas de contrôle possible
+	newVersion, err := s.budget.PatchData(ctx, budgetID, ops, version, userID, userName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	utils.SafeInfo("✅ Imported %d recurring charges into budget", len(imported))
+	return imported, newVersion, nil
+}
+
+// history lit les débits du ledger depuis since, descriptions déchiffrées.
+func (s *RecurringChargeService) history(ctx context.Context, budgetID, userID, accountID string, since time.Time) ([]historyTx, error) {
+	query := `
+		SELECT bt.id, bt.booking_date, bt.amount, COALESCE(bt.currency, ''), COALESCE(bt.encrypted_description, '')
+		FROM bank_transactions bt
+		JOIN banking_accounts ba ON ba.id = bt.account_id
+		JOIN banking_connections bc ON bc.id = ba.connection_id
+		WHERE bc.budget_id = $1 AND bc.user_id = $2
+		  AND bt.booking_date >= $3 AND bt.amount < 0
+	`
+	args := []interface{}{budgetID, userID, since}
+	if accountID != "" {
+		query += ` AND bt.account_id = $4`
+		args = append(args, accountID)
+	}
+	query += ` ORDER BY bt.booking_date, bt.id`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []historyTx
+	for rows.Next() {
+		var tx historyTx
+		var encrypted string
+		if err := rows.Scan(&tx.ID, &tx.Date, &tx.Amount, &tx.Currency, &encrypted); err != nil {
+			return nil, err
+		}
+		if encrypted != "" {
+			plain, err := utils.Decrypt(encrypted)
+			if err != nil {
+				utils.SafeWarn("⚠️  Failed to decrypt transaction description: %v", err)
+				continue
+			}
+			tx.Description = string(plain)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, rows.Err()
+}
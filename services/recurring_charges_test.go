@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// series génère n débits espacés de months mois à partir de start.
+func series(prefix, description string, amount float64, start string, months, n int) []historyTx {
+	var txs []historyTx
+	for i := 0; i < n; i++ {
+		txs = append(txs, historyTx{
+			ID:          fmt.Sprintf("%s%d", prefix, i),
+			Date:        day(start).AddDate(0, i*months, 0),
+			Amount:      -amount,
+			Currency:    "EUR",
+			Description: description,
+		})
+	}
+	return txs
+}
+
+func TestMerchantKey(t *testing.T) {
+	cases := map[string]string{
+		"VIR SEPA LOYER MARS 2026":        "loyer",
+		"PRLV SEPA NETFLIX.COM 123456":    "netflix com",
+		"CB CARREFOUR MARKET PARIS 15 FR": "carrefour market paris",
+		"12/03 1234":                      "",
+	}
+	for in, want := range cases {
+		if got := merchantKey(in); got != want {
+			t.Errorf("merchantKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDetectRecurringFrequencies(t *testing.T) {
+	now := day("2026-06-20")
+
+	var txs []historyTx
+	txs = append(txs, series("n", "PRLV NETFLIX.COM", 13.49, "2026-01-12", 1, 6)...)
+	txs = append(txs, series("w", "PRLV SEPA VEOLIA EAU", 96, "2025-09-03", 3, 4)...)
+	txs = append(txs, series("a", "PRLV MAIF ASSURANCE HABITATION", 240, "2025-06-15", 12, 2)...)
+	// Courses : même marchand, montants variables → pas une charge
+	for i, amount := range []float64{54.2, 112.9, 23.4, 87.1, 61.0} {
+		txs = append(txs, historyTx{ID: fmt.Sprintf("c%d", i), Date: day("2026-01-05").AddDate(0, 0, i*30), Amount: -amount, Description: "CB CARREFOUR"})
+	}
+	// Crédit : jamais une charge
+	txs = append(txs, series("s", "VIR SALAIRE", -2500, "2026-01-28", 1, 5)...)
+
+	got := detectRecurring(txs, now)
+
+	byMerchant := map[string]recurringCandidate{}
+	for _, c := range got {
+		byMerchant[c.Merchant] = c
+	}
+	if len(got) != 3 {
+		t.Fatalf("detected %d candidates, want 3: %+v", len(got), got)
+	}
+
+	netflix := byMerchant["netflix com"]
+	if netflix.Frequency.Name != FrequencyMonthly || netflix.Amount != 13.49 || netflix.DayOfMonth != 12 || len(netflix.Transactions) != 6 {
+		t.Errorf("netflix = %+v", netflix)
+	}
+	water := byMerchant["veolia eau"]
+	if water.Frequency.Name != FrequencyQuarterly || water.MonthlyAmount() != 32 || water.DayOfMonth != 0 {
+		t.Errorf("water = %+v", water)
+	}
+	insurance := byMerchant["maif assurance habitation"]
+	if insurance.Frequency.Name != FrequencyYearly || insurance.MonthlyAmount() != 20 {
+		t.Errorf("insurance = %+v", insurance)
+	}
+	if got[0].Merchant != "veolia eau" {
+		t.Errorf("candidates should be sorted by monthly amount, got %q first", got[0].Merchant)
+	}
+	if netflix.Key != "netflix com|monthly|13" {
+		t.Errorf("key = %q", netflix.Key)
+	}
+}
+
+func TestDetectRecurringSplitsByAmount(t *testing.T) {
+	now := day("2026-05-20")
+	txs := append(
+		series("m", "APPLE.COM/BILL", 2.99, "2026-01-03", 1, 5),
+		series("t", "APPLE.COM/BILL", 9.99, "2026-01-17", 1, 5)...,
+	)
+
+	got := detectRecurring(txs, now)
+
+	if len(got) != 2 || got[0].Amount != 9.99 || got[1].Amount != 2.99 {
+		t.Fatalf("want two subscriptions, got %+v", got)
+	}
+}
+
+func TestDetectRecurringRejects(t *testing.T) {
+	cases := map[string][]historyTx{
+		// Résilié : dernier débit il y a trois mois
+		"stale": series("x", "PRLV SPOTIFY", 10.99, "2025-10-01", 1, 5),
+		// Deux débits mensuels ne suffisent pas
+		"too few": series("x", "PRLV DEEZER", 10.99, "2026-04-02", 1, 2),
+		// Écarts irréguliers
+		"irregular": {
+			{ID: "1", Date: day("2026-01-02"), Amount: -30, Description: "CB PRESSING"},
+			{ID: "2", Date: day("2026-01-20"), Amount: -30, Description: "CB PRESSING"},
+			{ID: "3", Date: day("2026-03-01"), Amount: -30, Description: "CB PRESSING"},
+			{ID: "4", Date: day("2026-03-29"), Amount: -30, Description: "CB PRESSING"},
+			{ID: "5", Date: day("2026-05-30"), Amount: -30, Description: "CB PRESSING"},
+		},
+	}
+	for name, txs := range cases {
+		if got := detectRecurring(txs, day("2026-06-10")); len(got) != 0 {
+			t.Errorf("%s: detected %+v", name, got)
+		}
+	}
+}
+
+func TestDetectRecurringToleratesOneLateDebit(t *testing.T) {
+	txs := series("g", "PRLV BASIC FIT", 29.99, "2026-01-05", 1, 6)
+	txs[3].Date = txs[3].Date.AddDate(0, 0, 12) // prélèvement décalé
+
+	got := detectRecurring(txs, day("2026-06-10"))
+	if len(got) != 1 || got[0].Confidence >= 1 {
+		t.Fatalf("want one candidate with reduced confidence, got %+v", got)
+	}
+}
+
+func TestExistingChargeFor(t *testing.T) {
+	candidate := recurringCandidate{
+		Merchant:  "veolia eau",
+		Frequency: recurringFrequencies[1],
+		Amount:    96,
+	}
+	cases := []struct {
+		charges []budgetCharge
+		want    string
+	}{
+		{[]budgetCharge{{ID: "1", Label: "Veolia eau", Amount: 50}}, "1"},
+		{[]budgetCharge{{ID: "2", Label: "Eau", Amount: 32}}, "2"},
+		{[]budgetCharge{{ID: "3", Label: "Eau", Amount: 96}}, "3"},
+		{[]budgetCharge{{ID: "4", Label: "Eau", Amount: 60}}, ""},
+		{[]budgetCharge{{ID: "5", Label: "Loyer", Amount: 32}}, ""},
+	}
+	for _, tc := range cases {
+		if got := existingChargeFor(tc.charges, candidate); got != tc.want {
+			t.Errorf("existingChargeFor(%+v) = %q, want %q", tc.charges, got, tc.want)
+		}
+	}
+}
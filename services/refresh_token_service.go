@@ -83,6 +83,10 @@ func (r *RefreshToken) IsExpired(now time.Time) bool {
 type RefreshTokenService struct {
 	db       *sql.DB
 	lifetime time.Duration
+
+	// onRevokeAll est appelé quand toutes les sessions d'un user tombent
+	// (ex: fermeture des WebSockets ouverts). Optionnel.
+	onRevokeAll func(userID string)
 }
 
 // NewRefreshTokenService crée le service. Si lifetime est zéro, 7 jours par défaut.
@@ -93,6 +97,19 @@ func NewRefreshTokenService(db *sql.DB, lifetime time.Duration) *RefreshTokenSer
 	return &RefreshTokenService{db: db, lifetime: lifetime}
 }
 
+// OnRevokeAll enregistre un callback déclenché après RevokeAllForUser et après
+// une révocation de famille pour reuse. Les access tokens étant stateless, c'est
+// le seul moyen de couper les connexions longues (WebSocket) d'un user.
+func (s *RefreshTokenService) OnRevokeAll(fn func(userID string)) {
+	s.onRevokeAll = fn
+}
+
+func (s *RefreshTokenService) notifyRevokeAll(userID string) {
+	if s.onRevokeAll != nil {
+		s.onRevokeAll(userID)
+	}
+}
+
 // Lifetime retourne la durée de vie configurée (utile pour fixer le Max-Age du cookie).
 func (s *RefreshTokenService) Lifetime() time.Duration {
 	return s.lifetime
@@ -172,6 +189,7 @@ func (s *RefreshTokenService) Rotate(
 	// Le présenter à nouveau = quelqu'un l'a volé. On révoque toute la famille.
 	if rt.IsRevoked() && rt.ReplacedBy.Valid {
 		_ = s.RevokeFamily(ctx, rt.FamilyID, "reuse_detected")
+		s.notifyRevokeAll(rt.UserID)
 		return "", nil, "", ErrRefreshTokenReused
 	}
 
@@ -243,6 +261,7 @@ func (s *RefreshTokenService) RevokeAllForUser(ctx context.Context, userID strin
 		return 0, fmt.Errorf("revoke all for user: %w", err)
 	}
 	rows, _ := res.RowsAffected()
+	s.notifyRevokeAll(userID)
 	return rows, nil
 }
 
@@ -0,0 +1,396 @@
+// services/second_factor.go
+// ============================================================================
+// SECOND FACTOR — codes TOTP, codes de récupération et step-up
+// ============================================================================
+// À l'activation de la 2FA, l'utilisateur reçoit RecoveryCodeCount codes de
+// récupération à usage unique (affichés une seule fois, seul leur SHA-256 est
+// stocké). Un code de récupération remplace le code TOTP au login et pour
+// les actions sensibles (step-up : mot de passe, suppression du compte,
+// désactivation de la 2FA, retrait d'un membre). Les régénérer invalide les
+// précédents.
+//
+// Un code TOTP n'est accepté qu'une fois : users.totp_last_counter garde la
+// dernière période utilisée, un code de la même période (celui du login,
+// rejoué) est refusé.
+//
+// Après SecondFactorMaxFailures codes invalides, Verify refuse tout code,
+// même correct, pendant SecondFactorLockout (ErrSecondFactorLocked). Le
+// compteur est par utilisateur, dans users (partagé par toutes les instances
+// et par le login, le step-up et la désactivation de la 2FA).
+//
+// Step-up : Claim réserve le code avant l'action protégée, Release le rend
+// si elle échoue (mauvais mot de passe actuel, validation...). Un code de
+// récupération n'est donc perdu que pour une action réussie.
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LovationAdmin/budget-api/utils"
+)
+
+// RecoveryCodeCount : nombre de codes générés à chaque (ré)génération.
+const RecoveryCodeCount = 10
+
+// Verrouillage après trop de codes invalides : 5 échecs / 15 min par
+// utilisateur, comme LoginRateLimit.
+const (
+	SecondFactorMaxFailures = 5
+	SecondFactorLockout     = 15 * time.Minute
+)
+
+// Facteur accepté par Verify
+const (
+	SecondFactorTOTP     = "totp"
+	SecondFactorRecovery = "recovery_code"
+)
+
+var (
+	ErrSecondFactorRequired = errors.New("2FA code required")
+	ErrInvalidSecondFactor  = errors.New("invalid 2FA code")
+	ErrTOTPNotSetUp         = errors.New("TOTP not set up")
+	ErrTOTPNotEnabled       = errors.New("2FA is not enabled")
+	ErrSecondFactorLocked   = errors.New("too many invalid 2FA codes")
+	ErrPasswordRequired     = errors.New("password confirmation required")
+	ErrInvalidPassword      = errors.New("invalid password")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCode : 10 caractères base32 (50 bits), "xxxxx-xxxxx".
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeSecondFactorCode retire espaces et tirets, en minuscules : les
+// codes se recopient à la main.
+func normalizeSecondFactorCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// isTOTPCode : six chiffres, sinon c'est un code de récupération.
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// hashRecoveryCode : SHA-256 hex du code normalisé, salé par l'utilisateur.
+func hashRecoveryCode(userID, code string) string {
+	sum := sha256.Sum256([]byte(userID + ":" + normalizeSecondFactorCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ============================================================================
+// SERVICE
+// ============================================================================
+
+type SecondFactorService struct {
+	db *sql.DB
+}
+
+func NewSecondFactorService(db *sql.DB) *SecondFactorService {
+	return &SecondFactorService{db: db}
+}
+
+// SecondFactorClaim : code réservé par Claim. Release le rend utilisable si
+// l'action qu'il protège échoue.
+type SecondFactorClaim struct {
+	Method string
+
+	userID     string
+	recoveryID int64         // code de récupération réservé
+	counter    int64         // période TOTP réservée
+	previous   sql.NullInt64 // période TOTP acceptée avant elle
+}
+
+// Verify contrôle un code TOTP ou de récupération et le consomme. Sans 2FA
+// activée, il n'y a rien à vérifier (method vide, pas d'erreur).
+func (s *SecondFactorService) Verify(ctx context.Context, userID, code string) (string, error) {
+	claim, err := s.Claim(ctx, userID, code)
+	if err != nil || claim == nil {
+		return "", err
+	}
+	return claim.Method, nil
+}
+
+// Claim vérifie un code et le réserve : il ne resservira pas, sauf Release.
+// Claim nil sans erreur si la 2FA n'est pas activée. Après
+// SecondFactorMaxFailures échecs, ErrSecondFactorLocked, même pour un code
+// correct.
+func (s *SecondFactorService) Claim(ctx context.Context, userID, code string) (*SecondFactorClaim, error) {
+	var enabled bool
+	var secret sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(totp_enabled, FALSE), totp_secret FROM users WHERE id = $1
+	`, userID).Scan(&enabled, &secret)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled || !secret.Valid {
+		return nil, nil
+	}
+
+	code = normalizeSecondFactorCode(code)
+	if code == "" {
+		return nil, ErrSecondFactorRequired
+	}
+
+	if err := s.countAttempt(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	claim := &SecondFactorClaim{userID: userID}
+	if isTOTPCode(code) {
+		claim.Method = SecondFactorTOTP
+		claim.counter, claim.previous, err = useTOTP(ctx, s.db, userID, secret.String, code)
+	} else {
+		claim.Method = SecondFactorRecovery
+		claim.recoveryID, err = s.useRecoveryCode(ctx, userID, code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ResetFailures(ctx, userID); err != nil {
+		return nil, err
+	}
+	if claim.Method == SecondFactorRecovery {
+		utils.SafeInfo("🔑 Recovery code used by user %s", userID)
+	}
+	return claim, nil
+}
+
+// Release rend le code réservé par Claim. Une période TOTP n'est rendue que
+// si aucun code plus récent n'a été accepté depuis.
+func (s *SecondFactorService) Release(ctx context.Context, claim *SecondFactorClaim) error {
+	if claim == nil {
+		return nil
+	}
+	if claim.Method == SecondFactorRecovery {
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE user_recovery_codes SET used_at = NULL WHERE id = $1 AND user_id = $2
+		`, claim.recoveryID, claim.userID)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE users SET totp_last_counter = $3
+		WHERE id = $1 AND totp_last_counter = $2
+	`, claim.userID, claim.counter, claim.previous)
+	return err
+}
+
+// VerifyPassword confirme le mot de passe de l'utilisateur (ré-authentification
+// sans 2FA). Les échecs comptent dans la même fenêtre que les codes 2FA.
+func (s *SecondFactorService) VerifyPassword(ctx context.Context, userID, password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	if err := s.countAttempt(ctx, userID); err != nil {
+		return err
+	}
+	var hash string
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT password_hash FROM users WHERE id = $1
+	`, userID).Scan(&hash); err != nil {
+		return err
+	}
+	if !utils.CheckPassword(password, hash) {
+		return ErrInvalidPassword
+	}
+	return s.ResetFailures(ctx, userID)
+}
+
+// countAttempt compte une tentative dans la fenêtre de l'utilisateur (en
+// base : partagé par toutes les instances) ; ErrSecondFactorLocked au-delà
+// de SecondFactorMaxFailures. Une tentative réussie remet le compteur à zéro.
+func (s *SecondFactorService) countAttempt(ctx context.Context, userID string) error {
+	var attempts int
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE users SET
+			second_factor_failures = CASE
+				WHEN second_factor_window_end IS NULL OR second_factor_window_end <= NOW() THEN 1
+				ELSE second_factor_failures + 1 END,
+			second_factor_window_end = CASE
+				WHEN second_factor_window_end IS NULL OR second_factor_window_end <= NOW()
+				THEN NOW() + make_interval(secs => $2)
+				ELSE second_factor_window_end END
+		WHERE id = $1
+		RETURNING second_factor_failures
+	`, userID, SecondFactorLockout.Seconds()).Scan(&attempts)
+	if err != nil {
+		return err
+	}
+	if attempts > SecondFactorMaxFailures {
+		return ErrSecondFactorLocked
+	}
+	return nil
+}
+
+// ResetFailures efface les échecs après une vérification réussie.
+func (s *SecondFactorService) ResetFailures(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE users SET second_factor_failures = 0, second_factor_window_end = NULL
+		WHERE id = $1 AND second_factor_failures <> 0
+	`, userID)
+	return err
+}
+
+// useRecoveryCode marque le code utilisé et renvoie son id.
+func (s *SecondFactorService) useRecoveryCode(ctx context.Context, userID, code string) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE user_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+		RETURNING id
+	`, userID, hashRecoveryCode(userID, code)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidSecondFactor
+	}
+	return id, err
+}
+
+// useTOTP valide le code et enregistre sa période ; une période déjà
+// utilisée (ou antérieure) est refusée. Renvoie la période et la précédente.
+func useTOTP(ctx context.Context, q sqlQueryer, userID, secret, code string) (int64, sql.NullInt64, error) {
+	var previous sql.NullInt64
+	counter, ok := utils.MatchTOTP(secret, code, time.Now())
+	if !ok {
+		return 0, previous, ErrInvalidSecondFactor
+	}
+	err := q.QueryRowContext(ctx, `
+		UPDATE users u
+		SET totp_last_counter = $2
+		FROM (SELECT id, totp_last_counter FROM users WHERE id = $1 FOR UPDATE) prev
+		WHERE u.id = prev.id AND (prev.totp_last_counter IS NULL OR prev.totp_last_counter < $2)
+		RETURNING prev.totp_last_counter
+	`, userID, counter).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return 0, previous, ErrInvalidSecondFactor
+	}
+	return counter, previous, err
+}
+
+// Enable active la 2FA avec le secret en attente (SetupTOTP) si code est
+// valide, et renvoie les codes de récupération.
+func (s *SecondFactorService) Enable(ctx context.Context, userID, code string) ([]string, error) {
+	var secret sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT totp_secret FROM users WHERE id = $1`, userID).Scan(&secret)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if !secret.Valid {
+		return nil, ErrTOTPNotSetUp
+	}
+
+	var codes []string
+	err = utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		if _, _, err := useTOTP(ctx, tx, userID, secret.String, normalizeSecondFactorCode(code)); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE users SET totp_enabled = TRUE, updated_at = NOW() WHERE id = $1
+		`, userID); err != nil {
+			return err
+		}
+		var txErr error
+		codes, txErr = replaceRecoveryCodes(ctx, tx, userID)
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable coupe la 2FA et supprime secret et codes de récupération.
+func (s *SecondFactorService) Disable(ctx context.Context, userID string) error {
+	return utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE users
+			SET totp_enabled = FALSE, totp_secret = NULL, totp_last_counter = NULL, updated_at = NOW()
+			WHERE id = $1
+		`, userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// RegenerateRecoveryCodes remplace tous les codes de récupération.
+func (s *SecondFactorService) RegenerateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	var enabled bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(totp_enabled, FALSE) FROM users WHERE id = $1
+	`, userID).Scan(&enabled)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrTOTPNotEnabled
+	}
+
+	var codes []string
+	err = utils.WithTransaction(s.db, func(tx *sql.Tx) error {
+		var txErr error
+		codes, txErr = replaceRecoveryCodes(ctx, tx, userID)
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RemainingRecoveryCodes : codes de récupération encore utilisables.
+func (s *SecondFactorService) RemainingRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL
+	`, userID).Scan(&n)
+	return n, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, RecoveryCodeCount)
+	for len(codes) < RecoveryCodeCount {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, hashRecoveryCode(userID, code)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
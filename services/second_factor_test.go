@@ -0,0 +1,203 @@
+// services/second_factor_test.go
+// ============================================================================
+// TESTS — codes de récupération 2FA
+// ============================================================================
+// Lancer : go test ./services -run 'RecoveryCode|SecondFactor' -v
+// ============================================================================
+
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestGenerateRecoveryCode(t *testing.T) {
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !format.MatchString(code) {
+			t.Fatalf("code %q does not match xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+		if isTOTPCode(normalizeSecondFactorCode(code)) {
+			t.Fatalf("recovery code %q mistaken for a TOTP code", code)
+		}
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	h := hashRecoveryCode("user-1", "abcde-fghij")
+
+	// Saisie à la main : casse, espaces et tirets ignorés
+	for _, typed := range []string{"ABCDE-FGHIJ", " abcdefghij ", "abcde fghij"} {
+		if got := hashRecoveryCode("user-1", typed); got != h {
+			t.Errorf("hash(%q) differs from the generated code's hash", typed)
+		}
+	}
+	if hashRecoveryCode("user-2", "abcde-fghij") == h {
+		t.Error("same hash for two users")
+	}
+}
+
+func TestIsTOTPCode(t *testing.T) {
+	cases := map[string]bool{
+		"123456":     true,
+		"12345":      false,
+		"1234567":    false,
+		"12a456":     false,
+		"abcdefghij": false,
+		"":           false,
+	}
+	for code, want := range cases {
+		if got := isTOTPCode(normalizeSecondFactorCode(code)); got != want {
+			t.Errorf("isTOTPCode(%q) = %v, want %v", code, got, want)
+		}
+	}
+	if !isTOTPCode(normalizeSecondFactorCode("123 456")) {
+		t.Error("spaced TOTP code not recognised")
+	}
+}
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func newSecondFactorMock(t *testing.T) (*SecondFactorService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewSecondFactorService(db), mock
+}
+
+func expectTwoFactorEnabled(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT COALESCE\(totp_enabled, FALSE\), totp_secret FROM users`).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"enabled", "secret"}).AddRow(true, testTOTPSecret))
+}
+
+func expectAttempt(mock sqlmock.Sqlmock, attempts int) {
+	mock.ExpectQuery(`second_factor_failures = CASE`).
+		WithArgs("user-1", SecondFactorLockout.Seconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"second_factor_failures"}).AddRow(attempts))
+}
+
+func TestSecondFactorLockout(t *testing.T) {
+	s, mock := newSecondFactorMock(t)
+	validCode, err := totp.GenerateCode(testTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 5 échecs déjà comptés : la 6e tentative est refusée avant de regarder
+	// le code (aucune requête sur totp_last_counter attendue)
+	expectTwoFactorEnabled(mock)
+	expectAttempt(mock, SecondFactorMaxFailures+1)
+
+	if _, err := s.Verify(context.Background(), "user-1", validCode); !errors.Is(err, ErrSecondFactorLocked) {
+		t.Fatalf("Verify with a valid code after %d failures = %v, want ErrSecondFactorLocked", SecondFactorMaxFailures, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSecondFactorInvalidCodeStaysCounted(t *testing.T) {
+	s, mock := newSecondFactorMock(t)
+
+	expectTwoFactorEnabled(mock)
+	expectAttempt(mock, 1)
+	mock.ExpectQuery(`UPDATE user_recovery_codes`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// Pas de remise à zéro attendue après un échec
+	if _, err := s.Verify(context.Background(), "user-1", "abcde-fghij"); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Fatalf("Verify = %v, want ErrInvalidSecondFactor", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSecondFactorClaimRelease(t *testing.T) {
+	s, mock := newSecondFactorMock(t)
+
+	expectTwoFactorEnabled(mock)
+	expectAttempt(mock, 1)
+	mock.ExpectQuery(`UPDATE user_recovery_codes`).
+		WithArgs("user-1", hashRecoveryCode("user-1", "abcde-fghij")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+	mock.ExpectExec(`UPDATE users SET second_factor_failures = 0`).
+		WithArgs("user-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	claim, err := s.Claim(context.Background(), "user-1", "ABCDE-FGHIJ")
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if claim.Method != SecondFactorRecovery {
+		t.Errorf("method = %q, want %q", claim.Method, SecondFactorRecovery)
+	}
+
+	// L'action protégée a échoué : le code redevient utilisable
+	mock.ExpectExec(`UPDATE user_recovery_codes SET used_at = NULL`).
+		WithArgs(int64(7), "user-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := s.Release(context.Background(), claim); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSecondFactorReleaseTOTP(t *testing.T) {
+	s, mock := newSecondFactorMock(t)
+	code, err := totp.GenerateCode(testTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectTwoFactorEnabled(mock)
+	expectAttempt(mock, 1)
+	mock.ExpectQuery(`UPDATE users u\s+SET totp_last_counter = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_last_counter"}).AddRow(nil))
+	mock.ExpectExec(`UPDATE users SET second_factor_failures = 0`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	claim, err := s.Claim(context.Background(), "user-1", code)
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+
+	// Rendue seulement si aucune période plus récente n'a été acceptée
+	mock.ExpectExec(`UPDATE users SET totp_last_counter = \$3\s+WHERE id = \$1 AND totp_last_counter = \$2`).
+		WithArgs("user-1", claim.counter, sqlmockNullInt64{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := s.Release(context.Background(), claim); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// sqlmockNullInt64 attend un sql.NullInt64 invalide (NULL).
+type sqlmockNullInt64 struct{}
+
+func (sqlmockNullInt64) Match(v driver.Value) bool { return v == nil }
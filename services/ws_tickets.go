@@ -0,0 +1,48 @@
+// services/ws_tickets.go
+// Tickets d'upgrade WebSocket (utils.GenerateWSTicket) : usage unique. Le jti
+// de chaque ticket accepté est gardé jusqu'à son expiration, en base pour
+// valoir sur toutes les instances ; un second upgrade avec le même ticket est
+// refusé.
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrWSTicketReused : le ticket a déjà servi à ouvrir un WebSocket.
+var ErrWSTicketReused = errors.New("websocket ticket already used")
+
+// ConsumeWSTicket enregistre le jti d'un ticket valide ; ErrWSTicketReused
+// s'il l'est déjà.
+func ConsumeWSTicket(ctx context.Context, db *sql.DB, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return ErrWSTicketReused
+	}
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO ws_ticket_uses (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`, jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("record websocket ticket: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWSTicketReused
+	}
+	return nil
+}
+
+// PruneWSTicketUses oublie les tickets expirés (nettoyage quotidien).
+func PruneWSTicketUses(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM ws_ticket_uses WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestConsumeWSTicketOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	expiresAt := time.Now().Add(time.Minute)
+
+	mock.ExpectExec(`INSERT INTO ws_ticket_uses`).WithArgs("jti-1", expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO ws_ticket_uses`).WithArgs("jti-1", expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := ConsumeWSTicket(context.Background(), db, "jti-1", expiresAt); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := ConsumeWSTicket(context.Background(), db, "jti-1", expiresAt); !errors.Is(err, ErrWSTicketReused) {
+		t.Fatalf("replay: err = %v, want ErrWSTicketReused", err)
+	}
+	if err := ConsumeWSTicket(context.Background(), db, "", expiresAt); !errors.Is(err, ErrWSTicketReused) {
+		t.Errorf("ticket without jti: err = %v, want ErrWSTicketReused", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
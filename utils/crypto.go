@@ -1,73 +1,299 @@
 package utils
 
+// ============================================================================
+// CHIFFREMENT DES DONNÉES (AES-256-GCM) ET ROTATION DES CLÉS
+// ============================================================================
+// Un texte chiffré est "<key id>:<base64(nonce || ciphertext)>". Le base64
+// standard ne contient pas de ':', donc un texte sans préfixe est un ancien
+// chiffré (avant la rotation) : il est essayé avec chaque clé du trousseau.
+//
+// Le trousseau vient de l'environnement :
+//   DATA_ENCRYPTION_KEY       clé active (32 caractères), chiffre et déchiffre
+//   DATA_ENCRYPTION_KEY_ID    son identifiant (défaut "k1")
+//   DATA_ENCRYPTION_OLD_KEYS  clés en lecture seule, "k0:<32 caractères>,..."
+//
+// Rotation : la clé actuelle passe dans DATA_ENCRYPTION_OLD_KEYS, la nouvelle
+// prend sa place avec un nouvel id, puis POST /admin/maintenance/reencrypt
+// rechiffre les données ; l'ancienne clé peut ensuite être retirée.
+//
+// Les données budgétaires ont chacune leur clé de données (préfixe "bk",
+// voir services/budget_keys.go), elle-même chiffrée par la clé maître.
+// ============================================================================
+
 import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 )
 
-// Encrypt encrypts a plain string/bytes and returns a base64 encoded ciphertext
-func Encrypt(plaintext []byte) (string, error) {
-	key := os.Getenv("DATA_ENCRYPTION_KEY")
-	if len(key) != 32 {
-		return "", errors.New("DATA_ENCRYPTION_KEY must be exactly 32 characters")
+// DefaultKeyID identifie DATA_ENCRYPTION_KEY quand DATA_ENCRYPTION_KEY_ID est
+// absent.
+const DefaultKeyID = "k1"
+
+// DataKeyID préfixe les textes chiffrés avec une clé de données ; réservé,
+// refusé comme identifiant de clé maître.
+const DataKeyID = "bk"
+
+var (
+	ErrUnknownKeyID = errors.New("unknown encryption key id")
+	ErrDecrypt      = errors.New("ciphertext cannot be decrypted with any known key")
+
+	keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,16}$`)
+)
+
+// Keyring : une clé active et des clés en lecture seule.
+type Keyring struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+// NewKeyring construit un trousseau ; old peut être nil.
+func NewKeyring(activeID string, active []byte, old map[string][]byte) (*Keyring, error) {
+	k := &Keyring{activeID: activeID, keys: map[string]cipher.AEAD{}}
+	if err := k.add(activeID, active); err != nil {
+		return nil, err
+	}
+	for id, key := range old {
+		if id == activeID {
+			return nil, fmt.Errorf("key id %q is both active and decrypt-only", id)
+		}
+		if err := k.add(id, key); err != nil {
+			return nil, err
+		}
 	}
+	return k, nil
+}
 
-	block, err := aes.NewCipher([]byte(key))
+func (k *Keyring) add(id string, key []byte) error {
+	if !keyIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid key id %q (letters, digits and '-', 16 max)", id)
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("encryption key %q must be exactly 32 characters", id)
+	}
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", err
+		return err
 	}
-
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", err
+		return err
+	}
+	k.keys[id] = gcm
+	return nil
+}
+
+// KeyringFromEnv lit le trousseau de l'environnement (voir l'en-tête).
+func KeyringFromEnv() (*Keyring, error) {
+	key := os.Getenv("DATA_ENCRYPTION_KEY")
+	if len(key) != 32 {
+		return nil, errors.New("DATA_ENCRYPTION_KEY must be exactly 32 characters")
+	}
+	activeID := os.Getenv("DATA_ENCRYPTION_KEY_ID")
+	if activeID == "" {
+		activeID = DefaultKeyID
 	}
 
+	if activeID == DataKeyID {
+		return nil, fmt.Errorf("DATA_ENCRYPTION_KEY_ID: %q is reserved", DataKeyID)
+	}
+
+	old := map[string][]byte{}
+	for _, entry := range strings.Split(os.Getenv("DATA_ENCRYPTION_OLD_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, oldKey, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, errors.New("DATA_ENCRYPTION_OLD_KEYS entries must look like <id>:<key>")
+		}
+		if id == DataKeyID {
+			return nil, fmt.Errorf("DATA_ENCRYPTION_OLD_KEYS: %q is reserved", DataKeyID)
+		}
+		if _, dup := old[id]; dup {
+			return nil, fmt.Errorf("DATA_ENCRYPTION_OLD_KEYS: duplicate key id %q", id)
+		}
+		old[id] = []byte(oldKey)
+	}
+	return NewKeyring(activeID, []byte(key), old)
+}
+
+// NewDataKeyring : trousseau d'une seule clé de données (32 octets).
+func NewDataKeyring(key []byte) (*Keyring, error) {
+	return NewKeyring(DataKeyID, key, nil)
+}
+
+// GenerateDataKey tire une clé de données aléatoire.
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ActiveKeyID : identifiant des nouveaux chiffrés.
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// KeyIDs : identifiants connus, clé active en premier.
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		if id != k.activeID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return append([]string{k.activeID}, ids...)
+}
+
+// HasKey indique si id est une clé du trousseau.
+func (k *Keyring) HasKey(id string) bool {
+	_, ok := k.keys[id]
+	return ok
+}
+
+// Encrypt chiffre avec la clé active.
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	gcm := k.keys[k.activeID]
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
 
 	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return k.activeID + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt takes a base64 encoded ciphertext and returns the original bytes
-func Decrypt(cryptoText string) ([]byte, error) {
-	key := os.Getenv("DATA_ENCRYPTION_KEY")
-	if len(key) != 32 {
-		return nil, errors.New("DATA_ENCRYPTION_KEY must be exactly 32 characters")
+// Decrypt déchiffre un texte préfixé par son key id, ou un ancien texte sans
+// préfixe en essayant chaque clé (la clé active d'abord).
+func (k *Keyring) Decrypt(cryptoText string) ([]byte, error) {
+	id, encoded, tagged := strings.Cut(cryptoText, ":")
+	if !tagged {
+		encoded = cryptoText
 	}
 
-	ciphertext, err := base64.StdEncoding.DecodeString(cryptoText)
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return nil, err
 	}
 
-	block, err := aes.NewCipher([]byte(key))
-	if err != nil {
-		return nil, err
+	if tagged {
+		gcm, ok := k.keys[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, id)
+		}
+		return open(gcm, ciphertext)
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
+	for _, id := range k.KeyIDs() {
+		if plaintext, err := open(k.keys[id], ciphertext); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, ErrDecrypt
+}
+
+// IsCurrent indique si cryptoText est déjà chiffré avec la clé active.
+func (k *Keyring) IsCurrent(cryptoText string) bool {
+	return CiphertextKeyID(cryptoText) == k.activeID
+}
+
+// CiphertextKeyID renvoie le key id d'un texte chiffré, "" pour un ancien
+// texte sans préfixe.
+func CiphertextKeyID(cryptoText string) string {
+	id, _, tagged := strings.Cut(cryptoText, ":")
+	if !tagged {
+		return ""
 	}
+	return id
+}
+
+// IsTaggedCiphertext indique si s a la forme d'un texte chiffré préfixé,
+// "<key id>:<base64>" assez long pour un nonce et un tag GCM, quelle que soit
+// la clé. Un identifiant en clair comme "file:<uuid>" n'a pas cette forme.
+func IsTaggedCiphertext(s string) bool {
+	id, encoded, tagged := strings.Cut(s, ":")
+	if !tagged || !keyIDPattern.MatchString(id) {
+		return false
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	return err == nil && len(raw) >= gcmNonceSize+gcmTagSize
+}
 
+// Tailles GCM standard (cipher.NewGCM)
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+func open(gcm cipher.AEAD, ciphertext []byte) ([]byte, error) {
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
 		return nil, errors.New("ciphertext too short")
 	}
 
 	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// cachedEnvKeyring garde le trousseau de l'environnement entre deux appels
+// de Encrypt / Decrypt : le reconstruire refait un AES + GCM par clé. Il est
+// reconstruit quand les variables changent (les tests les modifient).
+var cachedEnvKeyring struct {
+	mu      sync.Mutex
+	source  string
+	keyring *Keyring
+}
+
+// envKeyring renvoie le trousseau de l'environnement, mis en cache.
+func envKeyring() (*Keyring, error) {
+	source := strings.Join([]string{
+		os.Getenv("DATA_ENCRYPTION_KEY"),
+		os.Getenv("DATA_ENCRYPTION_KEY_ID"),
+		os.Getenv("DATA_ENCRYPTION_OLD_KEYS"),
+	}, "\x00")
+
+	cachedEnvKeyring.mu.Lock()
+	defer cachedEnvKeyring.mu.Unlock()
+	if cachedEnvKeyring.keyring != nil && cachedEnvKeyring.source == source {
+		return cachedEnvKeyring.keyring, nil
+	}
+	keyring, err := KeyringFromEnv()
 	if err != nil {
 		return nil, err
 	}
+	cachedEnvKeyring.source, cachedEnvKeyring.keyring = source, keyring
+	return keyring, nil
+}
+
+// Encrypt encrypts a plain string/bytes with the active key of the
+// environment keyring and returns a key-id-tagged base64 ciphertext
+func Encrypt(plaintext []byte) (string, error) {
+	keyring, err := envKeyring()
+	if err != nil {
+		return "", err
+	}
+	return keyring.Encrypt(plaintext)
+}
 
-	return plaintext, nil
-}
\ No newline at end of file
+// Decrypt takes a ciphertext (tagged or legacy) and returns the original bytes
+func Decrypt(cryptoText string) ([]byte, error) {
+	keyring, err := envKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Decrypt(cryptoText)
+}
@@ -0,0 +1,215 @@
+// utils/crypto_test.go
+// ============================================================================
+// TESTS — chiffrement et rotation des clés
+// ============================================================================
+// Lancer : go test ./utils -run 'Keyring|Encrypt' -v
+// ============================================================================
+
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	testKeyOld = "0123456789abcdef0123456789abcdef"
+	testKeyNew = "fedcba9876543210fedcba9876543210"
+)
+
+// legacyEncrypt reproduit le format d'avant la rotation (base64 sans key id).
+func legacyEncrypt(t *testing.T, key string, plaintext []byte) string {
+	t.Helper()
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil))
+}
+
+func TestEncryptTagsActiveKey(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", testKeyOld)
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+
+	text, err := Encrypt([]byte("budget"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if CiphertextKeyID(text) != DefaultKeyID {
+		t.Errorf("ciphertext %q not tagged with %q", text, DefaultKeyID)
+	}
+	plain, err := Decrypt(text)
+	if err != nil || string(plain) != "budget" {
+		t.Errorf("Decrypt = %q, %v", plain, err)
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", testKeyOld)
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "k1")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+
+	legacy := legacyEncrypt(t, testKeyOld, []byte("legacy"))
+	before, err := Encrypt([]byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotation : k1 passe en lecture seule, k2 devient active
+	t.Setenv("DATA_ENCRYPTION_KEY", testKeyNew)
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "k2")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "k1:"+testKeyOld)
+
+	keyring, err := KeyringFromEnv()
+	if err != nil {
+		t.Fatalf("KeyringFromEnv: %v", err)
+	}
+	if ids := keyring.KeyIDs(); len(ids) != 2 || ids[0] != "k2" || ids[1] != "k1" {
+		t.Errorf("KeyIDs = %v", ids)
+	}
+
+	for text, want := range map[string]string{legacy: "legacy", before: "before"} {
+		plain, err := keyring.Decrypt(text)
+		if err != nil || string(plain) != want {
+			t.Errorf("Decrypt(%q) = %q, %v", text, plain, err)
+		}
+		if keyring.IsCurrent(text) {
+			t.Errorf("%q reported as current", text)
+		}
+	}
+
+	after, err := keyring.Encrypt([]byte("after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keyring.IsCurrent(after) {
+		t.Errorf("new ciphertext %q not on the active key", after)
+	}
+
+	// Une fois k1 retirée, ses chiffrés ne sont plus lisibles
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+	if _, err := Decrypt(before); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("Decrypt with retired key: err = %v", err)
+	}
+	if _, err := Decrypt(legacy); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt legacy with retired key: err = %v", err)
+	}
+	if plain, err := Decrypt(after); err != nil || string(plain) != "after" {
+		t.Errorf("Decrypt(after) = %q, %v", plain, err)
+	}
+}
+
+func TestEnvKeyringCached(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", testKeyOld)
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "")
+	t.Setenv("DATA_ENCRYPTION_OLD_KEYS", "")
+
+	first, err := envKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := envKeyring(); again != first {
+		t.Error("keyring rebuilt although the environment did not change")
+	}
+
+	t.Setenv("DATA_ENCRYPTION_KEY_ID", "k2")
+	rotated, err := envKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == first || rotated.ActiveKeyID() != "k2" {
+		t.Errorf("keyring not rebuilt after the environment changed (active %q)", rotated.ActiveKeyID())
+	}
+}
+
+func TestKeyringFromEnvErrors(t *testing.T) {
+	cases := []struct {
+		name, key, id, old string
+	}{
+		{"short key", "short", "", ""},
+		{"bad id", testKeyNew, "k:2", ""},
+		{"old entry without id", testKeyNew, "k2", testKeyOld},
+		{"old key too short", testKeyNew, "k2", "k1:short"},
+		{"active id reused", testKeyNew, "k2", "k2:" + testKeyOld},
+		{"duplicate old id", testKeyNew, "k3", "k1:" + testKeyOld + ",k1:" + testKeyOld},
+		{"reserved active id", testKeyNew, DataKeyID, ""},
+		{"reserved old id", testKeyNew, "k2", DataKeyID + ":" + testKeyOld},
+	}
+	for _, tc := range cases {
+		t.Setenv("DATA_ENCRYPTION_KEY", tc.key)
+		t.Setenv("DATA_ENCRYPTION_KEY_ID", tc.id)
+		t.Setenv("DATA_ENCRYPTION_OLD_KEYS", tc.old)
+		if _, err := KeyringFromEnv(); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestDecryptRejectsTamperedCiphertext(t *testing.T) {
+	keyring, err := NewKeyring("k1", []byte(testKeyOld), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := keyring.Encrypt([]byte("secret"))
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(text, "k1:"))
+	raw[len(raw)-1] ^= 1
+	if _, err := keyring.Decrypt("k1:" + base64.StdEncoding.EncodeToString(raw)); err == nil {
+		t.Error("tampered ciphertext must not decrypt")
+	}
+}
+
+func TestIsTaggedCiphertext(t *testing.T) {
+	keyring, err := NewKeyring("k1", []byte(testKeyOld), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := keyring.Encrypt([]byte("secret"))
+	for _, s := range []string{text, "k0" + strings.TrimPrefix(text, "k1")} {
+		if !IsTaggedCiphertext(s) {
+			t.Errorf("IsTaggedCiphertext(%q) = false", s)
+		}
+	}
+	for _, s := range []string{
+		"", "session-123", "file:42", "file:3f2b8c1e-0000-4000-8000-000000000000",
+		legacyEncrypt(t, testKeyOld, []byte("secret")), "k1:AAAA",
+	} {
+		if IsTaggedCiphertext(s) {
+			t.Errorf("IsTaggedCiphertext(%q) = true", s)
+		}
+	}
+}
+
+func TestDataKeyring(t *testing.T) {
+	key, err := GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := NewDataKeyring(key)
+	if err != nil {
+		t.Fatalf("NewDataKeyring: %v", err)
+	}
+	text, _ := keyring.Encrypt([]byte("household"))
+	if CiphertextKeyID(text) != DataKeyID {
+		t.Errorf("ciphertext %q not tagged with %q", text, DataKeyID)
+	}
+
+	other, _ := GenerateDataKey()
+	otherKeyring, _ := NewDataKeyring(other)
+	if _, err := otherKeyring.Decrypt(text); err == nil {
+		t.Error("another budget's data key must not decrypt")
+	}
+}
@@ -82,6 +82,141 @@ func SendInvitationEmail(toEmail, inviterName, budgetName, invitationToken strin
 	return sendEmail(toEmail, fmt.Sprintf("%s vous invite à collaborer", inviterName), htmlBody)
 }
 
+// SendOwnershipTransferEmail demande au membre désigné de confirmer qu'il
+// reprend la propriété du budget
+func SendOwnershipTransferEmail(toEmail, ownerName, budgetName, transferToken string) error {
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+
+	confirmLink := fmt.Sprintf("%s/ownership-transfer/accept?token=%s", frontendURL, transferToken)
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Transfert de budget</title>
+</head>
+<body style="margin: 0; padding: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background-color: #f3f4f6;">
+    <table role="presentation" style="width: 100%%; border-collapse: collapse;">
+        <tr>
+            <td style="padding: 40px 0; text-align: center; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);">
+                <h1 style="margin: 0; color: #ffffff; font-size: 28px; font-weight: bold;">
+                    💰 Budget Famille
+                </h1>
+            </td>
+        </tr>
+        <tr>
+            <td style="padding: 40px 20px;">
+                <table role="presentation" style="max-width: 600px; margin: 0 auto; background-color: #ffffff; border-radius: 12px; box-shadow: 0 4px 6px rgba(0, 0, 0, 0.1);">
+                    <tr>
+                        <td style="padding: 40px;">
+                            <h2 style="margin: 0 0 20px 0; color: #1f2937; font-size: 24px;">Reprendre la gestion du budget</h2>
+                            <p style="margin: 0 0 20px 0; color: #4b5563; font-size: 16px; line-height: 1.6;">
+                                <strong>%s</strong> souhaite vous confier la propriété du budget <strong>"%s"</strong>.
+                                Vous pourrez ensuite gérer les membres et supprimer le budget.
+                            </p>
+                            <table role="presentation" style="margin: 20px 0;">
+                                <tr>
+                                    <td style="border-radius: 8px; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);">
+                                        <a href="%s" style="display: inline-block; padding: 16px 32px; color: #ffffff; text-decoration: none; font-size: 16px; font-weight: 600;">
+                                            Accepter le transfert
+                                        </a>
+                                    </td>
+                                </tr>
+                            </table>
+                            <p style="margin: 0; color: #9ca3af; font-size: 14px;">
+                                Ce lien expire dans 7 jours. Si vous ne souhaitez pas devenir propriétaire, ignorez cet email.
+                            </p>
+                        </td>
+                    </tr>
+                </table>
+            </td>
+        </tr>
+    </table>
+</body>
+</html>
+    `, ownerName, budgetName, confirmLink)
+
+	return sendEmail(toEmail, fmt.Sprintf("%s vous confie le budget \"%s\"", ownerName, budgetName), htmlBody)
+}
+
+// SendBankConsentReminderEmail prévient que le consentement bancaire (PSD2)
+// d'une connexion expire bientôt et renvoie vers le budget pour reconnecter
+func SendBankConsentReminderEmail(toEmail, userName, bankName, budgetName, budgetID string, daysLeft int) error {
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+
+	budgetLink := fmt.Sprintf("%s/budget/%s", frontendURL, budgetID)
+
+	if userName == "" {
+		userName = "Bonjour"
+	} else {
+		userName = "Bonjour " + userName
+	}
+
+	delay := fmt.Sprintf("dans %d jours", daysLeft)
+	if daysLeft <= 1 {
+		delay = "demain"
+	}
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Connexion bancaire</title>
+</head>
+<body style="margin: 0; padding: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background-color: #f3f4f6;">
+    <table role="presentation" style="width: 100%%; border-collapse: collapse;">
+        <tr>
+            <td style="padding: 40px 0; text-align: center; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);">
+                <h1 style="margin: 0; color: #ffffff; font-size: 28px; font-weight: bold;">
+                    💰 Budget Famille
+                </h1>
+            </td>
+        </tr>
+        <tr>
+            <td style="padding: 40px 20px;">
+                <table role="presentation" style="max-width: 600px; margin: 0 auto; background-color: #ffffff; border-radius: 12px; box-shadow: 0 4px 6px rgba(0, 0, 0, 0.1);">
+                    <tr>
+                        <td style="padding: 40px;">
+                            <h2 style="margin: 0 0 20px 0; color: #1f2937; font-size: 24px;">Votre connexion bancaire expire %s</h2>
+                            <p style="margin: 0 0 20px 0; color: #4b5563; font-size: 16px; line-height: 1.6;">
+                                %s, l'autorisation d'accès à <strong>%s</strong> pour le budget <strong>"%s"</strong>
+                                arrive à échéance. Sans renouvellement, vos soldes et transactions ne seront plus mis à jour.
+                            </p>
+                            <table role="presentation" style="margin: 20px 0;">
+                                <tr>
+                                    <td style="border-radius: 8px; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);">
+                                        <a href="%s" style="display: inline-block; padding: 16px 32px; color: #ffffff; text-decoration: none; font-size: 16px; font-weight: 600;">
+                                            Reconnecter ma banque
+                                        </a>
+                                    </td>
+                                </tr>
+                            </table>
+                            <p style="margin: 0; color: #9ca3af; font-size: 14px;">
+                                La réglementation européenne (DSP2) impose de renouveler cette autorisation régulièrement. Vos données déjà importées sont conservées.
+                            </p>
+                        </td>
+                    </tr>
+                </table>
+            </td>
+        </tr>
+    </table>
+</body>
+</html>
+    `, delay, userName, bankName, budgetName, budgetLink)
+
+	return sendEmail(toEmail, fmt.Sprintf("Votre connexion %s expire %s", bankName, delay), htmlBody)
+}
+
 // SendVerificationEmail envoie l'email de vérification
 func SendVerificationEmail(toEmail, userName, token string) error {
 	frontendURL := os.Getenv("FRONTEND_URL")
@@ -0,0 +1,306 @@
+// utils/json_patch.go
+// ============================================================================
+// JSON PATCH (RFC 6902) sur des documents décodés par encoding/json
+// ============================================================================
+// Les documents budget sont manipulés sous forme d'arbres génériques
+// (map[string]interface{} / []interface{} / float64 / string / bool / nil),
+// c'est-à-dire ce que renvoie json.Unmarshal vers un interface{}.
+//
+// ApplyJSONPatch est atomique : il travaille sur une copie profonde et ne
+// renvoie le document modifié que si TOUTES les opérations ont réussi.
+// ============================================================================
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation est une opération RFC 6902. Value reste brut pour pouvoir
+// distinguer une valeur absente d'un `null` explicite.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ErrPatchTestFailed est renvoyé quand une opération "test" ne correspond pas.
+var ErrPatchTestFailed = errors.New("json patch test operation failed")
+
+// ApplyJSONPatch applique les opérations dans l'ordre et renvoie le nouveau
+// document. Le document d'entrée n'est jamais modifié.
+func ApplyJSONPatch(doc interface{}, ops []PatchOperation) (interface{}, error) {
+	out := deepCopyJSON(doc)
+
+	for i, op := range ops {
+		var err error
+		out, err = applyOne(out, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return out, nil
+}
+
+func applyOne(doc interface{}, op PatchOperation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, errors.New("missing value")
+		}
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value: %w", err)
+		}
+		switch op.Op {
+		case "add":
+			return setValue(doc, path, value, false)
+		case "replace":
+			return setValue(doc, path, value, true)
+		default:
+			current, err := getValue(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrPatchTestFailed
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		out, _, err := removeValue(doc, path)
+		return out, err
+
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+		value, err := getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return setValue(doc, path, deepCopyJSON(value), false)
+		}
+		if isProperPrefix(from, path) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		doc, _, err = removeValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return setValue(doc, path, value, false)
+
+	default:
+		return nil, fmt.Errorf("unsupported op %q", op.Op)
+	}
+}
+
+// parsePointer découpe un JSON Pointer (RFC 6901) en tokens non échappés.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		t = strings.ReplaceAll(t, "~1", "/")
+		tokens[i] = strings.ReplaceAll(t, "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isProperPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex valide un index de tableau. allowEnd autorise len(arr) (insertion
+// en fin) et le token "-".
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if idx > max {
+		return 0, fmt.Errorf("array index %d out of bounds", idx)
+	}
+	return idx, nil
+}
+
+func getValue(node interface{}, path []string) (interface{}, error) {
+	for _, tok := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[tok]
+			if !ok {
+				return nil, fmt.Errorf("path not found: %q", tok)
+			}
+			node = child
+		case []interface{}:
+			idx, err := arrayIndex(tok, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[idx]
+		default:
+			return nil, fmt.Errorf("cannot traverse into scalar at %q", tok)
+		}
+	}
+	return node, nil
+}
+
+// setValue implémente add (replace=false) et replace (replace=true).
+func setValue(node interface{}, path []string, value interface{}, replace bool) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	tok := path[0]
+	last := len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if last {
+			if _, ok := n[tok]; replace && !ok {
+				return nil, fmt.Errorf("path not found: %q", tok)
+			}
+			n[tok] = value
+			return n, nil
+		}
+		child, ok := n[tok]
+		if !ok {
+			return nil, fmt.Errorf("path not found: %q", tok)
+		}
+		updated, err := setValue(child, path[1:], value, replace)
+		if err != nil {
+			return nil, err
+		}
+		n[tok] = updated
+		return n, nil
+
+	case []interface{}:
+		if last && !replace {
+			idx, err := arrayIndex(tok, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[idx+1:], n[idx:])
+			n[idx] = value
+			return n, nil
+		}
+		idx, err := arrayIndex(tok, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			n[idx] = value
+			return n, nil
+		}
+		updated, err := setValue(n[idx], path[1:], value, replace)
+		if err != nil {
+			return nil, err
+		}
+		n[idx] = updated
+		return n, nil
+
+	default:
+		return nil, fmt.Errorf("cannot traverse into scalar at %q", tok)
+	}
+}
+
+func removeValue(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the document root")
+	}
+	tok := path[0]
+	last := len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[tok]
+		if !ok {
+			return nil, nil, fmt.Errorf("path not found: %q", tok)
+		}
+		if last {
+			delete(n, tok)
+			return n, child, nil
+		}
+		updated, removed, err := removeValue(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[tok] = updated
+		return n, removed, nil
+
+	case []interface{}:
+		idx, err := arrayIndex(tok, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if last {
+			removed := n[idx]
+			return append(n[:idx], n[idx+1:]...), removed, nil
+		}
+		updated, removed, err := removeValue(n[idx], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[idx] = updated
+		return n, removed, nil
+
+	default:
+		return nil, nil, fmt.Errorf("cannot traverse into scalar at %q", tok)
+	}
+}
+
+func deepCopyJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			out[k] = deepCopyJSON(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, child := range t {
+			out[i] = deepCopyJSON(child)
+		}
+		return out
+	default:
+		return t
+	}
+}
@@ -0,0 +1,150 @@
+// utils/json_patch_test.go
+// ============================================================================
+// TESTS — JSON Patch (RFC 6902)
+// ============================================================================
+// Lancer : go test ./utils -run TestApplyJSONPatch -v
+// ============================================================================
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mustDecode(t *testing.T, raw string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("bad fixture %q: %v", raw, err)
+	}
+	return v
+}
+
+func mustOps(t *testing.T, raw string) []PatchOperation {
+	t.Helper()
+	var ops []PatchOperation
+	if err := json.Unmarshal([]byte(raw), &ops); err != nil {
+		t.Fatalf("bad ops %q: %v", raw, err)
+	}
+	return ops
+}
+
+func TestApplyJSONPatch_Valid(t *testing.T) {
+	cases := []struct {
+		name string
+		doc  string
+		ops  string
+		want string
+	}{
+		{
+			name: "add membre objet",
+			doc:  `{"foo": "bar"}`,
+			ops:  `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want: `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name: "add dans un tableau",
+			doc:  `{"foo": ["bar", "baz"]}`,
+			ops:  `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want: `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name: "add en fin de tableau",
+			doc:  `{"charges": [{"id": "c1"}]}`,
+			ops:  `[{"op": "add", "path": "/charges/-", "value": {"id": "c2"}}]`,
+			want: `{"charges": [{"id": "c1"}, {"id": "c2"}]}`,
+		},
+		{
+			name: "remove element de tableau",
+			doc:  `{"foo": ["bar", "qux", "baz"]}`,
+			ops:  `[{"op": "remove", "path": "/foo/1"}]`,
+			want: `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name: "replace valeur",
+			doc:  `{"charges": [{"id": "c1", "amount": 40}]}`,
+			ops:  `[{"op": "replace", "path": "/charges/0/amount", "value": 45}]`,
+			want: `{"charges": [{"id": "c1", "amount": 45}]}`,
+		},
+		{
+			name: "move",
+			doc:  `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			ops:  `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want: `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name: "copy puis modification independante",
+			doc:  `{"a": {"x": 1}}`,
+			ops:  `[{"op": "copy", "from": "/a", "path": "/b"}, {"op": "replace", "path": "/b/x", "value": 2}]`,
+			want: `{"a": {"x": 1}, "b": {"x": 2}}`,
+		},
+		{
+			name: "test reussi et cle echappee",
+			doc:  `{"a/b": 1, "m~n": 2}`,
+			ops:  `[{"op": "test", "path": "/a~1b", "value": 1}, {"op": "remove", "path": "/m~0n"}]`,
+			want: `{"a/b": 1}`,
+		},
+		{
+			name: "add null explicite",
+			doc:  `{}`,
+			ops:  `[{"op": "add", "path": "/note", "value": null}]`,
+			want: `{"note": null}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ApplyJSONPatch(mustDecode(t, tc.doc), mustOps(t, tc.ops))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := mustDecode(t, tc.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatch_Invalid(t *testing.T) {
+	cases := []struct {
+		name string
+		ops  string
+	}{
+		{"chemin absent", `[{"op": "replace", "path": "/missing", "value": 1}]`},
+		{"index hors limites", `[{"op": "add", "path": "/list/5", "value": 1}]`},
+		{"index avec zero initial", `[{"op": "remove", "path": "/list/01"}]`},
+		{"remove racine", `[{"op": "remove", "path": ""}]`},
+		{"value manquante", `[{"op": "add", "path": "/x"}]`},
+		{"op inconnue", `[{"op": "merge", "path": "/x", "value": 1}]`},
+		{"move dans un enfant", `[{"op": "move", "from": "/obj", "path": "/obj/child"}]`},
+		{"pointeur invalide", `[{"op": "add", "path": "x", "value": 1}]`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := mustDecode(t, `{"list": [1, 2], "obj": {"a": 1}}`)
+			if _, err := ApplyJSONPatch(doc, mustOps(t, tc.ops)); err == nil {
+				t.Errorf("expected an error for %s", tc.ops)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatch_Atomic(t *testing.T) {
+	doc := mustDecode(t, `{"amount": 40}`)
+	ops := mustOps(t, `[
+		{"op": "replace", "path": "/amount", "value": 50},
+		{"op": "test", "path": "/amount", "value": 40}
+	]`)
+
+	_, err := ApplyJSONPatch(doc, ops)
+	if !errors.Is(err, ErrPatchTestFailed) {
+		t.Fatalf("expected ErrPatchTestFailed, got %v", err)
+	}
+	if want := mustDecode(t, `{"amount": 40}`); !reflect.DeepEqual(doc, want) {
+		t.Errorf("input document was mutated: %#v", doc)
+	}
+}
@@ -74,4 +74,81 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	}
 
 	return nil, fmt.Errorf("invalid token")
-}
\ No newline at end of file
+}
+// ============================================================================
+// WEBSOCKET TICKETS
+// ============================================================================
+// Le navigateur ne peut pas poser de header Authorization sur un upgrade
+// WebSocket. Le front échange donc son access token contre un ticket court,
+// lié à UN budget, qu'il passe en query (?ticket=...). Le ticket est signé
+// avec une clé dérivée : il n'est pas utilisable comme access token, et
+// inversement.
+
+const wsTicketTTL = 60 * time.Second
+
+type WSTicketClaims struct {
+	UserID   string `json:"user_id"`
+	BudgetID string `json:"budget_id"`
+	jwt.RegisteredClaims
+}
+
+func wsTicketKey() ([]byte, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("JWT_SECRET not set")
+	}
+	return []byte(secret + ":ws-ticket"), nil
+}
+
+// GenerateWSTicket émet un ticket d'upgrade WebSocket valable 60s.
+func GenerateWSTicket(userID, budgetID string) (string, time.Time, error) {
+	key, err := wsTicketKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(wsTicketTTL)
+	claims := WSTicketClaims{
+		UserID:   userID,
+		BudgetID: budgetID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "budget-api",
+			Audience:  jwt.ClaimStrings{"budget-ws"},
+			Subject:   userID,
+			ID:        uuid.New().String(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(key)
+	return signed, expiresAt, err
+}
+
+// ValidateWSTicket vérifie la signature, l'expiration et l'audience du ticket.
+// L'usage unique est à la charge de l'appelant (services.ConsumeWSTicket sur
+// claims.ID).
+func ValidateWSTicket(ticket string) (*WSTicketClaims, error) {
+	key, err := wsTicketKey()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.ParseWithClaims(ticket, &WSTicketClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key, nil
+	}, jwt.WithAudience("budget-ws"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*WSTicketClaims); ok && token.Valid && claims.UserID != "" && claims.ID != "" {
+		return claims, nil
+	}
+
+	return nil, fmt.Errorf("invalid ticket")
+}
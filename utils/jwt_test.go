@@ -0,0 +1,47 @@
+// utils/jwt_test.go
+// ============================================================================
+// TESTS — WebSocket tickets
+// ============================================================================
+// Lancer : go test ./utils -run TestWSTicket -v
+// ============================================================================
+
+package utils
+
+import "testing"
+
+func TestWSTicket_RoundTrip(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	ticket, _, err := GenerateWSTicket("user-1", "budget-1")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	claims, err := ValidateWSTicket(ticket)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.BudgetID != "budget-1" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestWSTicket_NotInterchangeableWithAccessToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	ticket, _, err := GenerateWSTicket("user-1", "budget-1")
+	if err != nil {
+		t.Fatalf("generate ticket: %v", err)
+	}
+	if _, err := ValidateToken(ticket); err == nil {
+		t.Error("a WS ticket must not be accepted as an access token")
+	}
+
+	access, err := GenerateAccessToken("user-1", "alice@example.com")
+	if err != nil {
+		t.Fatalf("generate access token: %v", err)
+	}
+	if _, err := ValidateWSTicket(access); err == nil {
+		t.Error("an access token must not be accepted as a WS ticket")
+	}
+}
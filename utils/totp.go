@@ -1,9 +1,22 @@
 package utils
 
 import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 )
 
+// totpOpts : paramètres des applis d'authentification (30 s, 6 chiffres,
+// une période de tolérance de part et d'autre).
+var totpOpts = totp.ValidateOpts{
+	Period:    30,
+	Skew:      1,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
 func GenerateTOTPSecret(email string) (string, string, error) {
 	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      "Budget Famille",
@@ -19,4 +32,21 @@ func GenerateTOTPSecret(email string) (string, string, error) {
 func VerifyTOTP(secret, code string) (bool, error) {
 	valid := totp.Validate(code, secret)
 	return valid, nil
-}
\ No newline at end of file
+}
+
+// MatchTOTP renvoie la période (compteur) du code s'il est valide à now. Le
+// compteur permet de refuser un code déjà utilisé (rejeu dans sa fenêtre).
+func MatchTOTP(secret, code string, now time.Time) (int64, bool) {
+	period := int64(totpOpts.Period)
+	current := now.Unix() / period
+	for _, counter := range []int64{current, current - 1, current + 1} {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(counter*period, 0), totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
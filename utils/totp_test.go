@@ -0,0 +1,47 @@
+// utils/totp_test.go
+// ============================================================================
+// TESTS — codes TOTP et période (anti-rejeu)
+// ============================================================================
+// Lancer : go test ./utils -run TOTP -v
+// ============================================================================
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestMatchTOTP(t *testing.T) {
+	secret, _, err := GenerateTOTPSecret("jane@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_800_000_015, 0)
+	current := now.Unix() / 30
+
+	for offset, want := range map[time.Duration]int64{
+		0:                 current,
+		-30 * time.Second: current - 1,
+		30 * time.Second:  current + 1,
+	} {
+		code, err := totp.GenerateCode(secret, now.Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		counter, ok := MatchTOTP(secret, code, now)
+		if !ok || counter != want {
+			t.Errorf("offset %v: counter = %d, %v; want %d", offset, counter, ok, want)
+		}
+	}
+
+	old, _ := totp.GenerateCode(secret, now.Add(-2*time.Minute))
+	if _, ok := MatchTOTP(secret, old, now); ok {
+		t.Error("code from two minutes ago accepted")
+	}
+	if _, ok := MatchTOTP(secret, "", now); ok {
+		t.Error("empty code accepted")
+	}
+}